@@ -19,17 +19,29 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/providers"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
 )
 
+const (
+	// the additional BSL is validated this often while its credentials are rotated, so the phase
+	// follows the credentials within a few validations
+	additionalBSLValidationFrequency = 10 * time.Second
+	additionalBSLPhaseTimeout        = 12 * additionalBSLValidationFrequency
+)
+
 func BackupRestoreWithSnapshots() {
 	BackupRestoreTest(true)
 }
@@ -42,9 +54,11 @@ func BackupRestoreTest(useVolumeSnapshots bool) {
 
 	var (
 		backupName, restoreName, kibishiiNamespace string
-		err                                        error
-		provideSnapshotVolumesParmInBackup         bool
-		veleroCfg                                  VeleroConfig
+		// backupNames are the backups of the test whose snapshots are cleaned up after the test
+		backupNames                        []string
+		err                                error
+		provideSnapshotVolumesParmInBackup bool
+		veleroCfg                          VeleroConfig
 	)
 	provideSnapshotVolumesParmInBackup = false
 
@@ -59,6 +73,7 @@ func BackupRestoreTest(useVolumeSnapshots bool) {
 		flag.Parse()
 		UUIDgen, err = uuid.NewRandom()
 		kibishiiNamespace = "kibishii-workload" + UUIDgen.String()
+		backupNames = nil
 		Expect(err).To(Succeed())
 	})
 
@@ -67,6 +82,16 @@ func BackupRestoreTest(useVolumeSnapshots bool) {
 			By("Clean backups after test", func() {
 				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
 			})
+			if useVolumeSnapshots {
+				By("Clean snapshots leaked by the backups after test", func() {
+					for _, name := range backupNames {
+						if err := CleanupSnapshotsByTags(veleroCfg.CloudProvider, veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket,
+							veleroCfg.BSLConfig, veleroCfg.VSLConfig, map[string]string{BackupSnapshotTag: name, RunLabel: UUIDgen.String()}); err != nil {
+							fmt.Printf("Failed to clean snapshots of backup %s: %v\n", name, err)
+						}
+					}
+				})
+			}
 			if veleroCfg.InstallVelero {
 				err = VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)
 				Expect(err).To(Succeed())
@@ -95,6 +120,7 @@ func BackupRestoreTest(useVolumeSnapshots bool) {
 			}
 			backupName = "backup-" + UUIDgen.String()
 			restoreName = "restore-" + UUIDgen.String()
+			backupNames = append(backupNames, backupName)
 			// Even though we are using Velero's CloudProvider plugin for object storage, the kubernetes cluster is running on
 			// KinD. So use the kind installation for Kibishii.
 
@@ -102,10 +128,25 @@ func BackupRestoreTest(useVolumeSnapshots bool) {
 			veleroCfg.ProvideSnapshotsVolumeParam = provideSnapshotVolumesParmInBackup
 
 			// Set DefaultVolumesToFsBackup to false since DefaultVolumesToFsBackup was set to true during installation
-			Expect(RunKibishiiTests(veleroCfg, backupName, restoreName, "", kibishiiNamespace, useVolumeSnapshots, false)).To(Succeed(),
+			Expect(RunKibishiiTests(veleroCfg, backupName, restoreName, "", kibishiiNamespace, "", useVolumeSnapshots, false)).To(Succeed(),
 				"Failed to successfully backup and restore Kibishii namespace")
 		})
 
+		It("should be successfully backed up and restored into a different namespace", func() {
+			if veleroCfg.InstallVelero {
+				veleroCfg.UseNodeAgent = true
+				veleroCfg.DefaultVolumesToFsBackup = false
+				Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+			}
+			backupName = "backup-ns-mapping-" + UUIDgen.String()
+			restoreName = "restore-ns-mapping-" + UUIDgen.String()
+			backupNames = append(backupNames, backupName)
+			veleroCfg.ProvideSnapshotsVolumeParam = provideSnapshotVolumesParmInBackup
+			Expect(RunKibishiiTests(veleroCfg, backupName, restoreName, "", kibishiiNamespace, kibishiiNamespace+"-mapped",
+				useVolumeSnapshots, !useVolumeSnapshots)).To(Succeed(),
+				"Failed to successfully backup and restore Kibishii namespace into a different namespace")
+		})
+
 		It("should successfully back up and restore to an additional BackupStorageLocation with unique credentials", func() {
 			if veleroCfg.AdditionalBSLProvider == "" {
 				Skip("no additional BSL provider given, not running multiple BackupStorageLocation with unique credentials tests")
@@ -130,32 +171,9 @@ func BackupRestoreTest(useVolumeSnapshots bool) {
 				Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
 			}
 
-			Expect(VeleroAddPluginsForProvider(context.TODO(), veleroCfg.VeleroCLI,
-				veleroCfg.VeleroNamespace, veleroCfg.AdditionalBSLProvider,
-				veleroCfg.AddBSLPlugins, veleroCfg.Features)).To(Succeed())
-
-			// Create Secret for additional BSL
-			secretName := fmt.Sprintf("bsl-credentials-%s", UUIDgen)
-			secretKey := fmt.Sprintf("creds-%s", veleroCfg.AdditionalBSLProvider)
-			files := map[string]string{
-				secretKey: veleroCfg.AdditionalBSLCredentials,
-			}
-
-			Expect(CreateSecretFromFiles(context.TODO(), *veleroCfg.ClientToInstallVelero, veleroCfg.VeleroNamespace, secretName, files)).To(Succeed())
-
-			// Create additional BSL using credential
-			additionalBsl := fmt.Sprintf("bsl-%s", UUIDgen)
-			Expect(VeleroCreateBackupLocation(context.TODO(),
-				veleroCfg.VeleroCLI,
-				veleroCfg.VeleroNamespace,
-				additionalBsl,
-				veleroCfg.AdditionalBSLProvider,
-				veleroCfg.AdditionalBSLBucket,
-				veleroCfg.AdditionalBSLPrefix,
-				veleroCfg.AdditionalBSLConfig,
-				secretName,
-				secretKey,
-			)).To(Succeed())
+			additionalBsl, cleanupBSL, err := SetupAdditionalBSL(context.TODO(), veleroCfg, UUIDgen.String())
+			Expect(err).To(Succeed())
+			defer cleanupBSL()
 
 			bsls := []string{"default", additionalBsl}
 
@@ -168,10 +186,76 @@ func BackupRestoreTest(useVolumeSnapshots bool) {
 					backupName = fmt.Sprintf("%s-%s", backupName, UUIDgen)
 					restoreName = fmt.Sprintf("%s-%s", restoreName, UUIDgen)
 				}
+				backupNames = append(backupNames, backupName)
 				veleroCfg.ProvideSnapshotsVolumeParam = !provideSnapshotVolumesParmInBackup
-				Expect(RunKibishiiTests(veleroCfg, backupName, restoreName, bsl, kibishiiNamespace, useVolumeSnapshots, !useVolumeSnapshots)).To(Succeed(),
+				Expect(RunKibishiiTests(veleroCfg, backupName, restoreName, bsl, kibishiiNamespace, "", useVolumeSnapshots, !useVolumeSnapshots)).To(Succeed(),
 					"Failed to successfully backup and restore Kibishii namespace using BSL %s", bsl)
 			}
+
+			rotateAdditionalBSLCredentials(veleroCfg, additionalBsl)
 		})
 	})
 }
+
+// rotateAdditionalBSLCredentials breaks the credentials of the additional BSL by updating its secret, checks
+// the BSL becomes unavailable, then repairs the credentials and checks the backups to the BSL work again
+// without restarting the velero server, i.e. the updated secret is reloaded by the server
+func rotateAdditionalBSLCredentials(veleroCfg VeleroConfig, bslName string) {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer ctxCancel()
+	client := *veleroCfg.ClientToInstallVelero
+	secretName, secretKey := AdditionalBSLSecret(veleroCfg, UUIDgen.String())
+	namespace := "bsl-rotation-" + UUIDgen.String()
+	backupName := "backup-rotation-" + UUIDgen.String()
+
+	restartCounts, err := GetVeleroRestartCounts(ctx, client, veleroCfg.VeleroNamespace)
+	Expect(err).To(Succeed())
+
+	By(fmt.Sprintf("Validate backup storage location %s every %s", bslName, additionalBSLValidationFrequency), func() {
+		Expect(PatchBackupStorageLocation(ctx, veleroCfg.VeleroNamespace, bslName,
+			fmt.Sprintf(`{"spec":{"validationFrequency":"%s"}}`, additionalBSLValidationFrequency))).To(Succeed())
+	})
+
+	By(fmt.Sprintf("Backup storage location %s should be unavailable with invalid credentials in secret %s", bslName, secretName), func() {
+		invalidCredentials := filepath.Join(GinkgoT().TempDir(), "invalid-credentials")
+		Expect(os.WriteFile(invalidCredentials, []byte("invalid-credentials"), 0600)).To(Succeed())
+		Expect(UpdateSecretFromFiles(ctx, client, veleroCfg.VeleroNamespace, secretName,
+			map[string]string{secretKey: invalidCredentials})).To(Succeed())
+		Expect(WaitForBSLPhase(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, bslName,
+			velerov1api.BackupStorageLocationPhaseUnavailable, additionalBSLPhaseTimeout)).To(Succeed())
+	})
+
+	By(fmt.Sprintf("Backup storage location %s should be available again with valid credentials in secret %s", bslName, secretName), func() {
+		Expect(UpdateSecretFromFiles(ctx, client, veleroCfg.VeleroNamespace, secretName,
+			map[string]string{secretKey: veleroCfg.AdditionalBSLCredentials})).To(Succeed())
+		Expect(WaitForBSLPhase(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, bslName,
+			velerov1api.BackupStorageLocationPhaseAvailable, additionalBSLPhaseTimeout)).To(Succeed())
+	})
+
+	By(fmt.Sprintf("Backup to %s should work with the rotated credentials", bslName), func() {
+		Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+		defer func() {
+			if !veleroCfg.Debug {
+				if err := DeleteNamespace(context.Background(), client, namespace, false); err != nil {
+					fmt.Printf("Failed to delete namespace %s: %v\n", namespace, err)
+				}
+			}
+		}()
+		_, err := CreateConfigMap(client.ClientGo, namespace, "bsl-rotation", nil, map[string]string{"data": namespace})
+		Expect(err).To(Succeed())
+		Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, BackupConfig{
+			BackupName:     backupName,
+			Namespace:      namespace,
+			BackupLocation: bslName,
+		})).To(Succeed(), func() string {
+			RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+			return "Fail to backup workload with the rotated credentials"
+		})
+	})
+
+	By("Velero server should not be restarted to reload the credentials", func() {
+		counts, err := GetVeleroRestartCounts(ctx, client, veleroCfg.VeleroNamespace)
+		Expect(err).To(Succeed())
+		Expect(counts).To(Equal(restartCounts))
+	})
+}
@@ -0,0 +1,128 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backup
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// BackupRestoreWithExpectedNodes runs kibishii with one node per worker node of the cluster, and
+// checks the data generated across all the kibishii nodes is verified after restore
+func BackupRestoreWithExpectedNodes() {
+	var (
+		kibishiiNamespace string
+		veleroCfg         VeleroConfig
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		kibishiiNamespace = "kibishii-nodes-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", kibishiiNamespace), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, kibishiiNamespace, true)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Data generated across all the expected kibishii nodes should be verified after restore", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		backupName := "backup-kibishii-nodes-" + UUIDgen.String()
+		restoreName := "restore-kibishii-nodes-" + UUIDgen.String()
+
+		workerNodes, err := GetWorkerNodes(ctx)
+		Expect(err).To(Succeed())
+		if len(workerNodes) < 2 {
+			Skip(fmt.Sprintf("Only %d worker nodes in the cluster, skip kibishii multiple nodes test", len(workerNodes)))
+		}
+		kibishiiData := *DefaultKibishiiData
+		kibishiiData.ExpectedNodes = len(workerNodes)
+
+		checkDistribution := func() {
+			distribution, err := GetKibishiiPodNodeDistribution(ctx, client, kibishiiNamespace)
+			Expect(err).To(Succeed())
+			fmt.Printf("Kibishii pods are distributed on nodes: %v\n", distribution)
+			Expect(distribution).To(HaveLen(kibishiiData.ExpectedNodes), fmt.Sprintf("Kibishii pods should be spread across %d nodes", kibishiiData.ExpectedNodes))
+			for _, node := range workerNodes {
+				Expect(distribution[node]).NotTo(BeEmpty(), fmt.Sprintf("Worker node %s should be served by at least one kibishii pod", node))
+			}
+		}
+
+		By(fmt.Sprintf("Deploy kibishii with data across %d nodes in namespace %s", kibishiiData.ExpectedNodes, kibishiiNamespace), func() {
+			Expect(CreateNamespace(ctx, client, kibishiiNamespace)).To(Succeed())
+			Expect(KibishiiPrepareBeforeBackup(ctx, client, veleroCfg.CloudProvider, kibishiiNamespace,
+				veleroCfg.RegistryCredentialFile, veleroCfg.Features, veleroCfg.KibishiiDirectory,
+				veleroCfg.KibishiiStorageClass, false, &kibishiiData)).To(Succeed())
+			checkDistribution()
+		})
+
+		By(fmt.Sprintf("Back up workload with name %s", backupName), func() {
+			backupCfg := BackupConfig{
+				BackupName:               backupName,
+				Namespace:                kibishiiNamespace,
+				DefaultVolumesToFsBackup: true,
+			}
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By(fmt.Sprintf("Delete namespace %s and restore it", kibishiiNamespace), func() {
+			Expect(DeleteNamespace(ctx, client, kibishiiNamespace, true)).To(Succeed())
+			Expect(VeleroRestore(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, backupName, "")).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+				return "Fail to restore workload"
+			})
+		})
+
+		By("Data of all the expected kibishii nodes should be verified after restore", func() {
+			Expect(KibishiiVerifyAfterRestore(client, kibishiiNamespace, ctx, &kibishiiData)).To(Succeed())
+			checkDistribution()
+		})
+	})
+}
@@ -0,0 +1,67 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backup
+
+import (
+	"context"
+	"flag"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// BackupRestoreWithPartiallyFailedBackup checks kibishii could be restored from the backup which
+// is PartiallyFailed because of other resources in the namespace
+func BackupRestoreWithPartiallyFailedBackup() {
+	var veleroCfg VeleroConfig
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Data of kibishii should be restored from the partially failed backup", func() {
+		backupName := "backup-partially-failed-" + UUIDgen.String()
+		restoreName := "restore-partially-failed-" + UUIDgen.String()
+		kibishiiNamespace := "kibishii-partially-failed-" + UUIDgen.String()
+		Expect(RunKibishiiTestsWithPartiallyFailedBackup(veleroCfg, backupName, restoreName, kibishiiNamespace)).To(Succeed(),
+			"Failed to restore kibishii from the partially failed backup")
+	})
+}
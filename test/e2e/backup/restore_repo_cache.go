@@ -0,0 +1,129 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backup
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// coldRestoreBudget is the longest duration acceptable for restoring kibishii from a cold repository
+const coldRestoreBudget = 30 * time.Minute
+
+// RestoreWithColdAndWarmRepository restores the same fs-backup twice, the first restore is done
+// after the node-agent is restarted to drop the repository cache, and the second one reuses the cache
+func RestoreWithColdAndWarmRepository() {
+	var (
+		backupName, kibishiiNamespace string
+		veleroCfg                     VeleroConfig
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		kibishiiNamespace = "kibishii-repo-cache-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", kibishiiNamespace), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, kibishiiNamespace, false)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("should restore faster from a warm repository than from a cold one", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), time.Minute*120)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		backupName = "backup-repo-cache-" + UUIDgen.String()
+
+		By(fmt.Sprintf("Deploy sample workload of Kibishii in namespace %s", kibishiiNamespace), func() {
+			Expect(CreateNamespace(ctx, client, kibishiiNamespace)).To(Succeed())
+			Expect(KibishiiPrepareBeforeBackup(ctx, client, veleroCfg.CloudProvider, kibishiiNamespace,
+				veleroCfg.RegistryCredentialFile, veleroCfg.Features, veleroCfg.KibishiiDirectory,
+				veleroCfg.KibishiiStorageClass, false, DefaultKibishiiData)).To(Succeed())
+		})
+
+		var backupDuration time.Duration
+		By(fmt.Sprintf("Back up workload with name %s", backupName), func() {
+			backupCfg := BackupConfig{
+				BackupName:               backupName,
+				Namespace:                kibishiiNamespace,
+				DefaultVolumesToFsBackup: true,
+			}
+			start := time.Now()
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+			backupDuration = time.Since(start)
+		})
+
+		restore := func(restoreName string) KibishiiTestResult {
+			Expect(DeleteNamespace(ctx, client, kibishiiNamespace, true)).To(Succeed())
+			start := time.Now()
+			Expect(VeleroRestore(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, backupName, "")).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+				return "Fail to restore workload"
+			})
+			result := KibishiiTestResult{BackupDuration: backupDuration, RestoreDuration: time.Since(start)}
+			Expect(KibishiiVerifyAfterRestore(client, kibishiiNamespace, ctx, DefaultKibishiiData)).To(Succeed())
+			return result
+		}
+
+		var cold, warm KibishiiTestResult
+		By("Restore from a cold repository", func() {
+			Expect(RestartNodeAgent(ctx, veleroCfg.VeleroNamespace)).To(Succeed())
+			cold = restore("restore-cold-" + UUIDgen.String())
+		})
+		By("Restore from a warm repository", func() {
+			warm = restore("restore-warm-" + UUIDgen.String())
+		})
+
+		fmt.Printf("Backup duration: %s, cold restore duration: %s, warm restore duration: %s\n",
+			backupDuration, cold.RestoreDuration, warm.RestoreDuration)
+		Expect(cold.RestoreDuration < coldRestoreBudget).To(BeTrue(),
+			fmt.Sprintf("Cold restore took %s, exceeds the budget %s", cold.RestoreDuration, coldRestoreBudget))
+		Expect(warm.RestoreDuration < cold.RestoreDuration).To(BeTrue(),
+			fmt.Sprintf("Warm restore took %s, is not faster than cold restore %s", warm.RestoreDuration, cold.RestoreDuration))
+	})
+}
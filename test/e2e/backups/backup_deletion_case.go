@@ -0,0 +1,216 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backups
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/uploader"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/providers"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const defaultBSL = "default"
+
+// BackupDeletionCase backs up kibishii by fs-backup or volume snapshots, checks the deletion is rejected
+// while the backup storage location is read-only, then deletes the backup by "velero backup delete" and
+// checks all the artifacts of the backup are cleaned up: the backup CR, the files in object storage, the
+// pod volume backups and their snapshots in the backup repository, and the native snapshots in cloud
+type BackupDeletionCase struct {
+	TestCase
+	snapshotCheckPoint SnapshotCheckPoint
+	// uploaderType and podVolumeSnapshots are the uploader and the snapshot IDs of the pod volume backups
+	uploaderType       string
+	podVolumeSnapshots []string
+}
+
+var BackupDeletionFsBackupCaseTest func() = TestFunc(&BackupDeletionCase{TestCase: TestCase{UseVolumeSnapshots: false}})
+var BackupDeletionSnapshotCaseTest func() = TestFunc(&BackupDeletionCase{TestCase: TestCase{UseVolumeSnapshots: true}})
+
+func (b *BackupDeletionCase) Init() error {
+	b.VeleroCfg = VeleroCfg
+	b.Client = *b.VeleroCfg.ClientToInstallVelero
+	b.VeleroCfg.UseVolumeSnapshots = b.UseVolumeSnapshots
+	b.VeleroCfg.UseNodeAgent = !b.UseVolumeSnapshots
+	dataPath := "fs-backup"
+	if b.UseVolumeSnapshots {
+		dataPath = "snapshot"
+	}
+	b.NSBaseName = "backup-deletion-" + dataPath
+	b.NSIncluded = &[]string{b.NSBaseName}
+	b.TestMsg = &TestMSG{
+		Desc:      fmt.Sprintf("Delete backup of kibishii with %s", dataPath),
+		FailedMSG: fmt.Sprintf("Failed to clean up the artifacts of deleted backup with %s", dataPath),
+		Text:      fmt.Sprintf("Should clean up all the artifacts of the deleted backup with %s, and reject the deletion in read-only backup storage location", dataPath),
+	}
+	return nil
+}
+
+func (b *BackupDeletionCase) StartRun() error {
+	if b.UseVolumeSnapshots && b.VeleroCfg.CloudProvider == "kind" {
+		Skip("Volume snapshots not supported on kind")
+	}
+	b.BackupName = "backup-" + b.NSBaseName + "-" + UUIDgen.String()
+	b.BackupArgs = []string{
+		"create", "--namespace", b.VeleroCfg.VeleroNamespace, "backup", b.BackupName,
+		"--include-namespaces", b.NSBaseName,
+	}
+	if b.UseVolumeSnapshots {
+		b.BackupArgs = append(b.BackupArgs, "--snapshot-volumes")
+	} else {
+		b.BackupArgs = append(b.BackupArgs, "--default-volumes-to-fs-backup", "--snapshot-volumes=false")
+	}
+	return nil
+}
+
+func (b *BackupDeletionCase) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Deploy sample workload of Kibishii in namespace %s", b.NSBaseName), func() {
+		Expect(CreateNamespace(ctx, b.Client, b.NSBaseName)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", b.NSBaseName))
+		Expect(KibishiiPrepareBeforeBackup(ctx, b.Client, b.VeleroCfg.CloudProvider, b.NSBaseName,
+			b.VeleroCfg.RegistryCredentialFile, b.VeleroCfg.Features, b.VeleroCfg.KibishiiDirectory,
+			b.VeleroCfg.KibishiiStorageClass, b.UseVolumeSnapshots, DefaultKibishiiData)).To(Succeed())
+	})
+	return nil
+}
+
+func (b *BackupDeletionCase) Backup() error {
+	if err := b.TestCase.Backup(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+	defer ctxCancel()
+	if b.VeleroCfg.CloudProvider == "vsphere" && b.UseVolumeSnapshots {
+		// Wait for uploads started by the Velero Plug-in for vSphere to complete
+		fmt.Println("Waiting for vSphere uploads to complete")
+		pvcCount, err := GetBoundPVCCount(ctx, b.Client, b.NSBaseName)
+		Expect(err).To(Succeed())
+		Expect(WaitForVSphereUploadCompletion(ctx, time.Hour, b.NSBaseName, pvcCount)).To(Succeed())
+	}
+	By(fmt.Sprintf("Files of backup %s should be created in object storage", b.BackupName), func() {
+		Expect(ObjectsShouldBeInBucket(GetObjectStoreProvider(b.VeleroCfg), b.VeleroCfg.CloudCredentialsFile, b.VeleroCfg.BSLBucket,
+			b.VeleroCfg.BSLPrefix, b.VeleroCfg.BSLConfig, b.BackupName, BackupObjectsPrefix)).To(Succeed())
+	})
+	if b.UseVolumeSnapshots {
+		By("Snapshots should be created in cloud", func() {
+			var err error
+			b.snapshotCheckPoint, err = GetSnapshotCheckPointOfPVCs(b.Client, b.VeleroCfg, b.NSBaseName, b.BackupName, nil)
+			Expect(err).To(Succeed(), "Fail to get snapshot checkpoint")
+			Expect(SnapshotsShouldBeCreatedInCloud(b.VeleroCfg.CloudProvider, b.VeleroCfg.CloudCredentialsFile,
+				b.VeleroCfg.BSLBucket, b.VeleroCfg.BSLConfig, b.VeleroCfg.VSLConfig, b.BackupName, b.snapshotCheckPoint)).To(Succeed())
+		})
+	} else {
+		By(fmt.Sprintf("Pod volume backups of backup %s should be created", b.BackupName), func() {
+			Expect(PodVolumeBackupsShouldBeCompleted(ctx, b.Client, b.VeleroCfg.VeleroNamespace, b.BackupName, len(KibishiiPodNameList))).To(Succeed())
+			pvbs, err := ListPodVolumeBackups(ctx, b.Client, b.VeleroCfg.VeleroNamespace, b.BackupName)
+			Expect(err).To(Succeed())
+			for _, pvb := range pvbs {
+				b.podVolumeSnapshots = append(b.podVolumeSnapshots, pvb.Status.SnapshotID)
+			}
+			b.uploaderType, err = GetPodVolumeBackupUploaderType(ctx, b.Client, b.VeleroCfg.VeleroNamespace, b.BackupName)
+			Expect(err).To(Succeed())
+		})
+		if b.uploaderType == uploader.ResticType {
+			By(fmt.Sprintf("Snapshots of backup %s should be created in restic repository", b.BackupName), func() {
+				Expect(ResticSnapshotsShouldExistInCloud(GetObjectStoreProvider(b.VeleroCfg), b.VeleroCfg.CloudCredentialsFile, b.VeleroCfg.BSLBucket,
+					b.VeleroCfg.BSLPrefix, b.VeleroCfg.BSLConfig, b.NSBaseName, b.podVolumeSnapshots)).To(Succeed())
+			})
+		}
+	}
+	return nil
+}
+
+// Destroy deletes the backup instead of the workload, the deletion is requested in read-only backup storage
+// location first and should be rejected with the backup kept
+func (b *BackupDeletionCase) Destroy() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Deletion of backup %s should be rejected in read-only backup storage location", b.BackupName), func() {
+		Expect(SetBackupStorageLocationAccessMode(ctx, b.VeleroCfg.VeleroNamespace, defaultBSL,
+			velerov1api.BackupStorageLocationAccessModeReadOnly)).To(Succeed())
+		defer func() {
+			Expect(SetBackupStorageLocationAccessMode(ctx, b.VeleroCfg.VeleroNamespace, defaultBSL,
+				velerov1api.BackupStorageLocationAccessModeReadWrite)).To(Succeed())
+		}()
+		Expect(VeleroCmdExec(ctx, b.VeleroCfg.VeleroCLI, []string{"--namespace", b.VeleroCfg.VeleroNamespace,
+			"backup", "delete", b.BackupName, "--confirm"})).To(Succeed())
+		errs, err := WaitForDeleteBackupRequestProcessed(ctx, b.Client, b.VeleroCfg.VeleroNamespace, b.BackupName, 5*time.Minute)
+		Expect(err).To(Succeed())
+		Expect(errs).To(ContainElement(ContainSubstring("read-only mode")))
+		exist, err := IsBackupExist(ctx, b.VeleroCfg.VeleroCLI, b.BackupName)
+		Expect(err).To(Succeed())
+		Expect(exist).To(BeTrue(), fmt.Sprintf("Backup %s is deleted in read-only backup storage location", b.BackupName))
+		Expect(ObjectsShouldBeInBucket(GetObjectStoreProvider(b.VeleroCfg), b.VeleroCfg.CloudCredentialsFile, b.VeleroCfg.BSLBucket,
+			b.VeleroCfg.BSLPrefix, b.VeleroCfg.BSLConfig, b.BackupName, BackupObjectsPrefix)).To(Succeed())
+	})
+	By(fmt.Sprintf("Delete backup %s", b.BackupName), func() {
+		Expect(DeleteBackupResource(ctx, b.VeleroCfg.VeleroCLI, b.BackupName)).To(Succeed())
+	})
+	return nil
+}
+
+// Restore is skipped as the backup is deleted
+func (b *BackupDeletionCase) Restore() error {
+	return nil
+}
+
+func (b *BackupDeletionCase) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer ctxCancel()
+	// the backup CR is only removed when all the other artifacts are deleted without error
+	By(fmt.Sprintf("Backup %s should be deleted", b.BackupName), func() {
+		Expect(WaitBackupDeleted(ctx, b.VeleroCfg.VeleroCLI, b.BackupName, 10*time.Minute)).To(Succeed(),
+			fmt.Sprintf("Backup %s was not deleted", b.BackupName))
+	})
+	By(fmt.Sprintf("Files of backup %s should be deleted from object storage", b.BackupName), func() {
+		Expect(BackupObjectsShouldNotExistInCloud(GetObjectStoreProvider(b.VeleroCfg), b.VeleroCfg.CloudCredentialsFile, b.VeleroCfg.BSLBucket,
+			b.VeleroCfg.BSLPrefix, b.VeleroCfg.BSLConfig, b.BackupName)).To(Succeed())
+	})
+	if b.UseVolumeSnapshots {
+		By("Snapshots should be deleted in cloud", func() {
+			Expect(SnapshotsShouldBeDeletedInCloud(b.VeleroCfg.CloudProvider, b.VeleroCfg.CloudCredentialsFile,
+				b.VeleroCfg.BSLBucket, b.VeleroCfg.BSLConfig, b.BackupName, b.snapshotCheckPoint)).To(Succeed())
+		})
+	} else {
+		// the snapshots in the backup repository are forgotten before the pod volume backups are removed
+		By(fmt.Sprintf("Pod volume backups of backup %s should be deleted", b.BackupName), func() {
+			pvbs, err := ListPodVolumeBackups(ctx, b.Client, b.VeleroCfg.VeleroNamespace, b.BackupName)
+			Expect(err).To(Succeed())
+			Expect(pvbs).To(BeEmpty(), fmt.Sprintf("Pod volume backups of backup %s are not deleted", b.BackupName))
+		})
+		// restic stores each snapshot as a file in the repository, while kopia packs the snapshot manifests
+		// into the blobs shared with the others, so the snapshots of kopia repository are proven deleted by
+		// the backup removed above only, the failures of forgetting them are reported by the deletion request
+		if b.uploaderType == uploader.ResticType {
+			By(fmt.Sprintf("Snapshots %v of backup %s should be deleted from restic repository", b.podVolumeSnapshots, b.BackupName), func() {
+				Expect(ResticSnapshotsShouldNotExistInCloud(GetObjectStoreProvider(b.VeleroCfg), b.VeleroCfg.CloudCredentialsFile, b.VeleroCfg.BSLBucket,
+					b.VeleroCfg.BSLPrefix, b.VeleroCfg.BSLConfig, b.NSBaseName, b.podVolumeSnapshots)).To(Succeed())
+			})
+		}
+	}
+	return nil
+}
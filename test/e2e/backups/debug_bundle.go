@@ -0,0 +1,129 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backups
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	debugBundlePod    = "pod-debug-bundle"
+	debugBundleVolume = "volume-debug-bundle"
+)
+
+// Test the debug bundle generated by "velero debug" for a partially failed backup contains the logs of
+// Velero and the details of the failure
+func DebugBundleTest() {
+	var (
+		namespace string
+		veleroCfg VeleroConfig
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		namespace = "debug-bundle-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", namespace), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, namespace, false)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Debug bundle of the partially failed backup should contain the logs and the failure details", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		backupName := "backup-debug-bundle-" + UUIDgen.String()
+		var bundleDir string
+		var files []string
+
+		By(fmt.Sprintf("Create pod %s with failing pre backup hook in namespace %s", debugBundlePod, namespace), func() {
+			Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+			ann := map[string]string{
+				"pre.hook.backup.velero.io/container": debugBundlePod,
+				"pre.hook.backup.velero.io/command":   `["/bin/sh", "-c", "exit 1"]`,
+				"pre.hook.backup.velero.io/on-error":  string(velerov1api.HookErrorModeFail),
+			}
+			_, err := CreatePod(client, namespace, debugBundlePod, "", "", []string{debugBundleVolume}, nil, ann)
+			Expect(err).To(Succeed())
+			Expect(WaitForPods(ctx, client, namespace, []string{debugBundlePod})).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup %s should be partially failed", backupName), func() {
+			args := []string{
+				"--namespace", veleroCfg.VeleroNamespace, "create", "backup", backupName,
+				"--include-namespaces", namespace, "--default-volumes-to-fs-backup", "--snapshot-volumes=false",
+			}
+			Expect(VeleroCmdExec(ctx, veleroCfg.VeleroCLI, args)).To(Succeed())
+			_, err := WaitForBackupPhase(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName,
+				velerov1api.BackupPhasePartiallyFailed, 10*time.Minute)
+			Expect(err).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Generate and extract the debug bundle of backup %s", backupName), func() {
+			bundle, err := CollectDebugBundle(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+			Expect(err).To(Succeed())
+			bundleDir, files, err = ExtractDebugBundle(bundle)
+			Expect(err).To(Succeed())
+			Expect(DebugBundleShouldContain(files, backupName, "", veleroCfg.UseNodeAgent)).To(Succeed(),
+				fmt.Sprintf("Files in debug bundle %s: %v", bundle, files))
+		})
+
+		By("Debug bundle should contain the details of the failure", func() {
+			describe, err := os.ReadFile(filepath.Join(bundleDir, FindDebugBundleFile(files, fmt.Sprintf("backup_describe_%s.txt", backupName))))
+			Expect(err).To(Succeed())
+			sections := ParseDescribeOutput(string(describe))
+			Expect(sections["Phase"]).To(HavePrefix(string(velerov1api.BackupPhasePartiallyFailed)))
+			Expect(sections["Errors"]).To(ContainSubstring(namespace), "Errors of the failed hook should be reported for the namespace")
+
+			logs, err := os.ReadFile(filepath.Join(bundleDir, FindDebugBundleFile(files, fmt.Sprintf("backup_%s.log", backupName))))
+			Expect(err).To(Succeed())
+			Expect(string(logs)).To(ContainSubstring("Error executing hook"))
+		})
+	})
+}
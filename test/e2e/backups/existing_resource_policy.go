@@ -0,0 +1,234 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backups
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	existingPolicyConfigMap  = "cm-existing-policy"
+	existingPolicyDeployment = "deploy-existing-policy"
+	existingPolicyKey        = "key"
+	// the configmap is created from the YAML data with its name as the key
+	existingPolicySeededConfigMap = "cm-existing-policy-seeded"
+)
+
+// Test the restore of the resources which already exist in cluster and differ from the backed up
+// version, they are kept as they are with the policy none, and patched back with the policy update
+func ExistingResourcePolicyTest() {
+	var (
+		namespace string
+		veleroCfg VeleroConfig
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		namespace = "existing-policy-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", namespace), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, namespace, true)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Existing resources should be kept with policy none and updated with policy update", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		backupName := "backup-existing-policy-" + UUIDgen.String()
+		restoreNone := "restore-existing-policy-none-" + UUIDgen.String()
+		restoreUpdate := "restore-existing-policy-update-" + UUIDgen.String()
+		labels := map[string]string{"app": existingPolicyDeployment}
+		var cmResourceVersion string
+
+		By(fmt.Sprintf("Create configmap %s and deployment %s in namespace %s", existingPolicyConfigMap, existingPolicyDeployment, namespace), func() {
+			Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+			_, err := CreateConfigMap(client.ClientGo, namespace, existingPolicyConfigMap, nil, map[string]string{existingPolicyKey: "backed-up"})
+			Expect(err).To(Succeed())
+			_, err = CreateDeployment(client.ClientGo, namespace, NewDeployment(existingPolicyDeployment, namespace, 1, labels, nil).Result())
+			Expect(err).To(Succeed())
+			Expect(WaitForReadyDeployment(client.ClientGo, namespace, existingPolicyDeployment)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Back up configmaps and deployments in namespace %s", namespace), func() {
+			backupCfg := BackupConfig{
+				BackupName:       backupName,
+				Namespace:        namespace,
+				IncludeResources: "configmaps,deployments",
+			}
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By("Change the configmap value and scale the deployment in cluster", func() {
+			Expect(PatchConfigMapData(client.ClientGo, namespace, existingPolicyConfigMap, map[string]string{existingPolicyKey: "modified"})).To(Succeed())
+			Expect(ScaleDeployment(client.ClientGo, namespace, existingPolicyDeployment, 2)).To(Succeed())
+			Expect(WaitForReadyDeployment(client.ClientGo, namespace, existingPolicyDeployment)).To(Succeed())
+			cm, err := GetConfigmap(client.ClientGo, namespace, existingPolicyConfigMap)
+			Expect(err).To(Succeed())
+			cmResourceVersion = cm.ResourceVersion
+		})
+
+		By(fmt.Sprintf("Restore %s with existing resource policy none", restoreNone), func() {
+			Expect(VeleroRestoreWithExistingResourcePolicy(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreNone, backupName,
+				velerov1api.PolicyTypeNone)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreNone)
+				return "Fail to restore workload"
+			})
+		})
+
+		By("Configmap and deployment should not be changed by the restore with policy none", func() {
+			Expect(ConfigMapDataShouldBe(client.ClientGo, namespace, existingPolicyConfigMap, existingPolicyKey, "modified")).To(Succeed())
+			cm, err := GetConfigmap(client.ClientGo, namespace, existingPolicyConfigMap)
+			Expect(err).To(Succeed())
+			Expect(cm.ResourceVersion).To(Equal(cmResourceVersion), fmt.Sprintf("Configmap %s is modified", existingPolicyConfigMap))
+			Expect(cm.Labels).NotTo(HaveKey(velerov1api.RestoreNameLabel))
+			deploy, err := GetDeployment(client.ClientGo, namespace, existingPolicyDeployment)
+			Expect(err).To(Succeed())
+			// the resource version of deployment is changed by the status updates of controller, so only
+			// the spec and labels are checked
+			Expect(*deploy.Spec.Replicas).To(Equal(int32(2)), fmt.Sprintf("Replicas of deployment %s should not be changed", existingPolicyDeployment))
+			Expect(deploy.Labels).NotTo(HaveKey(velerov1api.RestoreNameLabel))
+		})
+
+		By(fmt.Sprintf("Restore %s with existing resource policy update", restoreUpdate), func() {
+			Expect(VeleroRestoreWithExistingResourcePolicy(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreUpdate, backupName,
+				velerov1api.PolicyTypeUpdate)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreUpdate)
+				return "Fail to restore workload"
+			})
+		})
+
+		By("Configmap and deployment should be patched back by the restore with policy update", func() {
+			Expect(ConfigMapDataShouldBe(client.ClientGo, namespace, existingPolicyConfigMap, existingPolicyKey, "backed-up")).To(Succeed())
+			cm, err := GetConfigmap(client.ClientGo, namespace, existingPolicyConfigMap)
+			Expect(err).To(Succeed())
+			Expect(RestoreLabelsShouldBe(cm, backupName, restoreUpdate)).To(Succeed())
+			deploy, err := GetDeployment(client.ClientGo, namespace, existingPolicyDeployment)
+			Expect(err).To(Succeed())
+			Expect(*deploy.Spec.Replicas).To(Equal(int32(1)), fmt.Sprintf("Replicas of deployment %s should be patched back", existingPolicyDeployment))
+			Expect(RestoreLabelsShouldBe(deploy, backupName, restoreUpdate)).To(Succeed())
+			Expect(WaitForReadyDeployment(client.ClientGo, namespace, existingPolicyDeployment)).To(Succeed())
+		})
+	})
+
+	It("Conflicting configmap seeded before restore should be kept with policy none and overwritten with policy update", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		backupName := "backup-existing-policy-seeded-" + UUIDgen.String()
+		restoreNone := "restore-existing-policy-seeded-none-" + UUIDgen.String()
+		restoreUpdate := "restore-existing-policy-seeded-update-" + UUIDgen.String()
+
+		By(fmt.Sprintf("Create configmap %s in namespace %s", existingPolicySeededConfigMap, namespace), func() {
+			Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+			Expect(CreateConfigMapFromYAMLData(client.ClientGo, "backed-up", existingPolicySeededConfigMap, namespace)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Back up configmaps in namespace %s", namespace), func() {
+			backupCfg := BackupConfig{
+				BackupName:       backupName,
+				Namespace:        namespace,
+				IncludeResources: "configmaps",
+			}
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By(fmt.Sprintf("Seed the conflicting configmap %s in namespace %s", existingPolicySeededConfigMap, namespace), func() {
+			Expect(DeleteConfigmap(client.ClientGo, namespace, existingPolicySeededConfigMap)).To(Succeed())
+			Expect(CreateConfigMapFromYAMLData(client.ClientGo, "conflicting", existingPolicySeededConfigMap, namespace)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Restore %s with existing resource policy none", restoreNone), func() {
+			restoreCfg := RestoreConfig{
+				RestoreName:            restoreNone,
+				BackupName:             backupName,
+				IncludedResources:      "configmaps",
+				ExistingResourcePolicy: string(velerov1api.PolicyTypeNone),
+			}
+			Expect(VeleroRestoreWithConfig(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreNone)
+				return "Fail to restore workload"
+			})
+		})
+
+		By("Conflicting configmap should be left untouched by the restore with policy none", func() {
+			Expect(ConfigMapDataShouldBe(client.ClientGo, namespace, existingPolicySeededConfigMap,
+				existingPolicySeededConfigMap, "conflicting")).To(Succeed())
+			// the conflict is reported as a warning rather than an error
+			warnings, errs, err := GetRestoreResult(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreNone)
+			Expect(err).To(Succeed())
+			Expect(warnings).To(BeNumerically(">=", 1))
+			Expect(errs).To(BeZero())
+		})
+
+		By(fmt.Sprintf("Restore %s with existing resource policy update", restoreUpdate), func() {
+			restoreCfg := RestoreConfig{
+				RestoreName:            restoreUpdate,
+				BackupName:             backupName,
+				IncludedResources:      "configmaps",
+				ExistingResourcePolicy: string(velerov1api.PolicyTypeUpdate),
+			}
+			Expect(VeleroRestoreWithConfig(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreUpdate)
+				return "Fail to restore workload"
+			})
+		})
+
+		By("Conflicting configmap should be overwritten by the restore with policy update", func() {
+			Expect(ConfigMapDataShouldBe(client.ClientGo, namespace, existingPolicySeededConfigMap,
+				existingPolicySeededConfigMap, "backed-up")).To(Succeed())
+			cm, err := GetConfigmap(client.ClientGo, namespace, existingPolicySeededConfigMap)
+			Expect(err).To(Succeed())
+			Expect(RestoreLabelsShouldBe(cm, backupName, restoreUpdate)).To(Succeed())
+		})
+	})
+}
@@ -0,0 +1,254 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backups
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	hookContainer  = "kibishii"
+	hookVolume     = "data"
+	hookMarkerFile = "hook-marker"
+	hookLogFile    = "hook-log"
+
+	hookDeployment       = "backup-hooks"
+	hookDeploymentVolume = "volume-backup-hooks"
+	preHookSentinel      = "pre-backup-hook-sentinel"
+	postHookSentinel     = "post-backup-hook-sentinel"
+)
+
+// Test the pre and post exec backup hooks defined by the annotations of kibishii pods
+func BackupHooksTest() {
+	var (
+		kibishiiNamespace string
+		veleroCfg         VeleroConfig
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		kibishiiNamespace = "backup-hooks-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", kibishiiNamespace), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, kibishiiNamespace, true)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Pre and post backup hooks should be executed on kibishii pods", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		backupName := "backup-hooks-" + UUIDgen.String()
+		prepareKibishiiForHooks(ctx, veleroCfg, kibishiiNamespace)
+
+		// the pre hook creates the marker and the post hook removes it, both of them are logged,
+		// so the post hook could only log if the marker created by the pre hook exists
+		By("Annotate kibishii pods with pre and post backup hooks", func() {
+			ann := map[string]string{
+				"pre.hook.backup.velero.io/container": hookContainer,
+				"pre.hook.backup.velero.io/command": fmt.Sprintf(`["/bin/sh", "-c", "touch /%s/%s && echo pre >> /%s/%s"]`,
+					hookVolume, hookMarkerFile, hookVolume, hookLogFile),
+				"post.hook.backup.velero.io/container": hookContainer,
+				"post.hook.backup.velero.io/command": fmt.Sprintf(`["/bin/sh", "-c", "rm /%s/%s && echo post >> /%s/%s"]`,
+					hookVolume, hookMarkerFile, hookVolume, hookLogFile),
+			}
+			Expect(AddAnnotationToPods(ctx, *veleroCfg.ClientToInstallVelero, kibishiiNamespace, KibishiiPodNameList, ann)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Back up workload with name %s", backupName), func() {
+			backupCfg := BackupConfig{
+				BackupName:               backupName,
+				Namespace:                kibishiiNamespace,
+				DefaultVolumesToFsBackup: true,
+			}
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By("Marker should be created by the pre hook and removed by the post hook", func() {
+			for _, pod := range KibishiiPodNameList {
+				log, err := ReadFileFromPodVolume(ctx, kibishiiNamespace, pod, hookContainer, hookVolume, hookLogFile)
+				Expect(err).To(Succeed(), fmt.Sprintf("Failed to read hook log from pod %s", pod))
+				Expect(strings.Fields(log)).To(Equal([]string{"pre", "post"}), fmt.Sprintf("Unexpected hook log %q of pod %s", log, pod))
+				_, err = ReadFileFromPodVolume(ctx, kibishiiNamespace, pod, hookContainer, hookVolume, hookMarkerFile)
+				Expect(err).To(HaveOccurred(), fmt.Sprintf("Marker should be removed from pod %s by the post hook", pod))
+			}
+		})
+
+		// the hook executions are not counted in the backup status of this version, so check
+		// the backup has no error which it would have if any hook failed
+		By(fmt.Sprintf("Backup %s should have no errors in describe output", backupName), func() {
+			output, err := VeleroBackupDescribe(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, true)
+			Expect(err).To(Succeed())
+			sections := ParseDescribeOutput(output)
+			Expect(sections["Phase"]).To(HavePrefix(string(velerov1api.BackupPhaseCompleted)))
+			Expect(sections).NotTo(HaveKey("Errors"))
+		})
+	})
+
+	It("Sentinel written by the pre backup hook should be restored while the one of the post hook should not", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		// the namespace is cleaned up after the test the same as the one of kibishii
+		namespace := kibishiiNamespace
+		backupName := "backup-hooks-sentinel-" + UUIDgen.String()
+		restoreName := "restore-hooks-sentinel-" + UUIDgen.String()
+
+		// the pre hook runs before the volume is backed up and the post hook runs after it, so only the
+		// sentinel of the pre hook is in the backup
+		By(fmt.Sprintf("Create deployment %s with pre and post backup hooks in namespace %s", hookDeployment, namespace), func() {
+			Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+			_, err := CreatePVC(client, namespace, "pvc-0", "", nil)
+			Expect(err).To(Succeed())
+			ann, err := BackupExecHookAnnotations("container-busybox",
+				[]string{"/bin/sh", "-c", fmt.Sprintf("echo %s > /%s/%s", backupName, hookDeploymentVolume, preHookSentinel)},
+				[]string{"/bin/sh", "-c", fmt.Sprintf("echo %s > /%s/%s", backupName, hookDeploymentVolume, postHookSentinel)})
+			Expect(err).To(Succeed())
+			deployment := NewDeployment(hookDeployment, namespace, 1, map[string]string{"app": hookDeployment}, nil).
+				WithVolume(PrepareVolumeList([]string{hookDeploymentVolume})).WithPodAnnotations(ann).Result()
+			_, err = CreateDeployment(client.ClientGo, namespace, deployment)
+			Expect(err).To(Succeed())
+			Expect(WaitForReadyDeployment(client.ClientGo, namespace, hookDeployment)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Back up workload with name %s", backupName), func() {
+			backupCfg := BackupConfig{
+				BackupName:               backupName,
+				Namespace:                namespace,
+				DefaultVolumesToFsBackup: true,
+			}
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By("Sentinels should be written by both of the hooks", func() {
+			pod := hookDeploymentPod(ctx, client, namespace)
+			for _, sentinel := range []string{preHookSentinel, postHookSentinel} {
+				content, err := ReadFileFromPodVolume(ctx, namespace, pod, "container-busybox", hookDeploymentVolume, sentinel)
+				Expect(err).To(Succeed(), fmt.Sprintf("Failed to read sentinel %s from pod %s", sentinel, pod))
+				Expect(strings.TrimSpace(content)).To(Equal(backupName))
+			}
+		})
+
+		By(fmt.Sprintf("Restore %s from backup %s after it's deleted", namespace, backupName), func() {
+			Expect(DeleteNamespace(ctx, client, namespace, true)).To(Succeed())
+			Expect(VeleroRestore(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, backupName, "")).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+				return "Fail to restore workload"
+			})
+			Expect(WaitForReadyDeployment(client.ClientGo, namespace, hookDeployment)).To(Succeed())
+		})
+
+		By("Only the sentinel of the pre hook should be restored", func() {
+			pod := hookDeploymentPod(ctx, client, namespace)
+			content, err := ReadFileFromPodVolume(ctx, namespace, pod, "container-busybox", hookDeploymentVolume, preHookSentinel)
+			Expect(err).To(Succeed(), fmt.Sprintf("Sentinel %s written by the pre hook should be restored into pod %s", preHookSentinel, pod))
+			Expect(strings.TrimSpace(content)).To(Equal(backupName))
+			_, err = ReadFileFromPodVolume(ctx, namespace, pod, "container-busybox", hookDeploymentVolume, postHookSentinel)
+			Expect(err).To(HaveOccurred(), fmt.Sprintf("Sentinel %s written by the post hook should not be restored into pod %s", postHookSentinel, pod))
+		})
+	})
+
+	It("Backup should be partially failed when the pre backup hook fails with onError=Fail", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		backupName := "backup-hooks-fail-" + UUIDgen.String()
+		prepareKibishiiForHooks(ctx, veleroCfg, kibishiiNamespace)
+
+		By("Annotate kibishii pods with failing pre backup hook", func() {
+			ann := map[string]string{
+				"pre.hook.backup.velero.io/container": hookContainer,
+				"pre.hook.backup.velero.io/command":   `["/bin/sh", "-c", "exit 1"]`,
+				"pre.hook.backup.velero.io/on-error":  string(velerov1api.HookErrorModeFail),
+			}
+			Expect(AddAnnotationToPods(ctx, *veleroCfg.ClientToInstallVelero, kibishiiNamespace, KibishiiPodNameList, ann)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Back up workload with name %s", backupName), func() {
+			args := []string{
+				"--namespace", veleroCfg.VeleroNamespace, "create", "backup", backupName,
+				"--include-namespaces", kibishiiNamespace, "--default-volumes-to-fs-backup",
+			}
+			Expect(VeleroCmdExec(ctx, veleroCfg.VeleroCLI, args)).To(Succeed())
+			_, err := WaitForBackupPhase(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName,
+				velerov1api.BackupPhasePartiallyFailed, 30*time.Minute)
+			Expect(err).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup %s should report the errors of hooks in describe output", backupName), func() {
+			output, err := VeleroBackupDescribe(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, true)
+			Expect(err).To(Succeed())
+			sections := ParseDescribeOutput(output)
+			Expect(sections["Phase"]).To(HavePrefix(string(velerov1api.BackupPhasePartiallyFailed)))
+			Expect(sections["Errors"]).To(ContainSubstring(kibishiiNamespace), "Errors of the failed hooks should be reported for the namespace")
+		})
+	})
+}
+
+func prepareKibishiiForHooks(ctx context.Context, veleroCfg VeleroConfig, namespace string) {
+	client := *veleroCfg.ClientToInstallVelero
+	By(fmt.Sprintf("Deploy sample workload of Kibishii in namespace %s", namespace), func() {
+		Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+		Expect(KibishiiPrepareBeforeBackup(ctx, client, veleroCfg.CloudProvider, namespace,
+			veleroCfg.RegistryCredentialFile, veleroCfg.Features, veleroCfg.KibishiiDirectory,
+			veleroCfg.KibishiiStorageClass, false, DefaultKibishiiData)).To(Succeed())
+	})
+}
+
+// hookDeploymentPod returns the name of the only pod of the deployment with the backup hooks
+func hookDeploymentPod(ctx context.Context, client TestClient, namespace string) string {
+	podList, err := ListPods(ctx, client, namespace)
+	Expect(err).To(Succeed(), fmt.Sprintf("Failed to list pods in namespace %s", namespace))
+	Expect(podList.Items).To(HaveLen(1), fmt.Sprintf("Expecting 1 pod of deployment %s in namespace %s", hookDeployment, namespace))
+	return podList.Items[0].Name
+}
@@ -0,0 +1,145 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backups
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// downloadRequestsDeletionTimeout is the time to wait for the download requests created by the CLI to be
+// deleted, Velero deletes them after the download URLs expire in 10 minutes
+const downloadRequestsDeletionTimeout = 15 * time.Minute
+
+// Test the logs and the details of the backup and restore can be downloaded from the object storage by
+// the CLI through the DownloadRequests
+func BackupRestoreLogsTest() {
+	var (
+		namespace   string
+		backupName  string
+		restoreName string
+		veleroCfg   VeleroConfig
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		namespace = "logs-" + UUIDgen.String()
+		backupName = "backup-logs-" + UUIDgen.String()
+		restoreName = "restore-logs-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", namespace), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, namespace, false)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Logs and details of the backup and restore should be downloaded by the CLI", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), time.Hour)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+
+		By(fmt.Sprintf("Deploy kibishii into namespace %s", namespace), func() {
+			Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+			Expect(KibishiiPrepareBeforeBackup(ctx, client, veleroCfg.CloudProvider,
+				namespace, veleroCfg.RegistryCredentialFile, veleroCfg.Features,
+				veleroCfg.KibishiiDirectory, veleroCfg.KibishiiStorageClass, false, DefaultKibishiiData)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup namespace %s", namespace), func() {
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, BackupConfig{
+				BackupName:               backupName,
+				Namespace:                namespace,
+				DefaultVolumesToFsBackup: true,
+			})).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By("Logs of the backup should contain the resources of the namespace", func() {
+			logs, err := VeleroBackupLogs(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName)
+			Expect(err).To(Succeed())
+			Expect(logs).NotTo(BeEmpty())
+			Expect(logs).To(ContainSubstring("namespace=" + namespace))
+			Expect(logs).To(ContainSubstring("name=kibishii-deployment"))
+		})
+
+		By("Details of the backup should be described", func() {
+			details, err := VeleroBackupDescribe(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, true)
+			Expect(err).To(Succeed())
+			Expect(details).NotTo(BeEmpty())
+			Expect(details).To(ContainSubstring(namespace))
+		})
+
+		By(fmt.Sprintf("Restore namespace %s after deleting it", namespace), func() {
+			Expect(DeleteNamespace(ctx, client, namespace, true)).To(Succeed())
+			Expect(VeleroRestore(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, backupName, "")).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+				return "Fail to restore workload"
+			})
+		})
+
+		By("Logs of the restore should contain the resources of the namespace", func() {
+			logs, err := VeleroRestoreLogs(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName)
+			Expect(err).To(Succeed())
+			Expect(logs).NotTo(BeEmpty())
+			Expect(logs).To(ContainSubstring(namespace))
+		})
+
+		By("DownloadRequests should be created for the backup and restore", func() {
+			requests, err := ListDownloadRequests(ctx, client, veleroCfg.VeleroNamespace, backupName)
+			Expect(err).To(Succeed())
+			Expect(requests).NotTo(BeEmpty())
+			requests, err = ListDownloadRequests(ctx, client, veleroCfg.VeleroNamespace, restoreName)
+			Expect(err).To(Succeed())
+			Expect(requests).NotTo(BeEmpty())
+		})
+
+		By("DownloadRequests should be deleted after they expire", func() {
+			Expect(WaitForDownloadRequestsDeleted(ctx, client, veleroCfg.VeleroNamespace, backupName, downloadRequestsDeletionTimeout)).To(Succeed())
+			Expect(WaitForDownloadRequestsDeleted(ctx, client, veleroCfg.VeleroNamespace, restoreName, downloadRequestsDeletionTimeout)).To(Succeed())
+		})
+	})
+}
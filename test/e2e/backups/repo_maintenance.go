@@ -0,0 +1,181 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backups
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	repoMaintenancePod    = "pod-repo-maintenance"
+	repoMaintenanceVolume = "volume-repo-maintenance"
+	// the secret mounted into the Velero server and node-agent pods by the installation
+	repoMaintenanceCredentialsSecret = "cloud-credentials"
+	repoMaintenanceCredentialsKey    = "cloud"
+	// the backup repositories are reconciled every 5 minutes, so the maintenance is checked
+	// for a few reconciliations at most
+	repoMaintenanceTimeout = 15 * time.Minute
+	// the time for kubelet to refresh the mounted secret after it's updated
+	repoCredentialsRefreshTime = 2 * time.Minute
+)
+
+// Test the backup repository created by fs-backup is ready and maintained periodically, and
+// becomes not ready when the repository can't be connected with the broken credentials
+func BackupRepositoryMaintenanceTest() {
+	var (
+		namespace, brokenNamespace string
+		veleroCfg                  VeleroConfig
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		namespace = "repo-maintenance-" + UUIDgen.String()
+		brokenNamespace = "repo-maintenance-broken-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			// Make sure the repository maintenance is due at every reconciliation of the backup repository
+			veleroCfg.RepoMaintenanceFrequency = "1m0s"
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			for _, ns := range []string{namespace, brokenNamespace} {
+				By(fmt.Sprintf("Delete namespace %s", ns), func() {
+					DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, ns, false)
+				})
+			}
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Backup repository should be ready and maintained periodically, and be not ready with broken credentials", func() {
+		if !veleroCfg.InstallVelero {
+			Skip("The repository maintenance frequency can only be set by the installation of Velero")
+		}
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		backupName := "backup-repo-maintenance-" + UUIDgen.String()
+		var repo *velerov1api.BackupRepository
+
+		By(fmt.Sprintf("Create pod %s with data in namespace %s", repoMaintenancePod, namespace), func() {
+			Expect(createPodWithData(ctx, client, namespace)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup namespace %s with fs-backup", namespace), func() {
+			backupCfg := BackupConfig{
+				BackupName:               backupName,
+				Namespace:                namespace,
+				DefaultVolumesToFsBackup: true,
+			}
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By(fmt.Sprintf("Backup repository of namespace %s should be ready", namespace), func() {
+			var err error
+			repo, err = WaitForBackupRepositoryPhase(ctx, client, veleroCfg.VeleroNamespace, namespace,
+				velerov1api.BackupRepositoryPhaseReady, 5*time.Minute)
+			Expect(err).To(Succeed())
+			Expect(repo.Spec.BackupStorageLocation).To(Equal(defaultBSL))
+			Expect(repo.Spec.VolumeNamespace).To(Equal(namespace))
+		})
+
+		By(fmt.Sprintf("Backup repository %s should be got by velero CLI", repo.Name), func() {
+			repos, err := GetBackupRepositoriesByCLI(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, namespace)
+			Expect(err).To(Succeed())
+			Expect(repos).To(HaveLen(1))
+			Expect(repos[0].Name).To(Equal(repo.Name))
+			Expect(repos[0].Status.Phase).To(Equal(velerov1api.BackupRepositoryPhaseReady))
+		})
+
+		By(fmt.Sprintf("Backup repository %s should be maintained in %s", repo.Name, repoMaintenanceTimeout), func() {
+			after := time.Now()
+			if repo.Status.LastMaintenanceTime != nil && repo.Status.LastMaintenanceTime.Time.After(after) {
+				after = repo.Status.LastMaintenanceTime.Time
+			}
+			Expect(WaitForBackupRepositoryMaintained(ctx, client, veleroCfg.VeleroNamespace, repo.Name,
+				after, repoMaintenanceTimeout)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup repository of namespace %s should be not ready with broken credentials", brokenNamespace), func() {
+			secret, err := GetSecret(client.ClientGo, veleroCfg.VeleroNamespace, repoMaintenanceCredentialsSecret)
+			Expect(err).To(Succeed())
+			data := secret.Data
+			Expect(UpdateSecretData(client.ClientGo, veleroCfg.VeleroNamespace, repoMaintenanceCredentialsSecret,
+				map[string][]byte{repoMaintenanceCredentialsKey: []byte("broken credentials")})).To(Succeed())
+			defer func() {
+				Expect(UpdateSecretData(client.ClientGo, veleroCfg.VeleroNamespace, repoMaintenanceCredentialsSecret, data)).To(Succeed())
+			}()
+			fmt.Printf("Wait %s for the broken credentials to be refreshed in the pods\n", repoCredentialsRefreshTime)
+			time.Sleep(repoCredentialsRefreshTime)
+
+			Expect(createPodWithData(ctx, client, brokenNamespace)).To(Succeed())
+			brokenBackupName := "backup-repo-maintenance-broken-" + UUIDgen.String()
+			args := []string{
+				"--namespace", veleroCfg.VeleroNamespace, "create", "backup", brokenBackupName,
+				"--include-namespaces", brokenNamespace, "--default-volumes-to-fs-backup", "--snapshot-volumes=false",
+			}
+			Expect(VeleroCmdExec(ctx, veleroCfg.VeleroCLI, args)).To(Succeed())
+			brokenRepo, err := WaitForBackupRepositoryPhase(ctx, client, veleroCfg.VeleroNamespace, brokenNamespace,
+				velerov1api.BackupRepositoryPhaseNotReady, 5*time.Minute)
+			Expect(err).To(Succeed())
+			Expect(brokenRepo.Status.Message).NotTo(BeEmpty())
+			_, err = WaitForBackupCompletion(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, brokenBackupName, 10*time.Minute)
+			Expect(err).To(Succeed())
+		})
+	})
+}
+
+func createPodWithData(ctx context.Context, client TestClient, namespace string) error {
+	if err := CreateNamespace(ctx, client, namespace); err != nil {
+		return err
+	}
+	if _, err := CreatePod(client, namespace, repoMaintenancePod, "", "", []string{repoMaintenanceVolume}, nil, nil); err != nil {
+		return err
+	}
+	if err := WaitForPods(ctx, client, namespace, []string{repoMaintenancePod}); err != nil {
+		return err
+	}
+	return CreateFileToPod(ctx, namespace, repoMaintenancePod, repoMaintenancePod, repoMaintenanceVolume,
+		"data", "repo maintenance data")
+}
@@ -0,0 +1,190 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backups
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	restoreHookPod           = "restore-hook-pod"
+	restoreHookVolume        = "volume-restore-hook"
+	restoreHookInitContainer = "restore-hook-init"
+	restoreHookMarkerFile    = "restore-hook-marker"
+	restoreHookSentinel      = "restore-hook-init-done"
+)
+
+// Test the post restore exec and init container hooks defined by the annotations of pod
+func RestoreHooksTest() {
+	var (
+		namespace string
+		veleroCfg VeleroConfig
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		namespace = "restore-hooks-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", namespace), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, namespace, true)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Post restore exec and init container hooks should be executed on the restored pod", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		backupName := "backup-restore-hooks-" + UUIDgen.String()
+		restoreName := "restore-restore-hooks-" + UUIDgen.String()
+
+		// the init container created from the annotations has no volume mounted, so it writes
+		// the sentinel into its termination message which is kept in the pod status
+		ann := map[string]string{
+			"init.hook.restore.velero.io/container-name":  restoreHookInitContainer,
+			"init.hook.restore.velero.io/container-image": "gcr.io/velero-gcp/busybox:latest",
+			"init.hook.restore.velero.io/command": fmt.Sprintf(`["/bin/sh", "-c", "echo -n %s > /dev/termination-log"]`,
+				restoreHookSentinel),
+			"post.hook.restore.velero.io/container": restoreHookPod,
+			"post.hook.restore.velero.io/command": fmt.Sprintf(`["/bin/sh", "-c", "echo %s > /%s/%s"]`,
+				restoreName, restoreHookVolume, restoreHookMarkerFile),
+		}
+		backupAndDeleteRestoreHookPod(ctx, veleroCfg, namespace, backupName, ann)
+
+		By(fmt.Sprintf("Restore %s from backup %s", namespace, backupName), func() {
+			Expect(VeleroRestore(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, backupName, "")).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+				return "Fail to restore workload"
+			})
+			Expect(WaitForPods(ctx, *veleroCfg.ClientToInstallVelero, namespace, []string{restoreHookPod})).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Init container %s should run before the container of pod", restoreHookInitContainer), func() {
+			status, err := CheckInitContainerRunBefore(ctx, *veleroCfg.ClientToInstallVelero, namespace, restoreHookPod,
+				restoreHookInitContainer, restoreHookPod)
+			Expect(err).To(Succeed())
+			Expect(status.State.Terminated.Message).To(Equal(restoreHookSentinel), "Sentinel should be written by the init container")
+		})
+
+		By("Marker should be written into the restored volume by the exec hook", func() {
+			content, err := ReadFileFromPodVolume(ctx, namespace, restoreHookPod, restoreHookPod, restoreHookVolume, restoreHookMarkerFile)
+			Expect(err).To(Succeed(), "Failed to read the marker written by the exec hook")
+			Expect(strings.TrimSpace(content)).To(Equal(restoreName))
+		})
+
+		By(fmt.Sprintf("Restore %s should have no errors in describe output", restoreName), func() {
+			output, err := VeleroRestoreDescribe(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, true)
+			Expect(err).To(Succeed())
+			sections := ParseDescribeOutput(output)
+			Expect(sections["Phase"]).To(HavePrefix(string(velerov1api.RestorePhaseCompleted)))
+			Expect(sections).NotTo(HaveKey("Errors"))
+		})
+	})
+
+	It("Restore should be partially failed when the exec hook exceeds the timeout with onError=Fail", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		backupName := "backup-restore-hooks-timeout-" + UUIDgen.String()
+		restoreName := "restore-restore-hooks-timeout-" + UUIDgen.String()
+
+		ann := map[string]string{
+			"post.hook.restore.velero.io/container":    restoreHookPod,
+			"post.hook.restore.velero.io/command":      `["/bin/sh", "-c", "sleep 120"]`,
+			"post.hook.restore.velero.io/exec-timeout": "10s",
+			"post.hook.restore.velero.io/on-error":     string(velerov1api.HookErrorModeFail),
+		}
+		backupAndDeleteRestoreHookPod(ctx, veleroCfg, namespace, backupName, ann)
+
+		By(fmt.Sprintf("Restore %s from backup %s", namespace, backupName), func() {
+			args := []string{
+				"--namespace", veleroCfg.VeleroNamespace, "create", "restore", restoreName,
+				"--from-backup", backupName,
+			}
+			Expect(VeleroRestoreExec(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, args,
+				velerov1api.RestorePhasePartiallyFailed)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+				return "Restore should be partially failed"
+			})
+		})
+
+		By(fmt.Sprintf("Restore %s should report the timeout of exec hook in describe output", restoreName), func() {
+			output, err := VeleroRestoreDescribe(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, true)
+			Expect(err).To(Succeed())
+			sections := ParseDescribeOutput(output)
+			Expect(sections["Phase"]).To(HavePrefix(string(velerov1api.RestorePhasePartiallyFailed)))
+			Expect(sections["Errors"]).To(ContainSubstring(namespace), "Errors of the failed hook should be reported for the namespace")
+			Expect(sections["Errors"]).To(ContainSubstring("timed out"), "Timeout of the exec hook should be reported")
+		})
+	})
+}
+
+// backupAndDeleteRestoreHookPod creates a pod with the restore hook annotations, backs up the
+// namespace with fs-backup and then deletes the namespace to restore it from the backup
+func backupAndDeleteRestoreHookPod(ctx context.Context, veleroCfg VeleroConfig, namespace, backupName string, ann map[string]string) {
+	client := *veleroCfg.ClientToInstallVelero
+	By(fmt.Sprintf("Create pod %s with restore hooks in namespace %s", restoreHookPod, namespace), func() {
+		Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+		_, err := CreatePod(client, namespace, restoreHookPod, "", "", []string{restoreHookVolume}, nil, ann)
+		Expect(err).To(Succeed())
+		Expect(WaitForPods(ctx, client, namespace, []string{restoreHookPod})).To(Succeed())
+	})
+
+	By(fmt.Sprintf("Back up workload with name %s", backupName), func() {
+		backupCfg := BackupConfig{
+			BackupName:               backupName,
+			Namespace:                namespace,
+			DefaultVolumesToFsBackup: true,
+		}
+		Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+			RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+			return "Fail to backup workload"
+		})
+	})
+
+	By(fmt.Sprintf("Delete namespace %s", namespace), func() {
+		Expect(DeleteNamespace(ctx, client, namespace, true)).To(Succeed())
+	})
+}
@@ -0,0 +1,136 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backups
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	staleDataPathPod    = "pod-stale-data-path"
+	staleDataPathVolume = "volume-stale-data-path"
+	// the file is big enough to keep the PodVolumeBackup in progress while the backup is aborted
+	staleDataPathFileSizeMB = 1024
+	staleDataPathTimeout    = 2 * time.Minute
+	// the namespace deletion waits for the data path for staleDataPathTimeout at most, and then
+	// for the namespace to be deleted for 10 minutes at most
+	staleNamespaceDeletionTimeout = 15 * time.Minute
+)
+
+// Test the deletion of the workload namespace doesn't race with the PodVolumeBackups left by an
+// aborted backup, the backup is aborted by restarting the Velero server in the middle of fs-backup
+func StaleDataPathNamespaceDeletionTest() {
+	var (
+		namespace string
+		veleroCfg VeleroConfig
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		namespace = "stale-data-path-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", namespace), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, namespace, false)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Namespace should be deleted without wedging node-agent after the backup is aborted during fs-backup", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		backupName := "backup-stale-data-path-" + UUIDgen.String()
+		var restartCounts map[string]int32
+
+		By(fmt.Sprintf("Create pod %s with %dMiB data in namespace %s", staleDataPathPod, staleDataPathFileSizeMB, namespace), func() {
+			Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+			_, err := CreatePod(client, namespace, staleDataPathPod, "", "", []string{staleDataPathVolume}, nil, nil)
+			Expect(err).To(Succeed())
+			Expect(WaitForPods(ctx, client, namespace, []string{staleDataPathPod})).To(Succeed())
+			Expect(CreateRandomFileToPod(ctx, namespace, staleDataPathPod, staleDataPathPod, staleDataPathVolume,
+				"data", staleDataPathFileSizeMB)).To(Succeed())
+			restartCounts, err = GetNodeAgentRestartCounts(ctx, client, veleroCfg.VeleroNamespace)
+			Expect(err).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Abort backup %s by restarting the Velero server once the fs-backup starts", backupName), func() {
+			args := []string{
+				"--namespace", veleroCfg.VeleroNamespace, "create", "backup", backupName,
+				"--include-namespaces", namespace, "--default-volumes-to-fs-backup", "--snapshot-volumes=false",
+			}
+			Expect(VeleroCmdExec(ctx, veleroCfg.VeleroCLI, args)).To(Succeed())
+			Eventually(func() (bool, error) {
+				crs, err := GetDataPathCRsOfNamespace(ctx, client, veleroCfg.VeleroNamespace, namespace)
+				if err != nil {
+					return false, err
+				}
+				return len(crs) > 0 && !crs[0].Terminal, nil
+			}, 5*time.Minute, time.Second).Should(BeTrue(), "PodVolumeBackup should be in progress")
+			Expect(RestartVeleroServer(ctx, veleroCfg.VeleroNamespace)).To(Succeed())
+			// the backup in progress is marked as failed when the restarted server starts
+			Eventually(func() error {
+				return BackupPhaseShouldBe(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName,
+					velerov1api.BackupPhaseFailed)
+			}, time.Minute, 5*time.Second).Should(Succeed())
+		})
+
+		By(fmt.Sprintf("Namespace %s should be deleted in %s", namespace, staleNamespaceDeletionTimeout), func() {
+			start := time.Now()
+			Expect(SafeDeleteWorkloadNamespace(ctx, client, veleroCfg.VeleroNamespace, namespace, staleDataPathTimeout)).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("<", staleNamespaceDeletionTimeout))
+		})
+
+		By("Node-agent should not crash", func() {
+			counts, err := GetNodeAgentRestartCounts(ctx, client, veleroCfg.VeleroNamespace)
+			Expect(err).To(Succeed())
+			Expect(counts).To(Equal(restartCounts), "Node-agent pods should not be restarted")
+			logs, err := GetNodeAgentLogs(ctx, veleroCfg.VeleroNamespace)
+			Expect(err).To(Succeed())
+			Expect(strings.Contains(logs, "panic")).To(BeFalse(), "Node-agent should not panic")
+		})
+	})
+}
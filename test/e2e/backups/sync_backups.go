@@ -24,11 +24,13 @@ import (
 	"flag"
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
@@ -146,13 +148,13 @@ func BackupsSyncTest() {
 		})
 
 		By(fmt.Sprintf("Delete %s backup files in object store", test.backupName), func() {
-			err = DeleteObjectsInBucket(VeleroCfg.CloudProvider, VeleroCfg.CloudCredentialsFile, VeleroCfg.BSLBucket,
+			err = DeleteObjectsInBucket(GetObjectStoreProvider(VeleroCfg), VeleroCfg.CloudCredentialsFile, VeleroCfg.BSLBucket,
 				VeleroCfg.BSLPrefix, VeleroCfg.BSLConfig, test.backupName, BackupObjectsPrefix)
 			Expect(err).To(Succeed(), fmt.Sprintf("Failed to delete object in bucket %s with err %v", test.backupName, err))
 		})
 
 		By(fmt.Sprintf("Check %s backup files in object store is deleted", test.backupName), func() {
-			err = ObjectsShouldNotBeInBucket(VeleroCfg.CloudProvider, VeleroCfg.CloudCredentialsFile, VeleroCfg.BSLBucket,
+			err = ObjectsShouldNotBeInBucket(GetObjectStoreProvider(VeleroCfg), VeleroCfg.CloudCredentialsFile, VeleroCfg.BSLBucket,
 				VeleroCfg.BSLPrefix, VeleroCfg.BSLConfig, test.backupName, BackupObjectsPrefix, 1)
 			Expect(err).To(Succeed(), fmt.Sprintf("Failed to delete object in bucket %s with err %v", test.backupName, err))
 		})
@@ -161,6 +163,167 @@ func BackupsSyncTest() {
 			Expect(WaitBackupDeleted(ctx, VeleroCfg.VeleroCLI, test.backupName, time.Minute*10)).To(Succeed(), fmt.Sprintf("Failed to check backup %s deleted", test.backupName))
 		})
 	})
+
+	It("Backups written by a newer Velero in object storage should be synced without breaking the sync", func() {
+		test.Init()
+		if !IsObjectsMutationSupported(GetObjectStoreProvider(VeleroCfg)) {
+			Skip(fmt.Sprintf("Mutating backup metadata in bucket is not supported by object store provider %s", GetObjectStoreProvider(VeleroCfg)))
+		}
+		futureBackupName := "sync-future-" + UUIDgen.String()
+		futureFormatVersion := "99.0.0"
+
+		By(fmt.Sprintf("Prepare workload as target to backup by creating namespace %s namespace", test.testNS), func() {
+			Expect(CreateNamespace(ctx, *VeleroCfg.ClientToInstallVelero, test.testNS)).To(Succeed(),
+				fmt.Sprintf("Failed to create %s namespace", test.testNS))
+		})
+		if !VeleroCfg.Debug {
+			defer func() {
+				Expect(DeleteNamespace(ctx, *VeleroCfg.ClientToInstallVelero, test.testNS, false)).To(Succeed(),
+					fmt.Sprintf("Failed to delete the namespace %s", test.testNS))
+			}()
+		}
+		var BackupCfg BackupConfig
+		BackupCfg.BackupName = test.backupName
+		BackupCfg.Namespace = test.testNS
+		BackupCfg.UseVolumeSnapshots = false
+		By(fmt.Sprintf("Backup the workload in %s namespace", test.testNS), func() {
+			Expect(VeleroBackupNamespace(ctx, VeleroCfg.VeleroCLI,
+				VeleroCfg.VeleroNamespace, BackupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), VeleroCfg.VeleroCLI, VeleroCfg.VeleroNamespace, test.backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By(fmt.Sprintf("Write backup %s with format version %s and unknown fields into object storage", futureBackupName, futureFormatVersion), func() {
+			Expect(CopyBackupMetadataInBucket(GetObjectStoreProvider(VeleroCfg), VeleroCfg.CloudCredentialsFile, VeleroCfg.BSLBucket,
+				VeleroCfg.BSLPrefix, VeleroCfg.BSLConfig, test.backupName, futureBackupName, func(metadata map[string]interface{}) {
+					metadata["futureField"] = map[string]interface{}{"key": "value"}
+					if spec, ok := metadata["spec"].(map[string]interface{}); ok {
+						spec["futureSpecField"] = "value"
+					}
+					if status, ok := metadata["status"].(map[string]interface{}); ok {
+						status["formatVersion"] = futureFormatVersion
+					}
+				})).To(Succeed())
+		})
+
+		By("Reinstall velero to sync the backups in object storage", func() {
+			Expect(VeleroUninstall(ctx, VeleroCfg.VeleroCLI, VeleroCfg.VeleroNamespace)).To(Succeed())
+			veleroCfg := VeleroCfg
+			veleroCfg.UseVolumeSnapshots = false
+			Expect(VeleroInstall(ctx, &veleroCfg)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup %s written by the current Velero should be still synced", test.backupName), func() {
+			Expect(test.IsBackupsSynced()).To(Succeed(), fmt.Sprintf("Failed to sync backup %s from object storage", test.backupName))
+		})
+
+		// there is no check of the format version during the sync of the current Velero and the
+		// metadata isn't decoded strictly, so the unknown fields are dropped and the backup is synced
+		// with the format version written by the newer Velero kept
+		By(fmt.Sprintf("Backup %s should be synced with the format version unchanged", futureBackupName), func() {
+			// wait for a few more sync periods to make sure the sync isn't stuck by the backup
+			time.Sleep(3 * time.Minute)
+			exist, err := IsBackupExist(ctx, VeleroCfg.VeleroCLI, futureBackupName)
+			Expect(err).To(Succeed())
+			Expect(exist).To(BeTrue(), fmt.Sprintf("Backup %s is not synced from object storage", futureBackupName))
+			backup, err := GetBackupObject(ctx, VeleroCfg.VeleroCLI, VeleroCfg.VeleroNamespace, futureBackupName)
+			Expect(err).To(Succeed())
+			Expect(backup.Status.FormatVersion).To(Equal(futureFormatVersion))
+		})
+
+		By("Velero server should not crash or retry the sync of the backup in a hot loop", func() {
+			pods, err := VeleroCfg.ClientToInstallVelero.ClientGo.CoreV1().Pods(VeleroCfg.VeleroNamespace).List(ctx,
+				metav1.ListOptions{LabelSelector: "deploy=velero"})
+			Expect(err).To(Succeed())
+			for _, pod := range pods.Items {
+				for _, status := range pod.Status.ContainerStatuses {
+					Expect(status.RestartCount).To(BeZero(), fmt.Sprintf("Container %s of pod %s restarted", status.Name, pod.Name))
+				}
+			}
+			logs, err := GetVeleroServerLogs(ctx, VeleroCfg.VeleroNamespace)
+			Expect(err).To(Succeed())
+			// the backups are synced once per minute by default, a few lines in each sync are expected
+			Expect(strings.Count(logs, futureBackupName)).To(BeNumerically("<=", 20),
+				fmt.Sprintf("Too many logs of backup %s in Velero server", futureBackupName))
+		})
+	})
+
+	It("Backups uploaded into a fresh prefix of object storage should be synced and restored", func() {
+		test.Init()
+		if !IsObjectsMutationSupported(GetObjectStoreProvider(VeleroCfg)) {
+			Skip(fmt.Sprintf("Uploading backups into bucket is not supported by object store provider %s", GetObjectStoreProvider(VeleroCfg)))
+		}
+		configMapName := "sync-prepopulated-cm"
+		restoreName := "sync-prepopulated-restore-" + UUIDgen.String()
+		// the prefix is only used by this test, so the uploaded backup is the only one to be synced
+		prefix := strings.Trim(VeleroCfg.BSLPrefix+"/sync-prepopulated-"+UUIDgen.String(), "/")
+		// the tarball and the metadata are enough to sync and restore the backup, the other files are optional
+		backupFiles := []string{"velero-backup.json", test.backupName + ".tar.gz"}
+		var files map[string][]byte
+
+		By(fmt.Sprintf("Prepare workload as target to backup by creating configmap in %s namespace", test.testNS), func() {
+			Expect(CreateNamespace(ctx, *VeleroCfg.ClientToInstallVelero, test.testNS)).To(Succeed(),
+				fmt.Sprintf("Failed to create %s namespace", test.testNS))
+			_, err := CreateConfigMap(VeleroCfg.ClientToInstallVelero.ClientGo, test.testNS, configMapName, nil,
+				map[string]string{"data": test.testNS})
+			Expect(err).To(Succeed())
+		})
+		if !VeleroCfg.Debug {
+			defer func() {
+				Expect(DeleteNamespace(ctx, *VeleroCfg.ClientToInstallVelero, test.testNS, false)).To(Succeed(),
+					fmt.Sprintf("Failed to delete the namespace %s", test.testNS))
+			}()
+		}
+		var BackupCfg BackupConfig
+		BackupCfg.BackupName = test.backupName
+		BackupCfg.Namespace = test.testNS
+		BackupCfg.UseVolumeSnapshots = false
+		By(fmt.Sprintf("Backup the workload in %s namespace", test.testNS), func() {
+			Expect(VeleroBackupNamespace(ctx, VeleroCfg.VeleroCLI,
+				VeleroCfg.VeleroNamespace, BackupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), VeleroCfg.VeleroCLI, VeleroCfg.VeleroNamespace, test.backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By(fmt.Sprintf("Download the tarball and metadata of backup %s from object storage", test.backupName), func() {
+			files, err = GetObjectsFromBucket(GetObjectStoreProvider(VeleroCfg), VeleroCfg.CloudCredentialsFile, VeleroCfg.BSLBucket,
+				VeleroCfg.BSLPrefix, VeleroCfg.BSLConfig, test.backupName, backupFiles)
+			Expect(err).To(Succeed())
+		})
+
+		By("Uninstall velero and delete the backed up namespace", func() {
+			Expect(VeleroUninstall(ctx, VeleroCfg.VeleroCLI, VeleroCfg.VeleroNamespace)).To(Succeed())
+			Expect(DeleteNamespace(ctx, *VeleroCfg.ClientToInstallVelero, test.testNS, true)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Upload backup %s into prefix %s of object storage", test.backupName, prefix), func() {
+			Expect(PutObjectsToBucket(GetObjectStoreProvider(VeleroCfg), VeleroCfg.CloudCredentialsFile, VeleroCfg.BSLBucket,
+				prefix, VeleroCfg.BSLConfig, test.backupName, files)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Install velero with the backup storage location in prefix %s", prefix), func() {
+			veleroCfg := VeleroCfg
+			veleroCfg.UseVolumeSnapshots = false
+			veleroCfg.BSLPrefix = prefix
+			Expect(VeleroInstall(ctx, &veleroCfg)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup %s should be synced from prefix %s", test.backupName, prefix), func() {
+			// the backups are synced once per minute by default
+			Expect(WaitForBackupSynced(ctx, VeleroCfg.VeleroCLI, VeleroCfg.VeleroNamespace, test.backupName, 5*time.Minute)).To(Succeed(),
+				fmt.Sprintf("Failed to sync backup %s from object storage", test.backupName))
+		})
+
+		By(fmt.Sprintf("Restore the synced backup %s", test.backupName), func() {
+			Expect(VeleroRestore(ctx, VeleroCfg.VeleroCLI, VeleroCfg.VeleroNamespace, restoreName, test.backupName, "")).To(Succeed(), func() string {
+				RunDebug(context.Background(), VeleroCfg.VeleroCLI, VeleroCfg.VeleroNamespace, "", restoreName)
+				return "Fail to restore workload"
+			})
+			Expect(ConfigMapDataShouldBe(VeleroCfg.ClientToInstallVelero.ClientGo, test.testNS, configMapName, "data", test.testNS)).To(Succeed())
+		})
+	})
 }
 
 func (b *SyncBackups) IsBackupsSynced() error {
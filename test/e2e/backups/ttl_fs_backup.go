@@ -0,0 +1,130 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backups
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/providers"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// Test the expired backup with fs-backup is garbage collected along with its files in object
+// storage and the snapshots in the backup repository
+func TTLWithFsBackupTest() {
+	var (
+		testNS    string
+		veleroCfg VeleroConfig
+	)
+	ttl := 5 * time.Minute
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		testNS = "backup-ttl-fs-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			// Make sure the garbage collection runs frequently enough to pick up the expired backup in time
+			veleroCfg.GCFrequency = "1m0s"
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", testNS), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, testNS, true)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Expired backup with fs-backup should be deleted by GC with its files and snapshots", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		backupName := "backup-ttl-fs-" + UUIDgen.String()
+
+		By(fmt.Sprintf("Deploy sample workload of Kibishii in namespace %s", testNS), func() {
+			Expect(CreateNamespace(ctx, client, testNS)).To(Succeed())
+			Expect(KibishiiPrepareBeforeBackup(ctx, client, veleroCfg.CloudProvider, testNS,
+				veleroCfg.RegistryCredentialFile, veleroCfg.Features, veleroCfg.KibishiiDirectory,
+				veleroCfg.KibishiiStorageClass, false, DefaultKibishiiData)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup the workload with TTL %s", ttl), func() {
+			backupCfg := BackupConfig{
+				BackupName:               backupName,
+				Namespace:                testNS,
+				DefaultVolumesToFsBackup: true,
+				TTL:                      ttl,
+			}
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By("Files of backup and pod volume backups should be created", func() {
+			Expect(ObjectsShouldBeInBucket(GetObjectStoreProvider(veleroCfg), veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket,
+				veleroCfg.BSLPrefix, veleroCfg.BSLConfig, backupName, BackupObjectsPrefix)).To(Succeed())
+			pvbs, err := GetPVB(ctx, veleroCfg.VeleroNamespace, backupName)
+			Expect(err).To(Succeed())
+			Expect(len(pvbs)).To(Equal(len(KibishiiPodNameList)), fmt.Sprintf("Unexpected PVB %v", pvbs))
+		})
+
+		By(fmt.Sprintf("Backup %s should be expired and picked up by GC", backupName), func() {
+			Expect(WaitForBackupExpired(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, ttl+5*time.Minute)).To(Succeed())
+		})
+
+		// the backup is only deleted when all the related data including the snapshots in the
+		// backup repository are deleted successfully
+		By(fmt.Sprintf("Backup %s should be deleted", backupName), func() {
+			Expect(WaitBackupDeleted(ctx, veleroCfg.VeleroCLI, backupName, 10*time.Minute)).To(Succeed(),
+				fmt.Sprintf("Backup %s was not deleted by GC", backupName))
+		})
+
+		By("Files of backup in object storage should be deleted", func() {
+			Expect(ObjectsShouldNotBeInBucket(GetObjectStoreProvider(veleroCfg), veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket,
+				veleroCfg.BSLPrefix, veleroCfg.BSLConfig, backupName, BackupObjectsPrefix, 5)).To(Succeed())
+		})
+
+		By("Pod volume backups of the backup should be deleted", func() {
+			pvbs, err := GetPVB(ctx, veleroCfg.VeleroNamespace, backupName)
+			Expect(err).To(Succeed())
+			Expect(len(pvbs)).To(Equal(0), fmt.Sprintf("Unexpected PVB %v", pvbs))
+		})
+	})
+}
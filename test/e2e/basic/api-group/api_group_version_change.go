@@ -0,0 +1,168 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package basic
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// APIGroupVersionChangeTest backs up custom resources of a CRD serving v1beta1 as the storage version
+// and v1, and restores them after the CRD is changed to serve v1 only. With the EnableAPIGroupVersions
+// feature, the version preferred by the cluster v1 is found in the backup and restored by priority 1.
+func APIGroupVersionChangeTest() {
+	var (
+		namespace string
+		group     = "version-change.music.example.io"
+		crdName   = "rockbands." + group
+		// the object created by each version
+		rockbands = map[string]string{
+			"v1beta1": "rockband-v1beta1",
+			"v1":      "rockband-v1",
+		}
+	)
+	srcCrdYaml := "testdata/enable_api_group_versions/case-e-source.yaml"
+	tgtCrdYaml := "testdata/enable_api_group_versions/case-e-target.yaml"
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		var err error
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).NotTo(HaveOccurred())
+		flag.Parse()
+		namespace = "rockbands-version-change-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			veleroCfg.Features = "EnableAPIGroupVersions"
+			veleroCfg.UseVolumeSnapshots = false
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By(fmt.Sprintf("Delete namespace %s and CRD %s", namespace, crdName), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, namespace, true)
+				Expect(DeleteCRDByName(context.Background(), crdName)).To(Succeed())
+			})
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			if veleroCfg.InstallVelero {
+				By("Uninstall Velero", func() {
+					Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+				})
+			}
+		}
+	})
+
+	Context("When EnableAPIGroupVersions flag is set", func() {
+		It("Should restore the version served by the cluster after the CRD stops serving the storage version", func() {
+			ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+			defer ctxCancel()
+			client := *veleroCfg.ClientToInstallVelero
+			backupName := "backup-rockbands-version-change-" + UUIDgen.String()
+			restoreName := "restore-rockbands-version-change-" + UUIDgen.String()
+
+			By(fmt.Sprintf("Install CRD %s serving v1beta1 and v1", crdName), func() {
+				Expect(InstallCRD(ctx, srcCrdYaml)).To(Succeed())
+				Expect(WaitForCRDEstablished(crdName)).To(Succeed())
+			})
+
+			By(fmt.Sprintf("Create a rockband by each version in namespace %s", namespace), func() {
+				Expect(CreateNamespace(ctx, client, namespace)).To(Succeed())
+				for version, name := range rockbands {
+					gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: "rockbands"}
+					_, err := CreateCustomResource(client, gvr, namespace, newRockBand(gvr, namespace, name))
+					Expect(err).To(Succeed())
+				}
+				// Velero server refresh api version data by discovery helper every 5 minutes
+				time.Sleep(6 * time.Minute)
+			})
+
+			By(fmt.Sprintf("Backup namespace %s", namespace), func() {
+				backupCfg := BackupConfig{
+					BackupName:         backupName,
+					Namespace:          namespace,
+					UseVolumeSnapshots: false,
+				}
+				Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+					RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+					return "Fail to backup workload"
+				})
+			})
+
+			By(fmt.Sprintf("Delete namespace %s and change CRD %s to serve v1 only", namespace, crdName), func() {
+				Expect(DeleteNamespace(ctx, client, namespace, true)).To(Succeed())
+				Expect(ReplaceCRD(ctx, crdName, tgtCrdYaml)).To(Succeed())
+				time.Sleep(6 * time.Minute)
+			})
+
+			By(fmt.Sprintf("Restore namespace %s", namespace), func() {
+				Expect(VeleroRestore(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, backupName, "")).To(Succeed(), func() string {
+					RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+					return "Fail to restore workload"
+				})
+			})
+
+			By("Rockbands created by both versions should be restored as v1", func() {
+				gvr := schema.GroupVersionResource{Group: group, Version: "v1", Resource: "rockbands"}
+				for _, name := range rockbands {
+					rockband, err := GetCustomResource(client, gvr, namespace, name)
+					Expect(err).To(Succeed())
+					genre, _, err := unstructured.NestedString(rockband.Object, "spec", "genre")
+					Expect(err).To(Succeed())
+					Expect(genre).To(Equal("60s rock"), fmt.Sprintf("Unexpected spec of rockband %s", name))
+					Expect(rockband.GetLabels()).To(HaveKeyWithValue(velerov1api.RestoreNameLabel, restoreName))
+				}
+			})
+
+			By("Restore should not fall back from the version preferred by the cluster", func() {
+				logs, err := VeleroRestoreLogs(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName)
+				Expect(err).To(Succeed())
+				Expect(APIGroupVersionFallbacks(logs, crdName)).To(BeEmpty())
+			})
+		})
+	})
+}
+
+func newRockBand(gvr schema.GroupVersionResource, namespace, name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": gvr.GroupVersion().String(),
+		"kind":       "RockBand",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"genre":      "60s rock",
+			"leadSinger": "John Lennon",
+		},
+	}}
+}
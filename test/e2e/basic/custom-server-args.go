@@ -0,0 +1,66 @@
+package basic
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const customServerArg = "--log-level=debug"
+
+// CustomServerArgsTest installs Velero with a custom arg for the velero server and node-agent, and checks
+// the arg is present in the spec of their pods
+func CustomServerArgsTest() {
+	var veleroCfg VeleroConfig
+
+	BeforeEach(func() {
+		if !VeleroCfg.InstallVelero {
+			Skip("The args of the velero server and node-agent can only be customized by the installation of Velero")
+		}
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = true
+		veleroCfg.VeleroServerArgs = []string{customServerArg}
+		veleroCfg.NodeAgentArgs = []string{customServerArg}
+		flag.Parse()
+		Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+		}
+	})
+
+	It("Custom args should be present in the pods of velero server and node-agent", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+
+		for selector, containerName := range map[string]string{"deploy=velero": "velero", "name=node-agent": "node-agent"} {
+			By(fmt.Sprintf("Arg %s should be present in container %s of pods %s", customServerArg, containerName, selector), func() {
+				pods, err := client.ClientGo.CoreV1().Pods(veleroCfg.VeleroNamespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+				Expect(err).To(Succeed())
+				Expect(pods.Items).NotTo(BeEmpty())
+				for _, pod := range pods.Items {
+					found := false
+					for _, container := range pod.Spec.Containers {
+						if container.Name == containerName {
+							found = true
+							Expect(container.Args).To(ContainElement(customServerArg), fmt.Sprintf("Arg %s is not present in pod %s", customServerArg, pod.Name))
+						}
+					}
+					Expect(found).To(BeTrue(), fmt.Sprintf("Container %s is not found in pod %s", containerName, pod.Name))
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// KubeSystemBackup backs up the kube-system namespace and restores it into a scratch namespace by
+// namespace mapping, and checks the live objects in kube-system are not touched by the restore.
+// It never restores in place, and the workloads are excluded from the restore as the system
+// components such as kube-proxy would run again in the scratch namespace.
+type KubeSystemBackup struct {
+	TestCase
+	scratchNamespace string
+	// samples records the UID and resource version of the configmaps in kube-system before restore
+	samples map[string]metav1.ObjectMeta
+}
+
+const kubeSystemNamespace = "kube-system"
+
+// the configmaps of kube-system in the kind cluster which are not changed by the system components
+var kubeSystemSampleConfigMaps = []string{"coredns", "kube-proxy", "kubeadm-config", "kubelet-config"}
+
+var KubeSystemBackupTest func() = TestFunc(&KubeSystemBackup{})
+
+func (k *KubeSystemBackup) Init() error {
+	k.VeleroCfg = VeleroCfg
+	k.Client = *k.VeleroCfg.ClientToInstallVelero
+	// NSBaseName is the prefix of the namespaces cleaned by the test, it must not match kube-system
+	k.NSBaseName = "kube-system-scratch-"
+	k.samples = map[string]metav1.ObjectMeta{}
+	k.TestMsg = &TestMSG{
+		Desc:      "Backup kube-system and restore it into a scratch namespace",
+		FailedMSG: "Failed to backup and restore kube-system by namespace mapping",
+		Text:      "Should restore kube-system into the mapped namespace without touching the live kube-system",
+	}
+	return nil
+}
+
+func (k *KubeSystemBackup) StartRun() error {
+	if k.VeleroCfg.CloudProvider != "kind" {
+		Skip(fmt.Sprintf("Backup of kube-system is only tested on kind cluster, skip it on %s", k.VeleroCfg.CloudProvider))
+	}
+	k.scratchNamespace = k.NSBaseName + UUIDgen.String()
+	k.BackupName = "backup-kube-system-" + UUIDgen.String()
+	k.RestoreName = "restore-kube-system-" + UUIDgen.String()
+	k.BackupArgs = []string{
+		"create", "--namespace", k.VeleroCfg.VeleroNamespace, "backup", k.BackupName,
+		"--include-namespaces", kubeSystemNamespace, "--snapshot-volumes=false", "--wait",
+	}
+	k.RestoreArgs = []string{
+		"create", "--namespace", k.VeleroCfg.VeleroNamespace, "restore", k.RestoreName,
+		"--from-backup", k.BackupName,
+		"--namespace-mappings", kubeSystemNamespace + ":" + k.scratchNamespace,
+		"--exclude-resources", "pods,replicasets,deployments,daemonsets,statefulsets,jobs,cronjobs",
+		"--wait",
+	}
+	return nil
+}
+
+func (k *KubeSystemBackup) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Record the sample configmaps in namespace %s", kubeSystemNamespace), func() {
+		for _, name := range kubeSystemSampleConfigMaps {
+			cm, err := k.Client.ClientGo.CoreV1().ConfigMaps(kubeSystemNamespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				fmt.Printf("Skip sample configmap %s: %v\n", name, err)
+				continue
+			}
+			k.samples[name] = cm.ObjectMeta
+		}
+		Expect(k.samples).NotTo(BeEmpty(), fmt.Sprintf("No sample configmap found in namespace %s", kubeSystemNamespace))
+	})
+	return nil
+}
+
+func (k *KubeSystemBackup) Backup() error {
+	if err := k.GetTestCase().Backup(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Record the kinds of resources in backup %s", k.BackupName), func() {
+		contents, err := GetBackupContents(ctx, k.VeleroCfg.VeleroCLI, k.VeleroCfg.VeleroNamespace, k.BackupName)
+		Expect(err).To(Succeed())
+		kinds := map[string]int{}
+		for _, c := range contents {
+			kinds[strings.SplitN(c, ":", 2)[0]]++
+		}
+		var summary []string
+		for kind, count := range kinds {
+			summary = append(summary, fmt.Sprintf("%s(%d)", kind, count))
+		}
+		sort.Strings(summary)
+		fmt.Printf("Kinds of resources in backup %s: %s\n", k.BackupName, strings.Join(summary, ", "))
+		Expect(kinds).To(HaveKey("v1/ConfigMap"))
+	})
+	return nil
+}
+
+// Destroy keeps kube-system as it is, the backup is restored into the scratch namespace
+func (k *KubeSystemBackup) Destroy() error {
+	return nil
+}
+
+func (k *KubeSystemBackup) Restore() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Restore %s into namespace %s", kubeSystemNamespace, k.scratchNamespace), func() {
+		Expect(VeleroCmdExec(ctx, k.VeleroCfg.VeleroCLI, k.RestoreArgs)).To(Succeed())
+		restore, err := GetRestoreObject(ctx, k.VeleroCfg.VeleroCLI, k.VeleroCfg.VeleroNamespace, k.RestoreName)
+		Expect(err).To(Succeed())
+		// some system objects may fail to be restored into another namespace, only the completion
+		// of the restore is required here
+		fmt.Printf("Restore %s is %s with %d warnings and %d errors\n", k.RestoreName, restore.Status.Phase,
+			restore.Status.Warnings, restore.Status.Errors)
+		Expect(restore.Status.Phase).To(BeElementOf(velerov1api.RestorePhaseCompleted, velerov1api.RestorePhasePartiallyFailed), func() string {
+			RunDebug(context.Background(), k.VeleroCfg.VeleroCLI, k.VeleroCfg.VeleroNamespace, "", k.RestoreName)
+			return fmt.Sprintf("Unexpected phase of restore %s", k.RestoreName)
+		})
+	})
+	return nil
+}
+
+func (k *KubeSystemBackup) Verify() error {
+	By(fmt.Sprintf("Sample configmaps should be restored into namespace %s", k.scratchNamespace), func() {
+		for name := range k.samples {
+			_, err := GetConfigmap(k.Client.ClientGo, k.scratchNamespace, name)
+			Expect(err).To(Succeed(), fmt.Sprintf("Configmap %s is not restored into namespace %s", name, k.scratchNamespace))
+		}
+	})
+	By(fmt.Sprintf("Sample configmaps in namespace %s should not be touched", kubeSystemNamespace), func() {
+		for name, meta := range k.samples {
+			cm, err := GetConfigmap(k.Client.ClientGo, kubeSystemNamespace, name)
+			Expect(err).To(Succeed())
+			Expect(cm.UID).To(Equal(meta.UID), fmt.Sprintf("Configmap %s in %s is recreated", name, kubeSystemNamespace))
+			Expect(cm.ResourceVersion).To(Equal(meta.ResourceVersion), fmt.Sprintf("Configmap %s in %s is modified", name, kubeSystemNamespace))
+		}
+	})
+	return nil
+}
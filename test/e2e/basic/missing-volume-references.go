@@ -0,0 +1,219 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	missingConfigMapName = "missing-configmap"
+	missingSecretName    = "missing-secret"
+	missingRefsDataFile  = "test-data.txt"
+)
+
+// MissingVolumeReferences backs up and restores a deployment mounting a ConfigMap and a Secret
+// which don't exist.
+// The optional references are valid, so the backup and restore should not complain about them and
+// the pod should start with the data of its PVC restored by fs-backup.
+// The non-optional references keep the pod pending, the restore only creates the resources and
+// doesn't check the pods, so the pod should be still pending after the restore completes rather
+// than being reported as started. The volume is not backed up by fs-backup in this case as the
+// restore of fs-backup waits for the pod to start.
+type MissingVolumeReferences struct {
+	TestCase
+	optional       bool
+	namespace      string
+	deploymentName string
+	volume         string
+}
+
+var OptionalMissingVolumeReferencesTest func() = TestFunc(&MissingVolumeReferences{optional: true})
+var MissingVolumeReferencesTest func() = TestFunc(&MissingVolumeReferences{optional: false})
+
+func (m *MissingVolumeReferences) Init() error {
+	m.VeleroCfg = VeleroCfg
+	m.Client = *m.VeleroCfg.ClientToInstallVelero
+	m.VeleroCfg.UseVolumeSnapshots = false
+	m.VeleroCfg.UseNodeAgent = m.optional
+	m.deploymentName = "deploy-missing-refs"
+	m.volume = "volume-missing-refs"
+	if m.optional {
+		m.NSBaseName = "optional-missing-refs-"
+		m.TestMsg = &TestMSG{
+			Desc:      "Backup and restore workload referencing optional ConfigMap and Secret which don't exist",
+			FailedMSG: "Failed to backup and restore workload referencing optional ConfigMap and Secret which don't exist",
+			Text:      "Should restore the workload without errors or warnings about the missing optional references",
+		}
+	} else {
+		m.NSBaseName = "missing-refs-"
+		m.TestMsg = &TestMSG{
+			Desc:      "Backup and restore workload referencing non-optional ConfigMap and Secret which don't exist",
+			FailedMSG: "Failed to backup and restore workload referencing non-optional ConfigMap and Secret which don't exist",
+			Text:      "Should keep the restored pod pending as the workload referencing non-optional ConfigMap and Secret which don't exist",
+		}
+	}
+	m.namespace = m.NSBaseName + UUIDgen.String()
+	return nil
+}
+
+func (m *MissingVolumeReferences) StartRun() error {
+	m.BackupName = "backup-" + m.NSBaseName + UUIDgen.String()
+	m.RestoreName = "restore-" + m.NSBaseName + UUIDgen.String()
+	m.BackupArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "backup", m.BackupName,
+		"--include-namespaces", m.namespace, "--snapshot-volumes=false", "--wait",
+	}
+	if m.optional {
+		m.BackupArgs = append(m.BackupArgs, "--default-volumes-to-fs-backup")
+	}
+	m.RestoreArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "restore", m.RestoreName,
+		"--from-backup", m.BackupName, "--wait",
+	}
+	return nil
+}
+
+func (m *MissingVolumeReferences) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s", m.namespace), func() {
+		Expect(CreateNamespace(ctx, m.Client, m.namespace)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", m.namespace))
+	})
+	By(fmt.Sprintf("Create deployment %s referencing ConfigMap %s and Secret %s which don't exist", m.deploymentName,
+		missingConfigMapName, missingSecretName), func() {
+		optional := m.optional
+		vols := []*v1.Volume{
+			{
+				Name: missingConfigMapName,
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{
+						LocalObjectReference: v1.LocalObjectReference{Name: missingConfigMapName},
+						Optional:             &optional,
+					},
+				},
+			},
+			{
+				Name: missingSecretName,
+				VolumeSource: v1.VolumeSource{
+					Secret: &v1.SecretVolumeSource{
+						SecretName: missingSecretName,
+						Items:      []v1.KeyToPath{{Key: "password", Path: "password"}},
+						Optional:   &optional,
+					},
+				},
+			},
+		}
+		if m.optional {
+			pvcVols := PrepareVolumeList([]string{m.volume})
+			_, err := CreatePVC(m.Client, m.namespace, pvcVols[0].PersistentVolumeClaim.ClaimName, "", nil)
+			Expect(err).To(Succeed())
+			vols = append(vols, pvcVols...)
+		}
+		deployment := NewDeployment(m.deploymentName, m.namespace, 1, map[string]string{"app": m.deploymentName}, nil).
+			WithVolume(vols).Result()
+		_, err := CreateDeployment(m.Client.ClientGo, m.namespace, deployment)
+		Expect(err).To(Succeed())
+	})
+	if m.optional {
+		By(fmt.Sprintf("Write data into volume %s", m.volume), func() {
+			Expect(WaitForReadyDeployment(m.Client.ClientGo, m.namespace, m.deploymentName)).To(Succeed())
+			Expect(WriteFileToPod(ctx, m.namespace, m.getPod(ctx).Name, "container-busybox",
+				fmt.Sprintf("/%s/%s", m.volume, missingRefsDataFile), m.fileContent())).To(Succeed())
+		})
+	} else {
+		By(fmt.Sprintf("Pod of deployment %s should be pending", m.deploymentName), func() {
+			m.podShouldBePending(ctx)
+		})
+	}
+	return nil
+}
+
+func (m *MissingVolumeReferences) Backup() error {
+	if err := m.TestCase.Backup(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Backup %s should not complain about the missing references", m.BackupName), func() {
+		backup, err := GetBackupObject(ctx, m.VeleroCfg.VeleroCLI, m.VeleroCfg.VeleroNamespace, m.BackupName)
+		Expect(err).To(Succeed())
+		Expect(backup.Status.Phase).To(Equal(velerov1api.BackupPhaseCompleted))
+		Expect(backup.Status.Errors).To(Equal(0), fmt.Sprintf("Backup %s should have no errors", m.BackupName))
+		Expect(backup.Status.Warnings).To(Equal(0), fmt.Sprintf("Backup %s should have no warnings", m.BackupName))
+	})
+	return nil
+}
+
+func (m *MissingVolumeReferences) Restore() error {
+	if err := m.TestCase.Restore(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Restore %s should not complain about the missing references", m.RestoreName), func() {
+		restore, err := GetRestoreObject(ctx, m.VeleroCfg.VeleroCLI, m.VeleroCfg.VeleroNamespace, m.RestoreName)
+		Expect(err).To(Succeed())
+		Expect(restore.Status.Errors).To(Equal(0), fmt.Sprintf("Restore %s should have no errors", m.RestoreName))
+		// the restore may warn about the resources existing in cluster, such as the default service
+		// account, so only the warnings about the missing references are checked
+		output, err := VeleroRestoreDescribe(ctx, m.VeleroCfg.VeleroCLI, m.VeleroCfg.VeleroNamespace, m.RestoreName, true)
+		Expect(err).To(Succeed())
+		Expect(output).NotTo(ContainSubstring(missingConfigMapName))
+		Expect(output).NotTo(ContainSubstring(missingSecretName))
+	})
+	return nil
+}
+
+func (m *MissingVolumeReferences) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	if !m.optional {
+		By(fmt.Sprintf("Restored pod of deployment %s should be still pending", m.deploymentName), func() {
+			m.podShouldBePending(ctx)
+		})
+		return nil
+	}
+	By(fmt.Sprintf("Deployment %s should be ready with the data of volume %s restored", m.deploymentName, m.volume), func() {
+		Expect(WaitForReadyDeployment(m.Client.ClientGo, m.namespace, m.deploymentName)).To(Succeed())
+		content, err := ReadFileFromPod(ctx, m.namespace, m.getPod(ctx).Name, "container-busybox",
+			fmt.Sprintf("/%s/%s", m.volume, missingRefsDataFile))
+		Expect(err).To(Succeed())
+		Expect(strings.TrimSpace(content)).To(Equal(m.fileContent()))
+	})
+	return nil
+}
+
+func (m *MissingVolumeReferences) fileContent() string {
+	return fmt.Sprintf("ns-%s volume-%s", m.namespace, m.volume)
+}
+
+func (m *MissingVolumeReferences) getPod(ctx context.Context) *v1.Pod {
+	pods, err := ListPods(ctx, m.Client, m.namespace)
+	Expect(err).To(Succeed())
+	Expect(len(pods.Items)).To(Equal(1), fmt.Sprintf("Only 1 pod should be found in namespace %s", m.namespace))
+	return &pods.Items[0]
+}
+
+// podShouldBePending checks the pod keeps pending for a while as the volumes can't be mounted
+func (m *MissingVolumeReferences) podShouldBePending(ctx context.Context) {
+	Eventually(func() int {
+		pods, err := ListPods(ctx, m.Client, m.namespace)
+		Expect(err).To(Succeed())
+		return len(pods.Items)
+	}, 5*time.Minute, 5*time.Second).Should(Equal(1), fmt.Sprintf("Pod of deployment %s should be created", m.deploymentName))
+	Consistently(func() v1.PodPhase {
+		return m.getPod(ctx).Status.Phase
+	}, time.Minute, 5*time.Second).Should(Equal(v1.PodPending), "Pod referencing non-optional missing volumes should be pending")
+}
@@ -0,0 +1,265 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	mixedScopeCRDYaml  = "testdata/mixed-scope-crds/crds.yaml"
+	mixedScopeGroup    = "mixed-scope.e2e.velero.io"
+	mixedScopeCRCount  = 2
+	mixedScopeBaseName = "mixed-scope-"
+)
+
+var (
+	widgetGVR        = schema.GroupVersionResource{Group: mixedScopeGroup, Version: "v1", Resource: "widgets"}
+	clusterWidgetGVR = schema.GroupVersionResource{Group: mixedScopeGroup, Version: "v1", Resource: "clusterwidgets"}
+)
+
+// MixedScopeCustomResources creates the instances of a namespaced CRD and a cluster scoped CRD of the
+// same API group, and backs up the group with the wildcard include "*.<group>" in one of the namespaces.
+// The include is matched against "<resource>.<group>", the "<group>/*" form isn't resolved by Velero.
+// With the namespace filter the cluster scoped instances are skipped unless the cluster resources
+// are included explicitly, so the backup with and without --include-cluster-resources and the restores
+// of them should capture exactly the namespaced instances of the included namespace plus the cluster
+// scoped instances in the latter.
+type MixedScopeCustomResources struct {
+	TestCase
+	includedNamespace    string
+	excludedNamespace    string
+	clusterWidgets       []string
+	namespacedBackupName string
+	namespacedRestore    string
+}
+
+var MixedScopeCustomResourcesTest func() = TestFunc(&MixedScopeCustomResources{})
+
+func (m *MixedScopeCustomResources) Init() error {
+	m.VeleroCfg = VeleroCfg
+	m.Client = *m.VeleroCfg.ClientToInstallVelero
+	m.VeleroCfg.UseVolumeSnapshots = false
+	m.NSBaseName = mixedScopeBaseName
+	m.includedNamespace = m.NSBaseName + "included-" + UUIDgen.String()
+	m.excludedNamespace = m.NSBaseName + "excluded-" + UUIDgen.String()
+	m.TestMsg = &TestMSG{
+		Desc:      "Back up and restore namespaced and cluster scoped custom resources of one API group with wildcard includes",
+		FailedMSG: "Failed to back up and restore mixed-scope custom resources with wildcard includes",
+		Text:      fmt.Sprintf("Should capture exactly the expected instances per scope when including \"*.%s\"", mixedScopeGroup),
+	}
+	return nil
+}
+
+func (m *MixedScopeCustomResources) StartRun() error {
+	m.BackupName = "backup-" + m.NSBaseName + UUIDgen.String()
+	m.RestoreName = "restore-" + m.NSBaseName + UUIDgen.String()
+	m.namespacedBackupName = "backup-namespaced-" + m.NSBaseName + UUIDgen.String()
+	m.namespacedRestore = "restore-namespaced-" + m.NSBaseName + UUIDgen.String()
+	m.BackupArgs = []string{
+		"create", "--namespace", m.VeleroCfg.VeleroNamespace, "backup", m.BackupName,
+		"--include-resources", "*." + mixedScopeGroup, "--include-namespaces", m.includedNamespace,
+		"--include-cluster-resources=true", "--wait",
+	}
+	m.RestoreArgs = []string{
+		"create", "--namespace", m.VeleroCfg.VeleroNamespace, "restore", m.RestoreName,
+		"--from-backup", m.BackupName, "--wait",
+	}
+	for i := 0; i < mixedScopeCRCount; i++ {
+		m.clusterWidgets = append(m.clusterWidgets, fmt.Sprintf("cluster-widget-%d-%s", i, UUIDgen.String()))
+	}
+	return nil
+}
+
+func (m *MixedScopeCustomResources) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Install the namespaced and cluster scoped CRDs of group %s", mixedScopeGroup), func() {
+		Expect(InstallCRD(ctx, mixedScopeCRDYaml)).To(Succeed())
+		Expect(WaitForCRDEstablished(widgetGVR.GroupResource().String())).To(Succeed())
+		Expect(WaitForCRDEstablished(clusterWidgetGVR.GroupResource().String())).To(Succeed())
+	})
+	By(fmt.Sprintf("Create widgets in namespaces %s and %s", m.includedNamespace, m.excludedNamespace), func() {
+		for _, ns := range []string{m.includedNamespace, m.excludedNamespace} {
+			Expect(CreateNamespace(ctx, m.Client, ns)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", ns))
+			for i := 0; i < mixedScopeCRCount; i++ {
+				_, err := CreateCustomResource(m.Client, widgetGVR, ns, newWidget(widgetGVR, "Widget", ns, fmt.Sprintf("widget-%d", i)))
+				Expect(err).To(Succeed())
+			}
+		}
+	})
+	By(fmt.Sprintf("Create cluster widgets %s", m.clusterWidgets), func() {
+		for _, name := range m.clusterWidgets {
+			_, err := CreateCustomResource(m.Client, clusterWidgetGVR, "", newWidget(clusterWidgetGVR, "ClusterWidget", "", name))
+			Expect(err).To(Succeed())
+		}
+	})
+	return nil
+}
+
+func (m *MixedScopeCustomResources) Backup() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Back up \"*.%s\" in namespace %s without cluster resources", mixedScopeGroup, m.includedNamespace), func() {
+		args := []string{
+			"create", "--namespace", m.VeleroCfg.VeleroNamespace, "backup", m.namespacedBackupName,
+			"--include-resources", "*." + mixedScopeGroup, "--include-namespaces", m.includedNamespace, "--wait",
+		}
+		Expect(VeleroBackupExec(ctx, m.VeleroCfg.VeleroCLI, m.VeleroCfg.VeleroNamespace, m.namespacedBackupName, args)).To(Succeed(), func() string {
+			RunDebug(context.Background(), m.VeleroCfg.VeleroCLI, m.VeleroCfg.VeleroNamespace, m.namespacedBackupName, "")
+			return "Fail to backup workload"
+		})
+	})
+	By(fmt.Sprintf("Backup %s should include only the widgets in namespace %s", m.namespacedBackupName, m.includedNamespace), func() {
+		Expect(m.groupContentsOf(ctx, m.namespacedBackupName)).To(ConsistOf(m.expectedContents(false)))
+	})
+
+	By(fmt.Sprintf("Back up \"*.%s\" in namespace %s with cluster resources", mixedScopeGroup, m.includedNamespace), func() {
+		Expect(m.TestCase.Backup()).To(Succeed())
+	})
+	By(fmt.Sprintf("Backup %s should include the widgets in namespace %s and all cluster widgets", m.BackupName, m.includedNamespace), func() {
+		Expect(m.groupContentsOf(ctx, m.BackupName)).To(ConsistOf(m.expectedContents(true)))
+	})
+	return nil
+}
+
+func (m *MixedScopeCustomResources) Destroy() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Delete namespace %s and the cluster widgets", m.includedNamespace), func() {
+		Expect(DeleteNamespace(ctx, m.Client, m.includedNamespace, true)).To(Succeed())
+		for _, name := range m.clusterWidgets {
+			Expect(DeleteCustomResource(m.Client, clusterWidgetGVR, "", name)).To(Succeed())
+		}
+	})
+	return nil
+}
+
+func (m *MixedScopeCustomResources) Restore() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Restore from backup %s without cluster resources", m.namespacedBackupName), func() {
+		args := []string{
+			"create", "--namespace", m.VeleroCfg.VeleroNamespace, "restore", m.namespacedRestore,
+			"--from-backup", m.namespacedBackupName, "--wait",
+		}
+		Expect(VeleroRestoreExec(ctx, m.VeleroCfg.VeleroCLI, m.VeleroCfg.VeleroNamespace, m.namespacedRestore, args,
+			velerov1api.RestorePhaseCompleted)).To(Succeed(), func() string {
+			RunDebug(context.Background(), m.VeleroCfg.VeleroCLI, m.VeleroCfg.VeleroNamespace, "", m.namespacedRestore)
+			return "Fail to restore workload"
+		})
+	})
+	By(fmt.Sprintf("Only the widgets in namespace %s should be restored by %s", m.includedNamespace, m.namespacedRestore), func() {
+		Expect(m.widgetsShouldBeRestored(m.namespacedBackupName, m.namespacedRestore)).To(Succeed())
+		for _, name := range m.clusterWidgets {
+			_, err := GetCustomResource(m.Client, clusterWidgetGVR, "", name)
+			Expect(apierrors.IsNotFound(errors.Cause(err))).To(BeTrue(), fmt.Sprintf("Cluster widget %s should not be restored, err: %v", name, err))
+		}
+	})
+	return m.TestCase.Restore()
+}
+
+func (m *MixedScopeCustomResources) Verify() error {
+	By(fmt.Sprintf("Cluster widgets should be restored by %s", m.RestoreName), func() {
+		for _, name := range m.clusterWidgets {
+			cr, err := GetCustomResource(m.Client, clusterWidgetGVR, "", name)
+			Expect(err).To(Succeed())
+			Expect(RestoreLabelsShouldBe(cr, m.BackupName, m.RestoreName)).To(Succeed())
+		}
+	})
+	By(fmt.Sprintf("Widgets in namespace %s should be kept as restored by %s", m.includedNamespace, m.namespacedRestore), func() {
+		Expect(m.widgetsShouldBeRestored(m.namespacedBackupName, m.namespacedRestore)).To(Succeed())
+	})
+	By(fmt.Sprintf("Widgets in namespace %s should not be touched by the restores", m.excludedNamespace), func() {
+		for i := 0; i < mixedScopeCRCount; i++ {
+			cr, err := GetCustomResource(m.Client, widgetGVR, m.excludedNamespace, fmt.Sprintf("widget-%d", i))
+			Expect(err).To(Succeed())
+			Expect(cr.GetLabels()).NotTo(HaveKey(velerov1api.RestoreNameLabel))
+		}
+	})
+	return nil
+}
+
+func (m *MixedScopeCustomResources) Clean() error {
+	if !m.VeleroCfg.Debug {
+		// the CRDs and the cluster widgets are cluster scoped, so they're deleted even the test fails
+		// to not affect the other tests
+		By(fmt.Sprintf("Delete the CRDs of group %s", mixedScopeGroup), func() {
+			if err := DeleteCRD(context.Background(), mixedScopeCRDYaml); err != nil {
+				fmt.Printf("Failed to delete the CRDs of group %s: %v\n", mixedScopeGroup, err)
+			}
+		})
+	}
+	return m.TestCase.Clean()
+}
+
+// groupContentsOf returns the keys of the resources of the mixed-scope group in the backup
+func (m *MixedScopeCustomResources) groupContentsOf(ctx context.Context, backupName string) ([]string, error) {
+	contents, err := GetBackupContents(ctx, m.VeleroCfg.VeleroCLI, m.VeleroCfg.VeleroNamespace, backupName)
+	if err != nil {
+		return nil, err
+	}
+	var groupContents []string
+	for _, c := range contents {
+		if strings.HasPrefix(c, mixedScopeGroup+"/") {
+			groupContents = append(groupContents, c)
+		}
+	}
+	return groupContents, nil
+}
+
+func (m *MixedScopeCustomResources) expectedContents(clusterResources bool) []string {
+	var expected []string
+	for i := 0; i < mixedScopeCRCount; i++ {
+		expected = append(expected, fmt.Sprintf("%s/Widget:%s/widget-%d", widgetGVR.GroupVersion(), m.includedNamespace, i))
+	}
+	if clusterResources {
+		for _, name := range m.clusterWidgets {
+			expected = append(expected, fmt.Sprintf("%s/ClusterWidget:%s", clusterWidgetGVR.GroupVersion(), name))
+		}
+	}
+	return expected
+}
+
+func (m *MixedScopeCustomResources) widgetsShouldBeRestored(backupName, restoreName string) error {
+	for i := 0; i < mixedScopeCRCount; i++ {
+		name := fmt.Sprintf("widget-%d", i)
+		cr, err := GetCustomResource(m.Client, widgetGVR, m.includedNamespace, name)
+		if err != nil {
+			return err
+		}
+		if err := RestoreLabelsShouldBe(cr, backupName, restoreName); err != nil {
+			return errors.Wrapf(err, "unexpected restore labels of widget %s/%s", m.includedNamespace, name)
+		}
+	}
+	return nil
+}
+
+func newWidget(gvr schema.GroupVersionResource, kind, ns, name string) *unstructured.Unstructured {
+	metadata := map[string]interface{}{"name": name}
+	if ns != "" {
+		metadata["namespace"] = ns
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": gvr.GroupVersion().String(),
+		"kind":       kind,
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"size": "small",
+		},
+	}}
+}
@@ -0,0 +1,167 @@
+package basic
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	tenantVeleroNamespace = "velero-tenant"
+	multiInstancePod      = "pod-multi-instance"
+	multiInstanceVolume   = "volume-multi-instance"
+	multiInstanceFile     = "file-multi-instance"
+)
+
+// veleroInstance is one of the Velero installations in the cluster with the namespace it backs up
+type veleroInstance struct {
+	cfg         VeleroConfig
+	workloadNS  string
+	backupName  string
+	restoreName string
+}
+
+// MultipleVeleroInstancesTest installs a second Velero into another namespace with its own backup storage
+// location, backs up a different namespace by each instance and checks each backup and its pod volume backups
+// are only processed by the instance it belongs to, then uninstalls the second instance and checks the first
+// one still backs up and restores
+func MultipleVeleroInstancesTest() {
+	var platform, tenant *veleroInstance
+
+	BeforeEach(func() {
+		if !VeleroCfg.InstallVelero {
+			Skip("Velero is required to be installed by the test to install the second instance")
+		}
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+
+		platform = &veleroInstance{cfg: VeleroCfg, workloadNS: "multi-instance-platform"}
+		tenant = &veleroInstance{cfg: VeleroCfg, workloadNS: "multi-instance-tenant"}
+		// the tenant stores its backups under a prefix of its own, otherwise the backups of each instance
+		// are synced into the other one
+		tenant.cfg.VeleroNamespace = tenantVeleroNamespace
+		tenant.cfg.BSLPrefix = strings.Trim(VeleroCfg.BSLPrefix+"/"+tenantVeleroNamespace, "/")
+		for _, instance := range []*veleroInstance{platform, tenant} {
+			instance.cfg.UseVolumeSnapshots = false
+			instance.cfg.UseNodeAgent = true
+			instance.backupName = "backup-" + instance.workloadNS + "-" + UUIDgen.String()
+			instance.restoreName = "restore-" + instance.workloadNS + "-" + UUIDgen.String()
+			Expect(VeleroInstall(context.Background(), &instance.cfg)).To(Succeed(),
+				fmt.Sprintf("Failed to install Velero into namespace %s", instance.cfg.VeleroNamespace))
+		}
+	})
+
+	AfterEach(func() {
+		if !VeleroCfg.Debug {
+			client := *VeleroCfg.ClientToInstallVelero
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), client)
+			})
+			for _, instance := range []*veleroInstance{platform, tenant} {
+				By(fmt.Sprintf("Delete sample workload namespace %s", instance.workloadNS), func() {
+					DeleteNamespace(context.Background(), client, instance.workloadNS, true)
+				})
+			}
+			// the tenant is uninstalled without the CRDs shared with the platform, which are removed by
+			// uninstalling the platform at last
+			By(fmt.Sprintf("Uninstall Velero in namespace %s", tenantVeleroNamespace), func() {
+				Expect(VeleroUninstallInstance(context.Background(), client, tenantVeleroNamespace)).To(Succeed())
+			})
+			By(fmt.Sprintf("Uninstall Velero in namespace %s", VeleroCfg.VeleroNamespace), func() {
+				Expect(VeleroUninstall(context.Background(), VeleroCfg.VeleroCLI, VeleroCfg.VeleroNamespace)).To(Succeed())
+			})
+		}
+	})
+
+	It("Velero installations in different namespaces should only process their own backups", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *VeleroCfg.ClientToInstallVelero
+
+		for _, instance := range []*veleroInstance{platform, tenant} {
+			By(fmt.Sprintf("Deploy pod %s with a volume in namespace %s", multiInstancePod, instance.workloadNS), func() {
+				Expect(CreateNamespace(ctx, client, instance.workloadNS)).To(Succeed())
+				_, err := CreatePod(client, instance.workloadNS, multiInstancePod, "", "", []string{multiInstanceVolume}, nil, nil)
+				Expect(err).To(Succeed())
+				Expect(WaitForPods(ctx, client, instance.workloadNS, []string{multiInstancePod})).To(Succeed())
+				Expect(CreateFileToPod(ctx, instance.workloadNS, multiInstancePod, multiInstancePod, multiInstanceVolume,
+					multiInstanceFile, instance.workloadNS)).To(Succeed())
+			})
+		}
+
+		for _, instance := range []*veleroInstance{platform, tenant} {
+			By(fmt.Sprintf("Back up namespace %s by Velero in namespace %s", instance.workloadNS, instance.cfg.VeleroNamespace), func() {
+				Expect(VeleroBackupNamespace(ctx, instance.cfg.VeleroCLI, instance.cfg.VeleroNamespace, BackupConfig{
+					BackupName:               instance.backupName,
+					Namespace:                instance.workloadNS,
+					DefaultVolumesToFsBackup: true,
+				})).To(Succeed(), func() string {
+					RunDebugWithNodeAgent(context.Background(), instance.cfg.VeleroCLI, instance.cfg.VeleroNamespace, instance.backupName, "")
+					return "Fail to backup workload"
+				})
+			})
+		}
+
+		for _, pair := range [][2]*veleroInstance{{platform, tenant}, {tenant, platform}} {
+			owner, other := pair[0], pair[1]
+			By(fmt.Sprintf("Backup %s should only be processed by Velero in namespace %s", owner.backupName, owner.cfg.VeleroNamespace), func() {
+				logs, err := GetVeleroServerLogs(ctx, owner.cfg.VeleroNamespace)
+				Expect(err).To(Succeed())
+				Expect(logs).To(ContainSubstring(owner.backupName))
+				logs, err = GetVeleroServerLogs(ctx, other.cfg.VeleroNamespace)
+				Expect(err).To(Succeed())
+				Expect(logs).NotTo(ContainSubstring(owner.backupName),
+					fmt.Sprintf("Backup %s is processed by Velero in namespace %s", owner.backupName, other.cfg.VeleroNamespace))
+			})
+			By(fmt.Sprintf("Pod volume backups of backup %s should only be claimed by node-agent in namespace %s", owner.backupName, owner.cfg.VeleroNamespace), func() {
+				pvbs, err := GetPVB(ctx, owner.cfg.VeleroNamespace, owner.backupName)
+				Expect(err).To(Succeed())
+				Expect(len(pvbs)).To(Equal(1), fmt.Sprintf("Unexpected PVB %v", pvbs))
+				pvbs, err = GetPVB(ctx, other.cfg.VeleroNamespace, owner.backupName)
+				Expect(err).To(Succeed())
+				Expect(len(pvbs)).To(Equal(0), fmt.Sprintf("Unexpected PVB %v in namespace %s", pvbs, other.cfg.VeleroNamespace))
+				logs, err := GetNodeAgentLogs(ctx, other.cfg.VeleroNamespace)
+				Expect(err).To(Succeed())
+				Expect(logs).NotTo(ContainSubstring(owner.backupName),
+					fmt.Sprintf("Pod volume backup of backup %s is claimed by node-agent in namespace %s", owner.backupName, other.cfg.VeleroNamespace))
+			})
+		}
+
+		By(fmt.Sprintf("Uninstall Velero in namespace %s", tenantVeleroNamespace), func() {
+			Expect(VeleroUninstallInstance(ctx, client, tenantVeleroNamespace)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Velero in namespace %s should still back up and restore", platform.cfg.VeleroNamespace), func() {
+			backupName := "backup-after-uninstall-" + UUIDgen.String()
+			Expect(VeleroBackupNamespace(ctx, platform.cfg.VeleroCLI, platform.cfg.VeleroNamespace, BackupConfig{
+				BackupName:               backupName,
+				Namespace:                platform.workloadNS,
+				DefaultVolumesToFsBackup: true,
+			})).To(Succeed(), func() string {
+				RunDebugWithNodeAgent(context.Background(), platform.cfg.VeleroCLI, platform.cfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+			Expect(DeleteNamespace(ctx, client, platform.workloadNS, true)).To(Succeed())
+			Expect(VeleroRestore(ctx, platform.cfg.VeleroCLI, platform.cfg.VeleroNamespace, platform.restoreName, backupName, "")).To(Succeed(), func() string {
+				RunDebugWithNodeAgent(context.Background(), platform.cfg.VeleroCLI, platform.cfg.VeleroNamespace, "", platform.restoreName)
+				return "Fail to restore workload"
+			})
+			Expect(WaitForPods(ctx, client, platform.workloadNS, []string{multiInstancePod})).To(Succeed())
+			content, err := ReadFileFromPodVolume(ctx, platform.workloadNS, multiInstancePod, multiInstancePod, multiInstanceVolume, multiInstanceFile)
+			Expect(err).To(Succeed())
+			Expect(content).To(ContainSubstring(platform.workloadNS), "Restored data is not the same as the original")
+		})
+	})
+}
@@ -0,0 +1,126 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+)
+
+// NamespaceMappingKeepSource restores the namespace with the volume data into a new namespace by
+// namespace mapping while the original namespace still exists, and checks the data is restored
+// into a new volume without touching the original namespace and its volume
+type NamespaceMappingKeepSource struct {
+	TestCase
+	namespace       string
+	mappedNamespace string
+	pod             string
+	volume          string
+	podUID          types.UID
+	pvName          string
+}
+
+const namespaceMappingFileName = "test-data.txt"
+
+var NamespaceMappingKeepSourceTest func() = TestFunc(&NamespaceMappingKeepSource{})
+
+func (n *NamespaceMappingKeepSource) Init() error {
+	n.VeleroCfg = VeleroCfg
+	n.Client = *n.VeleroCfg.ClientToInstallVelero
+	n.VeleroCfg.UseNodeAgent = true
+	n.NSBaseName = "ns-mp-keep-src-"
+	n.pod = "pod-ns-mapping"
+	n.volume = "volume-ns-mapping"
+	n.TestMsg = &TestMSG{
+		Desc:      "Restore namespace with volume by namespace mapping while the original namespace exists",
+		FailedMSG: "Failed to restore namespace with volume by namespace mapping",
+		Text:      "Should restore the volume data into the mapped namespace with a new volume and keep the original namespace untouched",
+	}
+	return nil
+}
+
+func (n *NamespaceMappingKeepSource) StartRun() error {
+	n.namespace = n.NSBaseName + UUIDgen.String()
+	n.mappedNamespace = n.namespace + "-mapped"
+	n.BackupName = "backup-" + n.namespace
+	n.RestoreName = "restore-" + n.namespace
+	n.BackupArgs = []string{
+		"create", "--namespace", n.VeleroCfg.VeleroNamespace, "backup", n.BackupName,
+		"--include-namespaces", n.namespace, "--default-volumes-to-fs-backup",
+		"--snapshot-volumes=false", "--wait",
+	}
+	n.RestoreArgs = []string{
+		"create", "--namespace", n.VeleroCfg.VeleroNamespace, "restore", n.RestoreName,
+		"--from-backup", n.BackupName, "--namespace-mappings", n.namespace + ":" + n.mappedNamespace,
+		"--wait",
+	}
+	return nil
+}
+
+func (n *NamespaceMappingKeepSource) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s for workload", n.namespace), func() {
+		Expect(CreateNamespace(ctx, n.Client, n.namespace)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", n.namespace))
+	})
+	By(fmt.Sprintf("Deploy pod %s with volume %s and write data into it", n.pod, n.volume), func() {
+		_, err := CreatePod(n.Client, n.namespace, n.pod, "", "", []string{n.volume}, nil, nil)
+		Expect(err).To(Succeed())
+		Expect(WaitForPods(ctx, n.Client, n.namespace, []string{n.pod})).To(Succeed())
+		Expect(CreateFileToPod(ctx, n.namespace, n.pod, n.pod, n.volume,
+			namespaceMappingFileName, n.fileContent())).To(Succeed())
+
+		pod, err := GetPod(ctx, n.Client, n.namespace, n.pod)
+		Expect(err).To(Succeed())
+		n.podUID = pod.UID
+		n.pvName, err = GetPVByPodName(n.Client, n.namespace, n.pod)
+		Expect(err).To(Succeed())
+	})
+	return nil
+}
+
+// Destroy keeps the original namespace, the backup is restored into the mapped namespace
+func (n *NamespaceMappingKeepSource) Destroy() error {
+	return nil
+}
+
+func (n *NamespaceMappingKeepSource) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Data should be restored into pod %s in namespace %s", n.pod, n.mappedNamespace), func() {
+		Expect(WaitForPods(ctx, n.Client, n.mappedNamespace, []string{n.pod})).To(Succeed())
+		content, err := ReadFileFromPodVolume(ctx, n.mappedNamespace, n.pod, n.pod, n.volume, namespaceMappingFileName)
+		Expect(err).To(Succeed())
+		Expect(strings.TrimSpace(content)).To(Equal(n.fileContent()))
+	})
+	By(fmt.Sprintf("Restored PVC should be bound to a new PV other than %s", n.pvName), func() {
+		pvName, err := GetPVByPodName(n.Client, n.mappedNamespace, n.pod)
+		Expect(err).To(Succeed())
+		Expect(pvName).NotTo(Equal(n.pvName), "Restored PVC shares the PV of the original PVC")
+	})
+	By(fmt.Sprintf("Original namespace %s should be untouched", n.namespace), func() {
+		pod, err := GetPod(ctx, n.Client, n.namespace, n.pod)
+		Expect(err).To(Succeed())
+		Expect(pod.UID).To(Equal(n.podUID), fmt.Sprintf("Pod %s in the original namespace is recreated", n.pod))
+		pvName, err := GetPVByPodName(n.Client, n.namespace, n.pod)
+		Expect(err).To(Succeed())
+		Expect(pvName).To(Equal(n.pvName))
+		content, err := ReadFileFromPodVolume(ctx, n.namespace, n.pod, n.pod, n.volume, namespaceMappingFileName)
+		Expect(err).To(Succeed())
+		Expect(strings.TrimSpace(content)).To(Equal(n.fileContent()))
+	})
+	return nil
+}
+
+// fileContent is the content written by CreateFileToPod
+func (n *NamespaceMappingKeepSource) fileContent() string {
+	return fmt.Sprintf("ns-%s pod-%s volume-%s", n.namespace, n.pod, n.volume)
+}
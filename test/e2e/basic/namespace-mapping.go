@@ -92,7 +92,7 @@ func (n *NamespaceMapping) CreateResources() error {
 		By("Deploy sample workload of Kibishii", func() {
 			Expect(KibishiiPrepareBeforeBackup(ctx, n.Client, VeleroCfg.CloudProvider,
 				ns, VeleroCfg.RegistryCredentialFile, VeleroCfg.Features,
-				VeleroCfg.KibishiiDirectory, false, n.kibishiiData)).To(Succeed())
+				VeleroCfg.KibishiiDirectory, VeleroCfg.KibishiiStorageClass, false, n.kibishiiData)).To(Succeed())
 		})
 	}
 	return nil
@@ -0,0 +1,249 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// NoDefaultStorageClass restores the volumes of a StatefulSet with fs-backup while the cluster has
+// no default storage class.
+// The PVCs created when a default storage class exists always get the storage class name set by
+// the admission controller, so the default storage class is unset before the StatefulSet is deployed
+// and its PVC without storage class name is bound to a statically provisioned hostPath PV reserved
+// for it. The restored PVC is reset for dynamic provisioning, it should stay Pending without storage
+// class name with the restore waiting for the pod volume restores instead of finishing without the
+// data, and get bound and filled with the data after the default storage class is set back, which
+// depends on the retroactive default storage class assignment of Kubernetes 1.26+.
+type NoDefaultStorageClass struct {
+	TestCase
+	namespace   string
+	statefulSet string
+	volume      string
+	pvName      string
+	// defaultSCs records the annotation keys of the default storage classes unset by the case which
+	// must be set back
+	defaultSCs map[string][]string
+	// restoredSCs are the names of the default storage classes set back during the restore
+	restoredSCs []string
+}
+
+const noDefaultSCFileName = "test-data.txt"
+
+var NoDefaultStorageClassTest func() = TestFunc(&NoDefaultStorageClass{})
+
+func (n *NoDefaultStorageClass) Init() error {
+	n.VeleroCfg = VeleroCfg
+	n.Client = *n.VeleroCfg.ClientToInstallVelero
+	n.VeleroCfg.UseNodeAgent = true
+	n.NSBaseName = "no-default-sc-"
+	n.namespace = n.NSBaseName + UUIDgen.String()
+	n.statefulSet = "sts-no-default-sc"
+	n.volume = "data"
+	n.pvName = "pv-" + n.namespace
+	n.TestMsg = &TestMSG{
+		Desc:      "Restore volumes without storage class name when the cluster has no default storage class",
+		FailedMSG: "Failed to restore volumes when the cluster has no default storage class",
+		Text:      "Should keep the restore waiting until the default storage class is back and then restore the data",
+	}
+	return nil
+}
+
+func (n *NoDefaultStorageClass) StartRun() error {
+	version, err := n.Client.ClientGo.Discovery().ServerVersion()
+	Expect(err).To(Succeed())
+	minor, err := strconv.Atoi(strings.TrimSuffix(version.Minor, "+"))
+	Expect(err).To(Succeed(), fmt.Sprintf("Failed to parse the minor version %q of cluster", version.Minor))
+	if version.Major == "1" && minor < 26 {
+		Skip(fmt.Sprintf("Retroactive default storage class assignment is not supported by Kubernetes %s, skip no default storage class test", version.GitVersion))
+	}
+	n.BackupName = "backup-" + n.namespace
+	n.RestoreName = "restore-" + n.namespace
+	n.BackupArgs = []string{
+		"create", "--namespace", n.VeleroCfg.VeleroNamespace, "backup", n.BackupName,
+		"--include-namespaces", n.namespace, "--default-volumes-to-fs-backup",
+		"--snapshot-volumes=false", "--wait",
+	}
+	// the restore is not waited for, it can't be completed until the default storage class is back
+	n.RestoreArgs = []string{
+		"create", "--namespace", n.VeleroCfg.VeleroNamespace, "restore", n.RestoreName,
+		"--from-backup", n.BackupName,
+	}
+	return nil
+}
+
+func (n *NoDefaultStorageClass) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s for workload", n.namespace), func() {
+		Expect(CreateNamespace(ctx, n.Client, n.namespace)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", n.namespace))
+	})
+	By("Unset the default storage class of cluster", func() {
+		var err error
+		n.defaultSCs, err = UnsetDefaultStorageClass(ctx, n.Client)
+		Expect(err).To(Succeed())
+		if len(n.defaultSCs) == 0 {
+			Skip("No default storage class in the cluster to set back, skip no default storage class test")
+		}
+	})
+	By(fmt.Sprintf("Create hostPath PV %s without storage class for PVC %s", n.pvName, n.pvcName()), func() {
+		nodes, err := GetWorkerNodes(ctx)
+		Expect(err).To(Succeed())
+		Expect(nodes).NotTo(BeEmpty(), "No node to provision the hostPath PV")
+		_, err = CreateHostPathPersistentVolumeForClaim(n.Client, n.pvName, "/tmp/velero-e2e-"+n.pvName, nodes[0], n.namespace, n.pvcName())
+		Expect(err).To(Succeed())
+	})
+	By(fmt.Sprintf("Deploy statefulset %s with volume claim template without storage class", n.statefulSet), func() {
+		sts := NewStatefulSet(n.statefulSet, n.namespace, 1, map[string]string{"app": n.statefulSet}).
+			WithVolumeClaimTemplate(n.volume, "").Result()
+		_, err := CreateStatefulSet(n.Client.ClientGo, n.namespace, sts)
+		Expect(err).To(Succeed())
+		Expect(WaitForStatefulSetReplicas(n.Client.ClientGo, n.namespace, n.statefulSet)).To(Succeed())
+		pvc, err := GetPVC(ctx, n.Client, n.namespace, n.pvcName())
+		Expect(err).To(Succeed())
+		Expect(pvc.Spec.StorageClassName).To(BeNil(), fmt.Sprintf("PVC %s should have no storage class", n.pvcName()))
+		Expect(pvc.Spec.VolumeName).To(Equal(n.pvName))
+		Expect(CreateFileToPod(ctx, n.namespace, n.podName(), "container-busybox", n.volume,
+			noDefaultSCFileName, n.fileContent())).To(Succeed())
+	})
+	return nil
+}
+
+func (n *NoDefaultStorageClass) Destroy() error {
+	if err := n.GetTestCase().Destroy(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	// the restored PVC is reset for dynamic provisioning, so the released PV is deleted to make sure the
+	// PVC isn't bound to it again
+	By(fmt.Sprintf("PV %s should be released, then delete the PV object", n.pvName), func() {
+		Expect(WaitForPersistentVolumePhase(ctx, n.Client, n.pvName, v1.VolumeReleased, 5*time.Minute)).To(Succeed())
+		Expect(DeletePersistentVolume(ctx, n.Client, n.pvName, 5*time.Minute)).To(Succeed())
+	})
+	return nil
+}
+
+func (n *NoDefaultStorageClass) Restore() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 20*time.Minute)
+	defer ctxCancel()
+	pvcName := n.pvcName()
+	By(fmt.Sprintf("Start restore %s without default storage class", n.RestoreName), func() {
+		Expect(VeleroCmdExec(ctx, n.VeleroCfg.VeleroCLI, n.RestoreArgs)).To(Succeed())
+	})
+
+	By(fmt.Sprintf("PVC %s should be Pending and the restore should not finish without the data", pvcName), func() {
+		Eventually(func() error {
+			_, err := GetPVC(ctx, n.Client, n.namespace, pvcName)
+			return err
+		}, 5*time.Minute, 10*time.Second).Should(Succeed(), fmt.Sprintf("PVC %s is not restored", pvcName))
+		for i := 0; i < 6; i++ {
+			time.Sleep(10 * time.Second)
+			pvc, err := GetPVC(ctx, n.Client, n.namespace, pvcName)
+			Expect(err).To(Succeed())
+			Expect(pvc.Spec.StorageClassName).To(BeNil(), fmt.Sprintf("PVC %s should have no storage class", pvcName))
+			Expect(pvc.Status.Phase).To(Equal(v1.ClaimPending), fmt.Sprintf("PVC %s should be Pending", pvcName))
+			Expect(pvc.Spec.VolumeName).To(BeEmpty(), fmt.Sprintf("PVC %s should be reset for dynamic provisioning", pvcName))
+			restore, err := GetRestoreObject(ctx, n.VeleroCfg.VeleroCLI, n.VeleroCfg.VeleroNamespace, n.RestoreName)
+			Expect(err).To(Succeed())
+			Expect(restore.Status.Phase).To(BeElementOf(velerov1api.RestorePhaseNew, velerov1api.RestorePhaseInProgress),
+				"Restore should wait for the volume data instead of finishing")
+		}
+	})
+
+	By("Set the default storage class back and wait for the restore", func() {
+		Expect(RestoreDefaultStorageClass(ctx, n.Client, n.defaultSCs)).To(Succeed())
+		for name := range n.defaultSCs {
+			n.restoredSCs = append(n.restoredSCs, name)
+		}
+		n.defaultSCs = nil
+		restore, err := WaitForRestoreCompletion(ctx, n.VeleroCfg.VeleroCLI, n.VeleroCfg.VeleroNamespace, n.RestoreName, 10*time.Minute)
+		Expect(err).To(Succeed())
+		Expect(restore.Status.Phase).To(Equal(velerov1api.RestorePhaseCompleted), func() string {
+			RunDebug(context.Background(), n.VeleroCfg.VeleroCLI, n.VeleroCfg.VeleroNamespace, "", n.RestoreName)
+			return fmt.Sprintf("Unexpected phase of restore %s", n.RestoreName)
+		})
+	})
+
+	By(fmt.Sprintf("Restore %s should have no error and no warning of PVC %s", n.RestoreName, pvcName), func() {
+		_, errs, err := GetRestoreResult(ctx, n.VeleroCfg.VeleroCLI, n.VeleroCfg.VeleroNamespace, n.RestoreName)
+		Expect(err).To(Succeed())
+		Expect(errs).To(BeZero(), fmt.Sprintf("Restore %s should have no error", n.RestoreName))
+		// the warnings of the resources existing in the new namespace, e.g. the configmap kube-root-ca.crt,
+		// are expected, so only the warnings of the PVC and its volume are checked
+		output, err := VeleroRestoreDescribe(ctx, n.VeleroCfg.VeleroCLI, n.VeleroCfg.VeleroNamespace, n.RestoreName, false)
+		Expect(err).To(Succeed())
+		Expect(output).NotTo(ContainSubstring(pvcName), fmt.Sprintf("Restore %s should have no warning of PVC %s", n.RestoreName, pvcName))
+		Expect(output).NotTo(ContainSubstring(n.pvName), fmt.Sprintf("Restore %s should have no warning of PV %s", n.RestoreName, n.pvName))
+	})
+	return nil
+}
+
+func (n *NoDefaultStorageClass) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("PVC %s should be bound with the restored data", n.pvcName()), func() {
+		Expect(WaitForStatefulSetReplicas(n.Client.ClientGo, n.namespace, n.statefulSet)).To(Succeed())
+		pvc, err := GetPVC(ctx, n.Client, n.namespace, n.pvcName())
+		Expect(err).To(Succeed())
+		Expect(pvc.Status.Phase).To(Equal(v1.ClaimBound))
+		Expect(pvc.Spec.VolumeName).NotTo(Equal(n.pvName), fmt.Sprintf("A new PV should be provisioned for PVC %s", n.pvcName()))
+		Expect(pvc.Spec.StorageClassName).NotTo(BeNil(), fmt.Sprintf("PVC %s should be assigned the default storage class", n.pvcName()))
+		Expect(n.restoredSCs).To(ContainElement(*pvc.Spec.StorageClassName))
+		content, err := ReadFileFromPodVolume(ctx, n.namespace, n.podName(), "container-busybox", n.volume, noDefaultSCFileName)
+		Expect(err).To(Succeed())
+		Expect(strings.TrimSpace(content)).To(Equal(n.fileContent()), "Data of the volume is not restored")
+	})
+	return nil
+}
+
+func (n *NoDefaultStorageClass) Clean() error {
+	// set the default storage class back in case the test failed before doing it
+	if len(n.defaultSCs) > 0 {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), time.Minute)
+		defer ctxCancel()
+		if err := RestoreDefaultStorageClass(ctx, n.Client, n.defaultSCs); err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+			return err
+		}
+		n.defaultSCs = nil
+	}
+	if err := n.GetTestCase().Clean(); err != nil {
+		return err
+	}
+	// the PV is left if the test failed before it's deleted by Destroy
+	if !n.VeleroCfg.Debug {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer ctxCancel()
+		if err := DeletePersistentVolume(ctx, n.Client, n.pvName, 5*time.Minute); err != nil {
+			fmt.Printf("Failed to delete PV %s: %v\n", n.pvName, err)
+		}
+	}
+	return nil
+}
+
+func (n *NoDefaultStorageClass) podName() string {
+	return n.statefulSet + "-0"
+}
+
+func (n *NoDefaultStorageClass) pvcName() string {
+	return n.volume + "-" + n.podName()
+}
+
+// fileContent is the content written by CreateFileToPod
+func (n *NoDefaultStorageClass) fileContent() string {
+	return fmt.Sprintf("ns-%s pod-%s volume-%s", n.namespace, n.podName(), n.volume)
+}
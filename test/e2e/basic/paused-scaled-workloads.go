@@ -0,0 +1,187 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// PausedAndScaledToZeroWorkloads backs up a paused Deployment in the middle of a rollout and a
+// StatefulSet scaled to zero with the retained PVC, and checks they are restored as they were.
+type PausedAndScaledToZeroWorkloads struct {
+	TestCase
+	namespace      string
+	deploymentName string
+	stsName        string
+	volume         string
+	// replicaSets records the replicas of the ReplicaSets of the deployment by pod template hash
+	replicaSets map[string]int32
+}
+
+const PausedScaledBaseName string = "paused-scaled-"
+const pausedScaledFileName = "test-data.txt"
+
+var PausedAndScaledToZeroWorkloadsTest func() = TestFunc(&PausedAndScaledToZeroWorkloads{})
+
+func (p *PausedAndScaledToZeroWorkloads) Init() error {
+	p.VeleroCfg = VeleroCfg
+	p.Client = *p.VeleroCfg.ClientToInstallVelero
+	p.VeleroCfg.UseVolumeSnapshots = false
+	p.VeleroCfg.UseNodeAgent = true
+	p.NSBaseName = PausedScaledBaseName
+	p.namespace = p.NSBaseName + UUIDgen.String()
+	p.deploymentName = "paused-deploy"
+	p.stsName = "scaled-sts"
+	p.volume = "data"
+	p.TestMsg = &TestMSG{
+		Desc:      "Backup and restore paused Deployment and scaled to zero StatefulSet",
+		FailedMSG: "Failed to backup and restore paused Deployment and scaled to zero StatefulSet",
+		Text:      "Should restore paused Deployment and scaled to zero StatefulSet without resuming or scaling them",
+	}
+	return nil
+}
+
+func (p *PausedAndScaledToZeroWorkloads) StartRun() error {
+	p.BackupName = "backup-" + p.NSBaseName + UUIDgen.String()
+	p.RestoreName = "restore-" + p.NSBaseName + UUIDgen.String()
+	p.BackupArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "backup", p.BackupName,
+		"--include-namespaces", p.namespace, "--default-volumes-to-fs-backup",
+		"--snapshot-volumes=false", "--wait",
+	}
+	p.RestoreArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "restore", p.RestoreName,
+		"--from-backup", p.BackupName, "--wait",
+	}
+	return nil
+}
+
+func (p *PausedAndScaledToZeroWorkloads) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s", p.namespace), func() {
+		Expect(CreateNamespace(ctx, p.Client, p.namespace)).To(Succeed(),
+			fmt.Sprintf("Failed to create namespace %s", p.namespace))
+	})
+
+	By(fmt.Sprintf("Create deployment %s paused in the middle of rollout", p.deploymentName), func() {
+		maxSurge, maxUnavailable := intstr.FromInt(1), intstr.FromInt(0)
+		deployment := NewDeployment(p.deploymentName, p.namespace, 2, map[string]string{"app": p.deploymentName}, nil).Result()
+		deployment.Spec.Strategy.RollingUpdate = &apps.RollingUpdateDeployment{MaxSurge: &maxSurge, MaxUnavailable: &maxUnavailable}
+		deployment, err := CreateDeployment(p.Client.ClientGo, p.namespace, deployment)
+		Expect(err).To(Succeed())
+		Expect(WaitForReadyDeployment(p.Client.ClientGo, p.namespace, deployment.Name)).To(Succeed())
+
+		// the pods of the new revision never become ready, so the rollout stalls with two ReplicaSets
+		deployment, err = GetDeployment(p.Client.ClientGo, p.namespace, deployment.Name)
+		Expect(err).To(Succeed())
+		deployment.Spec.Template.Spec.Containers[0].ReadinessProbe = &v1.Probe{
+			ProbeHandler: v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"false"}}},
+		}
+		deployment, err = UpdateDeployment(p.Client.ClientGo, p.namespace, deployment)
+		Expect(err).To(Succeed())
+		Expect(WaitForReplicaSetsOfDeployment(p.Client.ClientGo, p.namespace, deployment, 2)).To(Succeed())
+
+		deployment, err = GetDeployment(p.Client.ClientGo, p.namespace, deployment.Name)
+		Expect(err).To(Succeed())
+		deployment.Spec.Paused = true
+		deployment, err = UpdateDeployment(p.Client.ClientGo, p.namespace, deployment)
+		Expect(err).To(Succeed())
+
+		p.replicaSets, err = p.getReplicaSets(deployment)
+		Expect(err).To(Succeed())
+		Expect(len(p.replicaSets)).To(Equal(2), fmt.Sprintf("Deployment %s should have 2 ReplicaSets, got %v", deployment.Name, p.replicaSets))
+	})
+
+	By(fmt.Sprintf("Create statefulset %s with data in PVC and scale it to zero", p.stsName), func() {
+		sts := NewStatefulSet(p.stsName, p.namespace, 1, map[string]string{"app": p.stsName}).WithVolumeClaimTemplate(p.volume, "").Result()
+		_, err := CreateStatefulSet(p.Client.ClientGo, p.namespace, sts)
+		Expect(err).To(Succeed())
+		Expect(WaitForStatefulSetReplicas(p.Client.ClientGo, p.namespace, p.stsName)).To(Succeed())
+		podName := p.stsName + "-0"
+		Expect(CreateFileToPod(ctx, p.namespace, podName, "container-busybox", p.volume,
+			pausedScaledFileName, fmt.Sprintf("ns-%s pod-%s volume-%s", p.namespace, podName, p.volume))).To(Succeed())
+		Expect(ScaleStatefulSet(p.Client.ClientGo, p.namespace, p.stsName, 0)).To(Succeed())
+		Expect(WaitForStatefulSetReplicas(p.Client.ClientGo, p.namespace, p.stsName)).To(Succeed())
+	})
+	return nil
+}
+
+func (p *PausedAndScaledToZeroWorkloads) Backup() error {
+	if err := p.TestCase.Backup(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	// fs-backup only backs up the volumes mounted by running pods, the PVC retained by the
+	// StatefulSet scaled to zero is not mounted by any pod, so its data is not backed up
+	By("PVC not mounted by any running pod should not be backed up by fs-backup", func() {
+		pvbs, err := GetPVB(ctx, p.VeleroCfg.VeleroNamespace, p.namespace)
+		Expect(err).To(Succeed())
+		Expect(len(pvbs)).To(Equal(0), fmt.Sprintf("Unexpected PVB %v", pvbs))
+	})
+	return nil
+}
+
+func (p *PausedAndScaledToZeroWorkloads) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Deployment %s should be still paused with the rollout state", p.deploymentName), func() {
+		deployment, err := GetDeployment(p.Client.ClientGo, p.namespace, p.deploymentName)
+		Expect(err).To(Succeed())
+		Expect(deployment.Spec.Paused).To(BeTrue(), "Deployment should be still paused after restore")
+		Expect(deployment.Spec.Template.Spec.Containers[0].ReadinessProbe).NotTo(BeNil(), "Template of the new revision should be kept")
+		// give the deployment controller a while to (not) resume the rollout
+		time.Sleep(time.Minute)
+		replicaSets, err := p.getReplicaSets(deployment)
+		Expect(err).To(Succeed())
+		Expect(replicaSets).To(Equal(p.replicaSets), "ReplicaSets of the deployment should not be changed after restore")
+	})
+
+	By(fmt.Sprintf("Statefulset %s should be still scaled to zero", p.stsName), func() {
+		sts, err := GetStatefulSet(p.Client.ClientGo, p.namespace, p.stsName)
+		Expect(err).To(Succeed())
+		Expect(*sts.Spec.Replicas).To(Equal(int32(0)), "Replicas of statefulset should stay 0 after restore")
+		pods, err := ListPods(ctx, p.Client, p.namespace)
+		Expect(err).To(Succeed())
+		for _, pod := range pods.Items {
+			Expect(pod.Labels["app"]).NotTo(Equal(p.stsName), fmt.Sprintf("Pod %s of statefulset should not be created", pod.Name))
+		}
+	})
+
+	pvcName := fmt.Sprintf("%s-%s-0", p.volume, p.stsName)
+	By(fmt.Sprintf("PVC %s should be restored without the data", pvcName), func() {
+		_, err := GetPVC(ctx, p.Client, p.namespace, pvcName)
+		Expect(err).To(Succeed(), fmt.Sprintf("PVC %s should be restored", pvcName))
+		podName := "pod-check-" + p.stsName
+		_, err = CreatePodWithExistingPVC(p.Client, p.namespace, podName, pvcName, p.volume)
+		Expect(err).To(Succeed())
+		Expect(WaitForPods(ctx, p.Client, p.namespace, []string{podName})).To(Succeed())
+		_, err = ReadFileFromPodVolume(ctx, p.namespace, podName, podName, p.volume, pausedScaledFileName)
+		Expect(err).To(HaveOccurred(), "Data of PVC not mounted by any running pod should not be restored by fs-backup")
+	})
+	return nil
+}
+
+func (p *PausedAndScaledToZeroWorkloads) getReplicaSets(deployment *apps.Deployment) (map[string]int32, error) {
+	rsList, err := ListReplicaSetsOfDeployment(p.Client.ClientGo, p.namespace, deployment)
+	if err != nil {
+		return nil, err
+	}
+	replicaSets := map[string]int32{}
+	for _, rs := range rsList.Items {
+		replicaSets[rs.Labels[apps.DefaultDeploymentUniqueLabelKey]] = *rs.Spec.Replicas
+	}
+	return replicaSets, nil
+}
@@ -0,0 +1,142 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// RestoreIntoTerminatingNamespace restores into a namespace held in Terminating phase by a
+// finalizer. Velero waits for the namespace to be deleted (up to the terminating resource timeout
+// of server) and then recreates it, so the restore should stay in progress without writing any
+// object into the terminating namespace, and complete after the namespace is gone.
+type RestoreIntoTerminatingNamespace struct {
+	TestCase
+	namespace string
+	cmName    string
+	holder    string
+}
+
+const terminatingNamespaceFinalizer = "e2e.velero.io/hold-namespace"
+
+var RestoreIntoTerminatingNamespaceTest func() = TestFunc(&RestoreIntoTerminatingNamespace{})
+
+func (r *RestoreIntoTerminatingNamespace) Init() error {
+	r.VeleroCfg = VeleroCfg
+	r.Client = *r.VeleroCfg.ClientToInstallVelero
+	r.NSBaseName = "restore-terminating-ns-"
+	r.namespace = r.NSBaseName + UUIDgen.String()
+	r.cmName = "cm-restore-terminating-ns"
+	r.holder = "cm-finalizer-holder"
+	r.TestMsg = &TestMSG{
+		Desc:      "Restore into the namespace being deleted",
+		FailedMSG: "Failed to restore into the namespace being deleted",
+		Text:      "Should wait for the terminating namespace to be deleted and then recreate it to restore",
+	}
+	return nil
+}
+
+func (r *RestoreIntoTerminatingNamespace) StartRun() error {
+	r.BackupName = "backup-" + r.namespace
+	r.RestoreName = "restore-" + r.namespace
+	r.BackupArgs = []string{
+		"create", "--namespace", r.VeleroCfg.VeleroNamespace, "backup", r.BackupName,
+		"--include-namespaces", r.namespace, "--wait",
+	}
+	// the restore is not waited for, the namespace is released during the restore
+	r.RestoreArgs = []string{
+		"create", "--namespace", r.VeleroCfg.VeleroNamespace, "restore", r.RestoreName,
+		"--from-backup", r.BackupName,
+	}
+	return nil
+}
+
+func (r *RestoreIntoTerminatingNamespace) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s with configmap %s", r.namespace, r.cmName), func() {
+		Expect(CreateNamespace(ctx, r.Client, r.namespace)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", r.namespace))
+		_, err := CreateConfigMap(r.Client.ClientGo, r.namespace, r.cmName, nil, map[string]string{"key": r.namespace})
+		Expect(err).To(Succeed(), fmt.Sprintf("Failed to create configmap %s in namespace %s", r.cmName, r.namespace))
+	})
+	return nil
+}
+
+func (r *RestoreIntoTerminatingNamespace) Destroy() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Delete namespace %s held in Terminating phase by finalizer", r.namespace), func() {
+		_, err := CreateConfigMapWithFinalizers(r.Client.ClientGo, r.namespace, r.holder, []string{terminatingNamespaceFinalizer})
+		Expect(err).To(Succeed())
+		Expect(DeleteNamespace(ctx, r.Client, r.namespace, false)).To(Succeed())
+		Expect(WaitForNamespaceTerminating(ctx, r.Client, r.namespace, 2*time.Minute)).To(Succeed())
+		Expect(WaitForConfigmapDelete(r.Client.ClientGo, r.namespace, r.cmName)).To(Succeed())
+	})
+	return nil
+}
+
+func (r *RestoreIntoTerminatingNamespace) Restore() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 20*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Start restore %s into the terminating namespace %s", r.RestoreName, r.namespace), func() {
+		Expect(VeleroCmdExec(ctx, r.VeleroCfg.VeleroCLI, r.RestoreArgs)).To(Succeed())
+	})
+
+	By("Restore should wait without writing objects into the terminating namespace", func() {
+		// keep the namespace terminating for a while, it's much shorter than the default
+		// terminating resource timeout of server which is 10 minutes
+		for i := 0; i < 6; i++ {
+			time.Sleep(10 * time.Second)
+			restore, err := GetRestoreObject(ctx, r.VeleroCfg.VeleroCLI, r.VeleroCfg.VeleroNamespace, r.RestoreName)
+			Expect(err).To(Succeed())
+			Expect(restore.Status.Phase).To(BeElementOf(velerov1api.RestorePhaseNew, velerov1api.RestorePhaseInProgress),
+				"Restore should not finish while the namespace is terminating")
+			_, err = GetConfigmap(r.Client.ClientGo, r.namespace, r.cmName)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue(), fmt.Sprintf("Configmap %s should not be restored into the terminating namespace", r.cmName))
+		}
+	})
+
+	By(fmt.Sprintf("Release namespace %s and wait for the restore", r.namespace), func() {
+		Expect(RemoveConfigMapFinalizers(r.Client.ClientGo, r.namespace, r.holder)).To(Succeed())
+		restore, err := WaitForRestoreCompletion(ctx, r.VeleroCfg.VeleroCLI, r.VeleroCfg.VeleroNamespace, r.RestoreName, 10*time.Minute)
+		Expect(err).To(Succeed())
+		Expect(restore.Status.Phase).To(Equal(velerov1api.RestorePhaseCompleted), func() string {
+			RunDebug(context.Background(), r.VeleroCfg.VeleroCLI, r.VeleroCfg.VeleroNamespace, "", r.RestoreName)
+			return fmt.Sprintf("Unexpected phase of restore %s", r.RestoreName)
+		})
+	})
+	return nil
+}
+
+func (r *RestoreIntoTerminatingNamespace) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Namespace %s should be recreated with the restored configmap", r.namespace), func() {
+		ns, err := GetNamespace(ctx, r.Client, r.namespace)
+		Expect(err).To(Succeed())
+		Expect(ns.DeletionTimestamp).To(BeNil(), fmt.Sprintf("Namespace %s should be recreated", r.namespace))
+		Expect(ConfigMapDataShouldBe(r.Client.ClientGo, r.namespace, r.cmName, "key", r.namespace)).To(Succeed())
+		_, err = GetConfigmap(r.Client.ClientGo, r.namespace, r.holder)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue(), fmt.Sprintf("Configmap %s created after backup should not be restored", r.holder))
+	})
+	return nil
+}
+
+func (r *RestoreIntoTerminatingNamespace) Clean() error {
+	// release the namespace in case the test failed before releasing it
+	if err := RemoveConfigMapFinalizers(r.Client.ClientGo, r.namespace, r.holder); err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+		return err
+	}
+	return r.GetTestCase().Clean()
+}
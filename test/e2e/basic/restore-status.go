@@ -0,0 +1,153 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	statusTestCRDYaml = "testdata/restore-status/statustest-crd.yaml"
+	statusTestCRDName = "statustests.e2e.velero.io"
+	statusTestCRName  = "status-test"
+	statusTestPhase   = "Ready"
+)
+
+var statusTestGVR = schema.GroupVersionResource{Group: "e2e.velero.io", Version: "v1", Resource: "statustests"}
+
+// RestoreStatus backs up a custom resource whose status is faked as there is no controller for it,
+// and checks the status is dropped by the restore by default, and restored by the restore including
+// the resource in --status-include-resources.
+type RestoreStatus struct {
+	TestCase
+	namespace             string
+	restoreWithStatusName string
+}
+
+const RestoreStatusBaseName string = "restore-status-"
+
+var RestoreStatusTest func() = TestFunc(&RestoreStatus{})
+
+func (r *RestoreStatus) Init() error {
+	r.VeleroCfg = VeleroCfg
+	r.Client = *r.VeleroCfg.ClientToInstallVelero
+	r.VeleroCfg.UseVolumeSnapshots = false
+	r.NSBaseName = RestoreStatusBaseName
+	r.namespace = r.NSBaseName + UUIDgen.String()
+	r.TestMsg = &TestMSG{
+		Desc:      "Restore status of custom resources included by status-include-resources",
+		FailedMSG: "Failed to restore status of custom resources",
+		Text:      "Should restore the status of custom resources only when they are included by status-include-resources",
+	}
+	return nil
+}
+
+func (r *RestoreStatus) StartRun() error {
+	r.BackupName = "backup-" + r.NSBaseName + UUIDgen.String()
+	r.RestoreName = "restore-" + r.NSBaseName + UUIDgen.String()
+	r.restoreWithStatusName = "restore-with-status-" + r.NSBaseName + UUIDgen.String()
+	r.BackupArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "backup", r.BackupName,
+		"--include-namespaces", r.namespace, "--wait",
+	}
+	r.RestoreArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "restore", r.RestoreName,
+		"--from-backup", r.BackupName, "--wait",
+	}
+	return nil
+}
+
+func (r *RestoreStatus) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Install CRD %s", statusTestCRDName), func() {
+		Expect(InstallCRD(ctx, statusTestCRDYaml)).To(Succeed())
+		Expect(WaitForCRDEstablished(statusTestCRDName)).To(Succeed())
+	})
+
+	By(fmt.Sprintf("Create custom resource %s with status in namespace %s", statusTestCRName, r.namespace), func() {
+		Expect(CreateNamespace(ctx, r.Client, r.namespace)).To(Succeed(),
+			fmt.Sprintf("Failed to create namespace %s", r.namespace))
+		cr := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": statusTestGVR.GroupVersion().String(),
+			"kind":       "StatusTest",
+			"metadata": map[string]interface{}{
+				"name":      statusTestCRName,
+				"namespace": r.namespace,
+			},
+			"spec": map[string]interface{}{
+				"message": "backed up",
+			},
+		}}
+		_, err := CreateCustomResource(r.Client, statusTestGVR, r.namespace, cr)
+		Expect(err).To(Succeed())
+		_, err = UpdateCustomResourceStatus(r.Client, statusTestGVR, r.namespace, statusTestCRName,
+			map[string]interface{}{"phase": statusTestPhase})
+		Expect(err).To(Succeed())
+		Expect(r.statusPhase()).To(Equal(statusTestPhase))
+	})
+	return nil
+}
+
+func (r *RestoreStatus) Restore() error {
+	if err := r.TestCase.Restore(); err != nil {
+		return err
+	}
+	By(fmt.Sprintf("Status of custom resource %s should not be restored by default", statusTestCRName), func() {
+		Expect(r.statusPhase()).To(BeEmpty(), "Status should not be restored without status-include-resources")
+	})
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Delete namespace %s and restore it with status of %s included", r.namespace, statusTestCRDName), func() {
+		Expect(CleanupNamespacesWithPoll(ctx, r.Client, r.NSBaseName)).To(Succeed())
+		args := []string{
+			"create", "--namespace", r.VeleroCfg.VeleroNamespace, "restore", r.restoreWithStatusName,
+			"--from-backup", r.BackupName, "--status-include-resources", statusTestCRDName, "--wait",
+		}
+		Expect(VeleroRestoreExec(ctx, r.VeleroCfg.VeleroCLI, r.VeleroCfg.VeleroNamespace, r.restoreWithStatusName, args,
+			r.RestorePhaseExpect)).To(Succeed(), func() string {
+			RunDebug(context.Background(), r.VeleroCfg.VeleroCLI, r.VeleroCfg.VeleroNamespace, "", r.restoreWithStatusName)
+			return "Fail to restore workload"
+		})
+	})
+	return nil
+}
+
+func (r *RestoreStatus) Verify() error {
+	By(fmt.Sprintf("Status of custom resource %s should be restored", statusTestCRName), func() {
+		Expect(r.statusPhase()).To(Equal(statusTestPhase), "Status should be restored with status-include-resources")
+	})
+	return nil
+}
+
+func (r *RestoreStatus) Clean() error {
+	// the CRD is cluster scoped, so it's deleted even the test fails to not affect the other tests
+	if !r.VeleroCfg.Debug {
+		By(fmt.Sprintf("Delete CRD %s", statusTestCRDName), func() {
+			if err := DeleteCRDByName(context.Background(), statusTestCRDName); err != nil {
+				fmt.Printf("Failed to delete CRD %s: %v\n", statusTestCRDName, err)
+			}
+		})
+	}
+	return r.TestCase.Clean()
+}
+
+func (r *RestoreStatus) statusPhase() (string, error) {
+	cr, err := GetCustomResource(r.Client, statusTestGVR, r.namespace, statusTestCRName)
+	if err != nil {
+		return "", err
+	}
+	phase, _, err := unstructured.NestedString(cr.Object, "status", "phase")
+	return phase, err
+}
@@ -110,36 +110,14 @@ func BslDeletionTest(useVolumeSnapshots bool) {
 				Skip("no additional BSL credentials given, not running multiple BackupStorageLocation with unique credentials tests")
 			}
 
-			By(fmt.Sprintf("Add an additional plugin for provider %s", veleroCfg.AdditionalBSLProvider), func() {
-				Expect(VeleroAddPluginsForProvider(context.TODO(), veleroCfg.VeleroCLI,
-					veleroCfg.VeleroNamespace, veleroCfg.AdditionalBSLProvider,
-					veleroCfg.AddBSLPlugins, veleroCfg.Features)).To(Succeed())
-			})
-
-			additionalBsl := fmt.Sprintf("bsl-%s", UUIDgen)
-			secretName := fmt.Sprintf("bsl-credentials-%s", UUIDgen)
-			secretKey := fmt.Sprintf("creds-%s", veleroCfg.AdditionalBSLProvider)
-			files := map[string]string{
-				secretKey: veleroCfg.AdditionalBSLCredentials,
-			}
-
-			By(fmt.Sprintf("Create Secret for additional BSL %s", additionalBsl), func() {
-				Expect(CreateSecretFromFiles(context.TODO(), *veleroCfg.ClientToInstallVelero, veleroCfg.VeleroNamespace, secretName, files)).To(Succeed())
-			})
-
-			By(fmt.Sprintf("Create additional BSL using credential %s", secretName), func() {
-				Expect(VeleroCreateBackupLocation(context.TODO(),
-					veleroCfg.VeleroCLI,
-					veleroCfg.VeleroNamespace,
-					additionalBsl,
-					veleroCfg.AdditionalBSLProvider,
-					veleroCfg.AdditionalBSLBucket,
-					veleroCfg.AdditionalBSLPrefix,
-					veleroCfg.AdditionalBSLConfig,
-					secretName,
-					secretKey,
-				)).To(Succeed())
+			var additionalBsl string
+			var cleanupBSL func()
+			By(fmt.Sprintf("Create an additional BSL for provider %s", veleroCfg.AdditionalBSLProvider), func() {
+				var err error
+				additionalBsl, cleanupBSL, err = SetupAdditionalBSL(context.TODO(), veleroCfg, UUIDgen.String())
+				Expect(err).To(Succeed())
 			})
+			defer cleanupBSL()
 
 			backupName_1 := "backup1-" + UUIDgen.String()
 			backupName_2 := "backup2-" + UUIDgen.String()
@@ -159,7 +137,7 @@ func BslDeletionTest(useVolumeSnapshots bool) {
 			By("Deploy sample workload of Kibishii", func() {
 				Expect(KibishiiPrepareBeforeBackup(oneHourTimeout, *veleroCfg.ClientToInstallVelero, veleroCfg.CloudProvider,
 					bslDeletionTestNs, veleroCfg.RegistryCredentialFile, veleroCfg.Features,
-					veleroCfg.KibishiiDirectory, useVolumeSnapshots, DefaultKibishiiData)).To(Succeed())
+					veleroCfg.KibishiiDirectory, veleroCfg.KibishiiStorageClass, useVolumeSnapshots, DefaultKibishiiData)).To(Succeed())
 			})
 
 			// Restic can not backup PV only, so pod need to be labeled also
@@ -235,7 +213,7 @@ func BslDeletionTest(useVolumeSnapshots bool) {
 					Expect(err).NotTo(HaveOccurred(), "Fail to get Azure CSI snapshot checkpoint")
 					Expect(SnapshotsShouldBeCreatedInCloud(veleroCfg.CloudProvider,
 						veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket,
-						veleroCfg.BSLConfig, backupName_1, snapshotCheckPoint)).To(Succeed())
+						veleroCfg.BSLConfig, veleroCfg.VSLConfig, backupName_1, snapshotCheckPoint)).To(Succeed())
 				})
 				By(fmt.Sprintf("Snapshot of bsl %s should be created in cloud object store", backupLocation_2), func() {
 					snapshotCheckPoint, err = GetSnapshotCheckPoint(*veleroCfg.ClientToInstallVelero, veleroCfg, 1, bslDeletionTestNs, backupName_2, []string{podName_2})
@@ -251,7 +229,7 @@ func BslDeletionTest(useVolumeSnapshots bool) {
 
 					Expect(SnapshotsShouldBeCreatedInCloud(veleroCfg.CloudProvider,
 						BSLCredentials, veleroCfg.AdditionalBSLBucket,
-						BSLConfig, backupName_2, snapshotCheckPoint)).To(Succeed())
+						BSLConfig, "", backupName_2, snapshotCheckPoint)).To(Succeed())
 				})
 			} else { // For Restics
 				By(fmt.Sprintf("Resticrepositories for BSL %s should be created in Velero namespace", backupLocation_1), func() {
@@ -286,7 +264,7 @@ func BslDeletionTest(useVolumeSnapshots bool) {
 				Expect(cmp.Diff(backupsInBsl1AndBsl2, backupsBeforeDel, cmpopts.SortSlices(less))).Should(BeEmpty())
 
 				By(fmt.Sprintf("Backup1 %s should exist in cloud object store before bsl deletion", backupName_1), func() {
-					Expect(ObjectsShouldBeInBucket(veleroCfg.CloudProvider, veleroCfg.CloudCredentialsFile,
+					Expect(ObjectsShouldBeInBucket(GetObjectStoreProvider(veleroCfg), veleroCfg.CloudCredentialsFile,
 						veleroCfg.BSLBucket, veleroCfg.BSLPrefix, veleroCfg.BSLConfig,
 						backupName_1, BackupObjectsPrefix)).To(Succeed())
 				})
@@ -305,14 +283,14 @@ func BslDeletionTest(useVolumeSnapshots bool) {
 			})
 
 			By(fmt.Sprintf("Backup1 %s should still exist in cloud object store after bsl deletion", backupName_1), func() {
-				Expect(ObjectsShouldBeInBucket(veleroCfg.CloudProvider, veleroCfg.CloudCredentialsFile,
+				Expect(ObjectsShouldBeInBucket(GetObjectStoreProvider(veleroCfg), veleroCfg.CloudCredentialsFile,
 					veleroCfg.BSLBucket, veleroCfg.BSLPrefix, veleroCfg.BSLConfig,
 					backupName_1, BackupObjectsPrefix)).To(Succeed())
 			})
 
 			// TODO: Choose additional BSL to be deleted as an new test case
 			// By(fmt.Sprintf("Backup %s should still exist in cloud object store", backupName_2), func() {
-			// 	Expect(ObjectsShouldBeInBucket(veleroCfg.CloudProvider, veleroCfg.AdditionalBSLCredentials,
+			// 	Expect(ObjectsShouldBeInBucket(GetObjectStoreProvider(veleroCfg), veleroCfg.AdditionalBSLCredentials,
 			// 		veleroCfg.AdditionalBSLBucket, veleroCfg.AdditionalBSLPrefix, veleroCfg.AdditionalBSLConfig,
 			// 		backupName_2, BackupObjectsPrefix)).To(Succeed())
 			// })
@@ -334,7 +312,7 @@ func BslDeletionTest(useVolumeSnapshots bool) {
 					Expect(err).NotTo(HaveOccurred(), "Fail to get Azure CSI snapshot checkpoint")
 					Expect(SnapshotsShouldBeCreatedInCloud(veleroCfg.CloudProvider,
 						veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket,
-						veleroCfg.BSLConfig, backupName_1, snapshotCheckPoint)).To(Succeed())
+						veleroCfg.BSLConfig, veleroCfg.VSLConfig, backupName_1, snapshotCheckPoint)).To(Succeed())
 				})
 				By(fmt.Sprintf("Snapshot should not be deleted in cloud object store after deleting bsl %s", backupLocation_2), func() {
 					var BSLCredentials, BSLConfig string
@@ -349,7 +327,7 @@ func BslDeletionTest(useVolumeSnapshots bool) {
 					Expect(err).NotTo(HaveOccurred(), "Fail to get Azure CSI snapshot checkpoint")
 					Expect(SnapshotsShouldBeCreatedInCloud(veleroCfg.CloudProvider,
 						BSLCredentials, veleroCfg.AdditionalBSLBucket,
-						BSLConfig, backupName_2, snapshotCheckPoint)).To(Succeed())
+						BSLConfig, "", backupName_2, snapshotCheckPoint)).To(Succeed())
 				})
 			} else { // For Restic
 				By(fmt.Sprintf("Resticrepositories for BSL %s should be deleted in Velero namespace", backupLocation_1), func() {
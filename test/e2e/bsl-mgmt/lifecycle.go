@@ -0,0 +1,175 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package bslmgmt
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+const (
+	bslLifecycleTestNs    = "bsl-lifecycle"
+	bslLifecycleConfigMap = "bsl-lifecycle-cm"
+	bslCredentialsKey     = "cloud"
+	// the locations are enqueued for validation every 10 seconds, so the phase should be changed
+	// within a few validations
+	bslValidationFrequency = "10s"
+	bslPhaseTimeout        = 2 * time.Minute
+)
+
+// BslLifecycleTest creates an additional backup storage location with its own credentials, checks the
+// backups to it are rejected while it's read-only but the restores still work, and it becomes unavailable
+// once the credentials are broken and available again after they are repaired
+func BslLifecycleTest() {
+	var (
+		veleroCfg  VeleroConfig
+		bslName    string
+		secretName string
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		veleroCfg.UseNodeAgent = false
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		bslName = "bsl-lifecycle-" + UUIDgen.String()
+		secretName = "bsl-lifecycle-credentials-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete backup storage location %s and its credentials", bslName), func() {
+				if err := VeleroCmdExec(context.Background(), veleroCfg.VeleroCLI, []string{"--namespace", veleroCfg.VeleroNamespace,
+					"delete", "backup-location", bslName, "--confirm"}); err != nil {
+					fmt.Printf("Failed to delete backup storage location %s: %v\n", bslName, err)
+				}
+				if err := veleroCfg.ClientToInstallVelero.ClientGo.CoreV1().Secrets(veleroCfg.VeleroNamespace).Delete(
+					context.Background(), secretName, metav1.DeleteOptions{}); err != nil {
+					fmt.Printf("Failed to delete secret %s: %v\n", secretName, err)
+				}
+			})
+			By(fmt.Sprintf("Delete sample workload namespace %s", bslLifecycleTestNs), func() {
+				Expect(DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, bslLifecycleTestNs, true)).To(Succeed())
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Backup storage location should reject backups in read-only mode and follow the availability of its credentials", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		backupName := "backup-" + bslLifecycleTestNs + "-" + UUIDgen.String()
+		readOnlyBackupName := "backup-read-only-" + UUIDgen.String()
+		restoreName := "restore-" + bslLifecycleTestNs + "-" + UUIDgen.String()
+
+		credentials, err := os.ReadFile(veleroCfg.CloudCredentialsFile)
+		Expect(err).To(Succeed(), fmt.Sprintf("Failed to read credentials file %s", veleroCfg.CloudCredentialsFile))
+
+		By(fmt.Sprintf("Create backup storage location %s with its own credentials", bslName), func() {
+			Expect(CreateSecretFromFiles(ctx, client, veleroCfg.VeleroNamespace, secretName,
+				map[string]string{bslCredentialsKey: veleroCfg.CloudCredentialsFile})).To(Succeed())
+			// the backups are stored under a prefix of their own to be isolated from the default location
+			prefix := strings.Trim(veleroCfg.BSLPrefix+"/"+bslName, "/")
+			Expect(VeleroCreateBackupLocation(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, bslName,
+				GetObjectStoreProvider(veleroCfg), veleroCfg.BSLBucket, prefix, veleroCfg.BSLConfig,
+				secretName, bslCredentialsKey)).To(Succeed())
+			Expect(PatchBackupStorageLocation(ctx, veleroCfg.VeleroNamespace, bslName,
+				fmt.Sprintf(`{"spec":{"validationFrequency":"%s"}}`, bslValidationFrequency))).To(Succeed())
+			Expect(WaitForBSLPhase(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, bslName,
+				velerov1api.BackupStorageLocationPhaseAvailable, bslPhaseTimeout)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Create namespace %s with configmap %s and back it up to %s", bslLifecycleTestNs, bslLifecycleConfigMap, bslName), func() {
+			Expect(CreateNamespace(ctx, client, bslLifecycleTestNs)).To(Succeed())
+			_, err := CreateConfigMap(client.ClientGo, bslLifecycleTestNs, bslLifecycleConfigMap, nil,
+				map[string]string{"data": bslLifecycleTestNs})
+			Expect(err).To(Succeed())
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, BackupConfig{
+				BackupName:     backupName,
+				Namespace:      bslLifecycleTestNs,
+				BackupLocation: bslName,
+			})).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By(fmt.Sprintf("Backup to read-only backup storage location %s should fail validation", bslName), func() {
+			Expect(SetBackupStorageLocationAccessMode(ctx, veleroCfg.VeleroNamespace, bslName,
+				velerov1api.BackupStorageLocationAccessModeReadOnly)).To(Succeed())
+			Expect(VeleroBackupNamespaceExpectPhase(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, BackupConfig{
+				BackupName:     readOnlyBackupName,
+				Namespace:      bslLifecycleTestNs,
+				BackupLocation: bslName,
+			}, velerov1api.BackupPhaseFailedValidation)).To(Succeed())
+			backup, err := GetBackupObject(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, readOnlyBackupName)
+			Expect(err).To(Succeed())
+			Expect(backup.Status.ValidationErrors).To(ContainElement(ContainSubstring("read-only mode")))
+		})
+
+		By(fmt.Sprintf("Restore from read-only backup storage location %s should still work", bslName), func() {
+			Expect(DeleteNamespace(ctx, client, bslLifecycleTestNs, true)).To(Succeed())
+			Expect(VeleroRestore(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, backupName, "")).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+				return "Fail to restore workload"
+			})
+			Expect(ConfigMapDataShouldBe(client.ClientGo, bslLifecycleTestNs, bslLifecycleConfigMap, "data", bslLifecycleTestNs)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup storage location %s should be unavailable with broken credentials", bslName), func() {
+			Expect(UpdateSecretData(client.ClientGo, veleroCfg.VeleroNamespace, secretName,
+				map[string][]byte{bslCredentialsKey: []byte("invalid-credentials")})).To(Succeed())
+			Expect(WaitForBSLPhase(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, bslName,
+				velerov1api.BackupStorageLocationPhaseUnavailable, bslPhaseTimeout)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup storage location %s should be available again with the credentials repaired", bslName), func() {
+			Expect(UpdateSecretData(client.ClientGo, veleroCfg.VeleroNamespace, secretName,
+				map[string][]byte{bslCredentialsKey: credentials})).To(Succeed())
+			Expect(WaitForBSLPhase(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, bslName,
+				velerov1api.BackupStorageLocationPhaseAvailable, bslPhaseTimeout)).To(Succeed())
+			// make the location writable again to delete the backups in it after the test
+			Expect(SetBackupStorageLocationAccessMode(ctx, veleroCfg.VeleroNamespace, bslName,
+				velerov1api.BackupStorageLocationAccessModeReadWrite)).To(Succeed())
+		})
+	})
+}
@@ -67,6 +67,8 @@ func init() {
 	flag.BoolVar(&VeleroCfg.InstallVelero, "install-velero", true, "install/uninstall velero during the test.  Optional.")
 	flag.StringVar(&VeleroCfg.RegistryCredentialFile, "registry-credential-file", "", "file containing credential for the image registry, follows the same format rules as the ~/.docker/config.json file. Optional.")
 	flag.StringVar(&VeleroCfg.KibishiiDirectory, "kibishii-directory", "github.com/vmware-tanzu-experiments/distributed-data-generator/kubernetes/yaml/", "The file directory or URL path to install Kibishii. Optional.")
+	flag.StringVar(&VeleroCfg.KibishiiStorageClass, "kibishii-storage-class", "", "Storage class used by the PVCs of Kibishii, the base Kibishii manifests are installed with this storage class instead of the provider specific ones when it's set. Optional.")
+	flag.IntVar(&VeleroCfg.KibishiiLargeFileSizeMB, "kibishii-large-file-size-mb", 0, "Size in MB of the large file written into the volume of each kibishii pod by the kibishii tests and verified by checksum after restore, no large file is written if it's 0. Optional.")
 	//vmware-tanzu-experiments
 	// Flags to create an additional BSL for multiple credentials test
 	flag.StringVar(&VeleroCfg.AdditionalBSLProvider, "additional-bsl-object-store-provider", "", "Provider of object store plugin for additional backup storage location. Required if testing multiple credentials support.")
@@ -81,20 +83,31 @@ func init() {
 	flag.StringVar(&VeleroCfg.StandbyCluster, "standby-cluster", "", "Standby cluster context for migration test.")
 	flag.StringVar(&VeleroCfg.UploaderType, "uploader-type", "", "Identify persistent volume backup uploader.")
 	flag.BoolVar(&VeleroCfg.VeleroServerDebugMode, "velero-server-debug-mode", false, "Identify persistent volume backup uploader.")
+	flag.StringVar(&VeleroCfg.PerfReportDir, "perf-report-dir", "", "Directory to write the timing metrics of backups and restores into, the metrics are not written if it's empty.")
+	flag.StringVar(&VeleroCfg.ArtifactsDir, "artifacts-dir", "", "Directory to write the debug bundles into, the current directory is used if it's empty.")
+	flag.BoolVar(&VeleroCfg.StrictPerf, "strict-perf", false, "Fail the tests when the measured performance such as RTO and RPO is out of the expectation, otherwise it's only reported.")
+	flag.StringVar(&VeleroCfg.VerifyStrategy, "verify-strategy", string(VerifyByExec), "Preferred way to verify the data of the workloads: exec, port-forward-http or pv-reader. The data is verified by exec if the preferred way is unavailable.")
+	flag.BoolVar(&VeleroCfg.RecordAPIRequestsBaseline, "record-api-requests-baseline", false, "Record the number of API requests issued by backup measured by the API requests test into its baseline file rather than check it against the baseline.")
 
 }
 
 var _ = Describe("[APIGroup][Common] Velero tests with various CRD API group versions", APIGropuVersionsTest)
 var _ = Describe("[APIGroup][APIExtensions] CRD of apiextentions v1beta1 should be B/R successfully from cluster(k8s version < 1.22) to cluster(k8s version >= 1.22)", APIExtensionsVersionsTest)
+var _ = Describe("[APIGroup][VersionChange] CRs should be restored by the version served by the cluster after the CRD stops serving the storage version", APIGroupVersionChangeTest)
 
 // Test backup and restore of Kibishi using restic
 var _ = Describe("[Basic][Restic] Velero tests on cluster using the plugin provider for object storage and Restic for volume backups", BackupRestoreWithRestic)
+var _ = Describe("[Basic][Restic][MultiNodes] Kibishii data generated across all the expected nodes should be verified after restore", BackupRestoreWithExpectedNodes)
+var _ = Describe("[Basic][Restic][PartiallyFailed] Velero tests on cluster using the plugin provider for object storage and Restic for volume backups", BackupRestoreWithPartiallyFailedBackup)
 
 var _ = Describe("[Basic][Snapshot] Velero tests on cluster using the plugin provider for object storage and snapshots for volume backups", BackupRestoreWithSnapshots)
 
+var _ = Describe("[Basic][Restic][RepoCache] Restore performance of Kibishii from cold and warm backup repository", RestoreWithColdAndWarmRepository)
+
 var _ = Describe("[Basic][ClusterResource] Backup/restore of cluster resources", ResourcesCheckTest)
 
 var _ = Describe("[Scale][LongTime] Backup/restore of 2500 namespaces", MultiNSBackupRestore)
+var _ = Describe("[Scale][APIRequests] Number of Kubernetes API requests issued by backup should be bounded", APIRequestsOfBackupTest)
 
 // Upgrade test by Kibishi using restic
 var _ = Describe("[Upgrade][Restic] Velero upgrade tests on cluster using the plugin provider for object storage and Restic for volume backups", BackupUpgradeRestoreWithRestic)
@@ -102,6 +115,7 @@ var _ = Describe("[Upgrade][Snapshot] Velero upgrade tests on cluster using the
 
 // test filter objects by namespace, type, or labels when backup or restore.
 var _ = Describe("[ResourceFiltering][ExcludeFromBackup] Resources with the label velero.io/exclude-from-backup=true are not included in backup", ExcludeFromBackupTest)
+var _ = Describe("[ResourceFiltering][ExcludeFromBackup][OrderedResources] Resources with the label velero.io/exclude-from-backup=true are not included in backup even if listed in ordered resources", ExcludeFromBackupWithOrderedResourcesTest)
 var _ = Describe("[ResourceFiltering][ExcludeNamespaces][Backup] Velero test on exclude namespace from the cluster backup", BackupWithExcludeNamespaces)
 var _ = Describe("[ResourceFiltering][ExcludeNamespaces][Restore] Velero test on exclude namespace from the cluster restore", RestoreWithExcludeNamespaces)
 var _ = Describe("[ResourceFiltering][ExcludeResources][Backup] Velero test on exclude resources from the cluster backup", BackupWithExcludeResources)
@@ -111,21 +125,42 @@ var _ = Describe("[ResourceFiltering][IncludeNamespaces][Restore] Velero test on
 var _ = Describe("[ResourceFiltering][IncludeResources][Backup] Velero test on include resources from the cluster backup", BackupWithIncludeResources)
 var _ = Describe("[ResourceFiltering][IncludeResources][Restore] Velero test on include resources from the cluster restore", RestoreWithIncludeResources)
 var _ = Describe("[ResourceFiltering][LabelSelector] Velero test on backup include resources matching the label selector", BackupWithLabelSelector)
+var _ = Describe("[ResourceFiltering][OrLabelSelector] Velero test on backup include resources matching the label selector or the OR label selectors", BackupWithOrLabelSelector)
+var _ = Describe("[ResourceFiltering][ResourceType] Velero test on backup with the resource type filters and cluster scoped resources", ResourceFilteringTest)
 var _ = Describe("[ResourceFiltering][ResourcePolicies] Velero test on skip backup of volume by resource policies", ResourcePoliciesTest)
+var _ = Describe("[ResourceFiltering][ResourcePolicies][File] Velero test on skip backup of volume by resource policies authored in file", ResourcePoliciesFromFileTest)
+var _ = Describe("[ResourceFiltering][ResourcePolicies][Snapshot] Velero test on skip snapshot of volume by resource policies", ResourcePoliciesSnapshotTest)
+var _ = Describe("[ResourceFiltering][ResourcePolicies][VolumeSource] Velero test on skip backup of volume by nfs and csi conditions of resource policies", ResourcePoliciesVolumeSourceTest)
+var _ = Describe("[ResourceFiltering][ResourcePolicies][Capacity] Velero test on skip backup of volume by capacity range starting from zero", ResourcePoliciesZeroLowerCapacityTest)
+var _ = Describe("[ResourceFiltering][ResourcePolicies][Capacity] Velero test on skip backup of volume by capacity range without upper boundary", ResourcePoliciesOpenUpperCapacityTest)
+var _ = Describe("[ResourceFiltering][ResourcePolicies][Update] Velero test on skip backup of volume by resource policies updated between backups", ResourcePoliciesUpdateTest)
+var _ = Describe("[ResourceFiltering][ResourcePolicies][Invalid] Velero test on failing the validation of backup by invalid resource policies", ResourcePoliciesInvalidTest)
 
 var _ = Describe("[Backups][Deletion][Restic] Velero tests of Restic backup deletion", BackupDeletionWithRestic)
 var _ = Describe("[Backups][Deletion][Snapshot] Velero tests of snapshot backup deletion", BackupDeletionWithSnapshots)
+var _ = Describe("[Backups][Deletion][Case][FsBackup] Artifacts of the deleted backup with fs-backup should be cleaned up", BackupDeletionFsBackupCaseTest)
+var _ = Describe("[Backups][Deletion][Case][Snapshot] Artifacts of the deleted backup with snapshots should be cleaned up", BackupDeletionSnapshotCaseTest)
 var _ = Describe("[Backups][TTL][LongTime] Local backups and restic repos will be deleted once the corresponding backup storage location is deleted", TTLTest)
+var _ = Describe("[Backups][TTL][FsBackup] Expired backup with fs-backup will be deleted with its files and snapshots by GC", TTLWithFsBackupTest)
+var _ = Describe("[Backups][Hooks] Pre and post backup exec hooks defined by pod annotations", BackupHooksTest)
+var _ = Describe("[Backups][Hooks][Restore] Post restore exec and init container hooks defined by pod annotations", RestoreHooksTest)
+var _ = Describe("[Backups][ExistingResourcePolicy][Restore] Existing resources should be kept or updated by the existing resource policy of restore", ExistingResourcePolicyTest)
+var _ = Describe("[Backups][FsBackup][StaleDataPath] Workload namespace should be deleted without wedging node-agent after the backup is aborted during fs-backup", StaleDataPathNamespaceDeletionTest)
+var _ = Describe("[Backups][RepoMaintenance][FsBackup] Backup repository of fs-backup should be ready and maintained periodically", BackupRepositoryMaintenanceTest)
+var _ = Describe("[Backups][DebugBundle] Debug bundle of the partially failed backup contains the logs and the failure details", DebugBundleTest)
+var _ = Describe("[Backups][Logs] Logs and details of the backup and restore are downloaded by the CLI", BackupRestoreLogsTest)
 var _ = Describe("[Backups][BackupsSync] Backups in object storage are synced to a new Velero and deleted backups in object storage are synced to be deleted in Velero", BackupsSyncTest)
 
 var _ = Describe("[Schedule][BR][Pause][LongTime] Backup will be created periodly by schedule defined by a Cron expression", ScheduleBackupTest)
 var _ = Describe("[Schedule][OrederedResources] Backup resources should follow the specific order in schedule", ScheduleOrderedResources)
 var _ = Describe("[Schedule][BackupCreation] Schedule controller wouldn't create a new backup when it still has pending or InProgress backup", ScheduleBackupCreationTest)
+var _ = Describe("[Schedule][Kibishii][Pause] Backup kibishii periodically by schedule which could be paused and unpaused", ScheduleBackupCaseTest)
 
 var _ = Describe("[PrivilegesMgmt][SSR] Velero test on ssr object when controller namespace mix-ups", SSRTest)
 
 var _ = Describe("[BSL][Deletion][Snapshot] Local backups will be deleted once the corresponding backup storage location is deleted", BslDeletionWithSnapshots)
 var _ = Describe("[BSL][Deletion][Restic] Local backups and restic repos will be deleted once the corresponding backup storage location is deleted", BslDeletionWithRestic)
+var _ = Describe("[BSL][Lifecycle] Backup storage location rejects backups in read-only mode and follows the availability of its credentials", BslLifecycleTest)
 
 var _ = Describe("[Migration][Restic] Migrate resources between clusters by Restic", MigrationWithRestic)
 var _ = Describe("[Migration][Snapshot] Migrate resources between clusters by snapshot", MigrationWithSnapshots)
@@ -134,13 +169,32 @@ var _ = Describe("[NamespaceMapping][Single][Restic] Backup resources should fol
 var _ = Describe("[NamespaceMapping][Multiple][Restic] Backup resources should follow the specific order in schedule", MultiNamespacesMappingResticTest)
 var _ = Describe("[NamespaceMapping][Single][Snapshot] Backup resources should follow the specific order in schedule", OneNamespaceMappingSnapshotTest)
 var _ = Describe("[NamespaceMapping][Multiple][Snapshot] Backup resources should follow the specific order in schedule", MultiNamespacesMappingSnapshotTest)
+var _ = Describe("[NamespaceMapping][KeepSource][Restic] Restore namespace with volume by namespace mapping while the original namespace exists", NamespaceMappingKeepSourceTest)
 
 var _ = Describe("[pv-backup][Opt-In] Backup resources should follow the specific order in schedule", OptInPVBackupTest)
 var _ = Describe("[pv-backup][Opt-Out] Backup resources should follow the specific order in schedule", OptOutPVBackupTest)
+var _ = Describe("[pv-backup][CSI][FsBackup] Volumes should be protected by fs-backup rather than CSI snapshot when both are enabled", CSIFsBackupPrecedenceTest)
+var _ = Describe("[pv-backup][CSI][Annotations] PVC annotations required by CSI driver should be valid after restore", CSIPVCAnnotationsTest)
+var _ = Describe("[pv-backup][SharedVolume] Volume mounted by multiple containers at different paths should be restored for all of them", SharedVolumeMountsTest)
+var _ = Describe("[pv-backup][Describe][FsBackup] Volume information of backup describe should list every PVC protected by fs-backup", DescribeVolumeInfoFsBackupTest)
+var _ = Describe("[pv-backup][Describe][CSI] Volume information of backup describe should list every PVC protected by CSI snapshot", DescribeVolumeInfoCSISnapshotTest)
+var _ = Describe("[pv-backup][Describe][Snapshot] Volume information of backup describe should list every PVC protected by Velero-native snapshot", DescribeVolumeInfoNativeSnapshotTest)
+var _ = Describe("[pv-backup][ReclaimPolicy][Retain] Restored PVC should re-bind to the retained PV with the data intact", RetainPVRestoreTest)
+var _ = Describe("[pv-backup][ReclaimPolicy][Delete] Restored PVC should be bound to a newly provisioned PV with the data restored", DeletePVRestoreTest)
 
 var _ = Describe("[Basic][Nodeport] Service nodeport reservation during restore is configurable", NodePortTest)
 var _ = Describe("[Basic][StorageClass] Storage class of persistent volumes and persistent volume claims can be changed during restores", StorageClasssChangingTest)
 var _ = Describe("[Basic][SelectedNode] Node selectors of persistent volume claims can be changed during restores", PVCSelectedNodeChangingTest)
+var _ = Describe("[Basic][PausedScaledToZero] Paused Deployment and scaled to zero StatefulSet should be restored as they were", PausedAndScaledToZeroWorkloadsTest)
+var _ = Describe("[Basic][TerminatingNamespace] Restore should wait for the terminating namespace to be deleted and recreate it", RestoreIntoTerminatingNamespaceTest)
+var _ = Describe("[Basic][StorageClass][NoDefault] Restore volumes when the cluster has no default storage class", NoDefaultStorageClassTest)
+var _ = Describe("[Basic][KubeSystem] Backup kube-system and restore it into a scratch namespace by namespace mapping", KubeSystemBackupTest)
+var _ = Describe("[Basic][RestoreStatus] Status of custom resources should be restored only when included by status-include-resources", RestoreStatusTest)
+var _ = Describe("[Basic][MultipleInstances] Velero installations in different namespaces of one cluster only process their own backups", MultipleVeleroInstancesTest)
+var _ = Describe("[Basic][CustomServerArgs] Custom args of the velero server and node-agent are applied by the installation", CustomServerArgsTest)
+var _ = Describe("[Basic][MixedScopeCRs] Backup and restore with wildcard includes should capture the expected custom resources per scope", MixedScopeCustomResourcesTest)
+var _ = Describe("[Basic][MissingVolumeRefs][Optional] Workload referencing optional ConfigMap and Secret which do not exist should be restored without errors", OptionalMissingVolumeReferencesTest)
+var _ = Describe("[Basic][MissingVolumeRefs] Workload referencing non-optional ConfigMap and Secret which do not exist should be kept pending after restore", MissingVolumeReferencesTest)
 
 func GetKubeconfigContext() error {
 	var err error
@@ -25,7 +25,10 @@ import (
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
@@ -36,6 +39,14 @@ import (
 var migrationNamespace string
 var veleroCfg VeleroConfig
 
+const (
+	// timestampWorkload writes the timestamps continuously along with kibishii to measure RTO and RPO
+	timestampWorkload       = "timestamp-writer"
+	timestampWorkloadVolume = "volume-timestamp"
+	// maxMigrationRTO is the expected max time from starting restore to the workload serving
+	maxMigrationRTO = 30 * time.Minute
+)
+
 func MigrationWithSnapshots() {
 	veleroCfg = VeleroCfg
 	for _, veleroCLI2Version := range GetVersionList(veleroCfg.MigrateFromVeleroCLI, veleroCfg.MigrateFromVeleroVersion) {
@@ -54,46 +65,39 @@ func MigrationTest(useVolumeSnapshots bool, veleroCLI2Version VeleroCLI2Version)
 	var (
 		backupName, restoreName     string
 		backupScName, restoreScName string
+		drMetric                    DRMetric
 		err                         error
 	)
 	BeforeEach(func() {
 		veleroCfg = VeleroCfg
 		UUIDgen, err = uuid.NewRandom()
 		migrationNamespace = "migration-workload-" + UUIDgen.String()
+		drMetric = DRMetric{}
 		if useVolumeSnapshots && veleroCfg.CloudProvider == "kind" {
 			Skip("Volume snapshots not supported on kind")
 		}
 		if useVolumeSnapshots && veleroCfg.CloudProvider == "aws" {
 			Skip("Volume snapshots migration not supported on AWS provisioned by Sheperd public pool")
 		}
-		if veleroCfg.DefaultCluster == "" && veleroCfg.StandbyCluster == "" {
-			Skip("Migration test needs 2 clusters")
+		if veleroCfg.DefaultCluster == "" || veleroCfg.StandbyCluster == "" || veleroCfg.StandbyClient == nil {
+			Skip("Migration test needs 2 clusters, both the default and standby kubeconfig contexts should be provided")
 		}
 	})
 	AfterEach(func() {
 		if !veleroCfg.Debug {
-			By("Clean backups after test", func() {
-				DeleteBackups(context.Background(), *veleroCfg.DefaultClient)
+			// each cluster is cleaned up regardless of the failures in the other one
+			var errs []error
+			By(fmt.Sprintf("Clean up cluster-B (%s)", veleroCfg.StandbyCluster), func() {
+				errs = append(errs, cleanUpMigrationCluster(veleroCfg, false)...)
+			})
+			By(fmt.Sprintf("Clean up cluster-A (%s)", veleroCfg.DefaultCluster), func() {
+				errs = append(errs, cleanUpMigrationCluster(veleroCfg, true)...)
 			})
-			if veleroCfg.InstallVelero {
-				By(fmt.Sprintf("Uninstall Velero and delete sample workload namespace %s", migrationNamespace), func() {
-					Expect(KubectlConfigUseContext(context.Background(), veleroCfg.DefaultCluster)).To(Succeed())
-					Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI,
-						veleroCfg.VeleroNamespace)).To(Succeed())
-					DeleteNamespace(context.Background(), *veleroCfg.DefaultClient, migrationNamespace, true)
-
-					Expect(KubectlConfigUseContext(context.Background(), veleroCfg.StandbyCluster)).To(Succeed())
-					Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI,
-						veleroCfg.VeleroNamespace)).To(Succeed())
-					DeleteNamespace(context.Background(), *veleroCfg.StandbyClient, migrationNamespace, true)
-				})
-			}
 			By(fmt.Sprintf("Switch to default kubeconfig context %s", veleroCfg.DefaultCluster), func() {
-				Expect(KubectlConfigUseContext(context.Background(), veleroCfg.DefaultCluster)).To(Succeed())
-				veleroCfg.ClientToInstallVelero = veleroCfg.DefaultClient
+				Expect(UseDefaultCluster(context.Background(), &veleroCfg)).To(Succeed())
 			})
+			Expect(errs).To(BeEmpty(), "Failed to clean up the clusters of migration")
 		}
-
 	})
 	When("kibishii is the sample workload", func() {
 		It("should be successfully backed up and restored to the default BackupStorageLocation", func() {
@@ -119,10 +123,9 @@ func MigrationTest(useVolumeSnapshots bool, veleroCLI2Version VeleroCLI2Version)
 			}
 			OriginVeleroCfg := veleroCfg
 			By(fmt.Sprintf("Install Velero in cluster-A (%s) to backup workload", veleroCfg.DefaultCluster), func() {
-				Expect(KubectlConfigUseContext(context.Background(), veleroCfg.DefaultCluster)).To(Succeed())
+				Expect(UseDefaultCluster(context.Background(), &OriginVeleroCfg)).To(Succeed())
 				OriginVeleroCfg.MigrateFromVeleroVersion = veleroCLI2Version.VeleroVersion
 				OriginVeleroCfg.VeleroCLI = veleroCLI2Version.VeleroCLI
-				OriginVeleroCfg.ClientToInstallVelero = OriginVeleroCfg.DefaultClient
 				OriginVeleroCfg.UseVolumeSnapshots = useVolumeSnapshots
 				OriginVeleroCfg.UseNodeAgent = !useVolumeSnapshots
 				// TODO: self means 1.10 and upper version
@@ -163,7 +166,16 @@ func MigrationTest(useVolumeSnapshots bool, veleroCLI2Version VeleroCLI2Version)
 			By("Deploy sample workload of Kibishii", func() {
 				Expect(KibishiiPrepareBeforeBackup(oneHourTimeout, *veleroCfg.DefaultClient, veleroCfg.CloudProvider,
 					migrationNamespace, veleroCfg.RegistryCredentialFile, veleroCfg.Features,
-					veleroCfg.KibishiiDirectory, useVolumeSnapshots, DefaultKibishiiData)).To(Succeed())
+					veleroCfg.KibishiiDirectory, veleroCfg.KibishiiStorageClass, useVolumeSnapshots, DefaultKibishiiData)).To(Succeed())
+			})
+
+			By(fmt.Sprintf("Deploy workload %s writing timestamps continuously", timestampWorkload), func() {
+				_, err := CreateTimestampWorkload(*veleroCfg.DefaultClient, migrationNamespace, timestampWorkload,
+					veleroCfg.KibishiiStorageClass, timestampWorkloadVolume)
+				Expect(err).To(Succeed())
+				Expect(WaitForPods(oneHourTimeout, *veleroCfg.DefaultClient, migrationNamespace, []string{timestampWorkload})).To(Succeed())
+				_, err = WaitForTimestampWorkloadServing(oneHourTimeout, migrationNamespace, timestampWorkload, 5*time.Minute)
+				Expect(err).To(Succeed())
 			})
 
 			By(fmt.Sprintf("Backup namespace %s", migrationNamespace), func() {
@@ -189,30 +201,36 @@ func MigrationTest(useVolumeSnapshots bool, veleroCLI2Version VeleroCLI2Version)
 				//TODO Remove UseRestic parameter once minor version is 1.10 or upper
 				BackupCfg.UseResticIfFSBackup = !supportUploaderType
 
+				drMetric.BackupName = backupName
+				drMetric.BackupStart = time.Now()
 				Expect(VeleroBackupNamespace(context.Background(), OriginVeleroCfg.VeleroCLI,
 					OriginVeleroCfg.VeleroNamespace, BackupCfg)).To(Succeed(), func() string {
 					RunDebug(context.Background(), OriginVeleroCfg.VeleroCLI, OriginVeleroCfg.VeleroNamespace, BackupCfg.BackupName, "")
 					return "Fail to backup workload"
 				})
+				drMetric.BackupCompletion = time.Now()
 			})
 
 			if useVolumeSnapshots {
 				if veleroCfg.CloudProvider == "vsphere" {
 					// TODO - remove after upload progress monitoring is implemented
 					By("Waiting for vSphere uploads to complete", func() {
+						// the timestamp workload adds its PVC to the ones of kibishii
+						pvcCount, err := GetBoundPVCCount(context.Background(), *veleroCfg.DefaultClient, migrationNamespace)
+						Expect(err).To(Succeed())
 						Expect(WaitForVSphereUploadCompletion(context.Background(), time.Hour,
-							migrationNamespace, 2)).To(Succeed())
+							migrationNamespace, pvcCount)).To(Succeed())
 					})
 				}
 				var snapshotCheckPoint SnapshotCheckPoint
 				snapshotCheckPoint.NamespaceBackedUp = migrationNamespace
 				By("Snapshot should be created in cloud object store", func() {
-					snapshotCheckPoint, err := GetSnapshotCheckPoint(*veleroCfg.DefaultClient, veleroCfg, 2,
-						migrationNamespace, backupName, KibishiiPodNameList)
+					snapshotCheckPoint, err := GetSnapshotCheckPointOfPVCs(*veleroCfg.DefaultClient, veleroCfg,
+						migrationNamespace, backupName, nil)
 					Expect(err).NotTo(HaveOccurred(), "Fail to get snapshot checkpoint")
 					Expect(SnapshotsShouldBeCreatedInCloud(veleroCfg.CloudProvider,
 						veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket,
-						veleroCfg.BSLConfig, backupName, snapshotCheckPoint)).To(Succeed())
+						veleroCfg.BSLConfig, veleroCfg.VSLConfig, backupName, snapshotCheckPoint)).To(Succeed())
 				})
 			}
 
@@ -236,17 +254,19 @@ func MigrationTest(useVolumeSnapshots bool, veleroCLI2Version VeleroCLI2Version)
 				Expect(ns.Name).To(Equal(migrationNamespace))
 				Expect(err).NotTo(HaveOccurred())
 
-				Expect(KubectlConfigUseContext(context.Background(), veleroCfg.StandbyCluster)).To(Succeed())
+				Expect(UseStandbyCluster(context.Background(), &veleroCfg)).To(Succeed())
 				_, err = GetNamespace(context.Background(), *veleroCfg.StandbyClient, migrationNamespace)
 				Expect(err).To(HaveOccurred())
 				strings.Contains(fmt.Sprint(err), "namespaces \""+migrationNamespace+"\" not found")
 
 				fmt.Println(err)
 
-				veleroCfg.ClientToInstallVelero = veleroCfg.StandbyClient
 				veleroCfg.UseNodeAgent = !useVolumeSnapshots
 				veleroCfg.UseRestic = false
 				Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+				// the backups in the bucket are owned by cluster-A, cluster-B only syncs and restores them
+				Expect(SetBackupStorageLocationAccessMode(context.Background(), veleroCfg.VeleroNamespace, "default",
+					velerov1api.BackupStorageLocationAccessModeReadOnly)).To(Succeed())
 			})
 
 			By(fmt.Sprintf("Waiting for backups sync to Velero in cluster-B (%s)", veleroCfg.StandbyCluster), func() {
@@ -254,7 +274,12 @@ func MigrationTest(useVolumeSnapshots bool, veleroCLI2Version VeleroCLI2Version)
 				Expect(WaitForBackupToBeCreated(context.Background(), veleroCfg.VeleroCLI, backupScName, 5*time.Minute)).To(Succeed())
 			})
 
+			// the workload in cluster-A is seen as lost from now on, the writes after it can't be recovered
+			drMetric.FailoverDecision = time.Now()
+
 			By(fmt.Sprintf("Restore %s", migrationNamespace), func() {
+				drMetric.RestoreName = restoreName
+				drMetric.RestoreStart = time.Now()
 				Expect(VeleroRestore(context.Background(), veleroCfg.VeleroCLI,
 					veleroCfg.VeleroNamespace, restoreScName, backupScName, "StorageClass")).To(Succeed(), func() string {
 					RunDebug(context.Background(), veleroCfg.VeleroCLI,
@@ -269,6 +294,30 @@ func MigrationTest(useVolumeSnapshots bool, veleroCLI2Version VeleroCLI2Version)
 				})
 			})
 
+			By(fmt.Sprintf("Workload %s should serve the restored timestamps", timestampWorkload), func() {
+				drMetric.WorkloadServing, err = WaitForTimestampWorkloadServing(oneHourTimeout, migrationNamespace, timestampWorkload, maxMigrationRTO)
+				Expect(err).To(Succeed())
+				content, err := GetTimestampsFromWorkload(oneHourTimeout, migrationNamespace, timestampWorkload)
+				Expect(err).To(Succeed())
+				timestamps, err := ParseTimestamps(content)
+				Expect(err).To(Succeed())
+				// the timestamps after the failover decision are written by the restored workload
+				var found bool
+				drMetric.LastSurvivingWrite, found = LastTimestampBefore(timestamps, drMetric.FailoverDecision)
+				Expect(found).To(BeTrue(), "No timestamp written before the failover survives the restore")
+			})
+
+			By("Report RTO and RPO of the migration", func() {
+				drMetric.Compute()
+				Expect(WriteDRMetric(veleroCfg.PerfReportDir, &drMetric)).To(Succeed())
+				if err := drMetric.Check(maxMigrationRTO); err != nil {
+					if veleroCfg.StrictPerf {
+						Fail(err.Error())
+					}
+					fmt.Printf("Warning: %v\n", err)
+				}
+			})
+
 			By(fmt.Sprintf("Verify workload %s after restore ", migrationNamespace), func() {
 				Expect(KibishiiVerifyAfterRestore(*veleroCfg.StandbyClient, migrationNamespace,
 					oneHourTimeout, DefaultKibishiiData)).To(Succeed(), "Fail to verify workload after restore")
@@ -276,3 +325,39 @@ func MigrationTest(useVolumeSnapshots bool, veleroCLI2Version VeleroCLI2Version)
 		})
 	})
 }
+
+// cleanUpMigrationCluster deletes the backups and the workload namespace and uninstalls Velero in the default
+// or standby cluster, it goes on with the failures to avoid leaking the resources. The backups are only deleted
+// in the default cluster, they are synced into the standby cluster by the read-only backup storage location
+func cleanUpMigrationCluster(veleroCfg VeleroConfig, defaultCluster bool) []error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer ctxCancel()
+	client := veleroCfg.StandbyClient
+	useCluster := UseStandbyCluster
+	if defaultCluster {
+		client = veleroCfg.DefaultClient
+		useCluster = UseDefaultCluster
+	}
+	if err := useCluster(ctx, &veleroCfg); err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	if defaultCluster {
+		if err := DeleteBackups(ctx, *client); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if veleroCfg.InstallVelero {
+		if err := VeleroUninstall(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := DeleteNamespace(ctx, *client, migrationNamespace, true); err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+		errs = append(errs, err)
+	}
+	for _, err := range errs {
+		fmt.Printf("Failed to clean up the cluster: %v\n", err)
+	}
+	return errs
+}
@@ -0,0 +1,135 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// CSIFsBackupPrecedence backs up volumes with both CSI snapshot and fs-backup enabled, since the
+// volumes of pods are selected for fs-backup by "--default-volumes-to-fs-backup", they should be
+// protected by pod volume backups only, and no CSI snapshot should be taken for them
+type CSIFsBackupPrecedence struct {
+	TestCase
+	podsList    []string
+	volumesList [][]string
+}
+
+var CSIFsBackupPrecedenceTest func() = TestFunc(&CSIFsBackupPrecedence{})
+
+func (c *CSIFsBackupPrecedence) Init() error {
+	c.VeleroCfg = VeleroCfg
+	c.Client = *c.VeleroCfg.ClientToInstallVelero
+	c.UseVolumeSnapshots = true
+	c.VeleroCfg.UseVolumeSnapshots = true
+	c.VeleroCfg.UseNodeAgent = true
+	c.NSBaseName = "csi-fs-precedence"
+	c.NSIncluded = &[]string{c.NSBaseName}
+	c.TestMsg = &TestMSG{
+		Desc:      "Backup PVs with both CSI snapshot and fs-backup enabled",
+		FailedMSG: "Failed to backup PVs by the mechanism of precedence",
+		Text:      fmt.Sprintf("Should protect each PV in namespace %s by fs-backup only and restore it by fs-restore", c.NSBaseName),
+	}
+	return nil
+}
+
+func (c *CSIFsBackupPrecedence) StartRun() error {
+	if !strings.Contains(c.VeleroCfg.Features, "EnableCSI") {
+		Skip("CSI feature is not enabled, skip fs-backup and CSI snapshot precedence test")
+	}
+	if c.VeleroCfg.CloudProvider == "kind" {
+		Skip("Volume snapshots not supported on kind")
+	}
+	c.BackupName = "backup-" + c.NSBaseName + "-" + UUIDgen.String()
+	c.RestoreName = "restore-" + c.NSBaseName + "-" + UUIDgen.String()
+	c.BackupArgs = []string{
+		"create", "--namespace", c.VeleroCfg.VeleroNamespace, "backup", c.BackupName,
+		"--include-namespaces", c.NSBaseName, "--snapshot-volumes",
+		"--default-volumes-to-fs-backup", "--wait",
+	}
+	c.RestoreArgs = []string{
+		"create", "--namespace", c.VeleroCfg.VeleroNamespace, "restore", c.RestoreName,
+		"--from-backup", c.BackupName, "--wait",
+	}
+	return nil
+}
+
+func (c *CSIFsBackupPrecedence) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s for workload\n", c.NSBaseName), func() {
+		Expect(CreateNamespace(ctx, c.Client, c.NSBaseName)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", c.NSBaseName))
+	})
+	By(fmt.Sprintf("Deploy a few pods with several PVs in namespace %s", c.NSBaseName), func() {
+		for i := 0; i <= POD_COUNT-1; i++ {
+			var volumes []string
+			for j := 0; j <= VOLUME_COUNT_PER_POD-1; j++ {
+				volumes = append(volumes, fmt.Sprintf("volume-precedence-%d-%d", i, j))
+			}
+			c.volumesList = append(c.volumesList, volumes)
+			podName := fmt.Sprintf("pod-%d", i)
+			c.podsList = append(c.podsList, podName)
+			// Use the default storage class which is expected to be provisioned by CSI driver
+			_, err := CreatePod(c.Client, c.NSBaseName, podName, "", "", volumes, nil, nil)
+			Expect(err).To(Succeed())
+		}
+	})
+	By(fmt.Sprintf("Populate all pods %s with file %s", c.podsList, FILE_NAME), func() {
+		Expect(WaitForPods(ctx, c.Client, c.NSBaseName, c.podsList)).To(Succeed())
+		for i, pod := range c.podsList {
+			for _, volume := range c.volumesList[i] {
+				Expect(CreateFileToPod(ctx, c.NSBaseName, pod, pod, volume,
+					FILE_NAME, fileContent(c.NSBaseName, pod, volume))).To(Succeed())
+			}
+		}
+	})
+	return nil
+}
+
+func (c *CSIFsBackupPrecedence) Backup() error {
+	if err := c.TestCase.Backup(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By("Each PV should be protected by exactly one mechanism which is fs-backup", func() {
+		mechanisms, err := GetVolumeProtectionMechanisms(ctx, c.Client, c.VeleroCfg.VeleroNamespace, c.NSBaseName, c.BackupName)
+		Expect(err).To(Succeed())
+		Expect(len(mechanisms)).To(Equal(POD_COUNT*VOLUME_COUNT_PER_POD), "Unexpected count of PVCs in the namespace")
+		for pvc, m := range mechanisms {
+			Expect(m).To(Equal([]string{VolumeProtectedByFsBackup}),
+				fmt.Sprintf("PVC %s should be protected by fs-backup only, but got %v", pvc, m))
+		}
+	})
+	return nil
+}
+
+func (c *CSIFsBackupPrecedence) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Waiting for all pods to start %s", c.podsList), func() {
+		Expect(WaitForPods(ctx, c.Client, c.NSBaseName, c.podsList)).To(Succeed())
+	})
+	By("Volumes should be restored by fs-restore", func() {
+		pvrs, err := GetPVR(ctx, c.VeleroCfg.VeleroNamespace, c.NSBaseName)
+		Expect(err).To(Succeed())
+		Expect(len(pvrs)).To(Equal(POD_COUNT*VOLUME_COUNT_PER_POD), fmt.Sprintf("Unexpected count of PVR %v", pvrs))
+	})
+	By("Restored data should be the same as the original", func() {
+		for i, pod := range c.podsList {
+			for _, volume := range c.volumesList[i] {
+				Expect(fileExist(ctx, c.VeleroCfg, c.NSBaseName, pod, volume)).To(Succeed())
+			}
+		}
+	})
+	return nil
+}
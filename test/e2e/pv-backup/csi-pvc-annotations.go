@@ -0,0 +1,147 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+)
+
+const (
+	annStorageProvisioner     = "volume.kubernetes.io/storage-provisioner"
+	annBetaStorageProvisioner = "volume.beta.kubernetes.io/storage-provisioner"
+	annBindCompleted          = "pv.kubernetes.io/bind-completed"
+)
+
+// CSIPVCAnnotations backs up PVCs provisioned by CSI driver with CSI snapshots, and checks the
+// annotations the CSI driver relies on are kept or regenerated on the restored PVCs, so the
+// restored volumes are still managed by the CSI driver
+type CSIPVCAnnotations struct {
+	TestCase
+	pod     string
+	volumes []string
+	// provisioners records the provisioner annotated on the PVCs before backup by PVC name
+	provisioners map[string]string
+}
+
+var CSIPVCAnnotationsTest func() = TestFunc(&CSIPVCAnnotations{})
+
+func (c *CSIPVCAnnotations) Init() error {
+	c.VeleroCfg = VeleroCfg
+	c.Client = *c.VeleroCfg.ClientToInstallVelero
+	c.UseVolumeSnapshots = true
+	c.VeleroCfg.UseVolumeSnapshots = true
+	c.NSBaseName = "csi-pvc-annotations"
+	c.NSIncluded = &[]string{c.NSBaseName}
+	c.pod = "pod-csi-pvc-annotations"
+	c.volumes = []string{"volume-csi-ann-0", "volume-csi-ann-1"}
+	c.provisioners = map[string]string{}
+	c.TestMsg = &TestMSG{
+		Desc:      "Backup and restore PVCs annotated by CSI driver",
+		FailedMSG: "Failed to keep the annotations of PVCs required by CSI driver",
+		Text:      "Should restore PVCs with the annotations of CSI driver so the volumes are usable",
+	}
+	return nil
+}
+
+func (c *CSIPVCAnnotations) StartRun() error {
+	if !strings.Contains(c.VeleroCfg.Features, "EnableCSI") {
+		Skip("CSI feature is not enabled, skip PVC annotations of CSI driver test")
+	}
+	if c.VeleroCfg.CloudProvider == "kind" {
+		Skip("Volume snapshots not supported on kind")
+	}
+	c.BackupName = "backup-" + c.NSBaseName + "-" + UUIDgen.String()
+	c.RestoreName = "restore-" + c.NSBaseName + "-" + UUIDgen.String()
+	c.BackupArgs = []string{
+		"create", "--namespace", c.VeleroCfg.VeleroNamespace, "backup", c.BackupName,
+		"--include-namespaces", c.NSBaseName, "--snapshot-volumes",
+		"--default-volumes-to-fs-backup=false", "--wait",
+	}
+	c.RestoreArgs = []string{
+		"create", "--namespace", c.VeleroCfg.VeleroNamespace, "restore", c.RestoreName,
+		"--from-backup", c.BackupName, "--wait",
+	}
+	return nil
+}
+
+func (c *CSIPVCAnnotations) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s for workload\n", c.NSBaseName), func() {
+		Expect(CreateNamespace(ctx, c.Client, c.NSBaseName)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", c.NSBaseName))
+	})
+	By(fmt.Sprintf("Deploy pod %s with PVCs provisioned by CSI driver", c.pod), func() {
+		// Use the default storage class which is expected to be provisioned by CSI driver
+		_, err := CreatePod(c.Client, c.NSBaseName, c.pod, "", "", c.volumes, nil, nil)
+		Expect(err).To(Succeed())
+		Expect(WaitForPods(ctx, c.Client, c.NSBaseName, []string{c.pod})).To(Succeed())
+		for _, volume := range c.volumes {
+			Expect(CreateFileToPod(ctx, c.NSBaseName, c.pod, c.pod, volume,
+				FILE_NAME, fileContent(c.NSBaseName, c.pod, volume))).To(Succeed())
+		}
+	})
+	By("Record the provisioner annotated on PVCs by CSI driver", func() {
+		for _, volume := range c.volumes {
+			pvcName := "pvc-" + volume
+			provisioner := c.checkPVCAnnotations(ctx, pvcName)
+			c.provisioners[pvcName] = provisioner
+		}
+	})
+	return nil
+}
+
+func (c *CSIPVCAnnotations) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Waiting for pod %s to start", c.pod), func() {
+		Expect(WaitForPods(ctx, c.Client, c.NSBaseName, []string{c.pod})).To(Succeed())
+	})
+	By("Annotations of restored PVCs required by CSI driver should be valid", func() {
+		for pvcName, provisioner := range c.provisioners {
+			Expect(c.checkPVCAnnotations(ctx, pvcName)).To(Equal(provisioner),
+				fmt.Sprintf("Provisioner of PVC %s should be the same as the original", pvcName))
+		}
+	})
+	By("Restored volumes should be usable", func() {
+		for _, volume := range c.volumes {
+			Expect(fileExist(ctx, c.VeleroCfg, c.NSBaseName, c.pod, volume)).To(Succeed())
+			Expect(CreateFileToPod(ctx, c.NSBaseName, c.pod, c.pod, volume,
+				FILE_NAME+".new", fileContent(c.NSBaseName, c.pod, volume))).To(Succeed(),
+				fmt.Sprintf("Failed to write into the restored volume %s", volume))
+		}
+	})
+	return nil
+}
+
+// checkPVCAnnotations checks the PVC is bound to the PV provisioned by the CSI driver annotated
+// on the PVC, and returns the provisioner
+func (c *CSIPVCAnnotations) checkPVCAnnotations(ctx context.Context, pvcName string) string {
+	pvc, err := GetPVC(ctx, c.Client, c.NSBaseName, pvcName)
+	Expect(err).To(Succeed())
+	Expect(pvc.Status.Phase).To(Equal(v1.ClaimBound), fmt.Sprintf("PVC %s should be bound", pvcName))
+
+	ann, err := GetPVCAnnotations(ctx, c.Client, c.NSBaseName, pvcName)
+	Expect(err).To(Succeed())
+	Expect(ann[annBindCompleted]).To(Equal("yes"), fmt.Sprintf("PVC %s should be annotated as bind completed", pvcName))
+	provisioner := ann[annStorageProvisioner]
+	if provisioner == "" {
+		provisioner = ann[annBetaStorageProvisioner]
+	}
+	Expect(provisioner).NotTo(BeEmpty(), fmt.Sprintf("PVC %s should be annotated with the provisioner", pvcName))
+
+	pv, err := GetPersistentVolume(ctx, c.Client, "", pvc.Spec.VolumeName)
+	Expect(err).To(Succeed())
+	Expect(pv.Spec.CSI).NotTo(BeNil(), fmt.Sprintf("PV %s should be provisioned by CSI driver", pv.Name))
+	Expect(pv.Spec.CSI.Driver).To(Equal(provisioner),
+		fmt.Sprintf("PV %s should be provisioned by the provisioner %s annotated on PVC %s", pv.Name, provisioner, pvcName))
+	return provisioner
+}
@@ -0,0 +1,158 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/providers"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// DescribeVolumeInfo backs up the volumes by one of the data paths, and checks the volume
+// information in the output of "velero backup describe --details" lists every PVC with the
+// identifier and status matching the PodVolumeBackups, VolumeSnapshotContents or the snapshots in cloud
+type DescribeVolumeInfo struct {
+	TestCase
+	dataPath    string
+	podsList    []string
+	volumesList [][]string
+}
+
+var DescribeVolumeInfoFsBackupTest func() = TestFunc(&DescribeVolumeInfo{dataPath: VolumeProtectedByFsBackup})
+var DescribeVolumeInfoCSISnapshotTest func() = TestFunc(&DescribeVolumeInfo{dataPath: VolumeProtectedByCSISnapshot})
+var DescribeVolumeInfoNativeSnapshotTest func() = TestFunc(&DescribeVolumeInfo{dataPath: VolumeProtectedByNativeSnapshot})
+
+func (d *DescribeVolumeInfo) Init() error {
+	d.VeleroCfg = VeleroCfg
+	d.Client = *d.VeleroCfg.ClientToInstallVelero
+	d.UseVolumeSnapshots = d.dataPath != VolumeProtectedByFsBackup
+	d.VeleroCfg.UseVolumeSnapshots = d.UseVolumeSnapshots
+	d.VeleroCfg.UseNodeAgent = !d.UseVolumeSnapshots
+	d.NSBaseName = "describe-volume-" + strings.ToLower(d.dataPath)
+	d.NSIncluded = &[]string{d.NSBaseName}
+	d.TestMsg = &TestMSG{
+		Desc:      fmt.Sprintf("Describe the volume information of backup with %s", d.dataPath),
+		FailedMSG: fmt.Sprintf("Failed to describe the volume information of backup with %s", d.dataPath),
+		Text:      fmt.Sprintf("Should list every PVC in namespace %s protected by %s in the output of backup describe", d.NSBaseName, d.dataPath),
+	}
+	return nil
+}
+
+func (d *DescribeVolumeInfo) StartRun() error {
+	csiEnabled := strings.Contains(d.VeleroCfg.Features, "EnableCSI")
+	switch d.dataPath {
+	case VolumeProtectedByCSISnapshot:
+		if !csiEnabled {
+			Skip("CSI feature is not enabled, skip describing CSI snapshots")
+		}
+	case VolumeProtectedByNativeSnapshot:
+		// the volumes are snapshotted by the CSI plugin rather than the volume snapshotter once CSI is enabled
+		if csiEnabled {
+			Skip("CSI feature is enabled, skip describing Velero-native snapshots")
+		}
+	}
+	if d.UseVolumeSnapshots && d.VeleroCfg.CloudProvider == "kind" {
+		Skip("Volume snapshots not supported on kind")
+	}
+	d.BackupName = "backup-" + d.NSBaseName + "-" + UUIDgen.String()
+	d.RestoreName = "restore-" + d.NSBaseName + "-" + UUIDgen.String()
+	d.BackupArgs = []string{
+		"create", "--namespace", d.VeleroCfg.VeleroNamespace, "backup", d.BackupName,
+		"--include-namespaces", d.NSBaseName, "--wait",
+	}
+	if d.UseVolumeSnapshots {
+		d.BackupArgs = append(d.BackupArgs, "--snapshot-volumes")
+	} else {
+		d.BackupArgs = append(d.BackupArgs, "--default-volumes-to-fs-backup", "--snapshot-volumes=false")
+	}
+	d.RestoreArgs = []string{
+		"create", "--namespace", d.VeleroCfg.VeleroNamespace, "restore", d.RestoreName,
+		"--from-backup", d.BackupName, "--wait",
+	}
+	return nil
+}
+
+func (d *DescribeVolumeInfo) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s for workload", d.NSBaseName), func() {
+		Expect(CreateNamespace(ctx, d.Client, d.NSBaseName)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", d.NSBaseName))
+	})
+	By(fmt.Sprintf("Deploy a few pods with several PVs in namespace %s", d.NSBaseName), func() {
+		for i := 0; i <= POD_COUNT-1; i++ {
+			var volumes []string
+			for j := 0; j <= VOLUME_COUNT_PER_POD-1; j++ {
+				volumes = append(volumes, fmt.Sprintf("volume-describe-%d-%d", i, j))
+			}
+			d.volumesList = append(d.volumesList, volumes)
+			podName := fmt.Sprintf("pod-%d", i)
+			d.podsList = append(d.podsList, podName)
+			var err error
+			// the checksum server sidecar is only needed to verify the data without exec into the pods
+			if VerifyStrategy(d.VeleroCfg.VerifyStrategy) == VerifyByPortForwardHTTP {
+				_, err = CreatePodWithChecksumServer(d.Client, d.NSBaseName, podName, "", volumes, nil)
+			} else {
+				_, err = CreatePod(d.Client, d.NSBaseName, podName, "", "", volumes, nil, nil)
+			}
+			Expect(err).To(Succeed())
+		}
+	})
+	By(fmt.Sprintf("Populate all pods %s with file %s", d.podsList, FILE_NAME), func() {
+		Expect(WaitForPods(ctx, d.Client, d.NSBaseName, d.podsList)).To(Succeed())
+		for i, pod := range d.podsList {
+			for _, volume := range d.volumesList[i] {
+				Expect(CreateFileToPod(ctx, d.NSBaseName, pod, pod, volume,
+					FILE_NAME, fileContent(d.NSBaseName, pod, volume))).To(Succeed())
+			}
+		}
+	})
+	return nil
+}
+
+func (d *DescribeVolumeInfo) Backup() error {
+	if err := d.TestCase.Backup(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Volume information of backup %s should list every PVC protected by %s", d.BackupName, d.dataPath), func() {
+		Expect(BackupVolumeDetailsShouldMatch(ctx, d.Client, d.VeleroCfg.VeleroCLI, d.VeleroCfg.VeleroNamespace,
+			d.NSBaseName, d.BackupName, d.dataPath)).To(Succeed())
+	})
+	if d.dataPath == VolumeProtectedByNativeSnapshot {
+		By("Described snapshots should be created in cloud", func() {
+			snapshotCheckPoint := SnapshotCheckPoint{
+				NamespaceBackedUp: d.NSBaseName,
+				ExpectCount:       POD_COUNT * VOLUME_COUNT_PER_POD,
+				PodName:           d.podsList,
+			}
+			Expect(SnapshotsShouldBeCreatedInCloud(d.VeleroCfg.CloudProvider, d.VeleroCfg.CloudCredentialsFile,
+				d.VeleroCfg.BSLBucket, d.VeleroCfg.BSLConfig, d.VeleroCfg.VSLConfig, d.BackupName, snapshotCheckPoint)).To(Succeed())
+		})
+	}
+	return nil
+}
+
+func (d *DescribeVolumeInfo) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Waiting for all pods to start %s", d.podsList), func() {
+		Expect(WaitForPods(ctx, d.Client, d.NSBaseName, d.podsList)).To(Succeed())
+	})
+	By("Restored data should be the same as the original", func() {
+		for i, pod := range d.podsList {
+			for _, volume := range d.volumesList[i] {
+				Expect(fileExist(ctx, d.VeleroCfg, d.NSBaseName, pod, volume)).To(Succeed())
+			}
+		}
+	})
+	return nil
+}
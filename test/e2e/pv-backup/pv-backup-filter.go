@@ -155,7 +155,7 @@ func (p *PVBackupFiltering) Verify() error {
 					if j%2 == 0 {
 						if p.annotation == OPT_IN_ANN {
 							By(fmt.Sprintf("File should exists in PV %s of pod %s under namespace %s\n", p.volumesList[i][j], p.podsList[k][i], ns), func() {
-								Expect(fileExist(ctx, ns, p.podsList[k][i], p.volumesList[i][j])).To(Succeed(), "File not exist as expect")
+								Expect(fileExist(ctx, p.VeleroCfg, ns, p.podsList[k][i], p.volumesList[i][j])).To(Succeed(), "File not exist as expect")
 							})
 						} else {
 							By(fmt.Sprintf("File should not exist in PV %s of pod %s under namespace %s\n", p.volumesList[i][j], p.podsList[k][i], ns), func() {
@@ -165,7 +165,7 @@ func (p *PVBackupFiltering) Verify() error {
 					} else {
 						if p.annotation == OPT_OUT_ANN {
 							By(fmt.Sprintf("File should exists in PV %s of pod %s under namespace %s\n", p.volumesList[i][j], p.podsList[k][i], ns), func() {
-								Expect(fileExist(ctx, ns, p.podsList[k][i], p.volumesList[i][j])).To(Succeed(), "File not exist as expect")
+								Expect(fileExist(ctx, p.VeleroCfg, ns, p.podsList[k][i], p.volumesList[i][j])).To(Succeed(), "File not exist as expect")
 							})
 						} else {
 							By(fmt.Sprintf("File should not exist in PV %s of pod %s under namespace %s\n", p.volumesList[i][j], p.podsList[k][i], ns), func() {
@@ -184,21 +184,18 @@ func fileContent(namespace, podName, volume string) string {
 	return fmt.Sprintf("ns-%s pod-%s volume-%s", namespace, podName, volume)
 }
 
-func fileExist(ctx context.Context, namespace, podName, volume string) error {
-	c, err := ReadFileFromPodVolume(ctx, namespace, podName, podName, volume, FILE_NAME)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Fail to read file %s from volume %s of pod %s in %s ",
-			FILE_NAME, volume, podName, namespace))
-	}
-	c = strings.Replace(c, "\n", "", -1)
-	origin_content := strings.Replace(fileContent(namespace, podName, volume), "\n", "", -1)
-	if c == origin_content {
-		return nil
-	} else {
-		return errors.New(fmt.Sprintf("UNEXPECTED: File %s does not exist in volume %s of pod %s in namespace %s.",
+// fileExist verifies the file created by CreateFileToPod in the volume by the verify strategy of the config
+func fileExist(ctx context.Context, veleroCfg VeleroConfig, namespace, podName, volume string) error {
+	target := VerifyTarget{Namespace: namespace, Pod: podName, Container: podName, Volume: volume, File: FILE_NAME}
+	// the content is written by echo with a trailing newline
+	if err := VerifyFileContent(ctx, *veleroCfg.ClientToInstallVelero, VerifyStrategy(veleroCfg.VerifyStrategy), target,
+		fileContent(namespace, podName, volume)+"\n"); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("UNEXPECTED: File %s does not exist in volume %s of pod %s in namespace %s.",
 			FILE_NAME, volume, podName, namespace))
 	}
+	return nil
 }
+
 func fileNotExist(ctx context.Context, namespace, podName, volume string) error {
 	_, err := ReadFileFromPodVolume(ctx, namespace, podName, podName, volume, FILE_NAME)
 	if err != nil {
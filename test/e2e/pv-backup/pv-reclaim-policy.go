@@ -0,0 +1,185 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+)
+
+const (
+	reclaimPolicyPod    = "pod-reclaim-policy"
+	reclaimPolicyPVC    = "pvc-reclaim-policy"
+	reclaimPolicyVolume = "volume-reclaim-policy"
+)
+
+// PVReclaimPolicy backs up a PVC bound to a PV of the reclaim policy, deletes the namespace and restores.
+// With Retain policy the PV is statically provisioned (hostPath on kind, provider disk otherwise) and only
+// the PV object is backed up, the restored PVC should re-bind to the retained volume with the data intact.
+// With Delete policy the volume is removed with the namespace, a new PV should be provisioned for the
+// restored PVC and the data is restored by fs-backup, so the PVC is provisioned by the default storage class
+// as the restored PVC is reset to be dynamically provisioned.
+type PVReclaimPolicy struct {
+	TestCase
+	reclaimPolicy corev1.PersistentVolumeReclaimPolicy
+	hostPath      bool
+	pvName        string
+}
+
+var RetainPVRestoreTest func() = TestFunc(&PVReclaimPolicy{reclaimPolicy: corev1.PersistentVolumeReclaimRetain})
+var DeletePVRestoreTest func() = TestFunc(&PVReclaimPolicy{reclaimPolicy: corev1.PersistentVolumeReclaimDelete})
+
+func (p *PVReclaimPolicy) Init() error {
+	p.VeleroCfg = VeleroCfg
+	p.Client = *p.VeleroCfg.ClientToInstallVelero
+	p.UseVolumeSnapshots = false
+	p.VeleroCfg.UseVolumeSnapshots = false
+	p.VeleroCfg.UseNodeAgent = p.reclaimPolicy == corev1.PersistentVolumeReclaimDelete
+	// the PVC of the static hostPath PV has no provisioner to provision a new PV after restore, so it's only
+	// used for Retain policy
+	p.hostPath = p.VeleroCfg.CloudProvider == "kind" && p.reclaimPolicy == corev1.PersistentVolumeReclaimRetain
+	p.NSBaseName = "pv-reclaim-" + strings.ToLower(string(p.reclaimPolicy))
+	p.NSIncluded = &[]string{p.NSBaseName}
+	p.TestMsg = &TestMSG{
+		Desc:      fmt.Sprintf("Restore PVC bound to PV with %s reclaim policy", p.reclaimPolicy),
+		FailedMSG: fmt.Sprintf("Failed to restore PVC bound to PV with %s reclaim policy", p.reclaimPolicy),
+		Text:      fmt.Sprintf("Should restore PVC bound to PV with %s reclaim policy in namespace %s with the data intact", p.reclaimPolicy, p.NSBaseName),
+	}
+	return nil
+}
+
+func (p *PVReclaimPolicy) StartRun() error {
+	p.BackupName = "backup-" + p.NSBaseName + "-" + UUIDgen.String()
+	p.RestoreName = "restore-" + p.NSBaseName + "-" + UUIDgen.String()
+	p.BackupArgs = []string{
+		"create", "--namespace", p.VeleroCfg.VeleroNamespace, "backup", p.BackupName,
+		"--include-namespaces", p.NSBaseName, "--snapshot-volumes=false", "--wait",
+	}
+	if p.VeleroCfg.UseNodeAgent {
+		p.BackupArgs = append(p.BackupArgs, "--default-volumes-to-fs-backup")
+	}
+	p.RestoreArgs = []string{
+		"create", "--namespace", p.VeleroCfg.VeleroNamespace, "restore", p.RestoreName,
+		"--from-backup", p.BackupName, "--wait",
+	}
+	return nil
+}
+
+func (p *PVReclaimPolicy) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s for workload", p.NSBaseName), func() {
+		Expect(CreateNamespace(ctx, p.Client, p.NSBaseName)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", p.NSBaseName))
+	})
+	if p.hostPath {
+		By(fmt.Sprintf("Create hostPath PV with %s reclaim policy and PVC %s requesting it", p.reclaimPolicy, reclaimPolicyPVC), func() {
+			nodes, err := GetWorkerNodes(ctx)
+			Expect(err).To(Succeed())
+			Expect(nodes).NotTo(BeEmpty(), "No node to provision the hostPath PV")
+			p.pvName = "pv-" + p.NSBaseName + "-" + UUIDgen.String()
+			_, err = CreateHostPathPersistentVolume(p.Client, p.pvName, "/tmp/velero-e2e-"+p.pvName, nodes[0], p.reclaimPolicy)
+			Expect(err).To(Succeed())
+			Expect(CreatePvc(p.Client, NewPVC(p.NSBaseName, reclaimPolicyPVC).
+				WithStorageClass(ManualStorageClass).WithVolumeName(p.pvName))).To(Succeed())
+		})
+	} else {
+		By(fmt.Sprintf("Create PVC %s provisioned by the default storage class", reclaimPolicyPVC), func() {
+			_, err := CreatePVC(p.Client, p.NSBaseName, reclaimPolicyPVC, "", nil)
+			Expect(err).To(Succeed())
+		})
+	}
+	By(fmt.Sprintf("Deploy pod %s with PVC %s and populate it with file %s", reclaimPolicyPod, reclaimPolicyPVC, FILE_NAME), func() {
+		_, err := CreatePodWithExistingPVC(p.Client, p.NSBaseName, reclaimPolicyPod, reclaimPolicyPVC, reclaimPolicyVolume)
+		Expect(err).To(Succeed())
+		Expect(WaitForPods(ctx, p.Client, p.NSBaseName, []string{reclaimPolicyPod})).To(Succeed())
+		Expect(CreateFileToPod(ctx, p.NSBaseName, reclaimPolicyPod, reclaimPolicyPod, reclaimPolicyVolume,
+			FILE_NAME, fileContent(p.NSBaseName, reclaimPolicyPod, reclaimPolicyVolume))).To(Succeed())
+	})
+	if !p.hostPath {
+		By(fmt.Sprintf("Set the reclaim policy of the PV bound to PVC %s to %s", reclaimPolicyPVC, p.reclaimPolicy), func() {
+			pvc, err := GetPVC(ctx, p.Client, p.NSBaseName, reclaimPolicyPVC)
+			Expect(err).To(Succeed())
+			p.pvName = pvc.Spec.VolumeName
+			Expect(SetPersistentVolumeReclaimPolicy(ctx, p.Client, p.pvName, p.reclaimPolicy)).To(Succeed())
+		})
+	}
+	return nil
+}
+
+func (p *PVReclaimPolicy) Destroy() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	if err := p.TestCase.Destroy(); err != nil {
+		return err
+	}
+	if p.reclaimPolicy == corev1.PersistentVolumeReclaimRetain {
+		// the restore waits for the Released PV of the same name to go away, so the PV object is deleted
+		// the same way as the disaster recovery, the volume is kept by the storage with Retain policy
+		By(fmt.Sprintf("PV %s should be released and kept, then delete the PV object", p.pvName), func() {
+			Expect(WaitForPersistentVolumePhase(ctx, p.Client, p.pvName, corev1.VolumeReleased, 5*time.Minute)).To(Succeed())
+			Expect(DeletePersistentVolume(ctx, p.Client, p.pvName, 5*time.Minute)).To(Succeed())
+		})
+	} else {
+		By(fmt.Sprintf("PV %s should be deleted with the namespace", p.pvName), func() {
+			Expect(WaitForPersistentVolumeDeleted(ctx, p.Client, p.pvName, 5*time.Minute)).To(Succeed())
+		})
+	}
+	return nil
+}
+
+func (p *PVReclaimPolicy) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Waiting for pod %s to start", reclaimPolicyPod), func() {
+		Expect(WaitForPods(ctx, p.Client, p.NSBaseName, []string{reclaimPolicyPod})).To(Succeed())
+	})
+	By(fmt.Sprintf("PVC %s should be bound to the PV expected by %s reclaim policy", reclaimPolicyPVC, p.reclaimPolicy), func() {
+		pvc, err := GetPVC(ctx, p.Client, p.NSBaseName, reclaimPolicyPVC)
+		Expect(err).To(Succeed())
+		Expect(pvc.Status.Phase).To(Equal(corev1.ClaimBound), fmt.Sprintf("PVC %s is not bound", reclaimPolicyPVC))
+		if p.reclaimPolicy == corev1.PersistentVolumeReclaimRetain {
+			Expect(pvc.Spec.VolumeName).To(Equal(p.pvName), fmt.Sprintf("PVC %s should re-bind to the retained PV", reclaimPolicyPVC))
+			pv, err := GetPersistentVolume(ctx, p.Client, "", p.pvName)
+			Expect(err).To(Succeed())
+			Expect(pv.Spec.PersistentVolumeReclaimPolicy).To(Equal(corev1.PersistentVolumeReclaimRetain))
+		} else {
+			Expect(pvc.Spec.VolumeName).NotTo(Equal(p.pvName), fmt.Sprintf("A new PV should be provisioned for PVC %s", reclaimPolicyPVC))
+		}
+	})
+	By("Restored data should be the same as the original", func() {
+		Expect(fileExist(ctx, p.VeleroCfg, p.NSBaseName, reclaimPolicyPod, reclaimPolicyVolume)).To(Succeed())
+	})
+	return nil
+}
+
+func (p *PVReclaimPolicy) Clean() error {
+	if !p.VeleroCfg.Debug && p.reclaimPolicy == corev1.PersistentVolumeReclaimRetain && p.pvName != "" {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer ctxCancel()
+		By(fmt.Sprintf("Release the volume of PV %s", p.pvName), func() {
+			if err := CleanupNamespacesWithPoll(ctx, p.Client, p.NSBaseName); err != nil {
+				fmt.Printf("Failed to delete namespace %s: %v\n", p.NSBaseName, err)
+			}
+			// the hostPath directory is left on the node, and the provider disk is deleted by the
+			// provisioner once the released PV has Delete policy
+			var err error
+			if p.hostPath {
+				err = DeletePersistentVolume(ctx, p.Client, p.pvName, 5*time.Minute)
+			} else if err = SetPersistentVolumeReclaimPolicy(ctx, p.Client, p.pvName, corev1.PersistentVolumeReclaimDelete); err == nil {
+				err = WaitForPersistentVolumeDeleted(ctx, p.Client, p.pvName, 5*time.Minute)
+			}
+			if err != nil {
+				fmt.Printf("Failed to delete PV %s: %v\n", p.pvName, err)
+			}
+		})
+	}
+	return p.TestCase.Clean()
+}
@@ -0,0 +1,129 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+)
+
+// SharedVolumeMounts backs up a pod whose two containers mount the same volume at different
+// paths, and checks both containers see the restored data at their own paths after restore
+type SharedVolumeMounts struct {
+	TestCase
+	namespace  string
+	volume     string
+	mountPaths map[string]string
+}
+
+var SharedVolumeMountsTest func() = TestFunc(&SharedVolumeMounts{})
+
+func (s *SharedVolumeMounts) Init() error {
+	s.VeleroCfg = VeleroCfg
+	s.Client = *s.VeleroCfg.ClientToInstallVelero
+	s.VeleroCfg.UseVolumeSnapshots = false
+	s.VeleroCfg.UseNodeAgent = true
+	s.NSBaseName = "shared-volume-mounts-"
+	s.namespace = s.NSBaseName + UUIDgen.String()
+	s.volume = "volume-shared"
+	s.mountPaths = map[string]string{
+		"container-writer": "/data-writer",
+		"container-reader": "/mnt/data-reader",
+	}
+	s.TestMsg = &TestMSG{
+		Desc:      "Backup and restore volume mounted by multiple containers at different paths",
+		FailedMSG: "Failed to backup and restore volume mounted by multiple containers at different paths",
+		Text:      "Should restore the data of volume which is visible at all the mount paths of the containers",
+	}
+	return nil
+}
+
+func (s *SharedVolumeMounts) StartRun() error {
+	s.BackupName = "backup-" + s.NSBaseName + UUIDgen.String()
+	s.RestoreName = "restore-" + s.NSBaseName + UUIDgen.String()
+	s.BackupArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "backup", s.BackupName,
+		"--include-namespaces", s.namespace, "--default-volumes-to-fs-backup",
+		"--snapshot-volumes=false", "--wait",
+	}
+	s.RestoreArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "restore", s.RestoreName,
+		"--from-backup", s.BackupName, "--wait",
+	}
+	return nil
+}
+
+func (s *SharedVolumeMounts) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create namespace %s", s.namespace), func() {
+		Expect(CreateNamespace(ctx, s.Client, s.namespace)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", s.namespace))
+	})
+	By(fmt.Sprintf("Create deployment %s with the volume shared by containers", s.NSBaseName), func() {
+		vols := PrepareVolumeList([]string{s.volume})
+		_, err := CreatePVC(s.Client, s.namespace, vols[0].PersistentVolumeClaim.ClaimName, "", nil)
+		Expect(err).To(Succeed())
+		var containers []v1.Container
+		mounts := map[string][]v1.VolumeMount{}
+		for name, path := range s.mountPaths {
+			containers = append(containers, v1.Container{
+				Name:    name,
+				Image:   "gcr.io/velero-gcp/busybox:latest",
+				Command: []string{"sleep", "1000000"},
+			})
+			mounts[name] = []v1.VolumeMount{{Name: s.volume, MountPath: path}}
+		}
+		deployment := NewDeployment(s.NSBaseName, s.namespace, 1, map[string]string{"app": s.NSBaseName}, containers).
+			WithVolumeMounts(vols, mounts).Result()
+		_, err = CreateDeployment(s.Client.ClientGo, s.namespace, deployment)
+		Expect(err).To(Succeed())
+		Expect(WaitForReadyDeployment(s.Client.ClientGo, s.namespace, deployment.Name)).To(Succeed())
+	})
+	By("Write data into the volume from the writer container", func() {
+		pod := s.getPod(ctx)
+		Expect(WriteFileToPod(ctx, s.namespace, pod, "container-writer",
+			fmt.Sprintf("%s/%s", s.mountPaths["container-writer"], FILE_NAME), s.fileContent())).To(Succeed())
+		s.verifyData(ctx, pod)
+	})
+	return nil
+}
+
+func (s *SharedVolumeMounts) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Waiting for deployment %s ready", s.NSBaseName), func() {
+		Expect(WaitForReadyDeployment(s.Client.ClientGo, s.namespace, s.NSBaseName)).To(Succeed())
+	})
+	By("Restored data should be visible at the mount paths of all containers", func() {
+		s.verifyData(ctx, s.getPod(ctx))
+	})
+	return nil
+}
+
+func (s *SharedVolumeMounts) fileContent() string {
+	return fmt.Sprintf("ns-%s volume-%s", s.namespace, s.volume)
+}
+
+func (s *SharedVolumeMounts) getPod(ctx context.Context) string {
+	pods, err := ListPods(ctx, s.Client, s.namespace)
+	Expect(err).To(Succeed())
+	Expect(len(pods.Items)).To(Equal(1), fmt.Sprintf("Only 1 pod should be found in namespace %s", s.namespace))
+	return pods.Items[0].Name
+}
+
+func (s *SharedVolumeMounts) verifyData(ctx context.Context, pod string) {
+	for container, path := range s.mountPaths {
+		content, err := ReadFileFromPod(ctx, s.namespace, pod, container, fmt.Sprintf("%s/%s", path, FILE_NAME))
+		Expect(err).To(Succeed(), fmt.Sprintf("Failed to read file from %s of container %s", path, container))
+		Expect(strings.TrimSpace(content)).To(Equal(s.fileContent()),
+			fmt.Sprintf("Unexpected content of file in %s of container %s", path, container))
+	}
+}
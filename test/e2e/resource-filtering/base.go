@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -29,6 +30,7 @@ import (
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/test"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
 )
 
 type FilteringCase struct {
@@ -160,3 +162,48 @@ func (f *FilteringCase) Verify() error {
 	}
 	return nil
 }
+
+// namespacesShouldBeFiltered checks the description of the backup includes the resources of the included
+// namespaces only when testing in backup, or all the items of the restore are restored when testing in
+// restore, there should be no error in both cases
+func (f *FilteringCase) namespacesShouldBeFiltered(ctx context.Context, included, excluded []string) error {
+	if !f.IsTestInBackup {
+		description, err := DescribeRestore(ctx, f.VeleroCfg.VeleroCLI, f.VeleroCfg.VeleroNamespace, f.RestoreName)
+		if err != nil {
+			return err
+		}
+		if description.Errors != 0 {
+			return errors.Errorf("%d errors in restore %s", description.Errors, f.RestoreName)
+		}
+		if description.ItemsRestored != description.TotalItems {
+			return errors.Errorf("%d of %d items are restored by restore %s", description.ItemsRestored, description.TotalItems, f.RestoreName)
+		}
+		return nil
+	}
+
+	description, err := DescribeBackup(ctx, f.VeleroCfg.VeleroCLI, f.VeleroCfg.VeleroNamespace, f.BackupName)
+	if err != nil {
+		return err
+	}
+	if description.Errors != 0 {
+		return errors.Errorf("%d errors in backup %s", description.Errors, f.BackupName)
+	}
+	resources := map[string]bool{}
+	for _, resource := range description.Resources {
+		resources[resource] = true
+	}
+	for _, namespace := range included {
+		if !resources["v1/Namespace:"+namespace] {
+			return errors.Errorf("included namespace %s is not in backup %s", namespace, f.BackupName)
+		}
+	}
+	for _, namespace := range excluded {
+		for _, resource := range description.Resources {
+			if resource == "v1/Namespace:"+namespace || strings.Contains(resource, ":"+namespace+"/") {
+				return errors.Errorf("resource %s of excluded namespace %s is in backup %s", resource, namespace, f.BackupName)
+			}
+		}
+	}
+	fmt.Printf("%d items of backup %s are filtered by namespaces\n", description.ItemsBackedUp, f.BackupName)
+	return nil
+}
@@ -30,6 +30,7 @@ import (
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/test"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
 )
 
 /*
@@ -43,6 +44,47 @@ type ExcludeFromBackup struct {
 
 var ExcludeFromBackupTest func() = TestFunc(&ExcludeFromBackup{testInBackup})
 
+/*
+Resources with the label velero.io/exclude-from-backup=true are not included
+in backup, even if they are listed in the ordered resources of the backup.
+*/
+
+type ExcludeFromBackupWithOrderedResources struct {
+	ExcludeFromBackup
+	orderMap map[string]string
+}
+
+var ExcludeFromBackupWithOrderedResourcesTest func() = TestFunc(&ExcludeFromBackupWithOrderedResources{ExcludeFromBackup: ExcludeFromBackup{testInBackup}})
+
+func (e *ExcludeFromBackupWithOrderedResources) Init() error {
+	e.ExcludeFromBackup.Init()
+	e.TestMsg = &TestMSG{
+		Desc:      "Backup with the label velero.io/exclude-from-backup=true are not included even if listed in ordered resources test",
+		Text:      "Should not backup resources with the label velero.io/exclude-from-backup=true even if listed in ordered resources",
+		FailedMSG: "Failed to exclude resources listed in ordered resources with the label velero.io/exclude-from-backup=true",
+	}
+	// the secret is labeled with velero.io/exclude-from-backup=true, the others are not
+	e.orderMap = map[string]string{
+		"deployments": fmt.Sprintf("%s/%s", e.NSBaseName, e.NSBaseName),
+		"secrets":     fmt.Sprintf("%s/%s", e.NSBaseName, e.NSBaseName),
+		"configmaps":  fmt.Sprintf("%s/%s", e.NSBaseName, e.NSBaseName),
+	}
+	e.BackupArgs = append(e.BackupArgs, "--ordered-resources", GetOrderedResourcesArg(e.orderMap))
+	return nil
+}
+
+func (e *ExcludeFromBackupWithOrderedResources) Backup() error {
+	if err := e.TestCase.Backup(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Checking resource order in backup %s", e.BackupName), func() {
+		Expect(CheckBackupWithResourceOrder(ctx, e.VeleroCfg.VeleroCLI, e.VeleroCfg.VeleroNamespace, e.BackupName, e.orderMap)).To(Succeed())
+	})
+	return nil
+}
+
 func (e *ExcludeFromBackup) Init() error {
 	e.FilteringCase.Init()
 	e.BackupName = "backup-exclude-from-backup-" + UUIDgen.String()
@@ -124,6 +124,18 @@ func (e *ExcludeNamespaces) CreateResources() error {
 func (e *ExcludeNamespaces) Verify() error {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer ctxCancel()
+	var included, excluded []string
+	for nsNum := 0; nsNum < e.NamespacesTotal; nsNum++ {
+		namespace := fmt.Sprintf("%s-%00000d", e.NSBaseName, nsNum)
+		if nsNum >= e.namespacesExcluded {
+			included = append(included, namespace)
+		} else {
+			excluded = append(excluded, namespace)
+		}
+	}
+	if err := e.namespacesShouldBeFiltered(ctx, included, excluded); err != nil {
+		return err
+	}
 	// Verify that we got back all of the namespaces we created
 	for nsNum := 0; nsNum < e.namespacesExcluded; nsNum++ {
 		excludeNSName := fmt.Sprintf("%s-%00000d", e.NSBaseName, nsNum)
@@ -120,6 +120,18 @@ func (i *IncludeNamespaces) CreateResources() error {
 func (i *IncludeNamespaces) Verify() error {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer ctxCancel()
+	var included, excluded []string
+	for nsNum := 0; nsNum < i.NamespacesTotal; nsNum++ {
+		namespace := fmt.Sprintf("%s-%00000d", i.NSBaseName, nsNum)
+		if nsNum < i.namespacesIncluded {
+			included = append(included, namespace)
+		} else {
+			excluded = append(excluded, namespace)
+		}
+	}
+	if err := i.namespacesShouldBeFiltered(ctx, included, excluded); err != nil {
+		return err
+	}
 	// Verify that we got back all of the namespaces we created
 	for nsNum := 0; nsNum < i.namespacesIncluded; nsNum++ {
 		checkNSName := fmt.Sprintf("%s-%00000d", i.NSBaseName, nsNum)
@@ -29,6 +29,7 @@ import (
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/test"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
 )
 
 /*
@@ -126,6 +127,17 @@ func (l *LabelSelector) CreateResources() error {
 	return nil
 }
 
+func (l *LabelSelector) Backup() error {
+	if err := l.GetTestCase().Backup(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	// make sure a broken selector can't pass silently by checking the contents of the backup
+	return BackupContentsShouldMatchSelector(ctx, l.Client, l.VeleroCfg.VeleroCLI, l.VeleroCfg.VeleroNamespace,
+		l.BackupName, *l.NSIncluded, "resourcefiltering=true")
+}
+
 func (l *LabelSelector) Verify() error {
 	for nsNum := 0; nsNum < l.NamespacesTotal; nsNum++ {
 		namespace := fmt.Sprintf("%s-%00000d", l.NSBaseName, nsNum)
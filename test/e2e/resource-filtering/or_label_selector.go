@@ -0,0 +1,182 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filtering
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+/*
+Include resources matching the label selector or any of the OR label selectors, and restore them
+into the mapped namespaces to check exactly the matched resources are backed up.
+	velero backup create <backup-name> --selector <key>=<value>
+	spec.orLabelSelectors of the backup, which has no flag in velero CLI
+*/
+
+// BackupWithOrLabelSelector runs the backups with the label selector and the OR label selectors
+// against the resources labeled with a=1, b=2, both of them and none of them
+func BackupWithOrLabelSelector() {
+	var (
+		veleroCfg VeleroConfig
+		srcNS     string
+		otherNS   string
+	)
+	// the names of the resources by their labels
+	resources := map[string]map[string]string{
+		"res-a":    {"a": "1"},
+		"res-b":    {"b": "2"},
+		"res-ab":   {"a": "1", "b": "2"},
+		"res-none": {"c": "3"},
+	}
+	restoreShouldHave := func(ctx context.Context, ns string, expected ...string) {
+		for name := range resources {
+			exist := false
+			for _, e := range expected {
+				if e == name {
+					exist = true
+				}
+			}
+			Expect(LabeledResourcesShouldExist(ctx, *veleroCfg.ClientToInstallVelero, ns, name, exist)).To(Succeed())
+		}
+	}
+	restoreInto := func(ctx context.Context, backupName, restoreName, targetNS string) {
+		args := []string{
+			"create", "--namespace", veleroCfg.VeleroNamespace, "restore", restoreName,
+			"--from-backup", backupName, "--namespace-mappings", srcNS + ":" + targetNS, "--wait",
+		}
+		Expect(VeleroRestoreExec(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, args, velerov1api.RestorePhaseCompleted)).To(Succeed(), func() string {
+			RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+			return "Fail to restore workload"
+		})
+	}
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		srcNS = "or-selector-" + UUIDgen.String()
+		otherNS = "or-selector-other-" + UUIDgen.String()
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By("Clean namespaces after test", func() {
+				CleanupNamespaces(context.Background(), *veleroCfg.ClientToInstallVelero, srcNS)
+				CleanupNamespaces(context.Background(), *veleroCfg.ClientToInstallVelero, otherNS)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Only the resources matching the label selector or any of the OR label selectors should be backed up", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		selectorBackup := "backup-selector-" + UUIDgen.String()
+		orSelectorBackup := "backup-or-selector-" + UUIDgen.String()
+		noMatchBackup := "backup-selector-no-match-" + UUIDgen.String()
+
+		By(fmt.Sprintf("Create labeled resources in namespaces %s and %s", srcNS, otherNS), func() {
+			Expect(CreateNamespace(ctx, client, srcNS)).To(Succeed())
+			Expect(CreateNamespace(ctx, client, otherNS)).To(Succeed())
+			for name, labels := range resources {
+				Expect(CreateLabeledResources(client, srcNS, name, labels)).To(Succeed())
+			}
+			Expect(CreateLabeledResources(client, otherNS, "res-a", resources["res-a"])).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Backup namespace %s with label selector a=1", srcNS), func() {
+			backupCfg := BackupConfig{
+				BackupName: selectorBackup,
+				Namespace:  srcNS,
+				Selector:   "a=1",
+			}
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, selectorBackup, "")
+				return "Fail to backup workload"
+			})
+		})
+
+		By(fmt.Sprintf("Backup namespace %s with OR label selectors a=1 and b=2", srcNS), func() {
+			Expect(CreateBackupWithOrSelectors(ctx, client, veleroCfg.VeleroNamespace, orSelectorBackup,
+				[]string{srcNS}, []map[string]string{{"a": "1"}, {"b": "2"}})).To(Succeed())
+			backup, err := WaitForBackupCompletion(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, orSelectorBackup, 10*time.Minute)
+			Expect(err).To(Succeed())
+			Expect(backup.Status.Phase).To(Equal(velerov1api.BackupPhaseCompleted), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, orSelectorBackup, "")
+				return fmt.Sprintf("Unexpected phase of backup %s", orSelectorBackup)
+			})
+		})
+
+		By("Backup with label selector matching no resource should be completed without items", func() {
+			backupCfg := BackupConfig{
+				BackupName: noMatchBackup,
+				Namespace:  srcNS,
+				Selector:   "a=404",
+			}
+			Expect(VeleroBackupNamespace(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupCfg)).To(Succeed(), func() string {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, noMatchBackup, "")
+				return "Fail to backup workload"
+			})
+			items, err := GetBackupTotalItems(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, noMatchBackup)
+			Expect(err).To(Succeed())
+			Expect(items).To(BeZero(), fmt.Sprintf("Backup %s should have no item", noMatchBackup))
+		})
+
+		// the namespace is deleted to check it's excluded from the backup with OR label selectors
+		By(fmt.Sprintf("Delete namespace %s not included by the backups", otherNS), func() {
+			Expect(DeleteNamespace(ctx, client, otherNS, true)).To(Succeed())
+		})
+
+		By(fmt.Sprintf("Resources matching label selector a=1 should be restored from backup %s", selectorBackup), func() {
+			targetNS := srcNS + "-selector"
+			restoreInto(ctx, selectorBackup, "restore-selector-"+UUIDgen.String(), targetNS)
+			restoreShouldHave(ctx, targetNS, "res-a", "res-ab")
+		})
+
+		By(fmt.Sprintf("Resources matching a=1 or b=2 should be restored from backup %s", orSelectorBackup), func() {
+			targetNS := srcNS + "-or-selector"
+			restoreInto(ctx, orSelectorBackup, "restore-or-selector-"+UUIDgen.String(), targetNS)
+			restoreShouldHave(ctx, targetNS, "res-a", "res-b", "res-ab")
+			_, err := GetNamespace(ctx, client, otherNS)
+			Expect(err).To(HaveOccurred(), fmt.Sprintf("Namespace %s not included should not be restored", otherNS))
+		})
+	})
+}
@@ -0,0 +1,215 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filtering
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+/*
+Backup the namespace with the combinations of the resource type filters and check the kinds of
+the resources in the backup.
+	velero backup create <backup-name> --include-resources <resources>
+	velero backup create <backup-name> --exclude-resources <resources>
+	velero backup create <backup-name> --include-cluster-resources=<true|false>
+*/
+
+const (
+	kindDeployment  = "apps/v1/Deployment"
+	kindService     = "v1/Service"
+	kindSecret      = "v1/Secret"
+	kindPVC         = "v1/PersistentVolumeClaim"
+	kindPV          = "v1/PersistentVolume"
+	kindClusterRole = "rbac.authorization.k8s.io/v1/ClusterRole"
+)
+
+// ResourceFilteringCase is a backup with the resource type filters, and the kinds of resources
+// which should be or not be in the backup
+type ResourceFilteringCase struct {
+	Name     string
+	Args     []string
+	Included []string
+	Excluded []string
+}
+
+var resourceFilteringCases = []ResourceFilteringCase{
+	{
+		Name:     "include-resources",
+		Args:     []string{"--include-resources", "deployments,services"},
+		Included: []string{kindDeployment, kindService},
+		Excluded: []string{kindSecret, kindPVC, kindPV, kindClusterRole},
+	},
+	{
+		Name:     "exclude-resources",
+		Args:     []string{"--exclude-resources", "secrets,services"},
+		Included: []string{kindDeployment, kindPVC, kindPV},
+		Excluded: []string{kindSecret, kindService, kindClusterRole},
+	},
+	{
+		Name:     "include-cluster-resources",
+		Args:     []string{"--include-resources", "clusterroles", "--include-cluster-resources=true"},
+		Included: []string{kindClusterRole},
+		Excluded: []string{kindDeployment, kindService, kindSecret, kindPVC},
+	},
+	{
+		// the PVs are cluster scoped, so they are excluded even they are bound to the PVCs in the backup
+		Name:     "exclude-cluster-resources",
+		Args:     []string{"--include-cluster-resources=false"},
+		Included: []string{kindDeployment, kindService, kindSecret, kindPVC},
+		Excluded: []string{kindPV, kindClusterRole},
+	},
+	{
+		// the excluded resources take precedence over the PVs backed up along with the PVCs
+		Name:     "pvc-without-pv",
+		Args:     []string{"--exclude-resources", "persistentvolumes"},
+		Included: []string{kindPVC},
+		Excluded: []string{kindPV},
+	},
+}
+
+func ResourceFilteringTest() {
+	var (
+		veleroCfg   VeleroConfig
+		testNS      string
+		clusterRole string
+	)
+
+	BeforeEach(func() {
+		veleroCfg = VeleroCfg
+		veleroCfg.UseVolumeSnapshots = false
+		var err error
+		flag.Parse()
+		UUIDgen, err = uuid.NewRandom()
+		Expect(err).To(Succeed())
+		testNS = "resource-type-filtering-" + UUIDgen.String()
+		clusterRole = "clusterrole-" + testNS
+		if veleroCfg.InstallVelero {
+			Expect(VeleroInstall(context.Background(), &veleroCfg)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		// the cluster scoped resources are not removed along with the namespace, clean them up
+		// even the test is in debug mode or failed
+		By(fmt.Sprintf("Clean clusterrole %s after test", clusterRole), func() {
+			Expect(CleanupClusterRole(context.Background(), *veleroCfg.ClientToInstallVelero, testNS)).To(Succeed())
+		})
+		if !veleroCfg.Debug {
+			By("Clean backups after test", func() {
+				DeleteBackups(context.Background(), *veleroCfg.ClientToInstallVelero)
+			})
+			By(fmt.Sprintf("Delete namespace %s", testNS), func() {
+				DeleteNamespace(context.Background(), *veleroCfg.ClientToInstallVelero, testNS, true)
+			})
+			if veleroCfg.InstallVelero {
+				Expect(VeleroUninstall(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace)).To(Succeed())
+			}
+		}
+	})
+
+	It("Only the kinds of resources matching the resource type filters should be backed up", func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+		defer ctxCancel()
+		client := *veleroCfg.ClientToInstallVelero
+		labels := map[string]string{"e2e-resource-filtering": UUIDgen.String()}
+		podName := "pod-resource-filtering"
+
+		By(fmt.Sprintf("Create deployment, service, secret, PVC in namespace %s and clusterrole %s", testNS, clusterRole), func() {
+			Expect(CreateNamespace(ctx, client, testNS)).To(Succeed())
+			deployment, err := CreateDeployment(client.ClientGo, testNS, NewDeployment("deploy-resource-filtering", testNS, 1, labels, nil).Result())
+			Expect(err).To(Succeed())
+			Expect(WaitForReadyDeployment(client.ClientGo, testNS, deployment.Name)).To(Succeed())
+			Expect(CreateService(ctx, client, testNS, "svc-resource-filtering", labels, &corev1.ServiceSpec{
+				Selector: labels,
+				Ports:    []corev1.ServicePort{{Port: 80}},
+			})).To(Succeed())
+			_, err = CreateSecret(client.ClientGo, testNS, "secret-resource-filtering", labels)
+			Expect(err).To(Succeed())
+			// the PVC is bound to the PV after the pod is running
+			_, err = CreatePod(client, testNS, podName, "", "", []string{"volume-resource-filtering"}, nil, nil)
+			Expect(err).To(Succeed())
+			Expect(WaitForPods(ctx, client, testNS, []string{podName})).To(Succeed())
+			Expect(CreateClusterRole(ctx, client, clusterRole, labels)).To(Succeed())
+		})
+
+		for _, c := range resourceFilteringCases {
+			backupName := fmt.Sprintf("backup-%s-%s", c.Name, UUIDgen.String())
+			By(fmt.Sprintf("Backup %s with %v", backupName, c.Args), func() {
+				args := []string{
+					"create", "--namespace", veleroCfg.VeleroNamespace, "backup", backupName,
+					"--include-namespaces", testNS,
+				}
+				args = append(args, c.Args...)
+				args = append(args, "--wait")
+				Expect(VeleroBackupExec(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, args)).To(Succeed(), func() string {
+					RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+					return "Fail to backup workload"
+				})
+			})
+
+			By(fmt.Sprintf("Kinds of resources in backup %s should match the filters", backupName), func() {
+				contents, err := GetBackupContents(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName)
+				Expect(err).To(Succeed())
+				for _, kind := range c.Included {
+					if kind == kindClusterRole {
+						// other clusterroles of the cluster are backed up as well, check the one created by the test
+						Expect(backupHasResource(contents, kind, clusterRole)).To(BeTrue(), fmt.Sprintf("%s %s should be in backup %s", kind, clusterRole, backupName))
+						continue
+					}
+					Expect(backupHasKind(contents, kind)).To(BeTrue(), fmt.Sprintf("%s should be in backup %s", kind, backupName))
+				}
+				for _, kind := range c.Excluded {
+					Expect(backupHasKind(contents, kind)).To(BeFalse(), fmt.Sprintf("%s should not be in backup %s", kind, backupName))
+				}
+			})
+		}
+	})
+}
+
+// backupHasKind returns whether any resource of the kind is in the contents got by GetBackupContents
+func backupHasKind(contents []string, kind string) bool {
+	for _, c := range contents {
+		if strings.HasPrefix(c, kind+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// backupHasResource returns whether the resource of the kind and the name is in the contents got by GetBackupContents,
+// the name of the namespaced resource is in the format of "<namespace>/<name>"
+func backupHasResource(contents []string, kind, name string) bool {
+	for _, c := range contents {
+		if c == kind+":"+name {
+			return true
+		}
+	}
+	return false
+}
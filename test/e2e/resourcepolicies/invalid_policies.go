@@ -0,0 +1,223 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/google/uuid"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// invalidPolicyCase is a malformed resource policies document and the substrings expected in the validation
+// errors of the backup referencing it
+type invalidPolicyCase struct {
+	name     string
+	yaml     string
+	messages []string
+}
+
+var invalidPolicyCases = []invalidPolicyCase{
+	{
+		name: "bad-version",
+		yaml: `version: v2
+volumePolicies:
+- conditions:
+    capacity: "0,100Gi"
+  action:
+    type: skip
+`,
+		messages: []string{"incompatible version number v2"},
+	},
+	{
+		name: "unknown-condition",
+		yaml: `version: v1
+volumePolicies:
+- conditions:
+    colour: red
+  action:
+    type: skip
+`,
+		messages: []string{"failed to decode volume conditions", "field colour not found"},
+	},
+	{
+		name: "bad-capacity",
+		yaml: `version: v1
+volumePolicies:
+- conditions:
+    capacity: "abc,3Gi"
+  action:
+    type: skip
+`,
+		messages: []string{"wrong format of Capacity abc"},
+	},
+	{
+		name: "unknown-action",
+		yaml: `version: v1
+volumePolicies:
+- conditions:
+    capacity: "0,100Gi"
+  action:
+    type: unknown-action
+`,
+		messages: []string{"invalid action type unknown-action"},
+	},
+}
+
+// ResourcePoliciesInvalidCase backs up a namespace with a volume by each of the invalid resource policies, the
+// backups should fail the validation without backing up anything
+type ResourcePoliciesInvalidCase struct {
+	TestCase
+	volName string
+	// results are the results of the backups keyed by the names of the invalid policy cases
+	results map[string]*BackupResult
+}
+
+var ResourcePoliciesInvalidTest func() = TestFunc(&ResourcePoliciesInvalidCase{})
+
+func (r *ResourcePoliciesInvalidCase) Init() error {
+	UUIDgen, _ = uuid.NewRandom()
+	r.VeleroCfg = VeleroCfg
+	r.Client = *r.VeleroCfg.ClientToInstallVelero
+	r.VeleroCfg.UseVolumeSnapshots = false
+	r.VeleroCfg.UseNodeAgent = true
+	r.NSBaseName = "rp-invalid-" + UUIDgen.String()
+	r.NamespacesTotal = 1
+	r.NSIncluded = &[]string{r.NSBaseName}
+	r.volName = "vol-" + r.NSBaseName
+	r.BackupName = "backup-rp-invalid-" + UUIDgen.String()
+	r.results = map[string]*BackupResult{}
+	r.TestMsg = &TestMSG{
+		Desc:      "Fail the validation of backup by invalid resource policies",
+		FailedMSG: "Failed to fail the validation of backup by invalid resource policies",
+		Text:      fmt.Sprintf("Should fail the validation of backup of namespace %s by invalid resource policies", r.NSBaseName),
+	}
+	return nil
+}
+
+func invalidPolicyConfigmap(c invalidPolicyCase) string {
+	return "cm-invalid-policies-" + c.name
+}
+
+func (r *ResourcePoliciesInvalidCase) invalidPolicyBackup(c invalidPolicyCase) string {
+	return r.BackupName + "-" + c.name
+}
+
+func (r *ResourcePoliciesInvalidCase) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create deployment %s with volume %s in namespace %s", r.NSBaseName, r.volName, r.NSBaseName), func() {
+		Expect(CreateNamespace(ctx, r.Client, r.NSBaseName)).To(Succeed())
+		_, err := CreatePVC(r.Client, r.NSBaseName, "pvc-0", "", nil)
+		Expect(err).To(Succeed())
+		deployment := NewDeployment(r.NSBaseName, r.NSBaseName, 1, map[string]string{"resource-policies": "invalid"}, nil).
+			WithVolume(PrepareVolumeList([]string{r.volName})).Result()
+		_, err = CreateDeployment(r.Client.ClientGo, r.NSBaseName, deployment)
+		Expect(err).To(Succeed())
+		Expect(WaitForReadyDeployment(r.Client.ClientGo, r.NSBaseName, r.NSBaseName)).To(Succeed())
+	})
+
+	for _, c := range invalidPolicyCases {
+		cmName := invalidPolicyConfigmap(c)
+		By(fmt.Sprintf("Create configmap %s of invalid resource policies in namespace %s", cmName, r.VeleroCfg.VeleroNamespace), func() {
+			Expect(CreateConfigMapFromYAMLData(r.Client.ClientGo, c.yaml, cmName, r.VeleroCfg.VeleroNamespace)).To(Succeed())
+		})
+	}
+	return nil
+}
+
+// Backup backs up the namespace by each of the invalid policies, the results are verified by Verify
+func (r *ResourcePoliciesInvalidCase) Backup() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	for _, c := range invalidPolicyCases {
+		backupCfg := BackupConfig{
+			BackupName:                r.invalidPolicyBackup(c),
+			Namespace:                 r.NSBaseName,
+			DefaultVolumesToFsBackup:  true,
+			ResourcePoliciesConfigmap: invalidPolicyConfigmap(c),
+		}
+		result, err := VeleroBackupNamespaceWithResult(ctx, r.VeleroCfg.VeleroCLI, r.VeleroCfg.VeleroNamespace, backupCfg)
+		if err != nil {
+			return err
+		}
+		r.results[c.name] = result
+	}
+	return nil
+}
+
+// Destroy keeps the namespace as nothing is backed up to be restored
+func (r *ResourcePoliciesInvalidCase) Destroy() error {
+	return nil
+}
+
+func (r *ResourcePoliciesInvalidCase) Restore() error {
+	return nil
+}
+
+func (r *ResourcePoliciesInvalidCase) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	for _, c := range invalidPolicyCases {
+		backupName := r.invalidPolicyBackup(c)
+		By(fmt.Sprintf("Backup %s should fail the validation of resource policies %s", backupName, c.name), func() {
+			result := r.results[c.name]
+			Expect(result.Phase).To(Equal(velerov1api.BackupPhaseFailedValidation), fmt.Sprintf("Unexpected phase of backup %s, stderr: %s", backupName, result.Stderr))
+			validationErrors := strings.Join(result.ValidationErrors, "\n")
+			messages := append([]string{fmt.Sprintf("resource policies %s/%s", r.VeleroCfg.VeleroNamespace, invalidPolicyConfigmap(c))}, c.messages...)
+			for _, message := range messages {
+				Expect(validationErrors).To(ContainSubstring(message), fmt.Sprintf("Validation errors of backup %s should explain the invalid policies", backupName))
+			}
+		})
+
+		By(fmt.Sprintf("Nothing should be backed up by backup %s", backupName), func() {
+			pvbs, err := ListPodVolumeBackups(ctx, r.Client, r.VeleroCfg.VeleroNamespace, backupName)
+			Expect(err).To(Succeed())
+			Expect(pvbs).To(BeEmpty(), fmt.Sprintf("No pod volume backup should be created for backup %s", backupName))
+			backup, err := GetBackupObject(ctx, r.VeleroCfg.VeleroCLI, r.VeleroCfg.VeleroNamespace, backupName)
+			Expect(err).To(Succeed())
+			if backup.Status.Progress != nil {
+				Expect(backup.Status.Progress.ItemsBackedUp).To(BeZero(), fmt.Sprintf("No item should be backed up by backup %s", backupName))
+			}
+			Expect(backup.Status.VolumeSnapshotsAttempted).To(BeZero(), fmt.Sprintf("No volume snapshot should be taken for backup %s", backupName))
+			Expect(backup.Status.CSIVolumeSnapshotsAttempted).To(BeZero(), fmt.Sprintf("No CSI volume snapshot should be taken for backup %s", backupName))
+		})
+	}
+	return nil
+}
+
+func (r *ResourcePoliciesInvalidCase) Clean() error {
+	if !r.VeleroCfg.Debug {
+		for _, c := range invalidPolicyCases {
+			if err := DeleteConfigmap(r.Client.ClientGo, r.VeleroCfg.VeleroNamespace, invalidPolicyConfigmap(c)); err != nil {
+				return err
+			}
+		}
+	}
+	return r.GetTestCase().Clean()
+}
@@ -0,0 +1,107 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filtering
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// skipAction is the only action type of the volume policies accepted by the Velero server for now, the
+// others fail the validation of the backup
+const skipAction = "skip"
+
+type volumePolicyAction struct {
+	Type string `yaml:"type"`
+}
+
+type volumePolicy struct {
+	Conditions map[string]interface{} `yaml:"conditions"`
+	Action     volumePolicyAction     `yaml:"action"`
+}
+
+type resourcePolicies struct {
+	Version        string         `yaml:"version"`
+	VolumePolicies []volumePolicy `yaml:"volumePolicies"`
+}
+
+// VolumePolicyBuilder builds the volume policy matching the volumes by all of its conditions, the matched
+// volumes are skipped unless another action is specified
+type VolumePolicyBuilder struct {
+	policy volumePolicy
+}
+
+func NewVolumePolicyBuilder() *VolumePolicyBuilder {
+	return &VolumePolicyBuilder{policy: volumePolicy{
+		Conditions: map[string]interface{}{},
+		Action:     volumePolicyAction{Type: skipAction},
+	}}
+}
+
+// WithCapacityRange matches the volumes whose capacity is in the inclusive range, the range is open at the
+// bound which is empty, and the lower bound "0" is the same as an empty one
+func (b *VolumePolicyBuilder) WithCapacityRange(lower, upper string) *VolumePolicyBuilder {
+	b.policy.Conditions["capacity"] = lower + "," + upper
+	return b
+}
+
+// WithStorageClasses matches the volumes of any of the storage classes
+func (b *VolumePolicyBuilder) WithStorageClasses(storageClasses ...string) *VolumePolicyBuilder {
+	b.policy.Conditions["storageClass"] = storageClasses
+	return b
+}
+
+// WithNFS matches all the NFS volumes
+func (b *VolumePolicyBuilder) WithNFS() *VolumePolicyBuilder {
+	b.policy.Conditions["nfs"] = map[string]interface{}{}
+	return b
+}
+
+// WithCSIDriver matches the CSI volumes of the driver
+func (b *VolumePolicyBuilder) WithCSIDriver(driver string) *VolumePolicyBuilder {
+	b.policy.Conditions["csi"] = map[string]interface{}{"driver": driver}
+	return b
+}
+
+// WithAction sets the action type of the matched volumes
+func (b *VolumePolicyBuilder) WithAction(actionType string) *VolumePolicyBuilder {
+	b.policy.Action.Type = actionType
+	return b
+}
+
+// PoliciesBuilder composes the YAML document of the resource policies, the volume policies are matched
+// in the order they're added
+type PoliciesBuilder struct {
+	policies resourcePolicies
+}
+
+func NewPoliciesBuilder() *PoliciesBuilder {
+	return &PoliciesBuilder{policies: resourcePolicies{Version: "v1"}}
+}
+
+func (b *PoliciesBuilder) WithVolumePolicy(policy *VolumePolicyBuilder) *PoliciesBuilder {
+	b.policies.VolumePolicies = append(b.policies.VolumePolicies, policy.policy)
+	return b
+}
+
+func (b *PoliciesBuilder) YAML() (string, error) {
+	data, err := yaml.Marshal(b.policies)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal resource policies")
+	}
+	return string(data), nil
+}
@@ -0,0 +1,195 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// storageClassPolicyCases are the volumes skipped or not by the policies skipping the storage class, which
+// are the policies of the configmap before it's updated
+var storageClassPolicyCases = []volumeCase{
+	{storageClass: "e2e-storage-class", capacity: "1Gi", skipped: true, reason: "storage class e2e-storage-class matches the skip policy"},
+	{storageClass: "e2e-storage-class-2", capacity: "2Gi", skipped: false, reason: "storage class e2e-storage-class-2 doesn't match the skip policy"},
+	{storageClass: "e2e-storage-class-2", capacity: "1Gi", skipped: false, reason: "storage class e2e-storage-class-2 doesn't match the skip policy"},
+	{storageClass: "e2e-storage-class", capacity: "3Gi", skipped: true, reason: "storage class e2e-storage-class matches the skip policy"},
+}
+
+// capacityPolicyCases are the same volumes as storageClassPolicyCases skipped or not by the policies skipping
+// the capacity range, which are the policies of the configmap after it's updated
+var capacityPolicyCases = []volumeCase{
+	{storageClass: "e2e-storage-class", capacity: "1Gi", skipped: false, reason: "1Gi is below the lower boundary 2Gi of capacity range"},
+	{storageClass: "e2e-storage-class-2", capacity: "2Gi", skipped: true, reason: "2Gi equals the inclusive lower boundary of capacity range"},
+	{storageClass: "e2e-storage-class-2", capacity: "1Gi", skipped: false, reason: "1Gi is below the lower boundary 2Gi of capacity range"},
+	{storageClass: "e2e-storage-class", capacity: "3Gi", skipped: true, reason: "3Gi equals the inclusive upper boundary of capacity range"},
+}
+
+// policyUpdateBackup is a backup taken with the configmap of the policies, and restored into the mapped
+// namespaces to be verified by cases
+type policyUpdateBackup struct {
+	backupName, restoreName string
+	policies                *PoliciesBuilder
+	yamlConfig              string
+	cases                   []volumeCase
+	namespaceMappings       map[string]string
+}
+
+// ResourcePoliciesUpdateCase backs up the same namespaces twice with the configmap of the resource policies
+// updated in place between the backups, the policies are read from the configmap when each backup is taken
+type ResourcePoliciesUpdateCase struct {
+	ResourcePoliciesCase
+	backups []*policyUpdateBackup
+}
+
+var ResourcePoliciesUpdateTest func() = TestFunc(&ResourcePoliciesUpdateCase{})
+
+func (r *ResourcePoliciesUpdateCase) Init() error {
+	if err := r.ResourcePoliciesCase.Init(); err != nil {
+		return err
+	}
+	r.backups = []*policyUpdateBackup{
+		{
+			backupName:  "backup-rp-storage-class-" + UUIDgen.String(),
+			restoreName: "restore-rp-storage-class-" + UUIDgen.String(),
+			policies:    NewPoliciesBuilder().WithVolumePolicy(NewVolumePolicyBuilder().WithStorageClasses("e2e-storage-class")),
+			cases:       storageClassPolicyCases,
+		},
+		{
+			backupName:  "backup-rp-capacity-" + UUIDgen.String(),
+			restoreName: "restore-rp-capacity-" + UUIDgen.String(),
+			policies:    NewPoliciesBuilder().WithVolumePolicy(NewVolumePolicyBuilder().WithCapacityRange("2Gi", "3Gi")),
+			cases:       capacityPolicyCases,
+		},
+	}
+
+	// the large file is written into the volumes backed up by any of the backups
+	r.volumeCases = make([]volumeCase, len(storageClassPolicyCases))
+	for i := range r.volumeCases {
+		r.volumeCases[i] = storageClassPolicyCases[i]
+		r.volumeCases[i].skipped = storageClassPolicyCases[i].skipped && capacityPolicyCases[i].skipped
+	}
+	r.NSBaseName = "rp-policy-update-" + UUIDgen.String()
+	r.NamespacesTotal = len(r.volumeCases)
+	r.NSIncluded = &[]string{}
+	for nsNum := 0; nsNum < r.NamespacesTotal; nsNum++ {
+		*r.NSIncluded = append(*r.NSIncluded, fmt.Sprintf("%s-%00000d", r.NSBaseName, nsNum))
+	}
+
+	for i, backup := range r.backups {
+		var err error
+		if backup.yamlConfig, err = backup.policies.YAML(); err != nil {
+			return err
+		}
+		// the mapped namespaces share the prefix of NSBaseName to be cleaned up with the others
+		backup.namespaceMappings = map[string]string{}
+		for _, ns := range *r.NSIncluded {
+			backup.namespaceMappings[ns] = fmt.Sprintf("%s-%c", ns, 'a'+i)
+		}
+	}
+	// the configmap is created with the policies of the first backup
+	r.yamlConfig = r.backups[0].yamlConfig
+	r.useBackup(r.backups[0])
+
+	r.TestMsg = &TestMSG{
+		Desc:      "Skip backup of volume by the resource policies updated between backups",
+		FailedMSG: "Failed to skip backup of volume by the resource policies updated between backups",
+		Text:      fmt.Sprintf("Should backup PVs in namespace %s respect to the resource policies when each backup is taken", *r.NSIncluded),
+	}
+	return nil
+}
+
+// useBackup makes the backup and restore of TestCase be the ones of backup
+func (r *ResourcePoliciesUpdateCase) useBackup(backup *policyUpdateBackup) {
+	r.BackupName = backup.backupName
+	r.RestoreName = backup.restoreName
+	r.BackupArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "backup", r.BackupName,
+		"--resource-policies-configmap", r.cmName,
+		"--include-namespaces", strings.Join(*r.NSIncluded, ","),
+		"--default-volumes-to-fs-backup",
+		"--snapshot-volumes=false", "--wait",
+	}
+	var mappings []string
+	for src, dst := range backup.namespaceMappings {
+		mappings = append(mappings, src+":"+dst)
+	}
+	sort.Strings(mappings)
+	r.RestoreArgs = []string{
+		"create", "--namespace", VeleroCfg.VeleroNamespace, "restore", r.RestoreName,
+		"--from-backup", r.BackupName, "--namespace-mappings", strings.Join(mappings, ","), "--wait",
+	}
+}
+
+// Backup takes the backups in order, the configmap is updated in place with the policies of each backup
+// before it's taken
+func (r *ResourcePoliciesUpdateCase) Backup() error {
+	for i, backup := range r.backups {
+		if i > 0 {
+			By(fmt.Sprintf("Update configmap %s in namespace %s with the policies of backup %s", r.cmName, r.VeleroCfg.VeleroNamespace, backup.backupName), func() {
+				Expect(UpdateConfigMapFromYAMLData(r.Client.ClientGo, backup.yamlConfig, r.cmName, r.VeleroCfg.VeleroNamespace)).To(Succeed())
+				Expect(ConfigMapDataShouldBe(r.Client.ClientGo, r.VeleroCfg.VeleroNamespace, r.cmName, r.cmName, backup.yamlConfig)).To(Succeed(),
+					fmt.Sprintf("Content of configmap %s in namespaces %s is not updated", r.cmName, r.VeleroCfg.VeleroNamespace))
+			})
+		}
+		r.useBackup(backup)
+		if err := r.ResourcePoliciesCase.Backup(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore restores each backup into its own mapped namespaces
+func (r *ResourcePoliciesUpdateCase) Restore() error {
+	for _, backup := range r.backups {
+		r.useBackup(backup)
+		if err := r.ResourcePoliciesCase.Restore(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ResourcePoliciesUpdateCase) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 20*time.Minute)
+	defer ctxCancel()
+	for _, backup := range r.backups {
+		// the backup records only the reference to the configmap rather than the policies, so the policies in
+		// effect for each backup are proven by the volumes skipped in it
+		By(fmt.Sprintf("Backup %s should reference configmap %s of the resource policies", backup.backupName, r.cmName), func() {
+			obj, err := GetBackupObject(ctx, r.VeleroCfg.VeleroCLI, r.VeleroCfg.VeleroNamespace, backup.backupName)
+			Expect(err).To(Succeed(), fmt.Sprintf("Failed to get backup %s", backup.backupName))
+			Expect(obj.Spec.ResourcePolicy).NotTo(BeNil(), fmt.Sprintf("Backup %s should reference the resource policies", backup.backupName))
+			Expect(obj.Spec.ResourcePolicy.Name).To(Equal(r.cmName))
+		})
+		r.verifyBackupVolumes(ctx, backup.backupName, backup.cases)
+		r.verifyRestoredData(ctx, backup.cases, backup.namespaceMappings)
+	}
+	return nil
+}
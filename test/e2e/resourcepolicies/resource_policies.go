@@ -23,6 +23,7 @@ import (
 	"math/rand"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -30,46 +31,176 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/test"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/providers"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
 )
 
 const FileName = "test-data.txt"
 
-var yamlData = `version: v1
-volumePolicies:
-- conditions:
-    capacity: "2Gi,3Gi"
-  action:
-    type: skip
-- conditions:
-    storageClass:
-    - e2e-storage-class
-  action:
-    type: skip
-`
+// dataFileNames are the files written into each volume, several files are written to check all of them
+// are backed up and restored with their own contents
+var dataFileNames = []string{FileName, "test-data-1.txt", "test-data-2.txt"}
+
+// largeFileName is a file of random data written into the volumes expected to be backed up, which is
+// verified by its checksum
+const (
+	largeFileName   = "test-data-large.bin"
+	largeFileSizeMB = 100
+)
+
+// maxConcurrentNamespaces is the max number of the namespaces whose workloads are created at the same time
+const maxConcurrentNamespaces = 3
+
+// policiesBuilder skips the volumes by their capacity and storage class
+var policiesBuilder = NewPoliciesBuilder().
+	WithVolumePolicy(NewVolumePolicyBuilder().WithCapacityRange("2Gi", "3Gi")).
+	WithVolumePolicy(NewVolumePolicyBuilder().WithStorageClasses("e2e-storage-class"))
+
+// volumeSourcePoliciesBuilder skips the volumes by their sources, the CSI driver is the one of the
+// storage class of the cloud provider
+func volumeSourcePoliciesBuilder(driver string) *PoliciesBuilder {
+	return NewPoliciesBuilder().
+		WithVolumePolicy(NewVolumePolicyBuilder().WithNFS()).
+		WithVolumePolicy(NewVolumePolicyBuilder().WithCSIDriver(driver))
+}
+
+const (
+	// volumeSourceNFS is the statically provisioned PV exported by the in-cluster NFS server
+	volumeSourceNFS = "nfs"
+	// volumeSourceEmptyDir is the emptyDir volume of the pod, no PVC is created for it
+	volumeSourceEmptyDir = "emptyDir"
+
+	// csiStorageClass is provisioned by the CSI driver of e2e-storage-class directly
+	csiStorageClass = "e2e-storage-class-csi"
+)
+
+// volumeCase describes the PVC created in the namespace of the same index and whether its
+// volume is expected to be skipped by the policies of policiesBuilder. The capacity range "2Gi,3Gi"
+// is inclusive at both ends and is matched against the capacity of the bound PV. The PVC of
+// the block mode is attached to the pod as a raw device, so no file is written into it.
+// The volume is provisioned by the storage class unless the source is specified, and by the
+// default storage class of the cluster if neither is specified.
+type volumeCase struct {
+	storageClass string
+	capacity     string
+	block        bool
+	source       string
+	skipped      bool
+	reason       string
+}
+
+var volumeCases = []volumeCase{
+	{storageClass: "e2e-storage-class", capacity: "1Gi", skipped: true, reason: "storage class e2e-storage-class matches the skip policy"},
+	{storageClass: "e2e-storage-class-2", capacity: "1Gi", skipped: false, reason: "1Gi is below the lower boundary 2Gi of capacity range"},
+	{storageClass: "e2e-storage-class-2", capacity: "2Gi", skipped: true, reason: "2Gi equals the inclusive lower boundary of capacity range"},
+	{storageClass: "e2e-storage-class-2", capacity: "2.5Gi", skipped: true, reason: "2.5Gi is inside capacity range"},
+	{storageClass: "e2e-storage-class-2", capacity: "3Gi", skipped: true, reason: "3Gi equals the inclusive upper boundary of capacity range"},
+	{storageClass: "e2e-storage-class-2", capacity: "4Gi", skipped: false, reason: "4Gi is above the upper boundary 3Gi of capacity range"},
+	{storageClass: "e2e-storage-class", capacity: "1Gi", block: true, skipped: true, reason: "storage class e2e-storage-class matches the skip policy regardless of the block mode"},
+}
+
+// volumeSourceCases are the volumes expected to be skipped or not by the policies of volumeSourcePoliciesBuilder
+var volumeSourceCases = []volumeCase{
+	{source: volumeSourceNFS, skipped: true, reason: "NFS volume matches the nfs condition"},
+	{storageClass: csiStorageClass, capacity: "1Gi", skipped: true, reason: "CSI volume of the driver matches the csi condition"},
+	{source: volumeSourceEmptyDir, skipped: false, reason: "emptyDir volume matches neither the nfs nor the csi condition"},
+	{storageClass: "e2e-storage-class-2", capacity: "1Gi", skipped: false, reason: "in-tree volume of storage class e2e-storage-class-2 matches neither the nfs nor the csi condition"},
+}
+
+// capacityEdgeCase is the policy of a capacity range open or starting from zero at one end, and the
+// volumes at the edges of the range
+type capacityEdgeCase struct {
+	name        string
+	policies    *PoliciesBuilder
+	volumeCases []volumeCase
+}
+
+var zeroLowerCapacityCase = &capacityEdgeCase{
+	name:     "zero-lower",
+	policies: NewPoliciesBuilder().WithVolumePolicy(NewVolumePolicyBuilder().WithCapacityRange("0", "3Gi")),
+	volumeCases: []volumeCase{
+		{storageClass: "e2e-storage-class-2", capacity: "1Gi", skipped: true, reason: "1Gi is inside capacity range 0,3Gi"},
+		{storageClass: "e2e-storage-class-2", capacity: "3Gi", skipped: true, reason: "3Gi equals the inclusive upper boundary of capacity range 0,3Gi"},
+		{storageClass: "e2e-storage-class-2", capacity: "4Gi", skipped: false, reason: "4Gi is above the upper boundary 3Gi of capacity range 0,3Gi"},
+		{capacity: "1Gi", skipped: true, reason: "the capacity condition matches the PVC without storage class"},
+	},
+}
+
+var openUpperCapacityCase = &capacityEdgeCase{
+	name:     "open-upper",
+	policies: NewPoliciesBuilder().WithVolumePolicy(NewVolumePolicyBuilder().WithCapacityRange("2Gi", "")),
+	volumeCases: []volumeCase{
+		{storageClass: "e2e-storage-class-2", capacity: "1Gi", skipped: false, reason: "1Gi is below the lower boundary 2Gi of capacity range 2Gi,"},
+		{storageClass: "e2e-storage-class-2", capacity: "2Gi", skipped: true, reason: "2Gi equals the inclusive lower boundary of capacity range 2Gi,"},
+		{storageClass: "e2e-storage-class-2", capacity: "10Gi", skipped: true, reason: "capacity range 2Gi, has no upper boundary"},
+		{capacity: "1Gi", skipped: false, reason: "the capacity condition doesn't match the PVC without storage class either"},
+	},
+}
 
 type ResourcePoliciesCase struct {
 	TestCase
 	cmName, yamlConfig string
+	// fromFile authors the policies as a local YAML file and creates the configmap from it
+	fromFile bool
+	// largeFileChecksums are the checksums of the large files keyed by the namespaces
+	largeFileChecksums map[string]string
+	// useSnapshots backs up the volumes by snapshots rather than fs-backup, the volumes not skipped by the
+	// policies are checked to be snapshotted by the check point resolved from their PVCs
+	useSnapshots       bool
+	snapshotCheckPoint SnapshotCheckPoint
+	// volumeSources covers the nfs and csi conditions by volumeSourceCases rather than volumeCases, the NFS
+	// server is installed in nfsNamespace which isn't backed up
+	volumeSources bool
+	volumeCases   []volumeCase
+	nfsNamespace  string
+	nfsServer     string
+	// capacityEdge replaces the policies and the volumes by the ones of the capacity edge case
+	capacityEdge *capacityEdgeCase
 }
 
 var ResourcePoliciesTest func() = TestFunc(&ResourcePoliciesCase{})
+var ResourcePoliciesFromFileTest func() = TestFunc(&ResourcePoliciesCase{fromFile: true})
+var ResourcePoliciesSnapshotTest func() = TestFunc(&ResourcePoliciesCase{useSnapshots: true})
+var ResourcePoliciesVolumeSourceTest func() = TestFunc(&ResourcePoliciesCase{volumeSources: true})
+var ResourcePoliciesZeroLowerCapacityTest func() = TestFunc(&ResourcePoliciesCase{capacityEdge: zeroLowerCapacityCase})
+var ResourcePoliciesOpenUpperCapacityTest func() = TestFunc(&ResourcePoliciesCase{capacityEdge: openUpperCapacityCase})
 
 func (r *ResourcePoliciesCase) Init() error {
 	rand.Seed(time.Now().UnixNano())
 	UUIDgen, _ = uuid.NewRandom()
-	r.yamlConfig = yamlData
+	policies := policiesBuilder
+	if r.capacityEdge != nil {
+		policies = r.capacityEdge.policies
+	}
+	var err error
+	if r.yamlConfig, err = policies.YAML(); err != nil {
+		return err
+	}
+	r.largeFileChecksums = map[string]string{}
 	r.VeleroCfg = VeleroCfg
 	r.Client = *r.VeleroCfg.ClientToInstallVelero
-	r.VeleroCfg.UseVolumeSnapshots = false
-	r.VeleroCfg.UseNodeAgent = true
-	r.NamespacesTotal = 3
+	r.UseVolumeSnapshots = r.useSnapshots
+	r.VeleroCfg.UseVolumeSnapshots = r.useSnapshots
+	r.VeleroCfg.UseNodeAgent = !r.useSnapshots
+	r.volumeCases = volumeCases
 	r.NSBaseName = "resource-policies-" + UUIDgen.String()
+	if r.volumeSources {
+		r.volumeCases = volumeSourceCases
+		r.NSBaseName = "rp-volume-source-" + UUIDgen.String()
+		r.nfsNamespace = "nfs-server-" + UUIDgen.String()
+	}
+	if r.capacityEdge != nil {
+		r.volumeCases = r.capacityEdge.volumeCases
+		r.NSBaseName = "rp-" + r.capacityEdge.name + "-" + UUIDgen.String()
+	}
+	r.NamespacesTotal = len(r.volumeCases)
 	r.cmName = "cm-resource-policies-sc"
 	r.NSIncluded = &[]string{}
 	for nsNum := 0; nsNum < r.NamespacesTotal; nsNum++ {
@@ -87,6 +218,14 @@ func (r *ResourcePoliciesCase) Init() error {
 		"--default-volumes-to-fs-backup",
 		"--snapshot-volumes=false", "--wait",
 	}
+	if r.useSnapshots {
+		r.BackupArgs = []string{
+			"create", "--namespace", VeleroCfg.VeleroNamespace, "backup", r.BackupName,
+			"--resource-policies-configmap", r.cmName,
+			"--include-namespaces", strings.Join(*r.NSIncluded, ","),
+			"--snapshot-volumes", "--wait",
+		}
+	}
 
 	r.RestoreArgs = []string{
 		"create", "--namespace", VeleroCfg.VeleroNamespace, "restore", r.RestoreName,
@@ -98,6 +237,37 @@ func (r *ResourcePoliciesCase) Init() error {
 		FailedMSG: "Failed to skip backup of volume by resource policies",
 		Text:      fmt.Sprintf("Should backup PVs in namespace %s respect to resource policies rules", *r.NSIncluded),
 	}
+	if r.fromFile {
+		r.TestMsg.Desc = "Skip backup of volume by resource policies authored in file"
+		r.TestMsg.Text = fmt.Sprintf("Should backup PVs in namespace %s respect to resource policies rules from file", *r.NSIncluded)
+	}
+	if r.volumeSources {
+		r.TestMsg.Desc = "Skip backup of volume by nfs and csi conditions of resource policies"
+		r.TestMsg.Text = fmt.Sprintf("Should backup PVs in namespace %s respect to nfs and csi conditions of resource policies", *r.NSIncluded)
+	}
+	if r.capacityEdge != nil {
+		r.TestMsg.Desc = fmt.Sprintf("Skip backup of volume by %s capacity range of resource policies", r.capacityEdge.name)
+		r.TestMsg.Text = fmt.Sprintf("Should backup PVs in namespace %s respect to %s capacity range of resource policies", *r.NSIncluded, r.capacityEdge.name)
+	}
+	if r.useSnapshots {
+		r.TestMsg.Desc = "Skip snapshot of volume by resource policies"
+		r.TestMsg.Text = fmt.Sprintf("Should snapshot PVs in namespace %s respect to resource policies rules", *r.NSIncluded)
+	}
+	return nil
+}
+
+func (r *ResourcePoliciesCase) StartRun() error {
+	if r.useSnapshots && r.VeleroCfg.CloudProvider == "kind" {
+		Skip("Volume snapshots not supported on kind")
+	}
+	if r.volumeSources {
+		// the PV provisioned by e2e-storage-class-2 is the one matching no condition only if it's an in-tree volume
+		inTree, err := IsInTreeStorageClass(fmt.Sprintf("testdata/storage-class/%s.yaml", r.VeleroCfg.CloudProvider))
+		Expect(err).To(Succeed())
+		if !inTree {
+			Skip(fmt.Sprintf("Storage class of %s is not provisioned by in-tree provisioner, skip nfs and csi conditions test", r.VeleroCfg.CloudProvider))
+		}
+	}
 	return nil
 }
 
@@ -108,46 +278,179 @@ func (r *ResourcePoliciesCase) CreateResources() error {
 		Expect(r.installTestStorageClasses(fmt.Sprintf("testdata/storage-class/%s.yaml", VeleroCfg.CloudProvider))).To(Succeed(), "Failed to install storage class")
 	})
 
+	if r.volumeSources {
+		By(fmt.Sprintf("Installing storage class %s of CSI driver and NFS server in namespace %s...", csiStorageClass, r.nfsNamespace), func() {
+			Expect(r.installVolumeSources(ctx)).To(Succeed())
+		})
+	}
+
 	By(fmt.Sprintf("Create configmap %s in namespaces %s for workload\n", r.cmName, r.VeleroCfg.VeleroNamespace), func() {
-		Expect(CreateConfigMapFromYAMLData(r.Client.ClientGo, r.yamlConfig, r.cmName, r.VeleroCfg.VeleroNamespace)).To(Succeed(), fmt.Sprintf("Failed to create configmap %s in namespaces %s for workload\n", r.cmName, r.VeleroCfg.VeleroNamespace))
+		if r.fromFile {
+			path, cleanup := BuildResourcePoliciesFile(r.yamlConfig)
+			defer cleanup()
+			Expect(CreateConfigMapFromFile(ctx, r.VeleroCfg.VeleroNamespace, r.cmName, r.cmName, path)).To(Succeed(), fmt.Sprintf("Failed to create configmap %s from file %s in namespaces %s for workload\n", r.cmName, path, r.VeleroCfg.VeleroNamespace))
+		} else {
+			Expect(CreateConfigMapFromYAMLData(r.Client.ClientGo, r.yamlConfig, r.cmName, r.VeleroCfg.VeleroNamespace)).To(Succeed(), fmt.Sprintf("Failed to create configmap %s in namespaces %s for workload\n", r.cmName, r.VeleroCfg.VeleroNamespace))
+		}
 	})
 
 	By(fmt.Sprintf("Waiting for configmap %s in namespaces %s ready\n", r.cmName, r.VeleroCfg.VeleroNamespace), func() {
 		Expect(WaitForConfigMapComplete(r.Client.ClientGo, r.VeleroCfg.VeleroNamespace, r.cmName)).To(Succeed(), fmt.Sprintf("Failed to wait configmap %s in namespaces %s ready\n", r.cmName, r.VeleroCfg.VeleroNamespace))
 	})
 
+	By(fmt.Sprintf("Checking content of configmap %s in namespaces %s round-trips\n", r.cmName, r.VeleroCfg.VeleroNamespace), func() {
+		Expect(ConfigMapDataShouldBe(r.Client.ClientGo, r.VeleroCfg.VeleroNamespace, r.cmName, r.cmName, r.yamlConfig)).To(Succeed(), fmt.Sprintf("Content of configmap %s in namespaces %s is not as expected\n", r.cmName, r.VeleroCfg.VeleroNamespace))
+	})
+
+	By(fmt.Sprintf("Create %d namespaces with workloads concurrently\n", r.NamespacesTotal), func() {
+		Expect(r.createNamespacesConcurrently(ctx)).To(Succeed())
+	})
+
+	return nil
+}
+
+// createNamespacesConcurrently creates the namespaces and their workloads with at most
+// maxConcurrentNamespaces of them in progress at the same time, the first failure cancels the others
+func (r *ResourcePoliciesCase) createNamespacesConcurrently(ctx context.Context) error {
+	var lock sync.Mutex
+	sem := make(chan struct{}, maxConcurrentNamespaces)
+	eg, ctx := errgroup.WithContext(ctx)
 	for nsNum := 0; nsNum < r.NamespacesTotal; nsNum++ {
-		namespace := fmt.Sprintf("%s-%00000d", r.NSBaseName, nsNum)
-		By(fmt.Sprintf("Create namespaces %s for workload\n", namespace), func() {
-			Expect(CreateNamespace(ctx, r.Client, namespace)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", namespace))
+		nsNum := nsNum
+		eg.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sem }()
+
+			namespace := fmt.Sprintf("%s-%00000d", r.NSBaseName, nsNum)
+			checksum, err := r.createNamespaceResources(ctx, nsNum, namespace)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create resources in namespace %s", namespace)
+			}
+			if checksum != "" {
+				lock.Lock()
+				r.largeFileChecksums[namespace] = checksum
+				lock.Unlock()
+			}
+			return nil
 		})
+	}
+	return eg.Wait()
+}
 
-		volName := fmt.Sprintf("vol-%s-%00000d", r.NSBaseName, nsNum)
-		volList := PrepareVolumeList([]string{volName})
+// createNamespaceResources creates the namespace with the PVC and deployment of the volume case of the index,
+// and writes the data into the volume, the checksum of the large file is returned if the volume is expected
+// to be backed up
+func (r *ResourcePoliciesCase) createNamespaceResources(ctx context.Context, nsNum int, namespace string) (string, error) {
+	fmt.Printf("Create namespace %s for workload\n", namespace)
+	if err := CreateNamespace(ctx, r.Client, namespace); err != nil {
+		return "", errors.Wrap(err, "failed to create namespace")
+	}
 
-		// Create PVC
-		By(fmt.Sprintf("Creating pvc in namespaces ...%s\n", namespace), func() {
-			Expect(r.createPVC(nsNum, namespace, volList)).To(Succeed(), fmt.Sprintf("Failed to create pvc in namespace %s", namespace))
-		})
+	volName := fmt.Sprintf("vol-%s-%00000d", r.NSBaseName, nsNum)
+	volList := PrepareVolumeList([]string{volName})
 
-		// Create deployment
-		By(fmt.Sprintf("Creating deployment in namespaces ...%s\n", namespace), func() {
-			Expect(r.createDeploymentWithVolume(namespace, volList)).To(Succeed(), fmt.Sprintf("Failed to create deployment namespace %s", namespace))
-		})
+	if r.volumeCases[nsNum].source == volumeSourceEmptyDir {
+		volList[0].VolumeSource = v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}
+	} else if err := r.createPVC(nsNum, namespace, volList); err != nil {
+		return "", err
+	}
+	if err := r.createDeploymentWithVolume(namespace, volList, r.volumeCases[nsNum].block); err != nil {
+		return "", err
+	}
+	if r.volumeCases[nsNum].block {
+		return "", nil
+	}
+	if err := r.writeMultipleFiles(namespace, volName, dataFileNames); err != nil {
+		return "", errors.Wrap(err, "failed to write data into pod")
+	}
 
-		//Write data into pods
-		By(fmt.Sprintf("Writing data into pod in namespaces ...%s\n", namespace), func() {
-			Expect(r.writeDataIntoPods(namespace, volName)).To(Succeed(), fmt.Sprintf("Failed to write data into pod in namespace %s", namespace))
-		})
+	if r.volumeCases[nsNum].skipped {
+		return "", nil
 	}
+	checksum, err := r.writeLargeFile(namespace, volName)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to write large file into pod")
+	}
+	return checksum, nil
+}
 
+// Backup backs up the namespaces, and gets the snapshot check point of the PVCs not skipped by the policies for
+// the snapshot variant before the namespaces are destroyed
+func (r *ResourcePoliciesCase) Backup() error {
+	if err := r.TestCase.Backup(); err != nil {
+		return err
+	}
+	if !r.useSnapshots {
+		return nil
+	}
+	By(fmt.Sprintf("Volumes not skipped by the resource policies should be snapshotted in backup %s", r.BackupName), func() {
+		// the PVC is named "pvc-0" as there is only one volume in each namespace
+		pvcs := map[string][]string{}
+		for i, ns := range *r.NSIncluded {
+			if !r.volumeCases[i].skipped {
+				pvcs[ns] = []string{"pvc-0"}
+			}
+		}
+		var err error
+		r.snapshotCheckPoint, err = GetSnapshotCheckPointOfVolumes(r.Client, r.VeleroCfg, r.BackupName, pvcs)
+		Expect(err).To(Succeed(), "Fail to get snapshot checkpoint")
+		Expect(SnapshotsShouldBeCreatedInCloud(r.VeleroCfg.CloudProvider,
+			r.VeleroCfg.CloudCredentialsFile, r.VeleroCfg.BSLBucket,
+			r.VeleroCfg.BSLConfig, r.VeleroCfg.VSLConfig, r.BackupName, r.snapshotCheckPoint)).To(Succeed())
+	})
 	return nil
 }
 
 func (r *ResourcePoliciesCase) Verify() error {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer ctxCancel()
-	for i, ns := range *r.NSIncluded {
+	r.verifyBackupVolumes(ctx, r.BackupName, r.volumeCases)
+	r.verifyRestoredData(ctx, r.volumeCases, nil)
+	return nil
+}
+
+// verifyBackupVolumes checks only the volumes not skipped according to cases are backed up in the backup
+func (r *ResourcePoliciesCase) verifyBackupVolumes(ctx context.Context, backupName string, cases []volumeCase) {
+	By(fmt.Sprintf("Volumes skipped by the resource policies should not be described in backup %s", backupName), func() {
+		description, err := DescribeBackup(ctx, r.VeleroCfg.VeleroCLI, r.VeleroCfg.VeleroNamespace, backupName)
+		Expect(err).To(Succeed(), fmt.Sprintf("Failed to describe backup %s", backupName))
+		Expect(description.Errors).To(Equal(0), fmt.Sprintf("Unexpected errors in backup %s", backupName))
+		if r.useSnapshots {
+			Expect(description.Volumes.PodVolumeBackups).To(BeEmpty(), fmt.Sprintf("No volume should be backed up by fs-backup in backup %s", backupName))
+			Expect(len(description.Volumes.NativeSnapshots)+len(description.Volumes.CSISnapshots)).To(Equal(r.snapshotCheckPoint.ExpectCount),
+				fmt.Sprintf("Only the volumes not skipped should be snapshotted in backup %s", backupName))
+			return
+		}
+		// the pod volume backups are keyed by "<namespace>/<pod>/<volume>" and there is one pod in each namespace
+		backedUp := map[string]string{}
+		for key, phase := range description.Volumes.PodVolumeBackups {
+			parts := strings.Split(key, "/")
+			backedUp[parts[0]+"/"+parts[len(parts)-1]] = phase
+		}
+		for i, ns := range *r.NSIncluded {
+			volName := fmt.Sprintf("vol-%s-%00000d", r.NSBaseName, i)
+			phase, ok := backedUp[ns+"/"+volName]
+			if cases[i].skipped {
+				Expect(ok).To(BeFalse(), fmt.Sprintf("Volume %s in namespace %s should be skipped in backup %s because %s", volName, ns, backupName, cases[i].reason))
+			} else {
+				Expect(phase).To(Equal("Completed"), fmt.Sprintf("Volume %s in namespace %s should be backed up in backup %s because %s", volName, ns, backupName, cases[i].reason))
+			}
+		}
+	})
+}
+
+// verifyRestoredData checks the data of the volumes not skipped according to cases are restored, the
+// namespaces are restored into the ones of namespaceMappings or themselves if they aren't mapped
+func (r *ResourcePoliciesCase) verifyRestoredData(ctx context.Context, cases []volumeCase, namespaceMappings map[string]string) {
+	for i, srcNS := range *r.NSIncluded {
+		ns := srcNS
+		if mapped, ok := namespaceMappings[srcNS]; ok {
+			ns = mapped
+		}
 		By(fmt.Sprintf("Verify pod data in namespace %s", ns), func() {
 			By(fmt.Sprintf("Waiting for deployment %s in namespace %s ready", r.NSBaseName, ns), func() {
 				Expect(WaitForReadyDeployment(r.Client.ClientGo, ns, r.NSBaseName)).To(Succeed(), fmt.Sprintf("Failed to waiting for deployment %s in namespace %s ready", r.NSBaseName, ns))
@@ -158,28 +461,46 @@ func (r *ResourcePoliciesCase) Verify() error {
 			volName := fmt.Sprintf("vol-%s-%00000d", r.NSBaseName, i)
 			for _, pod := range podList.Items {
 				for _, vol := range pod.Spec.Volumes {
-					if vol.Name != volName {
+					// there is no filesystem in the block volume to check, and the files in the NFS volume are still
+					// served by the NFS server after the namespace is destroyed, they're verified by the description
+					// of the backup
+					if vol.Name != volName || cases[i].block || cases[i].source == volumeSourceNFS {
 						continue
 					}
-					content, err := ReadFileFromPodVolume(ctx, ns, pod.Name, "container-busybox", vol.Name, FileName)
-					if i%2 == 0 {
-						Expect(err).To(HaveOccurred(), "Expected file not found") // File should not exist
+					if cases[i].skipped {
+						_, err := ReadFileFromPodVolume(ctx, ns, pod.Name, "container-busybox", vol.Name, FileName)
+						Expect(err).To(HaveOccurred(), fmt.Sprintf("File %s should not exist in volume %s of pod %s in namespace %s because %s",
+							FileName, vol.Name, pod.Name, ns, cases[i].reason))
 					} else {
-						Expect(err).NotTo(HaveOccurred(), fmt.Sprintf("Fail to read file %s from volume %s of pod %s in namespace %s",
-							FileName, vol.Name, pod.Name, ns))
-
-						content = strings.Replace(content, "\n", "", -1)
-						originContent := strings.Replace(fmt.Sprintf("ns-%s pod-%s volume-%s", ns, pod.Name, vol.Name), "\n", "", -1)
-
-						Expect(content == originContent).To(BeTrue(), fmt.Sprintf("File %s does not exist in volume %s of pod %s in namespace %s",
-							FileName, vol.Name, pod.Name, ns))
+						contents, err := ReadFilesFromPodVolume(ctx, ns, pod.Name, "container-busybox", vol.Name, dataFileNames)
+						Expect(err).NotTo(HaveOccurred(), fmt.Sprintf("Fail to read files %v from volume %s of pod %s in namespace %s, they should be backed up because %s",
+							dataFileNames, vol.Name, pod.Name, ns, cases[i].reason))
+
+						for j, content := range contents {
+							content = strings.Replace(content, "\n", "", -1)
+							Expect(content).To(Equal(fileContent(srcNS, pod.Name, vol.Name, dataFileNames[j])), fmt.Sprintf("Content of file %s in volume %s of pod %s in namespace %s is not as expected",
+								dataFileNames[j], vol.Name, pod.Name, ns))
+						}
+
+						checksum, err := GetFileChecksum(ctx, r.Client, VerifyStrategy(r.VeleroCfg.VerifyStrategy), VerifyTarget{
+							Namespace: ns, Pod: pod.Name, Container: "container-busybox", Volume: vol.Name, File: largeFileName})
+						Expect(err).NotTo(HaveOccurred(), fmt.Sprintf("Fail to checksum file %s in volume %s of pod %s in namespace %s", largeFileName, vol.Name, pod.Name, ns))
+						Expect(checksum).To(Equal(r.largeFileChecksums[srcNS]), fmt.Sprintf("Checksum of file %s in volume %s of pod %s in namespace %s is not as expected",
+							largeFileName, vol.Name, pod.Name, ns))
 					}
 				}
 			}
 		})
+	}
+}
 
+// Destroy deletes the NFS PVs besides the namespaces, the PVs of the retain policy are released rather than
+// deleted with the PVCs, so they're restored from the backup to be bound to the restored PVCs
+func (r *ResourcePoliciesCase) Destroy() error {
+	if err := r.TestCase.Destroy(); err != nil {
+		return err
 	}
-	return nil
+	return r.deleteNFSPersistentVolumes()
 }
 
 func (r *ResourcePoliciesCase) Clean() error {
@@ -187,28 +508,96 @@ func (r *ResourcePoliciesCase) Clean() error {
 		return err
 	}
 
+	if r.volumeSources {
+		if err := r.deleteTestStorageClassList([]string{csiStorageClass}); err != nil {
+			return err
+		}
+	}
+
 	if err := DeleteConfigmap(r.Client.ClientGo, r.VeleroCfg.VeleroNamespace, r.cmName); err != nil {
 		return err
 	}
 
-	return r.GetTestCase().Clean()
+	if err := r.GetTestCase().Clean(); err != nil {
+		return err
+	}
+
+	// the NFS PVs are protected until the restored PVCs are deleted with the namespaces above, and the NFS
+	// server is kept until the PVs are deleted
+	if r.volumeSources && !r.VeleroCfg.Debug {
+		if err := r.deleteNFSPersistentVolumes(); err != nil {
+			return err
+		}
+		if err := DeleteNamespace(context.Background(), r.Client, r.nfsNamespace, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installVolumeSources creates the storage class of the CSI driver and installs the NFS server for
+// volumeSourceCases, the CSI driver is filled into the policies
+func (r *ResourcePoliciesCase) installVolumeSources(ctx context.Context) error {
+	driver, err := CreateCSIStorageClass(ctx, r.Client, csiStorageClass, fmt.Sprintf("testdata/storage-class/%s.yaml", r.VeleroCfg.CloudProvider))
+	if err != nil {
+		return err
+	}
+	if r.yamlConfig, err = volumeSourcePoliciesBuilder(driver).YAML(); err != nil {
+		return err
+	}
+	if err := CreateNamespace(ctx, r.Client, r.nfsNamespace); err != nil {
+		return errors.Wrapf(err, "failed to create namespace %s for NFS server", r.nfsNamespace)
+	}
+	r.nfsServer, err = InstallNFSServer(ctx, r.Client, r.nfsNamespace, "testdata/nfs/nfs-server.yaml")
+	return err
+}
+
+// nfsPersistentVolumeName returns the name of the NFS PV of the volume case in the namespace
+func nfsPersistentVolumeName(namespace string) string {
+	return "nfs-" + namespace
+}
+
+func (r *ResourcePoliciesCase) deleteNFSPersistentVolumes() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	for i, ns := range *r.NSIncluded {
+		if r.volumeCases[i].source != volumeSourceNFS {
+			continue
+		}
+		if err := DeletePersistentVolume(ctx, r.Client, nfsPersistentVolumeName(ns), 5*time.Minute); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *ResourcePoliciesCase) createPVC(index int, namespace string, volList []*v1.Volume) error {
 	var err error
 	for i := range volList {
 		pvcName := fmt.Sprintf("pvc-%d", i)
-		By(fmt.Sprintf("Creating PVC %s in namespaces ...%s\n", pvcName, namespace))
-		if index%3 == 0 {
-			pvcBuilder := NewPVC(namespace, pvcName).WithStorageClass("e2e-storage-class") // Testing sc should not backup
-			err = CreatePvc(r.Client, pvcBuilder)
-		} else if index%3 == 1 {
-			pvcBuilder := NewPVC(namespace, pvcName).WithStorageClass("e2e-storage-class-2") // Testing sc should backup
-			err = CreatePvc(r.Client, pvcBuilder)
-		} else if index%3 == 2 {
-			pvcBuilder := NewPVC(namespace, pvcName).WithStorageClass("e2e-storage-class-2").WithResourceStorage(resource.MustParse("2Gi")) // Testing capacity should not backup
-			err = CreatePvc(r.Client, pvcBuilder)
+		c := r.volumeCases[index]
+		if c.source == volumeSourceNFS {
+			pvName := nfsPersistentVolumeName(namespace)
+			By(fmt.Sprintf("Creating PVC %s of NFS PV %s in namespaces ...%s, expected skipped: %v\n", pvcName, pvName, namespace, c.skipped))
+			if _, err := CreateNFSPersistentVolume(r.Client, pvName, r.nfsServer, "/"); err != nil {
+				return errors.Wrapf(err, "failed to create NFS PV %s", pvName)
+			}
+			if err := CreatePvc(r.Client, NewPVC(namespace, pvcName).WithStorageClass(ManualStorageClass).WithVolumeName(pvName)); err != nil {
+				return errors.Wrapf(err, "failed to create pvc %s in namespace %s", pvcName, namespace)
+			}
+			continue
+		}
+		By(fmt.Sprintf("Creating PVC %s with storage class %s and capacity %s in namespaces ...%s, block mode: %v, expected skipped: %v\n",
+			pvcName, c.storageClass, c.capacity, namespace, c.block, c.skipped))
+		pvcBuilder := NewPVC(namespace, pvcName).WithResourceStorage(resource.MustParse(c.capacity))
+		// the PVC without storage class is provisioned by the default storage class of the cluster
+		if c.storageClass != "" {
+			pvcBuilder.WithStorageClass(c.storageClass)
+		}
+		if c.block {
+			pvcBuilder.WithVolumeMode(v1.PersistentVolumeBlock)
 		}
+		err = CreatePvc(r.Client, pvcBuilder)
 		if err != nil {
 			return errors.Wrapf(err, "failed to create pvc %s in namespace %s", pvcName, namespace)
 		}
@@ -216,8 +605,14 @@ func (r *ResourcePoliciesCase) createPVC(index int, namespace string, volList []
 	return nil
 }
 
-func (r *ResourcePoliciesCase) createDeploymentWithVolume(namespace string, volList []*v1.Volume) error {
-	deployment := NewDeployment(r.NSBaseName, namespace, 1, map[string]string{"resource-policies": "resource-policies"}, nil).WithVolume(volList).Result()
+func (r *ResourcePoliciesCase) createDeploymentWithVolume(namespace string, volList []*v1.Volume, block bool) error {
+	builder := NewDeployment(r.NSBaseName, namespace, 1, map[string]string{"resource-policies": "resource-policies"}, nil)
+	if block {
+		builder.WithVolumeDevices(volList)
+	} else {
+		builder.WithVolume(volList)
+	}
+	deployment := builder.Result()
 	deployment, err := CreateDeployment(r.Client.ClientGo, namespace, deployment)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("failed to create deloyment %s the namespace %q", deployment.Name, namespace))
@@ -229,7 +624,9 @@ func (r *ResourcePoliciesCase) createDeploymentWithVolume(namespace string, volL
 	return nil
 }
 
-func (r *ResourcePoliciesCase) writeDataIntoPods(namespace, volName string) error {
+// writeMultipleFiles writes the files into the volume of the pods in the namespace, the content of each file
+// is unique to the namespace, pod, volume and the file itself
+func (r *ResourcePoliciesCase) writeMultipleFiles(namespace, volName string, fileNames []string) error {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer ctxCancel()
 	podList, err := ListPods(ctx, r.Client, namespace)
@@ -241,15 +638,43 @@ func (r *ResourcePoliciesCase) writeDataIntoPods(namespace, volName string) erro
 			if vol.Name != volName {
 				continue
 			}
-			err := CreateFileToPod(ctx, namespace, pod.Name, "container-busybox", vol.Name, FileName, fmt.Sprintf("ns-%s pod-%s volume-%s", namespace, pod.Name, vol.Name))
+			contents := make([]string, 0, len(fileNames))
+			for _, fileName := range fileNames {
+				contents = append(contents, fileContent(namespace, pod.Name, vol.Name, fileName))
+			}
+			err := CreateFilesToPod(ctx, namespace, pod.Name, "container-busybox", vol.Name, fileNames, contents)
 			if err != nil {
-				return errors.Wrap(err, fmt.Sprintf("failed to create file into pod %s in namespace: %q", pod.Name, namespace))
+				return errors.Wrap(err, fmt.Sprintf("failed to create files into pod %s in namespace: %q", pod.Name, namespace))
 			}
 		}
 	}
 	return nil
 }
 
+// writeLargeFile writes the large file of random data into the volume of the pod in the namespace and returns
+// its checksum, the deployment has only one pod
+func (r *ResourcePoliciesCase) writeLargeFile(namespace, volName string) (string, error) {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	podList, err := ListPods(ctx, r.Client, namespace)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("failed to list pods in namespace: %q with error %v", namespace, err))
+	}
+	if len(podList.Items) != 1 {
+		return "", errors.Errorf("expecting 1 pod in namespace %q, got %d", namespace, len(podList.Items))
+	}
+	pod := podList.Items[0]
+	if err := CreateRandomFileToPod(ctx, namespace, pod.Name, "container-busybox", volName, largeFileName, largeFileSizeMB); err != nil {
+		return "", err
+	}
+	return GetFileChecksum(ctx, r.Client, VerifyStrategy(r.VeleroCfg.VerifyStrategy), VerifyTarget{
+		Namespace: namespace, Pod: pod.Name, Container: "container-busybox", Volume: volName, File: largeFileName})
+}
+
+func fileContent(namespace, podName, volName, fileName string) string {
+	return fmt.Sprintf("ns-%s pod-%s volume-%s file-%s", namespace, podName, volName, fileName)
+}
+
 func (r *ResourcePoliciesCase) deleteTestStorageClassList(scList []string) error {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer ctxCancel()
@@ -264,7 +689,7 @@ func (r *ResourcePoliciesCase) deleteTestStorageClassList(scList []string) error
 func (r *ResourcePoliciesCase) installTestStorageClasses(path string) error {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer ctxCancel()
-	err := InstallStorageClass(ctx, path)
+	err := InstallStorageClassAndWaitProvisioner(ctx, path, 5*time.Minute)
 	if err != nil {
 		return err
 	}
@@ -287,3 +712,18 @@ func (r *ResourcePoliciesCase) installTestStorageClasses(path string) error {
 	}
 	return InstallStorageClass(ctx, tmpFile.Name())
 }
+
+// BuildResourcePoliciesFile writes the resource policies YAML into a temp file, the returned
+// cleanup function should be called to remove the file once it is no longer needed.
+func BuildResourcePoliciesFile(yaml string) (path string, cleanup func()) {
+	tmpFile, err := ioutil.TempFile("", "resource-policies-*.yaml")
+	Expect(err).To(Succeed(), "Failed to create temp file for resource policies")
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(yaml)
+	Expect(err).To(Succeed(), fmt.Sprintf("Failed to write resource policies into temp file %s", tmpFile.Name()))
+
+	return tmpFile.Name(), func() {
+		os.Remove(tmpFile.Name())
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scale
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+)
+
+const apiRequestsBaselineFile = "testdata/api-requests/backup.yaml"
+
+// apiRequestsBaselineHeader is the comment kept at the top of the baseline file when it's recorded
+const apiRequestsBaselineHeader = `# The baseline of the number of Kubernetes API requests issued by the velero service account
+# during the backup of the synthetic namespace (50 configmaps and 50 secrets) created by the
+# "[Scale][APIRequests]" spec. The spec fails if the requests exceed total * tolerance, or if
+# total is 0 as the baseline isn't measured. Run the spec with RECORD_API_REQUESTS_BASELINE=true
+# to record the measured total with the environment it's measured on into this file, and commit
+# it when the increase of the requests is expected. The measurement differs with the size of
+# cluster and the velero version.
+`
+
+// APIRequestsBaseline is the baseline of the number of API requests issued during a backup
+type APIRequestsBaseline struct {
+	Total     int     `json:"total"`
+	Tolerance float64 `json:"tolerance"`
+	// MeasuredOn is the environment the total is measured in
+	MeasuredOn *APIRequestsEnvironment `json:"measuredOn,omitempty"`
+}
+
+// APIRequestsEnvironment is the cluster and the velero the number of API requests is measured with
+type APIRequestsEnvironment struct {
+	CloudProvider     string `json:"cloudProvider"`
+	KubernetesVersion string `json:"kubernetesVersion"`
+	Nodes             int    `json:"nodes"`
+	VeleroVersion     string `json:"veleroVersion"`
+}
+
+// APIRequestsOfBackup backs up a namespace with a fixed number of resources and checks the
+// number of API requests issued by velero during the backup doesn't exceed the baseline
+type APIRequestsOfBackup struct {
+	TestCase
+	namespace     string
+	resourceCount int
+	counter       *APIRequestCounter
+	countBefore   map[string]int
+}
+
+var APIRequestsOfBackupTest func() = TestFunc(&APIRequestsOfBackup{})
+
+func (a *APIRequestsOfBackup) Init() error {
+	a.VeleroCfg = VeleroCfg
+	a.Client = *a.VeleroCfg.ClientToInstallVelero
+	a.NSBaseName = "api-requests-"
+	a.namespace = a.NSBaseName + UUIDgen.String()
+	a.resourceCount = 50
+	a.TestMsg = &TestMSG{
+		Desc:      "Number of API requests issued by backup",
+		FailedMSG: "Failed to bound the number of API requests issued by backup",
+		Text:      fmt.Sprintf("Should issue API requests under the baseline in %s when backing up the namespace", apiRequestsBaselineFile),
+	}
+	return nil
+}
+
+func (a *APIRequestsOfBackup) StartRun() error {
+	a.BackupName = "backup-" + a.NSBaseName + UUIDgen.String()
+	a.BackupArgs = []string{
+		"create", "--namespace", a.VeleroCfg.VeleroNamespace, "backup", a.BackupName,
+		"--include-namespaces", a.namespace, "--snapshot-volumes=false", "--wait",
+	}
+	return nil
+}
+
+func (a *APIRequestsOfBackup) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	fmt.Printf("Creating %d configmaps and secrets in namespace %s\n", a.resourceCount, a.namespace)
+	if err := CreateNamespace(ctx, a.Client, a.namespace); err != nil {
+		return errors.Wrapf(err, "failed to create namespace %s", a.namespace)
+	}
+	for i := 0; i < a.resourceCount; i++ {
+		name := fmt.Sprintf("%s%d", a.NSBaseName, i)
+		if _, err := CreateConfigMap(a.Client.ClientGo, a.namespace, name, nil, map[string]string{"data": name}); err != nil {
+			return errors.Wrapf(err, "failed to create configmap %s in namespace %s", name, a.namespace)
+		}
+		if _, err := CreateSecret(a.Client.ClientGo, a.namespace, name, nil); err != nil {
+			return errors.Wrapf(err, "failed to create secret %s in namespace %s", name, a.namespace)
+		}
+	}
+	return nil
+}
+
+func (a *APIRequestsOfBackup) PreBackup() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	var err error
+	a.counter, err = NewAPIRequestCounter(ctx, a.Client, a.VeleroCfg.VeleroNamespace, "velero")
+	if err != nil {
+		return err
+	}
+	a.countBefore, err = a.counter.Count(ctx)
+	return err
+}
+
+func (a *APIRequestsOfBackup) Backup() error {
+	if err := a.TestCase.Backup(); err != nil {
+		return err
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+	By("Number of API requests issued by backup should be under the baseline", func() {
+		content, err := ioutil.ReadFile(apiRequestsBaselineFile)
+		Expect(err).To(Succeed())
+		baseline := APIRequestsBaseline{}
+		Expect(yaml.Unmarshal(content, &baseline)).To(Succeed())
+
+		countAfter, err := a.counter.Count(ctx)
+		Expect(err).To(Succeed())
+		requests := DiffAPIRequestCounts(a.countBefore, countAfter)
+		total := 0
+		fmt.Printf("API requests issued by velero during backup %s:\n", a.BackupName)
+		for _, verb := range APIRequestVerbs {
+			fmt.Printf("\t%s:\t%d\n", verb, requests[verb])
+			total += requests[verb]
+		}
+		if a.VeleroCfg.RecordAPIRequestsBaseline {
+			baseline.Total = total
+			baseline.MeasuredOn, err = a.environment(ctx)
+			Expect(err).To(Succeed())
+			content, err := yaml.Marshal(baseline)
+			Expect(err).To(Succeed())
+			Expect(ioutil.WriteFile(apiRequestsBaselineFile, append([]byte(apiRequestsBaselineHeader), content...), 0644)).To(Succeed())
+			fmt.Printf("\ttotal:\t%d (recorded as the baseline into %s)\n", total, apiRequestsBaselineFile)
+			return
+		}
+		Expect(baseline.Total).To(BeNumerically(">", 0), fmt.Sprintf(
+			"The baseline in %s isn't measured, record it with the flag -record-api-requests-baseline", apiRequestsBaselineFile))
+		limit := int(float64(baseline.Total) * baseline.Tolerance)
+		fmt.Printf("\ttotal:\t%d (baseline %d measured on %+v, limit %d)\n", total, baseline.Total, baseline.MeasuredOn, limit)
+		Expect(total <= limit).To(BeTrue(), fmt.Sprintf("%d API requests issued by backup exceed the limit %d", total, limit))
+	})
+	return nil
+}
+
+// environment returns the cluster and the velero the API requests are measured with
+func (a *APIRequestsOfBackup) environment(ctx context.Context) (*APIRequestsEnvironment, error) {
+	version, err := a.Client.ClientGo.Discovery().ServerVersion()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the version of cluster")
+	}
+	nodes, err := a.Client.ClientGo.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the nodes of cluster")
+	}
+	return &APIRequestsEnvironment{
+		CloudProvider:     a.VeleroCfg.CloudProvider,
+		KubernetesVersion: version.GitVersion,
+		Nodes:             len(nodes.Items),
+		VeleroVersion:     a.VeleroCfg.VeleroVersion,
+	}, nil
+}
+
+// Restore is skipped because only the API requests of backup are measured
+func (a *APIRequestsOfBackup) Restore() error {
+	return nil
+}
+
+func (a *APIRequestsOfBackup) Clean() error {
+	if a.counter != nil && !a.VeleroCfg.Debug {
+		if err := a.counter.Delete(context.Background()); err != nil {
+			return err
+		}
+	}
+	return a.GetTestCase().Clean()
+}
@@ -22,7 +22,6 @@ import (
 	"flag"
 	"fmt"
 	"math/rand"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -130,11 +129,7 @@ func (o *OrderedResources) Init() error {
 
 	o.ScheduleArgs = []string{"--schedule", "@every 1m",
 		"--include-namespaces", o.Namespace, "--default-volumes-to-fs-backup", "--ordered-resources"}
-	var orderStr string
-	for kind, resource := range o.OrderMap {
-		orderStr += fmt.Sprintf("%s=%s;", kind, resource)
-	}
-	o.ScheduleArgs = append(o.ScheduleArgs, strings.TrimRight(orderStr, ";"))
+	o.ScheduleArgs = append(o.ScheduleArgs, GetOrderedResourcesArg(o.OrderMap))
 
 	return nil
 }
@@ -0,0 +1,144 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/test"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// ScheduleBackupCase creates a schedule backing up kibishii every minute, checks the backups
+// are stopped by pausing the schedule and resumed by unpausing it, then restores from the
+// latest scheduled backup
+type ScheduleBackupCase struct {
+	TestCase
+	namespace    string
+	ScheduleName string
+	ScheduleArgs []string
+	kibishiiData *KibishiiData
+	backupCount  int
+}
+
+var ScheduleBackupCaseTest func() = TestFunc(&ScheduleBackupCase{TestCase: TestCase{NSBaseName: "schedule-kibishii-"}})
+
+func (s *ScheduleBackupCase) Init() error {
+	s.VeleroCfg = VeleroCfg
+	s.Client = *s.VeleroCfg.ClientToInstallVelero
+	s.VeleroCfg.UseVolumeSnapshots = false
+	s.VeleroCfg.UseNodeAgent = true
+	s.kibishiiData = &KibishiiData{Levels: 1, DirsPerLevel: 2, FilesPerLevel: 2, FileLength: 1024, BlockSize: 1024, ExpectedNodes: 2}
+	s.TestMsg = &TestMSG{
+		Desc:      "Backup kibishii periodically by schedule which could be paused and unpaused",
+		FailedMSG: "Failed to backup kibishii by schedule",
+		Text:      "Should backup periodically according to the schedule and stop backing up when it's paused",
+	}
+	return nil
+}
+
+func (s *ScheduleBackupCase) StartRun() error {
+	s.namespace = s.NSBaseName + UUIDgen.String()
+	s.ScheduleName = "schedule-" + s.namespace
+	s.RestoreName = "restore-" + s.namespace
+	s.ScheduleArgs = []string{
+		"--include-namespaces", s.namespace,
+		"--default-volumes-to-fs-backup",
+		"--snapshot-volumes=false",
+		"--schedule=*/1 * * * *",
+	}
+	return nil
+}
+
+func (s *ScheduleBackupCase) CreateResources() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Deploy sample workload of Kibishii in namespace %s", s.namespace), func() {
+		Expect(CreateNamespace(ctx, s.Client, s.namespace)).To(Succeed(), fmt.Sprintf("Failed to create namespace %s", s.namespace))
+		Expect(KibishiiPrepareBeforeBackup(ctx, s.Client, s.VeleroCfg.CloudProvider, s.namespace,
+			s.VeleroCfg.RegistryCredentialFile, s.VeleroCfg.Features, s.VeleroCfg.KibishiiDirectory,
+			s.VeleroCfg.KibishiiStorageClass, false, s.kibishiiData)).To(Succeed())
+	})
+	return nil
+}
+
+func (s *ScheduleBackupCase) Backup() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Create schedule %s", s.ScheduleName), func() {
+		Expect(VeleroScheduleCreate(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName, s.ScheduleArgs)).To(Succeed(), func() string {
+			RunDebug(context.Background(), s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, "", "")
+			return "Fail to create schedule"
+		})
+	})
+
+	By(fmt.Sprintf("At least 2 backups should be created by schedule %s", s.ScheduleName), func() {
+		_, err := WaitForBackupsBySchedule(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName, 2, 10*time.Minute)
+		Expect(err).To(Succeed())
+	})
+
+	By(fmt.Sprintf("Pause schedule %s", s.ScheduleName), func() {
+		Expect(VeleroSchedulePause(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName)).To(Succeed())
+		// the backup triggered right before pausing may be still running, wait for it to be
+		// completed before counting
+		backups, err := GetBackupsBySchedule(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName)
+		Expect(err).To(Succeed())
+		backups, err = WaitForBackupsBySchedule(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName, len(backups), 10*time.Minute)
+		Expect(err).To(Succeed())
+		s.backupCount = len(backups)
+	})
+
+	By(fmt.Sprintf("No backup should be created by paused schedule %s", s.ScheduleName), func() {
+		time.Sleep(3 * time.Minute)
+		backups, err := GetBackupsBySchedule(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName)
+		Expect(err).To(Succeed())
+		Expect(len(backups)).To(Equal(s.backupCount), "New backup is created by paused schedule")
+	})
+
+	By(fmt.Sprintf("Backups should be resumed after unpausing schedule %s", s.ScheduleName), func() {
+		Expect(VeleroScheduleUnpause(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName)).To(Succeed())
+		_, err := WaitForBackupsBySchedule(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName, s.backupCount+1, 10*time.Minute)
+		Expect(err).To(Succeed())
+		// stop the schedule to keep the latest backup unchanged during restore
+		Expect(VeleroSchedulePause(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName)).To(Succeed())
+		// the backup triggered right before pausing may be still running, restore from the latest
+		// completed one after all of them are finished
+		backups, err := WaitForBackupsByScheduleFinished(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName, 10*time.Minute)
+		Expect(err).To(Succeed())
+		latest := LatestCompletedBackup(backups)
+		Expect(latest).NotTo(BeNil(), fmt.Sprintf("No backup created by schedule %s is completed", s.ScheduleName))
+		s.BackupName = latest.Name
+	})
+
+	s.RestoreArgs = []string{
+		"create", "--namespace", s.VeleroCfg.VeleroNamespace, "restore", s.RestoreName,
+		"--from-backup", s.BackupName, "--wait",
+	}
+	return nil
+}
+
+func (s *ScheduleBackupCase) Verify() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 60*time.Minute)
+	defer ctxCancel()
+	By(fmt.Sprintf("Verify data of kibishii restored from backup %s", s.BackupName), func() {
+		Expect(KibishiiVerifyAfterRestore(s.Client, s.namespace, ctx, s.kibishiiData)).To(Succeed())
+	})
+	return nil
+}
+
+func (s *ScheduleBackupCase) Clean() error {
+	if !s.VeleroCfg.Debug {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer ctxCancel()
+		By(fmt.Sprintf("Delete schedule %s", s.ScheduleName), func() {
+			Expect(VeleroScheduleDelete(ctx, s.VeleroCfg.VeleroCLI, s.VeleroCfg.VeleroNamespace, s.ScheduleName)).To(Succeed())
+		})
+	}
+	return s.GetTestCase().Clean()
+}
@@ -31,12 +31,13 @@ import (
 	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/providers"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
 )
 
 /*
 The VeleroBackupRestoreTest interface is just could be suit for the cases that follow the test flow of
-create resources, backup, delete test resource, restore and verify.
+create resources, mutate resources before backup, backup, delete test resource, restore and verify.
 And the cases have similar execute function and similar data. it's both fine for you to use it or not which
 depends on your test patterns.
 */
@@ -44,6 +45,7 @@ type VeleroBackupRestoreTest interface {
 	Init() error
 	StartRun() error
 	CreateResources() error
+	PreBackup() error
 	Backup() error
 	Destroy() error
 	Restore() error
@@ -157,12 +159,22 @@ func (t *TestCase) StartRun() error {
 	return nil
 }
 
+// PreBackup is called between CreateResources and Backup, the cases could override it to
+// mutate the resources created before backup
+func (t *TestCase) PreBackup() error {
+	return nil
+}
+
 func (t *TestCase) Backup() error {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer ctxCancel()
 	veleroCfg := t.GetTestCase().VeleroCfg
 	if err := VeleroBackupExec(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, t.BackupName, t.BackupArgs); err != nil {
-		RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, t.BackupName, "")
+		if veleroCfg.UseNodeAgent {
+			RunDebugWithNodeAgent(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, t.BackupName, "")
+		} else {
+			RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, t.BackupName, "")
+		}
 		return errors.Wrapf(err, "Failed to backup resources")
 	}
 	return nil
@@ -194,7 +206,11 @@ func (t *TestCase) Restore() error {
 			t.RestorePhaseExpect = velerov1api.RestorePhaseCompleted
 		}
 		Expect(VeleroRestoreExec(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, t.RestoreName, t.RestoreArgs, t.RestorePhaseExpect)).To(Succeed(), func() string {
-			RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", t.RestoreName)
+			if veleroCfg.UseNodeAgent {
+				RunDebugWithNodeAgent(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", t.RestoreName)
+			} else {
+				RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", t.RestoreName)
+			}
 			return "Fail to restore workload"
 		})
 	})
@@ -216,6 +232,14 @@ func (t *TestCase) Clean() error {
 		By("Clean backups after test", func() {
 			DeleteBackups(ctx, t.Client)
 		})
+		if t.UseVolumeSnapshots {
+			By(fmt.Sprintf("Clean snapshots leaked by backup %s after test", t.BackupName), func() {
+				if err := CleanupSnapshotsByTags(veleroCfg.CloudProvider, veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket,
+					veleroCfg.BSLConfig, veleroCfg.VSLConfig, map[string]string{BackupSnapshotTag: t.BackupName, RunLabel: UUIDgen.String()}); err != nil {
+					fmt.Printf("Failed to clean snapshots of backup %s: %v\n", t.BackupName, err)
+				}
+			})
+		}
 	}
 	return nil
 }
@@ -241,6 +265,14 @@ func RunTestCase(test VeleroBackupRestoreTest) error {
 	if err != nil {
 		return err
 	}
+	err = test.PreBackup()
+	if err != nil {
+		return err
+	}
+	err = test.GetTestCase().backupLocationShouldBeReady()
+	if err != nil {
+		return err
+	}
 	err = test.Backup()
 	if err != nil {
 		return err
@@ -259,3 +291,26 @@ func RunTestCase(test VeleroBackupRestoreTest) error {
 	}
 	return nil
 }
+
+// backupLocationShouldBeReady fails without waiting for the backup to time out when the backup storage location
+// the case backs up to is unavailable
+func (t *TestCase) backupLocationShouldBeReady() error {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer ctxCancel()
+	veleroCfg := t.VeleroCfg
+	return WaitForBSLAvailable(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupLocationOfArgs(t.BackupArgs), 3*time.Minute)
+}
+
+// backupLocationOfArgs returns the backup storage location set by "--storage-location" in the backup args, or
+// the default location
+func backupLocationOfArgs(args []string) string {
+	for i, arg := range args {
+		if arg == "--storage-location" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--storage-location=") {
+			return strings.TrimPrefix(arg, "--storage-location=")
+		}
+	}
+	return "default"
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/google/uuid"
 
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
 )
 
@@ -29,35 +30,40 @@ var UUIDgen uuid.UUID
 var VeleroCfg VeleroConfig
 
 type VeleroConfig struct {
-	VeleroCLI                   string
-	VeleroImage                 string
-	VeleroVersion               string
-	CloudCredentialsFile        string
-	BSLConfig                   string
-	BSLBucket                   string
-	BSLPrefix                   string
-	VSLConfig                   string
-	CloudProvider               string
-	ObjectStoreProvider         string
-	VeleroNamespace             string
-	AdditionalBSLProvider       string
-	AdditionalBSLBucket         string
-	AdditionalBSLPrefix         string
-	AdditionalBSLConfig         string
-	AdditionalBSLCredentials    string
-	RegistryCredentialFile      string
-	RestoreHelperImage          string
-	UpgradeFromVeleroVersion    string
-	UpgradeFromVeleroCLI        string
-	MigrateFromVeleroVersion    string
-	MigrateFromVeleroCLI        string
-	Plugins                     string
-	AddBSLPlugins               string
-	InstallVelero               bool
-	KibishiiDirectory           string
+	VeleroCLI                string
+	VeleroImage              string
+	VeleroVersion            string
+	CloudCredentialsFile     string
+	BSLConfig                string
+	BSLBucket                string
+	BSLPrefix                string
+	VSLConfig                string
+	CloudProvider            string
+	ObjectStoreProvider      string
+	VeleroNamespace          string
+	AdditionalBSLProvider    string
+	AdditionalBSLBucket      string
+	AdditionalBSLPrefix      string
+	AdditionalBSLConfig      string
+	AdditionalBSLCredentials string
+	RegistryCredentialFile   string
+	RestoreHelperImage       string
+	UpgradeFromVeleroVersion string
+	UpgradeFromVeleroCLI     string
+	MigrateFromVeleroVersion string
+	MigrateFromVeleroCLI     string
+	Plugins                  string
+	AddBSLPlugins            string
+	InstallVelero            bool
+	KibishiiDirectory        string
+	KibishiiStorageClass     string
+	// KibishiiLargeFileSizeMB is the size of the large file written into the volume of each kibishii pod by the
+	// kibishii tests and verified by checksum after restore, no large file is written if it's 0
+	KibishiiLargeFileSizeMB     int
 	Features                    string
 	Debug                       bool
 	GCFrequency                 string
+	RepoMaintenanceFrequency    string
 	DefaultCluster              string
 	StandbyCluster              string
 	ClientToInstallVelero       *TestClient
@@ -70,6 +76,19 @@ type VeleroConfig struct {
 	DefaultVolumesToFsBackup    bool
 	UseVolumeSnapshots          bool
 	VeleroServerDebugMode       bool
+	NodeAgentPodCPURequest      string
+	NodeAgentPodMemRequest      string
+	NodeAgentPodCPULimit        string
+	NodeAgentPodMemLimit        string
+	// extra args appended to the velero server and node-agent containers by the installation
+	VeleroServerArgs []string
+	NodeAgentArgs    []string
+	PerfReportDir    string
+	ArtifactsDir     string
+	StrictPerf       bool
+	VerifyStrategy   string
+	// RecordAPIRequestsBaseline records the measured number of API requests as the baseline rather than checks it
+	RecordAPIRequestsBaseline bool
 }
 
 type SnapshotCheckPoint struct {
@@ -80,11 +99,15 @@ type SnapshotCheckPoint struct {
 	ExpectCount    int
 	PodName        []string
 	EnableCSI      bool
+	// Volumes are the identifiers of the volumes expected to be snapshotted keyed by "<namespace>/<pvc>",
+	// which are resolved from the PVCs rather than the names of the pods
+	Volumes map[string]string
 }
 
 type BackupConfig struct {
 	BackupName                  string
 	Namespace                   string
+	ExcludedNamespaces          []string
 	BackupLocation              string
 	UseVolumeSnapshots          bool
 	ProvideSnapshotsVolumeParam bool
@@ -93,9 +116,28 @@ type BackupConfig struct {
 	IncludeResources            string
 	ExcludeResources            string
 	IncludeClusterResources     bool
-	OrderedResources            string
+	OrderedResources            map[string]string
 	UseResticIfFSBackup         bool
 	DefaultVolumesToFsBackup    bool
+	ItemOperationTimeout        time.Duration
+	ResourcePoliciesConfigmap   string
+	// ProgressClient and ProgressFn make the backup be waited for by polling its progress with the client
+	// rather than its phase with the CLI, ProgressFn is called on each change of the progress
+	ProgressClient *TestClient
+	ProgressFn     BackupProgressFunc
+}
+
+// BackupProgressFunc is called with the progress of the backup in the given phase
+type BackupProgressFunc func(backupName string, phase velerov1api.BackupPhase, progress velerov1api.BackupProgress)
+
+type RestoreConfig struct {
+	RestoreName       string
+	BackupName        string
+	IncludedResources string
+	ExcludedResources string
+	// NamespaceMappings maps the namespaces in the backup to the namespaces restored into
+	NamespaceMappings      map[string]string
+	ExistingResourcePolicy string
 }
 
 type VeleroCLI2Version struct {
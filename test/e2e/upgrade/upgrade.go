@@ -26,6 +26,8 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/uploader"
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/kibishii"
@@ -57,6 +59,8 @@ func BackupUpgradeRestoreWithRestic() {
 func BackupUpgradeRestoreTest(useVolumeSnapshots bool, veleroCLI2Version VeleroCLI2Version) {
 	var (
 		backupName, restoreName string
+		backupUploaderType      string
+		backupRepos             []velerov1api.BackupRepository
 		err                     error
 	)
 
@@ -148,7 +152,7 @@ func BackupUpgradeRestoreTest(useVolumeSnapshots bool, veleroCLI2Version VeleroC
 			By("Deploy sample workload of Kibishii", func() {
 				Expect(KibishiiPrepareBeforeBackup(oneHourTimeout, *veleroCfg.ClientToInstallVelero, tmpCfg.CloudProvider,
 					upgradeNamespace, tmpCfg.RegistryCredentialFile, tmpCfg.Features,
-					tmpCfg.KibishiiDirectory, useVolumeSnapshots, DefaultKibishiiData)).To(Succeed())
+					tmpCfg.KibishiiDirectory, tmpCfg.KibishiiStorageClass, useVolumeSnapshots, DefaultKibishiiData)).To(Succeed())
 			})
 
 			By(fmt.Sprintf("Backup namespace %s", upgradeNamespace), func() {
@@ -169,6 +173,21 @@ func BackupUpgradeRestoreTest(useVolumeSnapshots bool, veleroCLI2Version VeleroC
 				})
 			})
 
+			if !useVolumeSnapshots {
+				By("Record the uploader type and backup repositories of the fs-backup", func() {
+					backupUploaderType, err = GetPodVolumeBackupUploaderType(oneHourTimeout, *veleroCfg.ClientToInstallVelero,
+						tmpCfg.VeleroNamespace, backupName)
+					Expect(err).To(Succeed())
+					// BackupRepository is introduced along with the uploader type, the older versions create ResticRepository
+					if supportUploaderType {
+						backupRepos, err = ListBackupRepositories(oneHourTimeout, *veleroCfg.ClientToInstallVelero,
+							tmpCfg.VeleroNamespace, upgradeNamespace)
+						Expect(err).To(Succeed())
+						Expect(backupRepos).NotTo(BeEmpty())
+					}
+				})
+			}
+
 			if useVolumeSnapshots {
 				if veleroCfg.CloudProvider == "vsphere" {
 					// TODO - remove after upload progress monitoring is implemented
@@ -180,12 +199,12 @@ func BackupUpgradeRestoreTest(useVolumeSnapshots bool, veleroCLI2Version VeleroC
 				var snapshotCheckPoint SnapshotCheckPoint
 				snapshotCheckPoint.NamespaceBackedUp = upgradeNamespace
 				By("Snapshot should be created in cloud object store", func() {
-					snapshotCheckPoint, err := GetSnapshotCheckPoint(*veleroCfg.ClientToInstallVelero, veleroCfg, 2,
-						upgradeNamespace, backupName, KibishiiPodNameList)
+					snapshotCheckPoint, err := GetSnapshotCheckPointOfPVCs(*veleroCfg.ClientToInstallVelero, veleroCfg,
+						upgradeNamespace, backupName, nil)
 					Expect(err).NotTo(HaveOccurred(), "Fail to get snapshot checkpoint")
 					Expect(SnapshotsShouldBeCreatedInCloud(veleroCfg.CloudProvider,
 						veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket,
-						veleroCfg.BSLConfig, backupName, snapshotCheckPoint)).To(Succeed())
+						veleroCfg.BSLConfig, veleroCfg.VSLConfig, backupName, snapshotCheckPoint)).To(Succeed())
 				})
 			}
 
@@ -216,6 +235,11 @@ func BackupUpgradeRestoreTest(useVolumeSnapshots bool, veleroCLI2Version VeleroC
 				tmpCfg.UseNodeAgent = !useVolumeSnapshots
 				Expect(err).To(Succeed())
 				if supportUploaderType {
+					// the old Velero backs up by its default uploader restic, upgrade to kopia to cover the
+					// transition of the uploader unless the uploader is specified
+					if tmpCfg.UploaderType == "" {
+						tmpCfg.UploaderType = uploader.KopiaType
+					}
 					Expect(VeleroInstall(context.Background(), &tmpCfg)).To(Succeed())
 					Expect(CheckVeleroVersion(context.Background(), tmpCfg.VeleroCLI,
 						tmpCfg.VeleroVersion)).To(Succeed())
@@ -241,6 +265,21 @@ func BackupUpgradeRestoreTest(useVolumeSnapshots bool, veleroCLI2Version VeleroC
 				Expect(KibishiiVerifyAfterRestore(*veleroCfg.ClientToInstallVelero, upgradeNamespace,
 					oneHourTimeout, DefaultKibishiiData)).To(Succeed(), "Fail to verify workload after restore")
 			})
+
+			if !useVolumeSnapshots {
+				// the upgraded Velero may use another uploader by default, e.g. kopia instead of restic, the
+				// data backed up by the old Velero should still be restored by the uploader of the backup
+				By(fmt.Sprintf("Pod volumes should be restored by the %s uploader of the backup", backupUploaderType), func() {
+					Expect(PodVolumeRestoresShouldBeCompleted(oneHourTimeout, *veleroCfg.ClientToInstallVelero,
+						tmpCfg.VeleroNamespace, restoreName, len(KibishiiPodNameList))).To(Succeed())
+					Expect(PodVolumeRestoresUploaderTypeShouldBe(oneHourTimeout, *veleroCfg.ClientToInstallVelero,
+						tmpCfg.VeleroNamespace, restoreName, backupUploaderType)).To(Succeed())
+				})
+				By("Backup repositories created by the old Velero should keep working", func() {
+					Expect(BackupRepositoriesShouldBeReady(oneHourTimeout, *veleroCfg.ClientToInstallVelero,
+						backupRepos)).To(Succeed())
+				})
+			}
 		})
 	})
 }
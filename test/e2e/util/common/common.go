@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"syscall"
+	"time"
 )
 
 type OsCommandLine struct {
@@ -87,3 +89,37 @@ func CMDExecWithOutput(checkCMD *exec.Cmd) (*[]byte, error) {
 	}
 	return &jsonBuf, err
 }
+
+// RunCommandWithTimeout runs the command and returns its stdout and stderr like veleroexec.RunCommand. The command
+// runs in its own process group, which is killed if the command doesn't complete in the timeout, so the children
+// of the command like the processes started by "kubectl exec" don't outlive it. The command shouldn't be started.
+func RunCommandWithTimeout(cmd *exec.Cmd, timeout time.Duration) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	if err := cmd.Start(); err != nil {
+		return "", "", fmt.Errorf("failed to start command %s: %w", cmd, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return stdout.String(), stderr.String(), err
+	case <-timer.C:
+		// the negative pid is the process group of the command
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			fmt.Printf("Failed to kill the process group of command %s: %v\n", cmd, err)
+		}
+		<-done
+		return stdout.String(), stderr.String(), fmt.Errorf("command %s timed out after %s", cmd, timeout)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// processRunning returns true if the process exists and isn't a zombie, the killed process is left as a
+// zombie until it's reaped by its parent, which may never happen if it's reparented to a container init
+func processRunning(t *testing.T, pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if os.IsNotExist(err) {
+		return false
+	}
+	require.NoError(t, err)
+	// the state follows the command name in parentheses, e.g. "123 (sleep) S ..."
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	require.NotEmpty(t, fields)
+	return fields[0] != "Z"
+}
+
+func TestRunCommandWithTimeout(t *testing.T) {
+	stdout, stderr, err := RunCommandWithTimeout(exec.Command("sh", "-c", "echo out; echo err >&2"), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "out\n", stdout)
+	assert.Equal(t, "err\n", stderr)
+
+	_, _, err = RunCommandWithTimeout(exec.Command("sh", "-c", "exit 1"), time.Minute)
+	assert.Error(t, err)
+
+	// the child started in background is killed with the command in the same process group
+	start := time.Now()
+	stdout, _, err = RunCommandWithTimeout(exec.Command("sh", "-c", "sleep 60 & echo $!; wait"), time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out after 1s")
+	assert.Less(t, time.Since(start), 30*time.Second)
+	pid, err := strconv.Atoi(strings.TrimSpace(stdout))
+	require.NoError(t, err, "the pid of the child should be printed")
+	assert.Eventually(t, func() bool { return !processRunning(t, pid) }, 5*time.Second, 100*time.Millisecond,
+		"the child %d should be killed after the timeout", pid)
+}
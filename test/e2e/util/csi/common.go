@@ -23,6 +23,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	snapshotv1beta1api "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1beta1"
 	snapshotterClientSet "github.com/kubernetes-csi/external-snapshotter/client/v4/clientset/versioned"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
@@ -92,6 +93,45 @@ func GetCsiSnapshotHandle(client TestClient, backupName string) ([]string, error
 	}
 	return snapshotHandleList, nil
 }
+
+// GetCsiSnapshotSourceVolumeHandles returns the handles of the source volumes of VolumeSnapshotContents created by backup
+func GetCsiSnapshotSourceVolumeHandles(backupName string) ([]string, error) {
+	_, snapshotClient, err := GetClients()
+	if err != nil {
+		return nil, err
+	}
+	vscList, err := snapshotClient.SnapshotV1beta1().VolumeSnapshotContents().List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("velero.io/backup-name=%s", backupName),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list VolumeSnapshotContents of backup %s", backupName)
+	}
+	var volumeHandleList []string
+	for _, i := range vscList.Items {
+		if i.Spec.Source.VolumeHandle == nil {
+			fmt.Printf("VolumeSnapshotContent %s is not created from a volume\n", i.Name)
+			continue
+		}
+		volumeHandleList = append(volumeHandleList, *i.Spec.Source.VolumeHandle)
+	}
+	return volumeHandleList, nil
+}
+
+// GetVolumeSnapshotContentsOfBackup returns the VolumeSnapshotContents created by backup
+func GetVolumeSnapshotContentsOfBackup(backupName string) ([]snapshotv1beta1api.VolumeSnapshotContent, error) {
+	_, snapshotClient, err := GetClients()
+	if err != nil {
+		return nil, err
+	}
+	vscList, err := snapshotClient.SnapshotV1beta1().VolumeSnapshotContents().List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("velero.io/backup-name=%s", backupName),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list VolumeSnapshotContents of backup %s", backupName)
+	}
+	return vscList.Items, nil
+}
+
 func GetVolumeSnapshotContentNameByPod(client TestClient, podName, namespace, backupName string) (string, error) {
 	pvcList, err := GetPvcByPodName(context.Background(), namespace, podName)
 	if err != nil {
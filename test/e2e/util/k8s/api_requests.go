@@ -0,0 +1,199 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	veleroexec "github.com/vmware-tanzu/velero/pkg/util/exec"
+)
+
+const flowControlGroup = "flowcontrol.apiserver.k8s.io"
+
+// APIRequestVerbs are the verbs of the API requests counted by APIRequestCounter, the
+// requests to non-resource URLs and with other verbs are counted as "other"
+var APIRequestVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection", "other"}
+
+var dispatchedRequestsRegexp = regexp.MustCompile(`^apiserver_flowcontrol_dispatched_requests_total\{(.*)\}\s+(\S+)$`)
+var flowSchemaLabelRegexp = regexp.MustCompile(`flow_schema="([^"]*)"`)
+
+// APIRequestCounter counts the API requests issued by a service account. It creates one
+// FlowSchema per verb matching the requests of the service account, and reads the number of
+// requests dispatched by each FlowSchema from the API Priority and Fairness metrics.
+// The FlowSchemas are assigned to the "workload-low" priority level which the requests of
+// service accounts are assigned to by default, so the requests are handled as before.
+// The metrics are kept per API server instance, so the counts are only accurate for clusters
+// with a single API server.
+type APIRequestCounter struct {
+	Namespace      string
+	ServiceAccount string
+	name           string
+	version        string
+}
+
+// NewAPIRequestCounter creates the FlowSchemas to count the API requests issued by the service account
+func NewAPIRequestCounter(ctx context.Context, client TestClient, namespace, serviceAccount string) (*APIRequestCounter, error) {
+	groups, err := client.ClientGo.Discovery().ServerGroups()
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to get server API groups")
+	}
+	c := &APIRequestCounter{
+		Namespace:      namespace,
+		ServiceAccount: serviceAccount,
+		name:           fmt.Sprintf("e2e-api-requests-%s-%s", namespace, serviceAccount),
+	}
+	for _, group := range groups.Groups {
+		if group.Name == flowControlGroup {
+			c.version = group.PreferredVersion.Version
+		}
+	}
+	if c.version == "" {
+		return nil, errors.Errorf("API group %s is not served", flowControlGroup)
+	}
+
+	var manifests []string
+	for _, verb := range APIRequestVerbs {
+		manifests = append(manifests, c.flowSchema(verb))
+	}
+	if err := kubectlApplyContent(ctx, strings.Join(manifests, "---\n")); err != nil {
+		return nil, errors.Wrapf(err, "failed to create FlowSchemas for service account %s/%s", namespace, serviceAccount)
+	}
+	return c, nil
+}
+
+func (c *APIRequestCounter) flowSchemaName(verb string) string {
+	return fmt.Sprintf("%s-%s", c.name, verb)
+}
+
+func (c *APIRequestCounter) flowSchema(verb string) string {
+	// the FlowSchemas of the specific verbs have the higher precedence than the one of other verbs
+	precedence, rule := 500, fmt.Sprintf(`
+    resourceRules:
+    - verbs: ["%s"]
+      apiGroups: ["*"]
+      resources: ["*"]
+      namespaces: ["*"]
+      clusterScope: true`, verb)
+	if verb == "other" {
+		precedence, rule = 501, `
+    resourceRules:
+    - verbs: ["*"]
+      apiGroups: ["*"]
+      resources: ["*"]
+      namespaces: ["*"]
+      clusterScope: true
+    nonResourceRules:
+    - verbs: ["*"]
+      nonResourceURLs: ["*"]`
+	}
+	return fmt.Sprintf(`apiVersion: %s/%s
+kind: FlowSchema
+metadata:
+  name: %s
+spec:
+  matchingPrecedence: %d
+  priorityLevelConfiguration:
+    name: workload-low
+  distinguisherMethod:
+    type: ByUser
+  rules:
+  - subjects:
+    - kind: ServiceAccount
+      serviceAccount:
+        name: %s
+        namespace: %s%s
+`, flowControlGroup, c.version, c.flowSchemaName(verb), precedence, c.ServiceAccount, c.Namespace, rule)
+}
+
+// Count returns the number of API requests issued by the service account per verb so far
+func (c *APIRequestCounter) Count(ctx context.Context) (map[string]int, error) {
+	stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "get", "--raw", "/metrics"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get metrics of API server, stderr=%s", stderr)
+	}
+	verbs := map[string]string{}
+	for _, verb := range APIRequestVerbs {
+		verbs[c.flowSchemaName(verb)] = verb
+	}
+	counts := map[string]int{}
+	for _, line := range strings.Split(stdout, "\n") {
+		matches := dispatchedRequestsRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+		schema := flowSchemaLabelRegexp.FindStringSubmatch(matches[1])
+		if schema == nil {
+			continue
+		}
+		verb, ok := verbs[schema[1]]
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(matches[2], 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the metric %q", line)
+		}
+		counts[verb] += int(value)
+	}
+	return counts, nil
+}
+
+// Delete deletes the FlowSchemas created by the counter
+func (c *APIRequestCounter) Delete(ctx context.Context) error {
+	for _, verb := range APIRequestVerbs {
+		stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "delete",
+			fmt.Sprintf("flowschemas.%s", flowControlGroup), c.flowSchemaName(verb), "--ignore-not-found"))
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete FlowSchema %s, stdout=%s, stderr=%s", c.flowSchemaName(verb), stdout, stderr)
+		}
+	}
+	return nil
+}
+
+// DiffAPIRequestCounts returns the number of requests per verb issued between the two counts
+func DiffAPIRequestCounts(before, after map[string]int) map[string]int {
+	diff := map[string]int{}
+	for _, verb := range APIRequestVerbs {
+		diff[verb] = after[verb] - before[verb]
+	}
+	return diff
+}
+
+func kubectlApplyContent(ctx context.Context, content string) error {
+	tmpFile, err := ioutil.TempFile("", "manifest-*.yaml")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temp file")
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.WriteString(content); err != nil {
+		return errors.Wrapf(err, "failed to write content into temp file %s", tmpFile.Name())
+	}
+	stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "apply", "-f", tmpFile.Name()))
+	if err != nil {
+		return errors.Wrapf(err, "failed to apply %s, stdout=%s, stderr=%s", tmpFile.Name(), stdout, stderr)
+	}
+	return nil
+}
@@ -20,11 +20,13 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 
@@ -39,19 +41,45 @@ func EnsureClusterExists(ctx context.Context) error {
 }
 
 func CreateSecretFromFiles(ctx context.Context, client TestClient, namespace string, name string, files map[string]string) error {
+	data, err := secretDataFromFiles(files)
+	if err != nil {
+		return err
+	}
+	secret := builder.ForSecret(namespace, name).Data(data).Result()
+	_, err = client.ClientGo.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+	return err
+}
+
+// UpdateSecretFromFiles replaces the data of the secret created by CreateSecretFromFiles with the contents
+// of the files, e.g. to rotate the credentials in it
+func UpdateSecretFromFiles(ctx context.Context, client TestClient, namespace string, name string, files map[string]string) error {
+	data, err := secretDataFromFiles(files)
+	if err != nil {
+		return err
+	}
+	secret, err := client.ClientGo.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get secret %s in namespace %s", name, namespace)
+	}
+	secret.Data = data
+	if _, err := client.ClientGo.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to update secret %s in namespace %s", name, namespace)
+	}
+	return nil
+}
+
+func secretDataFromFiles(files map[string]string) (map[string][]byte, error) {
 	data := make(map[string][]byte)
 
 	for key, filePath := range files {
 		contents, err := os.ReadFile(filePath)
 		if err != nil {
-			return errors.WithMessagef(err, "Failed to read secret file %q", filePath)
+			return nil, errors.WithMessagef(err, "Failed to read secret file %q", filePath)
 		}
 
 		data[key] = contents
 	}
-	secret := builder.ForSecret(namespace, name).Data(data).Result()
-	_, err := client.ClientGo.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
-	return err
+	return data, nil
 }
 
 // WaitForPods waits until all of the pods have gone to PodRunning state
@@ -277,6 +305,53 @@ func CreateFileToPod(ctx context.Context, namespace, podName, containerName, vol
 	fmt.Printf("Kubectl exec cmd =%v\n", cmd)
 	return cmd.Run()
 }
+
+// CreateFilesToPod writes each of the contents into the file of the same index in the volume of the pod, the
+// files are written in order by a single exec
+func CreateFilesToPod(ctx context.Context, namespace, podName, containerName, volume string, filenames, contents []string) error {
+	if len(filenames) != len(contents) {
+		return errors.Errorf("got %d files but %d contents to write into pod %s/%s", len(filenames), len(contents), namespace, podName)
+	}
+	arg := []string{"exec", "-n", namespace, "-c", containerName, podName,
+		"--", "/bin/sh", "-c", writeFilesScript(volume, filenames, contents)}
+	cmd := exec.CommandContext(ctx, "kubectl", arg...)
+	fmt.Printf("Kubectl exec cmd =%v\n", cmd)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create files %v in pod %s/%s, stdout=%s, stderr=%s", filenames, namespace, podName, stdout, stderr)
+	}
+	return nil
+}
+
+// writeFilesScript returns the shell script writing the contents into the files in the volume, the contents
+// are single-quoted so they are written as they are
+func writeFilesScript(volume string, filenames, contents []string) string {
+	cmds := make([]string, 0, len(filenames))
+	for i := range filenames {
+		cmds = append(cmds, fmt.Sprintf("echo %s > /%s/%s", shellQuote(contents[i]), volume, filenames[i]))
+	}
+	return strings.Join(cmds, " && ")
+}
+
+// shellQuote single-quotes the string so that the shell takes it as it is
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// CreateRandomFileToPod writes a file of sizeMB MiB random data into the volume of the pod, which
+// takes the data path a while to back up
+func CreateRandomFileToPod(ctx context.Context, namespace, podName, containerName, volume, filename string, sizeMB int) error {
+	arg := []string{"exec", "-n", namespace, "-c", containerName, podName,
+		"--", "dd", "if=/dev/urandom", fmt.Sprintf("of=/%s/%s", volume, filename), "bs=1M", fmt.Sprintf("count=%d", sizeMB)}
+	cmd := exec.CommandContext(ctx, "kubectl", arg...)
+	fmt.Printf("Kubectl exec cmd =%v\n", cmd)
+	_, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create file %s in pod %s/%s, stderr=%s", filename, namespace, podName, stderr)
+	}
+	return nil
+}
+
 func ReadFileFromPodVolume(ctx context.Context, namespace, podName, containerName, volume, filename string) (string, error) {
 	arg := []string{"exec", "-n", namespace, "-c", containerName, podName,
 		"--", "cat", fmt.Sprintf("/%s/%s", volume, filename)}
@@ -288,6 +363,45 @@ func ReadFileFromPodVolume(ctx context.Context, namespace, podName, containerNam
 	return stdout, err
 }
 
+// ReadFilesFromPodVolume returns the contents of the files in the volume of the pod in the order of the files
+func ReadFilesFromPodVolume(ctx context.Context, namespace, podName, containerName, volume string, filenames []string) ([]string, error) {
+	contents := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		content, err := ReadFileFromPodVolume(ctx, namespace, podName, containerName, volume, filename)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read file %s from volume %s of pod %s/%s", filename, volume, namespace, podName)
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+// WriteFileToPod writes the content into the file of the path in the container of the pod
+func WriteFileToPod(ctx context.Context, namespace, podName, containerName, filePath, content string) error {
+	arg := []string{"exec", "-n", namespace, "-c", containerName, podName,
+		"--", "/bin/sh", "-c", fmt.Sprintf("echo %s > %s", shellQuote(content), shellQuote(filePath))}
+	cmd := exec.CommandContext(ctx, "kubectl", arg...)
+	fmt.Printf("Kubectl exec cmd =%v\n", cmd)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write file %s in container %s of pod %s/%s, stdout=%s, stderr=%s",
+			filePath, containerName, namespace, podName, stdout, stderr)
+	}
+	return nil
+}
+
+// ReadFileFromPod reads the file of the path in the container of the pod
+func ReadFileFromPod(ctx context.Context, namespace, podName, containerName, filePath string) (string, error) {
+	arg := []string{"exec", "-n", namespace, "-c", containerName, podName,
+		"--", "cat", filePath}
+	cmd := exec.CommandContext(ctx, "kubectl", arg...)
+	fmt.Printf("Kubectl exec cmd =%v\n", cmd)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	fmt.Print(stdout)
+	fmt.Print(stderr)
+	return stdout, err
+}
+
 func KubectlGetInfo(cmdName string, arg []string) {
 	cmd := exec.CommandContext(context.Background(), cmdName, arg...)
 	fmt.Printf("Kubectl exec cmd =%v\n", cmd)
@@ -346,3 +460,48 @@ func GetAllService(ctx context.Context) (string, error) {
 	}
 	return stdout, nil
 }
+
+// CreateLabeledResources creates a configmap, a secret and a pod with the same name and labels
+// in the namespace
+func CreateLabeledResources(client TestClient, namespace, name string, labels map[string]string) error {
+	fmt.Printf("Creating configmap, secret and pod %s with labels %v in namespace %s\n", name, labels, namespace)
+	if _, err := CreateConfigMap(client.ClientGo, namespace, name, labels, nil); err != nil {
+		return errors.Wrapf(err, "failed to create configmap %s in namespace %s", name, namespace)
+	}
+	if _, err := CreateSecret(client.ClientGo, namespace, name, labels); err != nil {
+		return errors.Wrapf(err, "failed to create secret %s in namespace %s", name, namespace)
+	}
+	if _, err := CreatePodWithLabels(client, namespace, name, labels); err != nil {
+		return errors.Wrapf(err, "failed to create pod %s in namespace %s", name, namespace)
+	}
+	return nil
+}
+
+// LabeledResourcesShouldExist checks whether the configmap, the secret and the pod created by
+// CreateLabeledResources exist in the namespace as expected
+func LabeledResourcesShouldExist(ctx context.Context, client TestClient, namespace, name string, expected bool) error {
+	checks := map[string]func() error{
+		"configmap": func() error {
+			_, err := client.ClientGo.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+			return err
+		},
+		"secret": func() error {
+			_, err := client.ClientGo.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			return err
+		},
+		"pod": func() error {
+			_, err := client.ClientGo.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+			return err
+		},
+	}
+	for kind, check := range checks {
+		err := check()
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to get %s %s in namespace %s", kind, name, namespace)
+		}
+		if exist := err == nil; exist != expected {
+			return errors.Errorf("%s %s in namespace %s is expected to exist: %t, but got: %t", kind, name, namespace, expected, exist)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWriteFilesScript(t *testing.T) {
+	assert.Equal(t, "", writeFilesScript("vol", nil, nil))
+	assert.Equal(t, "echo 'ns-a pod-b' > /vol/file-0 && echo 'it'\\''s' > /vol/file-1",
+		writeFilesScript("vol", []string{"file-0", "file-1"}, []string{"ns-a pod-b", "it's"}))
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "''", shellQuote(""))
+	assert.Equal(t, "'a b; $c'", shellQuote("a b; $c"))
+	assert.Equal(t, "'it'\\''s'", shellQuote("it's"))
+}
+
+func TestUpdateSecretFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid")
+	invalid := filepath.Join(dir, "invalid")
+	require.NoError(t, os.WriteFile(valid, []byte("valid-credentials"), 0600))
+	require.NoError(t, os.WriteFile(invalid, []byte("invalid-credentials"), 0600))
+
+	ctx := context.Background()
+	client := TestClient{ClientGo: fake.NewSimpleClientset()}
+	require.NoError(t, CreateSecretFromFiles(ctx, client, "velero", "creds", map[string]string{"cloud": valid}))
+
+	require.NoError(t, UpdateSecretFromFiles(ctx, client, "velero", "creds", map[string]string{"cloud": invalid}))
+	secret, err := client.ClientGo.CoreV1().Secrets("velero").Get(ctx, "creds", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"cloud": []byte("invalid-credentials")}, secret.Data)
+
+	assert.Error(t, UpdateSecretFromFiles(ctx, client, "velero", "creds", map[string]string{"cloud": filepath.Join(dir, "missing")}))
+	assert.Error(t, UpdateSecretFromFiles(ctx, client, "velero", "missing", map[string]string{"cloud": valid}))
+}
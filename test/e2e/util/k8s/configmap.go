@@ -17,7 +17,9 @@ limitations under the License.
 package k8s
 
 import (
+	"encoding/json"
 	"fmt"
+	"os/exec"
 	"time"
 
 	"github.com/pkg/errors"
@@ -26,9 +28,12 @@ import (
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	waitutil "k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
+
+	veleroexec "github.com/vmware-tanzu/velero/pkg/util/exec"
 )
 
 func CreateConfigMap(c clientset.Interface, ns, name string, labels, data map[string]string) (*v1.ConfigMap, error) {
@@ -42,6 +47,27 @@ func CreateConfigMap(c clientset.Interface, ns, name string, labels, data map[st
 	return c.CoreV1().ConfigMaps(ns).Create(context.TODO(), cm, metav1.CreateOptions{})
 }
 
+// CreateConfigMapWithFinalizers creates a configmap held by the finalizers, the configmap and its
+// namespace can't be removed until the finalizers are removed by RemoveConfigMapFinalizers
+func CreateConfigMapWithFinalizers(c clientset.Interface, ns, name string, finalizers []string) (*v1.ConfigMap, error) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Finalizers: finalizers,
+		},
+	}
+	return c.CoreV1().ConfigMaps(ns).Create(context.TODO(), cm, metav1.CreateOptions{})
+}
+
+// RemoveConfigMapFinalizers removes all the finalizers of the configmap
+func RemoveConfigMapFinalizers(c clientset.Interface, ns, name string) error {
+	patch := []byte(`{"metadata":{"finalizers":null}}`)
+	if _, err := c.CoreV1().ConfigMaps(ns).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to remove finalizers of configmap %s in namespace %s", name, ns)
+	}
+	return nil
+}
+
 func CreateConfigMapFromYAMLData(c clientset.Interface, yamlData, cmName, namespace string) error {
 	cmData := make(map[string]string)
 	cmData[cmName] = yamlData
@@ -56,6 +82,50 @@ func CreateConfigMapFromYAMLData(c clientset.Interface, yamlData, cmName, namesp
 	return err
 }
 
+// UpdateConfigMapFromYAMLData replaces the YAML data of the configmap created by CreateConfigMapFromYAMLData
+func UpdateConfigMapFromYAMLData(c clientset.Interface, yamlData, cmName, namespace string) error {
+	cm, err := GetConfigmap(c, namespace, cmName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get configmap %s in namespace %s", cmName, namespace)
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[cmName] = yamlData
+	if _, err := c.CoreV1().ConfigMaps(namespace).Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to update configmap %s in namespace %s", cmName, namespace)
+	}
+	return nil
+}
+
+// CreateConfigMapFromFile creates configmap with the content of file filePath stored under key.
+func CreateConfigMapFromFile(ctx context.Context, namespace, cmName, key, filePath string) error {
+	cmd := exec.CommandContext(ctx, "kubectl", "create", "configmap", cmName, "-n", namespace,
+		fmt.Sprintf("--from-file=%s=%s", key, filePath))
+	fmt.Printf("Kubectl create configmap cmd =%v\n", cmd)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create configmap %s in namespace %s, stdout=%s, stderr=%s", cmName, namespace, stdout, stderr)
+	}
+	return nil
+}
+
+// ConfigMapDataShouldBe checks the data stored under key of configmap is exactly the same as expected.
+func ConfigMapDataShouldBe(c clientset.Interface, ns, cmName, key, expected string) error {
+	cm, err := GetConfigmap(c, ns, cmName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get configmap %s in namespace %s", cmName, ns)
+	}
+	data, ok := cm.Data[key]
+	if !ok {
+		return errors.Errorf("key %s is not found in configmap %s in namespace %s", key, cmName, ns)
+	}
+	if data != expected {
+		return errors.Errorf("data of key %s in configmap %s in namespace %s is %q, expecting %q", key, cmName, ns, data, expected)
+	}
+	return nil
+}
+
 // WaitForConfigMapComplete uses c to wait for completions to complete for the Job jobName in namespace ns.
 func WaitForConfigMapComplete(c clientset.Interface, ns, configmapName string) error {
 	return wait.Poll(PollInterval, PollTimeout, func() (bool, error) {
@@ -71,6 +141,18 @@ func GetConfigmap(c clientset.Interface, ns, secretName string) (*v1.ConfigMap,
 	return c.CoreV1().ConfigMaps(ns).Get(context.TODO(), secretName, metav1.GetOptions{})
 }
 
+// PatchConfigMapData merges data into the data of the configmap
+func PatchConfigMapData(c clientset.Interface, ns, name string, data map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the patch of configmap data")
+	}
+	if _, err := c.CoreV1().ConfigMaps(ns).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to patch data of configmap %s in namespace %s", name, ns)
+	}
+	return nil
+}
+
 func DeleteConfigmap(c clientset.Interface, ns, name string) error {
 	if err := c.CoreV1().ConfigMaps(ns).Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("failed to delete  configmap in namespace %q", ns))
@@ -0,0 +1,38 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestUpdateConfigMapFromYAMLData(t *testing.T) {
+	t.Run("configmap not exist", func(t *testing.T) {
+		assert.Error(t, UpdateConfigMapFromYAMLData(fake.NewSimpleClientset(), "version: v1\n", "cm-1", "ns-1"))
+	})
+
+	t.Run("yaml data replaced", func(t *testing.T) {
+		client := fake.NewSimpleClientset()
+		require.NoError(t, CreateConfigMapFromYAMLData(client, "version: v1\n", "cm-1", "ns-1"))
+		require.NoError(t, UpdateConfigMapFromYAMLData(client, "version: v2\n", "cm-1", "ns-1"))
+		assert.NoError(t, ConfigMapDataShouldBe(client, "ns-1", "cm-1", "cm-1", "version: v2\n"))
+	})
+}
@@ -64,6 +64,19 @@ func DeleteCRDByName(ctx context.Context, name string) error {
 	return nil
 }
 
+// ReplaceCRD deletes the CRD and installs the one in the yaml, and waits for it to be established.
+// The served versions of a CRD can't be removed in place once there are objects stored in them, so
+// the CRD is recreated to change its versions.
+func ReplaceCRD(ctx context.Context, crdName, yaml string) error {
+	if err := DeleteCRDByName(ctx, crdName); err != nil {
+		return errors.Wrapf(err, "failed to delete CRD %s", crdName)
+	}
+	if err := InstallCRD(ctx, yaml); err != nil {
+		return errors.Wrapf(err, "failed to install CRD %s", yaml)
+	}
+	return WaitForCRDEstablished(crdName)
+}
+
 func InstallCR(ctx context.Context, crFile, ns string) error {
 	retries := 5
 	var stderr string
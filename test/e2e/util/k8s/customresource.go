@@ -0,0 +1,91 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/vmware-tanzu/velero/test/e2e/pkg/client"
+)
+
+func customResourceClient(c TestClient, gvr schema.GroupVersionResource, ns string) (client.Dynamic, error) {
+	resource := metav1.APIResource{Name: gvr.Resource, Namespaced: ns != ""}
+	return c.dynamicFactory.ClientForGroupVersionResource(gvr.GroupVersion(), resource, ns)
+}
+
+// CreateCustomResource creates the custom resource in the namespace with the dynamic client
+func CreateCustomResource(c TestClient, gvr schema.GroupVersionResource, ns string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	resourceClient, err := customResourceClient(c, gvr, ns)
+	if err != nil {
+		return nil, err
+	}
+	created, err := resourceClient.Create(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s %s/%s", gvr.GroupResource(), ns, obj.GetName())
+	}
+	return created, nil
+}
+
+// GetCustomResource gets the custom resource in the namespace with the dynamic client
+func GetCustomResource(c TestClient, gvr schema.GroupVersionResource, ns, name string) (*unstructured.Unstructured, error) {
+	resourceClient, err := customResourceClient(c, gvr, ns)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := resourceClient.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get %s %s/%s", gvr.GroupResource(), ns, name)
+	}
+	return obj, nil
+}
+
+// DeleteCustomResource deletes the custom resource in the namespace with the dynamic client, the
+// namespace is empty for the cluster scoped resources
+func DeleteCustomResource(c TestClient, gvr schema.GroupVersionResource, ns, name string) error {
+	resourceClient, err := customResourceClient(c, gvr, ns)
+	if err != nil {
+		return err
+	}
+	if err := resourceClient.Delete(name, metav1.DeleteOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to delete %s %s/%s", gvr.GroupResource(), ns, name)
+	}
+	return nil
+}
+
+// UpdateCustomResourceStatus replaces the status subresource of the custom resource, which fakes
+// the status set by the controller for the resources without controller
+func UpdateCustomResourceStatus(c TestClient, gvr schema.GroupVersionResource, ns, name string, status map[string]interface{}) (*unstructured.Unstructured, error) {
+	resourceClient, err := customResourceClient(c, gvr, ns)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := resourceClient.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get %s %s/%s", gvr.GroupResource(), ns, name)
+	}
+	if err := unstructured.SetNestedMap(obj.Object, status, "status"); err != nil {
+		return nil, errors.Wrapf(err, "failed to set status of %s %s/%s", gvr.GroupResource(), ns, name)
+	}
+	updated, err := resourceClient.UpdateStatus(obj, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to update status of %s %s/%s", gvr.GroupResource(), ns, name)
+	}
+	return updated, nil
+}
@@ -24,6 +24,8 @@ import (
 	apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
 )
@@ -102,6 +104,62 @@ func (d *DeploymentBuilder) WithVolume(vols []*v1.Volume) *DeploymentBuilder {
 	return d
 }
 
+// WithVolumeMounts adds the volumes to the pod and mounts them to the containers, the mounts
+// are keyed by the container name, so one volume could be mounted at different paths in
+// different containers
+func (d *DeploymentBuilder) WithVolumeMounts(vols []*v1.Volume, mounts map[string][]v1.VolumeMount) *DeploymentBuilder {
+	for i := range vols {
+		d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, *vols[i])
+	}
+	for i, container := range d.Spec.Template.Spec.Containers {
+		d.Spec.Template.Spec.Containers[i].VolumeMounts = append(d.Spec.Template.Spec.Containers[i].VolumeMounts, mounts[container.Name]...)
+	}
+	return d
+}
+
+// WithVolumeDevices adds the volumes of the Block mode PVCs to the pod and attaches them to the first container
+// as raw devices under "/dev", e.g. "/dev/vol-1"
+func (d *DeploymentBuilder) WithVolumeDevices(vols []*v1.Volume) *DeploymentBuilder {
+	for i, v := range vols {
+		d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, *vols[i])
+		d.Spec.Template.Spec.Containers[0].VolumeDevices = append(d.Spec.Template.Spec.Containers[0].VolumeDevices, v1.VolumeDevice{
+			Name:       v.Name,
+			DevicePath: "/dev/" + v.Name,
+		})
+	}
+	return d
+}
+
+// WithResources sets the resource requests and limits of all the containers, so the pods could be
+// throttled or scheduled by the resources they ask for
+func (d *DeploymentBuilder) WithResources(requests, limits v1.ResourceList) *DeploymentBuilder {
+	for i := range d.Spec.Template.Spec.Containers {
+		d.Spec.Template.Spec.Containers[i].Resources = v1.ResourceRequirements{
+			Requests: requests,
+			Limits:   limits,
+		}
+	}
+	return d
+}
+
+// WithPodAnnotations adds the annotations to the pod template, e.g. the hooks of Velero defined by
+// the pod annotations
+func (d *DeploymentBuilder) WithPodAnnotations(ann map[string]string) *DeploymentBuilder {
+	if d.Spec.Template.Annotations == nil {
+		d.Spec.Template.Annotations = map[string]string{}
+	}
+	for k, v := range ann {
+		d.Spec.Template.Annotations[k] = v
+	}
+	return d
+}
+
+// WithNodeSelector schedules the pods to the nodes with the labels of the selector
+func (d *DeploymentBuilder) WithNodeSelector(selector map[string]string) *DeploymentBuilder {
+	d.Spec.Template.Spec.NodeSelector = selector
+	return d
+}
+
 func CreateDeploy(c clientset.Interface, ns string, deployment *apps.Deployment) error {
 	_, err := c.AppsV1().Deployments(ns).Create(context.TODO(), deployment, metav1.CreateOptions{})
 	return err
@@ -114,9 +172,15 @@ func GetDeployment(c clientset.Interface, ns, name string) (*apps.Deployment, er
 	return c.AppsV1().Deployments(ns).Get(context.TODO(), name, metav1.GetOptions{})
 }
 
-// WaitForReadyDeployment waits for number of ready replicas to equal number of replicas.
+// WaitForReadyDeployment waits for number of ready replicas to equal number of replicas within PollTimeout.
 func WaitForReadyDeployment(c clientset.Interface, ns, name string) error {
-	if err := wait.PollImmediate(PollInterval, PollTimeout, func() (bool, error) {
+	return WaitForReadyDeploymentTimeout(c, ns, name, PollTimeout)
+}
+
+// WaitForReadyDeploymentTimeout waits for number of ready replicas to equal number of replicas within the timeout,
+// which could be longer than PollTimeout when the images are pulled from slow registries.
+func WaitForReadyDeploymentTimeout(c clientset.Interface, ns, name string, timeout time.Duration) error {
+	if err := wait.PollImmediate(PollInterval, timeout, func() (bool, error) {
 		deployment, err := c.AppsV1().Deployments(ns).Get(context.TODO(), name, metav1.GetOptions{})
 		if err != nil {
 			return false, fmt.Errorf("failed to get deployment %q: %v", name, err)
@@ -127,3 +191,37 @@ func WaitForReadyDeployment(c clientset.Interface, ns, name string) error {
 	}
 	return nil
 }
+
+func UpdateDeployment(c clientset.Interface, ns string, deployment *apps.Deployment) (*apps.Deployment, error) {
+	return c.AppsV1().Deployments(ns).Update(context.TODO(), deployment, metav1.UpdateOptions{})
+}
+
+// ScaleDeployment patches the replicas of the deployment
+func ScaleDeployment(c clientset.Interface, ns, name string, replicas int32) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	if _, err := c.AppsV1().Deployments(ns).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to scale deployment %q to %d: %v", name, replicas, err)
+	}
+	return nil
+}
+
+// ListReplicaSetsOfDeployment lists the ReplicaSets matching the selector of the deployment
+func ListReplicaSetsOfDeployment(c clientset.Interface, ns string, deployment *apps.Deployment) (*apps.ReplicaSetList, error) {
+	return c.AppsV1().ReplicaSets(ns).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(deployment.Spec.Selector.MatchLabels).String(),
+	})
+}
+
+// WaitForReplicaSetsOfDeployment waits for number of ReplicaSets of the deployment to equal count.
+func WaitForReplicaSetsOfDeployment(c clientset.Interface, ns string, deployment *apps.Deployment, count int) error {
+	if err := wait.PollImmediate(PollInterval, PollTimeout, func() (bool, error) {
+		rsList, err := ListReplicaSetsOfDeployment(c, ns, deployment)
+		if err != nil {
+			return false, fmt.Errorf("failed to list replicasets of deployment %q: %v", deployment.Name, err)
+		}
+		return len(rsList.Items) == count, nil
+	}); err != nil {
+		return fmt.Errorf("failed to wait for %d replicasets of deployment %q: %v", count, deployment.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1api "k8s.io/api/apps/v1"
+	corev1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newDeploymentWithReadyReplicas(name string, replicas, ready int32) *appsv1api.Deployment {
+	return &appsv1api.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns-1"},
+		Spec:       appsv1api.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1api.DeploymentStatus{ReadyReplicas: ready},
+	}
+}
+
+func TestWaitForReadyDeploymentTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		deployment *appsv1api.Deployment
+		expectErr  bool
+	}{
+		{
+			name:       "deployment is ready",
+			deployment: newDeploymentWithReadyReplicas("deploy-1", 2, 2),
+		},
+		{
+			name:       "deployment is not ready before timeout",
+			deployment: newDeploymentWithReadyReplicas("deploy-1", 2, 1),
+			expectErr:  true,
+		},
+		{
+			name:      "deployment not exist",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			if tc.deployment != nil {
+				_, err := clientset.AppsV1().Deployments("ns-1").Create(context.Background(), tc.deployment, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+			err := WaitForReadyDeploymentTimeout(clientset, "ns-1", "deploy-1", 100*time.Millisecond)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWaitForReadyDeployment(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newDeploymentWithReadyReplicas("deploy-1", 1, 1))
+	assert.NoError(t, WaitForReadyDeployment(clientset, "ns-1", "deploy-1"))
+}
+
+func TestDeploymentBuilderWithResources(t *testing.T) {
+	requests := corev1api.ResourceList{
+		corev1api.ResourceCPU:    resource.MustParse("100m"),
+		corev1api.ResourceMemory: resource.MustParse("64Mi"),
+	}
+	limits := corev1api.ResourceList{
+		corev1api.ResourceCPU:    resource.MustParse("200m"),
+		corev1api.ResourceMemory: resource.MustParse("128Mi"),
+	}
+	containers := []corev1api.Container{{Name: "container-1"}, {Name: "container-2"}}
+	deployment := NewDeployment("deploy-1", "ns-1", 1, map[string]string{"app": "test"}, containers).
+		WithResources(requests, limits).Result()
+
+	require.Len(t, deployment.Spec.Template.Spec.Containers, 2)
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		assert.Equal(t, requests, container.Resources.Requests)
+		assert.Equal(t, limits, container.Resources.Limits)
+	}
+}
+
+func TestDeploymentBuilderWithNodeSelector(t *testing.T) {
+	selector := map[string]string{"kubernetes.io/hostname": "node-1"}
+	deployment := NewDeployment("deploy-1", "ns-1", 1, map[string]string{"app": "test"}, nil).
+		WithNodeSelector(selector).Result()
+
+	assert.Equal(t, selector, deployment.Spec.Template.Spec.NodeSelector)
+	assert.Nil(t, deployment.Spec.Template.Spec.Affinity)
+}
+
+func TestDeploymentBuilderWithVolumeDevices(t *testing.T) {
+	vols := PrepareVolumeList([]string{"vol-1"})
+	deployment := NewDeployment("deploy-1", "ns-1", 1, map[string]string{"app": "test"}, nil).
+		WithVolumeDevices(vols).Result()
+
+	require.Len(t, deployment.Spec.Template.Spec.Volumes, 1)
+	assert.Equal(t, "vol-1", deployment.Spec.Template.Spec.Volumes[0].Name)
+	container := deployment.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []corev1api.VolumeDevice{{Name: "vol-1", DevicePath: "/dev/vol-1"}}, container.VolumeDevices)
+	assert.Empty(t, container.VolumeMounts)
+}
+
+func TestDeploymentBuilderWithPodAnnotations(t *testing.T) {
+	deployment := NewDeployment("deploy-1", "ns-1", 1, map[string]string{"app": "test"}, nil).
+		WithPodAnnotations(map[string]string{"a": "1"}).
+		WithPodAnnotations(map[string]string{"b": "2"}).Result()
+
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, deployment.Spec.Template.Annotations)
+	assert.Empty(t, deployment.Annotations)
+}
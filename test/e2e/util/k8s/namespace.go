@@ -75,18 +75,48 @@ func DeleteNamespace(ctx context.Context, client TestClient, namespace string, w
 	if !wait {
 		return nil
 	}
-	return waitutil.PollImmediateInfinite(5*time.Second,
+	return WaitForNamespaceDeleted(tenMinuteTimeout, client, namespace, 10*time.Minute)
+}
+
+// namespacePollInterval is the interval to poll the state of namespace
+var namespacePollInterval = 5 * time.Second
+
+// WaitForNamespaceDeleted waits until the namespace is fully removed, a namespace in Terminating
+// phase still exists until all its resources and finalizers are cleaned
+func WaitForNamespaceDeleted(ctx context.Context, client TestClient, namespace string, timeout time.Duration) error {
+	err := waitutil.PollImmediate(namespacePollInterval, timeout,
 		func() (bool, error) {
-			if _, err := client.ClientGo.CoreV1().Namespaces().Get(tenMinuteTimeout, namespace, metav1.GetOptions{}); err != nil {
+			ns, err := client.ClientGo.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+			if err != nil {
 				if apierrors.IsNotFound(err) {
 					return true, nil
 				}
 				return false, err
 			}
-			fmt.Printf("namespace %q is still being deleted...\n", namespace)
-			logrus.Debugf("namespace %q is still being deleted...", namespace)
+			fmt.Printf("namespace %q is still being deleted in phase %s...\n", namespace, ns.Status.Phase)
+			logrus.Debugf("namespace %q is still being deleted in phase %s...", namespace, ns.Status.Phase)
 			return false, nil
 		})
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for namespace %q to be deleted", namespace)
+	}
+	return nil
+}
+
+// WaitForNamespaceTerminating waits until the namespace is marked for deletion and in Terminating phase
+func WaitForNamespaceTerminating(ctx context.Context, client TestClient, namespace string, timeout time.Duration) error {
+	err := waitutil.PollImmediate(namespacePollInterval, timeout,
+		func() (bool, error) {
+			ns, err := client.ClientGo.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return ns.DeletionTimestamp != nil && ns.Status.Phase == corev1api.NamespaceTerminating, nil
+		})
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for namespace %q to be terminating", namespace)
+	}
+	return nil
 }
 
 func CleanupNamespacesWithPoll(ctx context.Context, client TestClient, nsBaseName string) error {
@@ -151,3 +181,60 @@ func NamespaceShouldNotExist(ctx context.Context, client TestClient, namespace s
 	}
 	return nil
 }
+
+// kubernetesManagedKeys are the label and annotation keys set by kubernetes, kubectl or velero on the
+// namespaces, which are not expected to be the same after restore. The other keys of the kubernetes
+// domains, e.g. the pod-security.kubernetes.io/* labels, are set by the users and must be restored.
+var kubernetesManagedKeys = map[string]bool{
+	"kubernetes.io/metadata.name":                      true,
+	"kubectl.kubernetes.io/last-applied-configuration": true,
+	"velero.io/backup-name":                            true,
+	"velero.io/restore-name":                           true,
+}
+
+// isKubernetesManagedKey returns true if the label or annotation key is maintained by kubernetes
+// or velero itself
+func isKubernetesManagedKey(key string) bool {
+	return kubernetesManagedKeys[key]
+}
+
+// diffNamespaceMetadata returns the readable differences of the user maintained keys between
+// the expected and the actual labels or annotations
+func diffNamespaceMetadata(kind string, expected, actual map[string]string) []string {
+	var diffs []string
+	for k, v := range expected {
+		if isKubernetesManagedKey(k) {
+			continue
+		}
+		got, ok := actual[k]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s %q=%q is missing", kind, k, v))
+		} else if got != v {
+			diffs = append(diffs, fmt.Sprintf("%s %q is %q, expected %q", kind, k, got, v))
+		}
+	}
+	for k, v := range actual {
+		if isKubernetesManagedKey(k) {
+			continue
+		}
+		if _, ok := expected[k]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s %q=%q is unexpected", kind, k, v))
+		}
+	}
+	return diffs
+}
+
+// NamespaceMetadataShouldBe checks the labels and annotations of the namespace are the same with the
+// ones captured before, the keys maintained by kubernetes or velero are ignored
+func NamespaceMetadataShouldBe(ctx context.Context, client TestClient, namespace string, labels, annotations map[string]string) error {
+	ns, err := GetNamespace(ctx, client, namespace)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get namespace %s", namespace)
+	}
+	diffs := diffNamespaceMetadata("label", labels, ns.Labels)
+	diffs = append(diffs, diffNamespaceMetadata("annotation", annotations, ns.Annotations)...)
+	if len(diffs) > 0 {
+		return errors.Errorf("labels or annotations of namespace %s are not the same with the ones before backup:\n%s", namespace, strings.Join(diffs, "\n"))
+	}
+	return nil
+}
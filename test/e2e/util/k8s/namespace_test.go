@@ -0,0 +1,118 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTerminatingNamespace(name string) *corev1api.Namespace {
+	now := metav1.Now()
+	return &corev1api.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			DeletionTimestamp: &now,
+			Finalizers:        []string{"kubernetes"},
+		},
+		Status: corev1api.NamespaceStatus{Phase: corev1api.NamespaceTerminating},
+	}
+}
+
+func TestWaitForNamespaceDeleted(t *testing.T) {
+	interval := namespacePollInterval
+	namespacePollInterval = 10 * time.Millisecond
+	defer func() { namespacePollInterval = interval }()
+
+	tests := []struct {
+		name      string
+		namespace *corev1api.Namespace
+		deleteIn  time.Duration
+		expectErr bool
+	}{
+		{
+			name: "namespace not exist",
+		},
+		{
+			name:      "namespace is gone after terminating for a while",
+			namespace: newTerminatingNamespace("ns-1"),
+			deleteIn:  100 * time.Millisecond,
+		},
+		{
+			name:      "namespace keeps terminating",
+			namespace: newTerminatingNamespace("ns-1"),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			client := TestClient{ClientGo: clientset}
+			if tc.namespace != nil {
+				_, err := clientset.CoreV1().Namespaces().Create(context.Background(), tc.namespace, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+			if tc.deleteIn > 0 {
+				go func() {
+					time.Sleep(tc.deleteIn)
+					clientset.CoreV1().Namespaces().Delete(context.Background(), tc.namespace.Name, metav1.DeleteOptions{})
+				}()
+			}
+
+			err := WaitForNamespaceDeleted(context.Background(), client, "ns-1", 500*time.Millisecond)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDiffNamespaceMetadata(t *testing.T) {
+	expected := map[string]string{
+		"kubernetes.io/metadata.name":        "ns-1",
+		"pod-security.kubernetes.io/enforce": "restricted",
+		"app":                                "foo",
+	}
+
+	assert.Empty(t, diffNamespaceMetadata("label", expected, map[string]string{
+		"kubernetes.io/metadata.name":        "ns-2",
+		"pod-security.kubernetes.io/enforce": "restricted",
+		"app":                                "foo",
+		"velero.io/backup-name":              "backup-1",
+		"velero.io/restore-name":             "restore-1",
+	}))
+
+	assert.ElementsMatch(t, []string{
+		`label "pod-security.kubernetes.io/enforce"="restricted" is missing`,
+		`label "app" is "bar", expected "foo"`,
+		`label "pod-security.kubernetes.io/warn"="baseline" is unexpected`,
+	}, diffNamespaceMetadata("label", expected, map[string]string{
+		"kubernetes.io/metadata.name":     "ns-1",
+		"app":                             "bar",
+		"pod-security.kubernetes.io/warn": "baseline",
+	}))
+}
@@ -0,0 +1,52 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/pkg/errors"
+
+	veleroexec "github.com/vmware-tanzu/velero/pkg/util/exec"
+)
+
+// NFSServerName is the name of the deployment and the service of the NFS server in testdata/nfs
+const NFSServerName = "nfs-server"
+
+// InstallNFSServer installs the NFS server in the yaml file into the namespace and waits for it to be ready,
+// the cluster IP of its service is returned as the server of the NFS volumes. The namespace should be created
+// before and it's better not to be backed up, so the exports are still served when the volumes are restored
+func InstallNFSServer(ctx context.Context, client TestClient, namespace, yaml string) (string, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", "apply", "-n", namespace, "-f", yaml)
+	fmt.Printf("Install NFS server cmd =%v\n", cmd)
+	if _, stderr, err := veleroexec.RunCommand(cmd); err != nil {
+		return "", errors.Wrapf(err, "failed to install NFS server with %s, stderr=%s", yaml, stderr)
+	}
+	if err := WaitForReadyDeployment(client.ClientGo, namespace, NFSServerName); err != nil {
+		return "", errors.Wrapf(err, "failed to wait for NFS server in namespace %s to be ready", namespace)
+	}
+	service, err := GetService(ctx, client, namespace, NFSServerName)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get service of NFS server in namespace %s", namespace)
+	}
+	if service.Spec.ClusterIP == "" {
+		return "", errors.Errorf("service of NFS server in namespace %s has no cluster IP", namespace)
+	}
+	return service.Spec.ClusterIP, nil
+}
@@ -19,14 +19,21 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+// ManualStorageClass is the storage class of the statically provisioned PVs, which is not backed by
+// any provisioner
+const ManualStorageClass = "manual"
+
 func CreatePersistentVolume(client TestClient, name string) (*corev1.PersistentVolume, error) {
 
 	p := &corev1.PersistentVolume{
@@ -34,7 +41,7 @@ func CreatePersistentVolume(client TestClient, name string) (*corev1.PersistentV
 			Name: name,
 		},
 		Spec: corev1.PersistentVolumeSpec{
-			StorageClassName: "manual",
+			StorageClassName: ManualStorageClass,
 			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
 			Capacity:         corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("2Gi")},
 
@@ -64,3 +71,135 @@ func AddAnnotationToPersistentVolume(ctx context.Context, client TestClient, nam
 
 	return client.ClientGo.CoreV1().PersistentVolumes().Update(ctx, newPV, metav1.UpdateOptions{})
 }
+
+// CreateHostPathPersistentVolume creates a statically provisioned PV of the directory on the node with
+// the reclaim policy, the PV is bound to the claims of ManualStorageClass requesting it by name.
+// The directory is created if it doesn't exist, and the pods using the PV are scheduled to the node
+// so that they see the same data.
+func CreateHostPathPersistentVolume(client TestClient, name, path, node string, reclaimPolicy corev1.PersistentVolumeReclaimPolicy) (*corev1.PersistentVolume, error) {
+	p := newHostPathPersistentVolume(name, path, node, reclaimPolicy)
+	return client.ClientGo.CoreV1().PersistentVolumes().Create(context.TODO(), p, metav1.CreateOptions{})
+}
+
+// CreateHostPathPersistentVolumeForClaim creates a statically provisioned hostPath PV like
+// CreateHostPathPersistentVolume without storage class, which is reserved for the claim of the name in
+// the namespace, so that the claim without storage class is bound to it when the cluster has no default
+// storage class.
+func CreateHostPathPersistentVolumeForClaim(client TestClient, name, path, node, namespace, claim string) (*corev1.PersistentVolume, error) {
+	p := newHostPathPersistentVolume(name, path, node, corev1.PersistentVolumeReclaimRetain)
+	p.Spec.StorageClassName = ""
+	p.Spec.ClaimRef = &corev1.ObjectReference{Namespace: namespace, Name: claim}
+	return client.ClientGo.CoreV1().PersistentVolumes().Create(context.TODO(), p, metav1.CreateOptions{})
+}
+
+func newHostPathPersistentVolume(name, path, node string, reclaimPolicy corev1.PersistentVolumeReclaimPolicy) *corev1.PersistentVolume {
+	hostPathType := corev1.HostPathDirectoryOrCreate
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			StorageClassName:              ManualStorageClass,
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Capacity:                      corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+			PersistentVolumeReclaimPolicy: reclaimPolicy,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: path,
+					Type: &hostPathType,
+				},
+			},
+			NodeAffinity: &corev1.VolumeNodeAffinity{
+				Required: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{
+							MatchExpressions: []corev1.NodeSelectorRequirement{
+								{
+									Key:      "kubernetes.io/hostname",
+									Operator: corev1.NodeSelectorOpIn,
+									Values:   []string{node},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// CreateNFSPersistentVolume creates a statically provisioned PV of the path exported by the NFS server, the PV is
+// bound to the claims of ManualStorageClass requesting it by name.
+func CreateNFSPersistentVolume(client TestClient, name, server, path string) (*corev1.PersistentVolume, error) {
+	p := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			StorageClassName:              ManualStorageClass,
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Capacity:                      corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				NFS: &corev1.NFSVolumeSource{
+					Server: server,
+					Path:   path,
+				},
+			},
+		},
+	}
+	return client.ClientGo.CoreV1().PersistentVolumes().Create(context.TODO(), p, metav1.CreateOptions{})
+}
+
+// SetPersistentVolumeReclaimPolicy changes the reclaim policy of the PV
+func SetPersistentVolumeReclaimPolicy(ctx context.Context, client TestClient, name string, reclaimPolicy corev1.PersistentVolumeReclaimPolicy) error {
+	pv, err := GetPersistentVolume(ctx, client, "", name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get PV %s", name)
+	}
+	pv.Spec.PersistentVolumeReclaimPolicy = reclaimPolicy
+	if _, err := client.ClientGo.CoreV1().PersistentVolumes().Update(ctx, pv, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to set reclaim policy of PV %s to %s", name, reclaimPolicy)
+	}
+	return nil
+}
+
+// WaitForPersistentVolumePhase waits for the PV to transit to the phase
+func WaitForPersistentVolumePhase(ctx context.Context, client TestClient, name string, phase corev1.PersistentVolumePhase, timeout time.Duration) error {
+	err := wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		pv, err := GetPersistentVolume(ctx, client, "", name)
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("PV %s is in phase %s, waiting for phase %s\n", name, pv.Status.Phase, phase)
+		return pv.Status.Phase == phase, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for PV %s to be in phase %s", name, phase)
+	}
+	return nil
+}
+
+// DeletePersistentVolume deletes the PV and waits for it to be removed, the data of the PV is
+// deleted or kept by the storage according to the reclaim policy
+func DeletePersistentVolume(ctx context.Context, client TestClient, name string, timeout time.Duration) error {
+	if err := client.ClientGo.CoreV1().PersistentVolumes().Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete PV %s", name)
+	}
+	return WaitForPersistentVolumeDeleted(ctx, client, name, timeout)
+}
+
+// WaitForPersistentVolumeDeleted waits for the PV to be removed
+func WaitForPersistentVolumeDeleted(ctx context.Context, client TestClient, name string, timeout time.Duration) error {
+	err := wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		_, err := GetPersistentVolume(ctx, client, "", name)
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for PV %s to be deleted", name)
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
@@ -26,10 +27,56 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// ChecksumServerContainer is the name of the sidecar serving the checksums of the files in the volumes
+	ChecksumServerContainer = "checksum-server"
+	// ChecksumServerPort is the port the checksum server sidecar listens on
+	ChecksumServerPort = 8081
+)
+
 func CreatePod(client TestClient, ns, name, sc, pvcName string, volumeNameList []string, pvcAnn, ann map[string]string) (*corev1.Pod, error) {
 	if pvcName != "" && len(volumeNameList) != 1 {
 		return nil, errors.New("Volume name list should contain only 1 since PVC name is not empty")
 	}
+	volumes, err := createPVCVolumes(client, ns, sc, pvcName, volumeNameList, pvcAnn)
+	if err != nil {
+		return nil, err
+	}
+
+	return createPodWithVolumes(client, ns, name, volumes, ann)
+}
+
+// CreatePodWithChecksumServer is the same as CreatePod but adds the checksum server sidecar, which serves
+// the output of sha256sum for the files in each volume at "/<volume>" over HTTP. The checksums are
+// refreshed every 5 seconds, so that the data can be verified without exec into the pod.
+func CreatePodWithChecksumServer(client TestClient, ns, name, sc string, volumeNameList []string, ann map[string]string) (*corev1.Pod, error) {
+	volumes, err := createPVCVolumes(client, ns, sc, "", volumeNameList, nil)
+	if err != nil {
+		return nil, err
+	}
+	p := newPodWithVolumes(name, volumes, ann)
+	var vmList []corev1.VolumeMount
+	for _, v := range volumes {
+		vmList = append(vmList, corev1.VolumeMount{
+			Name:      v.Name,
+			MountPath: "/" + v.Name,
+			ReadOnly:  true,
+		})
+	}
+	script := fmt.Sprintf("mkdir -p /checksums && httpd -p %d -h /checksums && while true; do for v in %s; do "+
+		"(cd /$v && find . -type f -exec sha256sum {} +) > /checksums/.$v && mv /checksums/.$v /checksums/$v; done; sleep 5; done",
+		ChecksumServerPort, strings.Join(volumeNameList, " "))
+	p.Spec.Containers = append(p.Spec.Containers, corev1.Container{
+		Name:         ChecksumServerContainer,
+		Image:        "gcr.io/velero-gcp/busybox",
+		Command:      []string{"/bin/sh", "-c", script},
+		VolumeMounts: vmList,
+	})
+	return client.ClientGo.CoreV1().Pods(ns).Create(context.TODO(), p, metav1.CreateOptions{})
+}
+
+// createPVCVolumes creates a PVC for each volume, or the PVC of pvcName for the only volume if it's not empty
+func createPVCVolumes(client TestClient, ns, sc, pvcName string, volumeNameList []string, pvcAnn map[string]string) ([]corev1.Volume, error) {
 	volumes := []corev1.Volume{}
 	for _, volume := range volumeNameList {
 		var _pvcName string
@@ -53,7 +100,51 @@ func CreatePod(client TestClient, ns, name, sc, pvcName string, volumeNameList [
 			},
 		})
 	}
+	return volumes, nil
+}
+
+// CreatePodWithExistingPVC creates a pod which mounts the existing PVC as the volume
+func CreatePodWithExistingPVC(client TestClient, ns, name, pvcName, volumeName string) (*corev1.Pod, error) {
+	volumes := []corev1.Volume{
+		{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvcName,
+					ReadOnly:  false,
+				},
+			},
+		},
+	}
+	return createPodWithVolumes(client, ns, name, volumes, nil)
+}
+
+// CreatePodWithLabels creates a pod without volumes with the labels
+func CreatePodWithLabels(client TestClient, ns, name string, labels map[string]string) (*corev1.Pod, error) {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    name,
+					Image:   "gcr.io/velero-gcp/busybox",
+					Command: []string{"sleep", "3600"},
+				},
+			},
+		},
+	}
+	return client.ClientGo.CoreV1().Pods(ns).Create(context.TODO(), p, metav1.CreateOptions{})
+}
 
+func createPodWithVolumes(client TestClient, ns, name string, volumes []corev1.Volume, ann map[string]string) (*corev1.Pod, error) {
+	p := newPodWithVolumes(name, volumes, ann)
+	return client.ClientGo.CoreV1().Pods(ns).Create(context.TODO(), p, metav1.CreateOptions{})
+}
+
+func newPodWithVolumes(name string, volumes []corev1.Volume, ann map[string]string) *corev1.Pod {
 	vmList := []corev1.VolumeMount{}
 	for _, v := range volumes {
 		vmList = append(vmList, corev1.VolumeMount{
@@ -79,8 +170,7 @@ func CreatePod(client TestClient, ns, name, sc, pvcName string, volumeNameList [
 			Volumes: volumes,
 		},
 	}
-
-	return client.ClientGo.CoreV1().Pods(ns).Create(context.TODO(), p, metav1.CreateOptions{})
+	return p
 }
 
 func GetPod(ctx context.Context, client TestClient, namespace string, pod string) (*corev1.Pod, error) {
@@ -107,6 +197,61 @@ func AddAnnotationToPod(ctx context.Context, client TestClient, namespace, podNa
 	return client.ClientGo.CoreV1().Pods(namespace).Update(ctx, newPod, metav1.UpdateOptions{})
 }
 
+// CheckInitContainerRunBefore checks the init container exists in the pod and has completed
+// successfully before the container started, the status of the init container is returned
+func CheckInitContainerRunBefore(ctx context.Context, client TestClient, namespace, podName, initContainerName, containerName string) (*corev1.ContainerStatus, error) {
+	pod, err := GetPod(ctx, client, namespace, podName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get pod %s in namespace %s", podName, namespace)
+	}
+	found := false
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == initContainerName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.Errorf("init container %s is not found in pod %s/%s", initContainerName, namespace, podName)
+	}
+
+	var initStatus, status *corev1.ContainerStatus
+	for i := range pod.Status.InitContainerStatuses {
+		if pod.Status.InitContainerStatuses[i].Name == initContainerName {
+			initStatus = &pod.Status.InitContainerStatuses[i]
+		}
+	}
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == containerName {
+			status = &pod.Status.ContainerStatuses[i]
+		}
+	}
+	if initStatus == nil || initStatus.State.Terminated == nil {
+		return nil, errors.Errorf("init container %s of pod %s/%s is not terminated", initContainerName, namespace, podName)
+	}
+	if initStatus.State.Terminated.ExitCode != 0 {
+		return nil, errors.Errorf("init container %s of pod %s/%s exited with code %d", initContainerName, namespace, podName, initStatus.State.Terminated.ExitCode)
+	}
+	if status == nil || status.State.Running == nil {
+		return nil, errors.Errorf("container %s of pod %s/%s is not running", containerName, namespace, podName)
+	}
+	if status.State.Running.StartedAt.Before(&initStatus.State.Terminated.FinishedAt) {
+		return nil, errors.Errorf("container %s of pod %s/%s started at %s before init container %s finished at %s", containerName, namespace, podName,
+			status.State.Running.StartedAt, initContainerName, initStatus.State.Terminated.FinishedAt)
+	}
+	return initStatus, nil
+}
+
+// AddAnnotationToPods adds the annotations to the running pods in the namespace
+func AddAnnotationToPods(ctx context.Context, client TestClient, namespace string, podNames []string, ann map[string]string) error {
+	for _, podName := range podNames {
+		if _, err := AddAnnotationToPod(ctx, client, namespace, podName, ann); err != nil {
+			return errors.Wrapf(err, "failed to add annotation to pod %s in namespace %s", podName, namespace)
+		}
+	}
+	return nil
+}
+
 func ListPods(ctx context.Context, client TestClient, namespace string) (*corev1.PodList, error) {
 	return client.ClientGo.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
 }
@@ -18,10 +18,15 @@ package k8s
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 // PVCBuilder builds PVC objects.
@@ -68,6 +73,19 @@ func (p *PVCBuilder) WithResourceStorage(q resource.Quantity) *PVCBuilder {
 	return p
 }
 
+// WithVolumeMode sets the volume mode of the PVC, the PVC of the Block mode is consumed by the pods as a raw
+// device rather than a mounted filesystem
+func (p *PVCBuilder) WithVolumeMode(mode corev1.PersistentVolumeMode) *PVCBuilder {
+	p.Spec.VolumeMode = &mode
+	return p
+}
+
+// WithVolumeName requests the PV of the name for the PVC
+func (p *PVCBuilder) WithVolumeName(volumeName string) *PVCBuilder {
+	p.Spec.VolumeName = volumeName
+	return p
+}
+
 func CreatePVC(client TestClient, ns, name, sc string, ann map[string]string) (*corev1.PersistentVolumeClaim, error) {
 	pvcBulder := NewPVC(ns, name)
 	if ann != nil {
@@ -88,3 +106,126 @@ func CreatePvc(client TestClient, pvcBulder *PVCBuilder) error {
 func GetPVC(ctx context.Context, client TestClient, namespace string, pvcName string) (*corev1.PersistentVolumeClaim, error) {
 	return client.ClientGo.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
 }
+
+// GetPVCAnnotations returns the annotations of the PVC
+func GetPVCAnnotations(ctx context.Context, client TestClient, namespace string, pvcName string) (map[string]string, error) {
+	pvc, err := GetPVC(ctx, client, namespace, pvcName)
+	if err != nil {
+		return nil, err
+	}
+	return pvc.Annotations, nil
+}
+
+// GetBoundPVCCount returns the number of the bound PVCs in the namespace
+func GetBoundPVCCount(ctx context.Context, client TestClient, namespace string) (int, error) {
+	pvcList, err := client.ClientGo.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to list PVCs in namespace %s", namespace)
+	}
+	count := 0
+	for _, pvc := range pvcList.Items {
+		if pvc.Status.Phase == corev1.ClaimBound {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetBoundVolumes returns the identifiers of the volumes bound to the PVCs in the namespace keyed by the PVC names,
+// the identifier is the volume handle for the CSI volume and the name of the PV otherwise. All the bound PVCs in
+// the namespace are resolved if no PVC name is specified, and any specified PVC that isn't bound fails it
+func GetBoundVolumes(ctx context.Context, client TestClient, namespace string, pvcNames []string) (map[string]string, error) {
+	var pvcs []corev1.PersistentVolumeClaim
+	if len(pvcNames) == 0 {
+		pvcList, err := client.ClientGo.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list PVCs in namespace %s", namespace)
+		}
+		for _, pvc := range pvcList.Items {
+			if pvc.Status.Phase == corev1.ClaimBound {
+				pvcs = append(pvcs, pvc)
+			}
+		}
+	} else {
+		for _, name := range pvcNames {
+			pvc, err := GetPVC(ctx, client, namespace, name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get PVC %s in namespace %s", name, namespace)
+			}
+			if pvc.Status.Phase != corev1.ClaimBound {
+				return nil, errors.Errorf("PVC %s in namespace %s is %s rather than bound", name, namespace, pvc.Status.Phase)
+			}
+			pvcs = append(pvcs, *pvc)
+		}
+	}
+
+	volumes := map[string]string{}
+	for _, pvc := range pvcs {
+		pv, err := client.ClientGo.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get PV %s of PVC %s in namespace %s", pvc.Spec.VolumeName, pvc.Name, namespace)
+		}
+		if pv.Spec.CSI != nil {
+			volumes[pvc.Name] = pv.Spec.CSI.VolumeHandle
+		} else {
+			volumes[pvc.Name] = pv.Name
+		}
+	}
+	return volumes, nil
+}
+
+// WaitForPVCsBound waits for all the PVCs in the namespace to be bound to volumes. The unbound PVCs are described
+// with their events on timeout, so the mismatch of the storage class or the provisioner is reported rather than
+// hanging in the scheduling of the pods
+func WaitForPVCsBound(ctx context.Context, client TestClient, namespace string, timeout time.Duration) error {
+	var unbound []corev1.PersistentVolumeClaim
+	err := wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		pvcList, err := client.ClientGo.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to list PVCs in namespace %s", namespace)
+		}
+		unbound = nil
+		for _, pvc := range pvcList.Items {
+			if pvc.Status.Phase != corev1.ClaimBound {
+				unbound = append(unbound, pvc)
+			}
+		}
+		if len(unbound) > 0 {
+			fmt.Printf("%d of %d PVCs in namespace %s are not bound yet\n", len(unbound), len(pvcList.Items), namespace)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		var descriptions []string
+		for _, pvc := range unbound {
+			descriptions = append(descriptions, describeUnboundPVC(ctx, client, pvc))
+		}
+		return errors.Errorf("timed out after %s waiting for PVCs in namespace %s to be bound, unbound: [%s]",
+			timeout, namespace, strings.Join(descriptions, "; "))
+	}
+	return err
+}
+
+// describeUnboundPVC describes the PVC with its phase, storage class and the events of it
+func describeUnboundPVC(ctx context.Context, client TestClient, pvc corev1.PersistentVolumeClaim) string {
+	storageClass := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClass = *pvc.Spec.StorageClassName
+	}
+	description := fmt.Sprintf("PVC %s is %s with storage class %q", pvc.Name, pvc.Status.Phase, storageClass)
+	events, err := client.ClientGo.CoreV1().Events(pvc.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Sprintf("%s, failed to list its events: %v", description, err)
+	}
+	var messages []string
+	for _, event := range events.Items {
+		if event.InvolvedObject.Kind == "PersistentVolumeClaim" && event.InvolvedObject.Name == pvc.Name {
+			messages = append(messages, fmt.Sprintf("%s %s: %s", event.Type, event.Reason, event.Message))
+		}
+	}
+	if len(messages) == 0 {
+		return description + ", no events"
+	}
+	return fmt.Sprintf("%s, events: %s", description, strings.Join(messages, ", "))
+}
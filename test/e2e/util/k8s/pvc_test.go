@@ -0,0 +1,128 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPVCBuilderWithVolumeMode(t *testing.T) {
+	pvc := NewPVC("ns-1", "pvc-1").Result()
+	assert.Nil(t, pvc.Spec.VolumeMode)
+
+	pvc = NewPVC("ns-1", "pvc-1").WithStorageClass("sc-1").WithVolumeMode(corev1api.PersistentVolumeBlock).Result()
+	require.NotNil(t, pvc.Spec.VolumeMode)
+	assert.Equal(t, corev1api.PersistentVolumeBlock, *pvc.Spec.VolumeMode)
+	assert.Equal(t, "sc-1", *pvc.Spec.StorageClassName)
+}
+
+func newPVCInPhase(name string, phase corev1api.PersistentVolumeClaimPhase) *corev1api.PersistentVolumeClaim {
+	pvc := NewPVC("ns-1", name).WithStorageClass("sc-1").Result()
+	pvc.Status.Phase = phase
+	return pvc
+}
+
+func TestWaitForPVCsBound(t *testing.T) {
+	ctx := context.Background()
+
+	client := TestClient{ClientGo: fake.NewSimpleClientset(
+		newPVCInPhase("pvc-1", corev1api.ClaimBound),
+		newPVCInPhase("pvc-2", corev1api.ClaimBound),
+	)}
+	assert.NoError(t, WaitForPVCsBound(ctx, client, "ns-1", time.Second))
+
+	client = TestClient{ClientGo: fake.NewSimpleClientset(
+		newPVCInPhase("pvc-1", corev1api.ClaimBound),
+		newPVCInPhase("pvc-2", corev1api.ClaimPending),
+		&corev1api.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "ns-1", Name: "pvc-2.1"},
+			InvolvedObject: corev1api.ObjectReference{Kind: "PersistentVolumeClaim", Name: "pvc-2"},
+			Type:           corev1api.EventTypeWarning,
+			Reason:         "ProvisioningFailed",
+			Message:        `storageclass.storage.k8s.io "sc-1" not found`,
+		},
+	)}
+	err := WaitForPVCsBound(ctx, client, "ns-1", time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `PVC pvc-2 is Pending with storage class "sc-1"`)
+	assert.Contains(t, err.Error(), `Warning ProvisioningFailed: storageclass.storage.k8s.io "sc-1" not found`)
+	assert.NotContains(t, err.Error(), "pvc-1")
+}
+
+func newBoundPVC(name, volumeName string) *corev1api.PersistentVolumeClaim {
+	pvc := newPVCInPhase(name, corev1api.ClaimBound)
+	pvc.Spec.VolumeName = volumeName
+	return pvc
+}
+
+func TestGetBoundPVCCount(t *testing.T) {
+	client := TestClient{ClientGo: fake.NewSimpleClientset(
+		newBoundPVC("pvc-1", "pv-1"),
+		newBoundPVC("pvc-2", "pv-2"),
+		newPVCInPhase("pvc-3", corev1api.ClaimPending),
+	)}
+
+	count, err := GetBoundPVCCount(context.Background(), client, "ns-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = GetBoundPVCCount(context.Background(), client, "ns-2")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestGetBoundVolumes(t *testing.T) {
+	ctx := context.Background()
+	csiPV := &corev1api.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+		Spec: corev1api.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1api.PersistentVolumeSource{
+				CSI: &corev1api.CSIPersistentVolumeSource{Driver: "disk.csi.azure.com", VolumeHandle: "handle-1"},
+			},
+		},
+	}
+	inTreePV := &corev1api.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-2"}}
+	client := TestClient{ClientGo: fake.NewSimpleClientset(
+		csiPV, inTreePV,
+		newBoundPVC("pvc-1", "pv-1"),
+		newBoundPVC("pvc-2", "pv-2"),
+		newPVCInPhase("pvc-3", corev1api.ClaimPending),
+	)}
+
+	volumes, err := GetBoundVolumes(ctx, client, "ns-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"pvc-1": "handle-1", "pvc-2": "pv-2"}, volumes)
+
+	volumes, err = GetBoundVolumes(ctx, client, "ns-1", []string{"pvc-2"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"pvc-2": "pv-2"}, volumes)
+
+	_, err = GetBoundVolumes(ctx, client, "ns-1", []string{"pvc-1", "pvc-3"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PVC pvc-3 in namespace ns-1 is Pending rather than bound")
+
+	_, err = GetBoundVolumes(ctx, client, "ns-1", []string{"pvc-4"})
+	assert.Error(t, err)
+}
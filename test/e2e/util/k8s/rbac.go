@@ -112,3 +112,17 @@ func CleanupClusterRoleBinding(ctx context.Context, client TestClient, nsBaseNam
 	}
 	return nil
 }
+
+// CreateClusterRole creates a cluster role with the labels and no rules
+func CreateClusterRole(ctx context.Context, client TestClient, name string, labels map[string]string) error {
+	role := &v1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+	if _, err := client.ClientGo.RbacV1().ClusterRoles().Create(ctx, role, metav1.CreateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to create clusterrole %s", name)
+	}
+	return nil
+}
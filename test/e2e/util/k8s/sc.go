@@ -3,9 +3,20 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	veleroexec "github.com/vmware-tanzu/velero/pkg/util/exec"
 )
 
 func InstallStorageClass(ctx context.Context, yaml string) error {
@@ -14,9 +25,208 @@ func InstallStorageClass(ctx context.Context, yaml string) error {
 	return err
 }
 
+// noProvisioner is the provisioner of the storage classes of the statically provisioned PVs
+const noProvisioner = "kubernetes.io/no-provisioner"
+
+// inTreeProvisionerCSIDrivers maps the in-tree provisioners to the CSI drivers the volumes are migrated to
+var inTreeProvisionerCSIDrivers = map[string]string{
+	"kubernetes.io/aws-ebs":        "ebs.csi.aws.com",
+	"kubernetes.io/azure-disk":     "disk.csi.azure.com",
+	"kubernetes.io/azure-file":     "file.csi.azure.com",
+	"kubernetes.io/gce-pd":         "pd.csi.storage.gke.io",
+	"kubernetes.io/cinder":         "cinder.csi.openstack.org",
+	"kubernetes.io/vsphere-volume": "csi.vsphere.vmware.com",
+}
+
+// InstallStorageClassAndWaitProvisioner installs the storage classes in the yaml file like InstallStorageClass,
+// and waits until the CSI drivers of their provisioners are registered on the nodes, so a missing provisioner
+// fails here rather than leaves the PVCs of the storage classes pending
+func InstallStorageClassAndWaitProvisioner(ctx context.Context, yaml string, timeout time.Duration) error {
+	drivers, err := getCSIDriversOfStorageClasses(yaml)
+	if err != nil {
+		return err
+	}
+	if err := InstallStorageClass(ctx, yaml); err != nil {
+		return errors.Wrapf(err, "failed to install storage class with %s", yaml)
+	}
+	for _, driver := range drivers {
+		if err := waitCSIDriverRegistered(ctx, driver, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readStorageClasses decodes the storage classes in the yaml file
+func readStorageClasses(path string) ([]storagev1.StorageClass, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open storage class file %s", path)
+	}
+	defer file.Close()
+	var scs []storagev1.StorageClass
+	decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		sc := storagev1.StorageClass{}
+		if err := decoder.Decode(&sc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrapf(err, "failed to decode storage class file %s", path)
+		}
+		scs = append(scs, sc)
+	}
+	return scs, nil
+}
+
+// getCSIDriversOfStorageClasses returns the CSI drivers of the provisioners of the storage classes in the yaml
+// file, the storage classes without provisioner are skipped
+func getCSIDriversOfStorageClasses(path string) ([]string, error) {
+	scs, err := readStorageClasses(path)
+	if err != nil {
+		return nil, err
+	}
+	var drivers []string
+	for _, sc := range scs {
+		if sc.Provisioner == "" || sc.Provisioner == noProvisioner {
+			continue
+		}
+		driver := sc.Provisioner
+		if csiDriver, ok := inTreeProvisionerCSIDrivers[driver]; ok {
+			driver = csiDriver
+		}
+		drivers = append(drivers, driver)
+	}
+	return drivers, nil
+}
+
+// IsInTreeStorageClass returns true if the first storage class in the yaml file is provisioned by an in-tree
+// provisioner, the PVs of it have the in-tree volume source even if they're migrated to the CSI driver
+func IsInTreeStorageClass(path string) (bool, error) {
+	scs, err := readStorageClasses(path)
+	if err != nil {
+		return false, err
+	}
+	if len(scs) == 0 {
+		return false, errors.Errorf("no storage class is found in %s", path)
+	}
+	_, ok := inTreeProvisionerCSIDrivers[scs[0].Provisioner]
+	return ok, nil
+}
+
+// CreateCSIStorageClass creates the storage class of the name provisioned by the CSI driver of the first storage
+// class in the yaml file, the in-tree provisioner is replaced by the CSI driver it's migrated to, so the PVs of the
+// storage class are CSI volumes. The CSI driver is returned
+func CreateCSIStorageClass(ctx context.Context, client TestClient, name, path string) (string, error) {
+	drivers, err := getCSIDriversOfStorageClasses(path)
+	if err != nil {
+		return "", err
+	}
+	if len(drivers) == 0 {
+		return "", errors.Errorf("no storage class with CSI driver is found in %s", path)
+	}
+	reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+	bindingMode := storagev1.VolumeBindingWaitForFirstConsumer
+	sc := &storagev1.StorageClass{
+		ObjectMeta:        v1.ObjectMeta{Name: name},
+		Provisioner:       drivers[0],
+		ReclaimPolicy:     &reclaimPolicy,
+		VolumeBindingMode: &bindingMode,
+	}
+	if _, err := client.ClientGo.StorageV1().StorageClasses().Create(ctx, sc, v1.CreateOptions{}); err != nil {
+		return "", errors.Wrapf(err, "failed to create storage class %s of CSI driver %s", name, drivers[0])
+	}
+	fmt.Printf("Storage class %s of CSI driver %s is created\n", name, drivers[0])
+	return drivers[0], nil
+}
+
+// waitCSIDriverRegistered waits for the CSI driver to be created and registered on any of the nodes
+func waitCSIDriverRegistered(ctx context.Context, driver string, timeout time.Duration) error {
+	err := wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		if _, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "get", "csidriver", driver)); err != nil {
+			fmt.Printf("CSI driver %s is not found, stderr=%s\n", driver, stderr)
+			return false, nil
+		}
+		stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "get", "csinodes",
+			"-o", "jsonpath={.items[*].spec.drivers[*].name}"))
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get drivers of CSI nodes, stderr=%s", stderr)
+		}
+		for _, registered := range strings.Fields(stdout) {
+			if registered == driver {
+				return true, nil
+			}
+		}
+		fmt.Printf("CSI driver %s is not registered on any node yet\n", driver)
+		return false, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "provisioner of CSI driver %s is not available in %s", driver, timeout)
+	}
+	fmt.Printf("CSI driver %s is registered\n", driver)
+	return nil
+}
+
 func DeleteStorageClass(ctx context.Context, client TestClient, name string) error {
 	if err := client.ClientGo.StorageV1().StorageClasses().Delete(ctx, name, v1.DeleteOptions{}); err != nil {
 		return errors.Wrapf(err, "Could not retrieve storage classes %s", name)
 	}
 	return nil
 }
+
+const (
+	defaultStorageClassAnnotation     = "storageclass.kubernetes.io/is-default-class"
+	betaDefaultStorageClassAnnotation = "storageclass.beta.kubernetes.io/is-default-class"
+)
+
+// UnsetDefaultStorageClass removes the default annotations from all the default storage classes of
+// the cluster, and returns the annotation keys set to "true" on each of them keyed by the names, so
+// they could be set back as they were by RestoreDefaultStorageClass
+func UnsetDefaultStorageClass(ctx context.Context, client TestClient) (map[string][]string, error) {
+	scList, err := client.ClientGo.StorageV1().StorageClasses().List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list storage classes")
+	}
+	defaults := map[string][]string{}
+	for i := range scList.Items {
+		sc := &scList.Items[i]
+		var keys []string
+		for _, key := range []string{defaultStorageClassAnnotation, betaDefaultStorageClassAnnotation} {
+			if sc.Annotations[key] == "true" {
+				keys = append(keys, key)
+				delete(sc.Annotations, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if _, err := client.ClientGo.StorageV1().StorageClasses().Update(ctx, sc, v1.UpdateOptions{}); err != nil {
+			return defaults, errors.Wrapf(err, "failed to unset default storage class %s", sc.Name)
+		}
+		fmt.Printf("Default storage class %s is unset\n", sc.Name)
+		defaults[sc.Name] = keys
+	}
+	return defaults, nil
+}
+
+// RestoreDefaultStorageClass sets the storage classes back as the default ones with the annotation keys
+// returned by UnsetDefaultStorageClass
+func RestoreDefaultStorageClass(ctx context.Context, client TestClient, defaults map[string][]string) error {
+	for name, keys := range defaults {
+		sc, err := client.ClientGo.StorageV1().StorageClasses().Get(ctx, name, v1.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get storage class %s", name)
+		}
+		if sc.Annotations == nil {
+			sc.Annotations = map[string]string{}
+		}
+		for _, key := range keys {
+			sc.Annotations[key] = "true"
+		}
+		if _, err := client.ClientGo.StorageV1().StorageClasses().Update(ctx, sc, v1.UpdateOptions{}); err != nil {
+			return errors.Wrapf(err, "failed to restore default storage class %s", name)
+		}
+		fmt.Printf("Default storage class %s is restored with annotations %v\n", name, keys)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetCSIDriversOfStorageClasses(t *testing.T) {
+	drivers, err := getCSIDriversOfStorageClasses("../../testdata/storage-class/aws.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ebs.csi.aws.com"}, drivers)
+
+	path := filepath.Join(t.TempDir(), "sc.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: e2e-storage-class
+provisioner: csi.vsphere.vmware.com
+---
+apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: e2e-storage-class-static
+provisioner: kubernetes.io/no-provisioner
+---
+apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: e2e-storage-class-gcp
+provisioner: kubernetes.io/gce-pd
+`), 0600))
+	drivers, err = getCSIDriversOfStorageClasses(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"csi.vsphere.vmware.com", "pd.csi.storage.gke.io"}, drivers)
+
+	_, err = getCSIDriversOfStorageClasses(filepath.Join(t.TempDir(), "not-exist.yaml"))
+	assert.Error(t, err)
+}
+
+func TestCreateCSIStorageClass(t *testing.T) {
+	ctx := context.Background()
+	client := TestClient{ClientGo: fake.NewSimpleClientset()}
+
+	driver, err := CreateCSIStorageClass(ctx, client, "e2e-storage-class-csi", "../../testdata/storage-class/aws.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "ebs.csi.aws.com", driver)
+	sc, err := client.ClientGo.StorageV1().StorageClasses().Get(ctx, "e2e-storage-class-csi", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "ebs.csi.aws.com", sc.Provisioner)
+	assert.Equal(t, storagev1.VolumeBindingWaitForFirstConsumer, *sc.VolumeBindingMode)
+
+	_, err = CreateCSIStorageClass(ctx, client, "e2e-storage-class-csi", "../../testdata/storage-class/aws.yaml")
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "sc.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: e2e-storage-class-static
+provisioner: kubernetes.io/no-provisioner
+`), 0600))
+	_, err = CreateCSIStorageClass(ctx, client, "e2e-storage-class-csi-2", path)
+	assert.Error(t, err)
+}
+
+func TestUnsetAndRestoreDefaultStorageClass(t *testing.T) {
+	ctx := context.Background()
+	client := TestClient{ClientGo: fake.NewSimpleClientset(
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "sc-ga", Annotations: map[string]string{defaultStorageClassAnnotation: "true"}}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "sc-beta", Annotations: map[string]string{betaDefaultStorageClassAnnotation: "true", "foo": "bar"}}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "sc-other", Annotations: map[string]string{defaultStorageClassAnnotation: "false"}}},
+	)}
+
+	defaults, err := UnsetDefaultStorageClass(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"sc-ga":   {defaultStorageClassAnnotation},
+		"sc-beta": {betaDefaultStorageClassAnnotation},
+	}, defaults)
+	for _, name := range []string{"sc-ga", "sc-beta"} {
+		sc, err := client.ClientGo.StorageV1().StorageClasses().Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, sc.Annotations, defaultStorageClassAnnotation)
+		assert.NotContains(t, sc.Annotations, betaDefaultStorageClassAnnotation)
+	}
+
+	require.NoError(t, RestoreDefaultStorageClass(ctx, client, defaults))
+	sc, err := client.ClientGo.StorageV1().StorageClasses().Get(ctx, "sc-ga", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{defaultStorageClassAnnotation: "true"}, sc.Annotations)
+	sc, err = client.ClientGo.StorageV1().StorageClasses().Get(ctx, "sc-beta", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{betaDefaultStorageClassAnnotation: "true", "foo": "bar"}, sc.Annotations)
+	sc, err = client.ClientGo.StorageV1().StorageClasses().Get(ctx, "sc-other", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{defaultStorageClassAnnotation: "false"}, sc.Annotations)
+}
+
+func TestIsInTreeStorageClass(t *testing.T) {
+	inTree, err := IsInTreeStorageClass("../../testdata/storage-class/aws.yaml")
+	require.NoError(t, err)
+	assert.True(t, inTree)
+
+	inTree, err = IsInTreeStorageClass("../../testdata/storage-class/vsphere.yaml")
+	require.NoError(t, err)
+	assert.False(t, inTree)
+
+	_, err = IsInTreeStorageClass(filepath.Join(t.TempDir(), "not-exist.yaml"))
+	assert.Error(t, err)
+}
@@ -72,3 +72,16 @@ func WaitForSecretsComplete(c clientset.Interface, ns, secretName string) error
 func GetSecret(c clientset.Interface, ns, secretName string) (*v1.Secret, error) {
 	return c.CoreV1().Secrets(ns).Get(context.TODO(), secretName, metav1.GetOptions{})
 }
+
+// UpdateSecretData replaces the data of the secret
+func UpdateSecretData(c clientset.Interface, ns, name string, data map[string][]byte) error {
+	secret, err := GetSecret(c, ns, name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get secret %s in namespace %s", name, ns)
+	}
+	secret.Data = data
+	if _, err := c.CoreV1().Secrets(ns).Update(context.TODO(), secret, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to update data of secret %s in namespace %s", name, ns)
+	}
+	return nil
+}
@@ -18,12 +18,10 @@ package k8s
 
 import (
 	"context"
-	"fmt"
 	"os"
 	"time"
 
 	"github.com/pkg/errors"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/vmware-tanzu/velero/pkg/builder"
@@ -46,25 +44,77 @@ func WaitUntilServiceAccountCreated(ctx context.Context, client TestClient, name
 		})
 }
 
+// PatchServiceAccountWithImagePullSecret creates or updates the image pull secret with the docker credential and
+// adds it to the image pull secrets of the service account. It's idempotent, the secret isn't listed twice when
+// called again, and it verifies the service account references the secret afterwards, so the missing credential
+// fails here rather than surfacing as a registry rate-limit failure of the pods later
 func PatchServiceAccountWithImagePullSecret(ctx context.Context, client TestClient, namespace, serviceAccount, dockerCredentialFile string) error {
 	credential, err := os.ReadFile(dockerCredentialFile)
 	if err != nil {
 		return errors.Wrapf(err, "failed to read the docker credential file %q", dockerCredentialFile)
 	}
 	secretName := "image-pull-secret"
+	if err := applyImagePullSecret(ctx, client, namespace, secretName, credential); err != nil {
+		return err
+	}
+	if _, err := client.ClientGo.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to get the image pull secret %q under namespace %q", secretName, namespace)
+	}
+
+	sa, err := client.ClientGo.CoreV1().ServiceAccounts(namespace).Get(ctx, serviceAccount, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the service account %q under the namespace %q", serviceAccount, namespace)
+	}
+	if !hasImagePullSecret(sa, secretName) {
+		sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: secretName})
+		if _, err = client.ClientGo.CoreV1().ServiceAccounts(namespace).Update(ctx, sa, metav1.UpdateOptions{}); err != nil {
+			return errors.Wrapf(err, "failed to patch the service account %q under the namespace %q", serviceAccount, namespace)
+		}
+	}
+
+	sa, err = client.ClientGo.CoreV1().ServiceAccounts(namespace).Get(ctx, serviceAccount, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the service account %q under the namespace %q", serviceAccount, namespace)
+	}
+	if !hasImagePullSecret(sa, secretName) {
+		return errors.Errorf("the service account %q under the namespace %q doesn't list the image pull secret %q after patched",
+			serviceAccount, namespace, secretName)
+	}
+	return nil
+}
+
+// applyImagePullSecret creates the image pull secret, or updates the credential in it if it exists
+func applyImagePullSecret(ctx context.Context, client TestClient, namespace, secretName string, credential []byte) error {
 	secret := builder.ForSecret(namespace, secretName).Data(map[string][]byte{".dockerconfigjson": credential}).Result()
 	secret.Type = corev1.SecretTypeDockerConfigJson
-	if _, err = client.ClientGo.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+	_, err := client.ClientGo.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
 		return errors.Wrapf(err, "failed to create secret %q under namespace %q", secretName, namespace)
 	}
-
-	if _, err = client.ClientGo.CoreV1().ServiceAccounts(namespace).Patch(ctx, serviceAccount, types.StrategicMergePatchType,
-		[]byte(fmt.Sprintf(`{"imagePullSecrets": [{"name": "%s"}]}`, secretName)), metav1.PatchOptions{}); err != nil {
-		return errors.Wrapf(err, "failed to patch the service account %q under the namespace %q", serviceAccount, namespace)
+	existing, err := client.ClientGo.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get secret %q under namespace %q", secretName, namespace)
+	}
+	existing.Type = secret.Type
+	existing.Data = secret.Data
+	if _, err := client.ClientGo.CoreV1().Secrets(namespace).Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to update secret %q under namespace %q", secretName, namespace)
 	}
 	return nil
 }
 
+func hasImagePullSecret(sa *corev1.ServiceAccount, secretName string) bool {
+	for _, ref := range sa.ImagePullSecrets {
+		if ref.Name == secretName {
+			return true
+		}
+	}
+	return false
+}
+
 func CreateServiceAccount(ctx context.Context, client TestClient, namespace string, serviceaccount string) error {
 	sa := &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,64 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPatchServiceAccountWithImagePullSecret(t *testing.T) {
+	credentialFile := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(credentialFile, []byte(`{"auths":{}}`), 0600))
+	ctx := context.Background()
+
+	t.Run("service account not exist", func(t *testing.T) {
+		client := TestClient{ClientGo: fake.NewSimpleClientset()}
+		assert.Error(t, PatchServiceAccountWithImagePullSecret(ctx, client, "ns-1", "default", credentialFile))
+	})
+
+	t.Run("credential file not exist", func(t *testing.T) {
+		client := TestClient{ClientGo: fake.NewSimpleClientset(
+			&corev1api.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "ns-1", Name: "default"}})}
+		assert.Error(t, PatchServiceAccountWithImagePullSecret(ctx, client, "ns-1", "default", credentialFile+".missing"))
+	})
+
+	t.Run("patched repeatedly", func(t *testing.T) {
+		client := TestClient{ClientGo: fake.NewSimpleClientset(&corev1api.ServiceAccount{
+			ObjectMeta:       metav1.ObjectMeta{Namespace: "ns-1", Name: "default"},
+			ImagePullSecrets: []corev1api.LocalObjectReference{{Name: "other-secret"}},
+		})}
+		require.NoError(t, PatchServiceAccountWithImagePullSecret(ctx, client, "ns-1", "default", credentialFile))
+		require.NoError(t, PatchServiceAccountWithImagePullSecret(ctx, client, "ns-1", "default", credentialFile))
+
+		sa, err := client.ClientGo.CoreV1().ServiceAccounts("ns-1").Get(ctx, "default", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []corev1api.LocalObjectReference{{Name: "other-secret"}, {Name: "image-pull-secret"}}, sa.ImagePullSecrets)
+		secret, err := client.ClientGo.CoreV1().Secrets("ns-1").Get(ctx, "image-pull-secret", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, corev1api.SecretTypeDockerConfigJson, secret.Type)
+		assert.Equal(t, []byte(`{"auths":{}}`), secret.Data[".dockerconfigjson"])
+	})
+}
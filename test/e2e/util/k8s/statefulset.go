@@ -0,0 +1,137 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// StatefulSetBuilder builds StatefulSet objects.
+type StatefulSetBuilder struct {
+	*apps.StatefulSet
+}
+
+func (s *StatefulSetBuilder) Result() *apps.StatefulSet {
+	return s.StatefulSet
+}
+
+// NewStatefulSet returns a StatefulSet with a busybox container
+func NewStatefulSet(name, ns string, replicas int32, labels map[string]string) *StatefulSetBuilder {
+	return &StatefulSetBuilder{
+		&apps.StatefulSet{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "StatefulSet",
+				APIVersion: "apps/v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns,
+				Name:      name,
+				Labels:    labels,
+			},
+			Spec: apps.StatefulSetSpec{
+				Replicas:    &replicas,
+				ServiceName: name,
+				Selector:    &metav1.LabelSelector{MatchLabels: labels},
+				Template: v1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: labels,
+					},
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{
+							{
+								Name:    "container-busybox",
+								Image:   "gcr.io/velero-gcp/busybox:latest",
+								Command: []string{"sleep", "1000000"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// WithVolumeClaimTemplate adds a volume claim template with the storage class and mounts it
+// to the first container, an empty storage class means the default storage class
+func (s *StatefulSetBuilder) WithVolumeClaimTemplate(name, sc string) *StatefulSetBuilder {
+	pvc := v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceStorage: resource.MustParse("1Gi"),
+				},
+			},
+		},
+	}
+	if sc != "" {
+		pvc.Spec.StorageClassName = &sc
+	}
+	s.Spec.VolumeClaimTemplates = append(s.Spec.VolumeClaimTemplates, pvc)
+	s.Spec.Template.Spec.Containers[0].VolumeMounts = append(s.Spec.Template.Spec.Containers[0].VolumeMounts, v1.VolumeMount{
+		Name:      name,
+		MountPath: "/" + name,
+	})
+	return s
+}
+
+func CreateStatefulSet(c clientset.Interface, ns string, statefulSet *apps.StatefulSet) (*apps.StatefulSet, error) {
+	return c.AppsV1().StatefulSets(ns).Create(context.TODO(), statefulSet, metav1.CreateOptions{})
+}
+
+func GetStatefulSet(c clientset.Interface, ns, name string) (*apps.StatefulSet, error) {
+	return c.AppsV1().StatefulSets(ns).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// ScaleStatefulSet sets the replicas of the StatefulSet
+func ScaleStatefulSet(c clientset.Interface, ns, name string, replicas int32) error {
+	scale, err := c.AppsV1().StatefulSets(ns).GetScale(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get scale of statefulset %q: %v", name, err)
+	}
+	scale.Spec.Replicas = replicas
+	if _, err := c.AppsV1().StatefulSets(ns).UpdateScale(context.TODO(), name, scale, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to scale statefulset %q to %d: %v", name, replicas, err)
+	}
+	return nil
+}
+
+// WaitForStatefulSetReplicas waits for number of current and ready replicas to equal the number of replicas.
+func WaitForStatefulSetReplicas(c clientset.Interface, ns, name string) error {
+	if err := wait.PollImmediate(PollInterval, PollTimeout, func() (bool, error) {
+		statefulSet, err := c.AppsV1().StatefulSets(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("failed to get statefulset %q: %v", name, err)
+		}
+		return statefulSet.Status.ReadyReplicas == *statefulSet.Spec.Replicas &&
+			statefulSet.Status.Replicas == *statefulSet.Spec.Replicas, nil
+	}); err != nil {
+		return fmt.Errorf("failed to wait for .readyReplicas and .replicas of statefulset to equal .spec.replicas: %v", err)
+	}
+	return nil
+}
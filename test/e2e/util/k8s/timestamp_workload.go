@@ -0,0 +1,156 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	veleroexec "github.com/vmware-tanzu/velero/pkg/util/exec"
+)
+
+const (
+	// TimestampFile is the file in the volume of the timestamp workload the timestamps are appended to
+	TimestampFile = "timestamps"
+	timestampPort = 8080
+)
+
+// CreateTimestampWorkload creates a pod which appends the unix timestamp to TimestampFile in the
+// volume every second and serves the volume over HTTP, the pod is ready once the file is served.
+// The timestamps surviving a backup and restore tell the point in time the data is recovered to.
+func CreateTimestampWorkload(client TestClient, ns, name, sc, volume string) (*corev1.Pod, error) {
+	pvc, err := CreatePVC(client, ns, "pvc-"+volume, sc, nil)
+	if err != nil {
+		return nil, err
+	}
+	script := fmt.Sprintf("httpd -p %d -h /%s && while true; do date +%%s >> /%s/%s; sleep 1; done",
+		timestampPort, volume, volume, TimestampFile)
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    name,
+					Image:   "gcr.io/velero-gcp/busybox",
+					Command: []string{"/bin/sh", "-c", script},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      volume,
+							MountPath: "/" + volume,
+						},
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{
+								Path: "/" + TimestampFile,
+								Port: intstr.FromInt(timestampPort),
+							},
+						},
+						PeriodSeconds: 1,
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: volume,
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: pvc.Name,
+						},
+					},
+				},
+			},
+		},
+	}
+	return client.ClientGo.CoreV1().Pods(ns).Create(context.TODO(), p, metav1.CreateOptions{})
+}
+
+// GetTimestampsFromWorkload gets the content of TimestampFile served by the timestamp workload
+func GetTimestampsFromWorkload(ctx context.Context, namespace, podName string) (string, error) {
+	arg := []string{"exec", "-n", namespace, "-c", podName, podName,
+		"--", "wget", "-q", "-O", "-", fmt.Sprintf("http://localhost:%d/%s", timestampPort, TimestampFile)}
+	stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", arg...))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get timestamps from pod %s/%s, stderr=%s", namespace, podName, stderr)
+	}
+	return stdout, nil
+}
+
+// WaitForTimestampWorkloadServing waits for the timestamp workload to serve TimestampFile and returns
+// the time it was found serving
+func WaitForTimestampWorkloadServing(ctx context.Context, namespace, podName string, timeout time.Duration) (time.Time, error) {
+	var serving time.Time
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		if _, err := GetTimestampsFromWorkload(ctx, namespace, podName); err != nil {
+			return false, nil
+		}
+		serving = time.Now()
+		return true, nil
+	})
+	if err != nil {
+		return serving, errors.Wrapf(err, "failed to wait for pod %s/%s to serve timestamps", namespace, podName)
+	}
+	return serving, nil
+}
+
+// ParseTimestamps parses the unix timestamps written by the timestamp workload line by line. The last
+// line without the trailing newline is partially written, e.g. the file is backed up or copied while the
+// timestamp is being appended, so it's dropped even if it's a valid number
+func ParseTimestamps(content string) ([]time.Time, error) {
+	lines := strings.Split(content, "\n")
+	// the element after the last newline is empty for the completely written content
+	lines = lines[:len(lines)-1]
+	var timestamps []time.Time
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sec, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timestamp %q at line %d", line, i+1)
+		}
+		timestamps = append(timestamps, time.Unix(sec, 0))
+	}
+	return timestamps, nil
+}
+
+// LastTimestampBefore returns the latest of the timestamps before t, the timestamps written after t
+// such as the ones written by the restored workload are ignored
+func LastTimestampBefore(timestamps []time.Time, t time.Time) (time.Time, bool) {
+	var last time.Time
+	found := false
+	for _, ts := range timestamps {
+		if ts.Before(t) && (!found || ts.After(last)) {
+			last = ts
+			found = true
+		}
+	}
+	return last, found
+}
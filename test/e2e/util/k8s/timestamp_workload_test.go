@@ -0,0 +1,95 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimestamps(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		expected  []int64
+		expectErr bool
+	}{
+		{
+			name:     "empty",
+			content:  "",
+			expected: nil,
+		},
+		{
+			name:     "timestamps",
+			content:  "1700000000\n1700000001\n1700000002\n",
+			expected: []int64{1700000000, 1700000001, 1700000002},
+		},
+		{
+			name:     "partially written last line",
+			content:  "1700000000\n1700000001\n17000",
+			expected: []int64{1700000000, 1700000001},
+		},
+		{
+			name:     "valid last line without newline",
+			content:  "1700000000\n1700000001\n1700000002",
+			expected: []int64{1700000000, 1700000001},
+		},
+		{
+			name:     "truncated last line",
+			content:  "1700000000\n1700000001\n1700\x00",
+			expected: []int64{1700000000, 1700000001},
+		},
+		{
+			name:      "invalid line",
+			content:   "1700000000\ninvalid\n1700000002\n",
+			expectErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			timestamps, err := ParseTimestamps(tc.content)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var actual []int64
+			for _, ts := range timestamps {
+				actual = append(actual, ts.Unix())
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestLastTimestampBefore(t *testing.T) {
+	timestamps := []time.Time{time.Unix(100, 0), time.Unix(101, 0), time.Unix(200, 0), time.Unix(201, 0)}
+
+	last, found := LastTimestampBefore(timestamps, time.Unix(150, 0))
+	assert.True(t, found)
+	assert.Equal(t, time.Unix(101, 0), last)
+
+	last, found = LastTimestampBefore(timestamps, time.Unix(300, 0))
+	assert.True(t, found)
+	assert.Equal(t, time.Unix(201, 0), last)
+
+	_, found = LastTimestampBefore(timestamps, time.Unix(100, 0))
+	assert.False(t, found)
+}
@@ -0,0 +1,418 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	veleroexec "github.com/vmware-tanzu/velero/pkg/util/exec"
+)
+
+// VerifyStrategy is the way to read the data in the volumes of the workload for the verification
+type VerifyStrategy string
+
+const (
+	// VerifyByExec reads the data by "kubectl exec" into the container of the workload
+	VerifyByExec VerifyStrategy = "exec"
+	// VerifyByPortForwardHTTP reads the checksums served by the checksum server sidecar of the workload
+	// over "kubectl port-forward"
+	VerifyByPortForwardHTTP VerifyStrategy = "port-forward-http"
+	// VerifyByPVReader reads the data from the hostPath or local PV directly on the kind node
+	VerifyByPVReader VerifyStrategy = "pv-reader"
+)
+
+// VerifyTarget is the file in the volume of the pod to verify
+type VerifyTarget struct {
+	Namespace string
+	Pod       string
+	Container string
+	Volume    string
+	File      string
+}
+
+func (t VerifyTarget) String() string {
+	return fmt.Sprintf("%s in volume %s of pod %s/%s", t.File, t.Volume, t.Namespace, t.Pod)
+}
+
+// DataVerifier gets the checksum of the file in the volume of the workload by one of the strategies
+type DataVerifier interface {
+	Strategy() VerifyStrategy
+	// Available returns an error if the target can't be verified by the verifier
+	Available(ctx context.Context, target VerifyTarget) error
+	// Checksum returns the sha256 checksum of the target
+	Checksum(ctx context.Context, target VerifyTarget) (string, error)
+	// VolumeChecksums returns the sha256 checksums of all the files in the volume of the target keyed by
+	// the paths relative to the volume, e.g. "./dir/file", the file of the target is ignored
+	VolumeChecksums(ctx context.Context, target VerifyTarget) (map[string]string, error)
+}
+
+// NewDataVerifier returns the verifier of the strategy
+func NewDataVerifier(client TestClient, strategy VerifyStrategy) (DataVerifier, error) {
+	switch strategy {
+	case "", VerifyByExec:
+		return &execVerifier{}, nil
+	case VerifyByPortForwardHTTP:
+		return &portForwardHTTPVerifier{client: client}, nil
+	case VerifyByPVReader:
+		return &pvReaderVerifier{client: client}, nil
+	default:
+		return nil, errors.Errorf("unknown verify strategy %q", strategy)
+	}
+}
+
+// VerifyFileContent checks the file has the content by comparing the checksums. The file is verified by
+// the preferred strategy, and by exec if the preferred one is unavailable or fails to get the checksum.
+func VerifyFileContent(ctx context.Context, client TestClient, strategy VerifyStrategy, target VerifyTarget, content string) error {
+	checksum, err := GetFileChecksum(ctx, client, strategy, target)
+	if err != nil {
+		return err
+	}
+	if expected := fmt.Sprintf("%x", sha256.Sum256([]byte(content))); checksum != expected {
+		return errors.Errorf("checksum %s of %s doesn't match the expected %s", checksum, target, expected)
+	}
+	return nil
+}
+
+// GetFileChecksum returns the checksum of the file by the preferred strategy, and by exec if the preferred one
+// is unavailable or fails to get the checksum. The checksums of the large files are compared before backup and
+// after restore instead of their contents
+func GetFileChecksum(ctx context.Context, client TestClient, strategy VerifyStrategy, target VerifyTarget) (string, error) {
+	checksum := ""
+	err := verifyWithFallback(ctx, client, strategy, target, func(verifier DataVerifier) error {
+		var err error
+		checksum, err = verifier.Checksum(ctx, target)
+		return err
+	})
+	return checksum, err
+}
+
+// GetVolumeChecksums returns the checksums of all the files in the volume of the target by the preferred
+// strategy, and by exec if the preferred one is unavailable or fails to get the checksums
+func GetVolumeChecksums(ctx context.Context, client TestClient, strategy VerifyStrategy, target VerifyTarget) (map[string]string, error) {
+	var checksums map[string]string
+	err := verifyWithFallback(ctx, client, strategy, target, func(verifier DataVerifier) error {
+		var err error
+		checksums, err = verifier.VolumeChecksums(ctx, target)
+		return err
+	})
+	return checksums, err
+}
+
+// VerifyVolumeChecksums checks the files in the volume of the target have the expected checksums keyed by the
+// paths relative to the volume, the files not in the expected ones such as the ones written by the restore are
+// ignored. The volume is verified by the preferred strategy with the fallback as GetVolumeChecksums
+func VerifyVolumeChecksums(ctx context.Context, client TestClient, strategy VerifyStrategy, target VerifyTarget, expected map[string]string) error {
+	checksums, err := GetVolumeChecksums(ctx, client, strategy, target)
+	if err != nil {
+		return err
+	}
+	if diffs := diffChecksums(expected, checksums); len(diffs) > 0 {
+		return errors.Errorf("files in volume %s of pod %s/%s mismatch: %s", target.Volume, target.Namespace, target.Pod, strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// diffChecksums returns the description of the expected files which are missing or have the different checksums
+func diffChecksums(expected, actual map[string]string) []string {
+	var diffs []string
+	for path, checksum := range expected {
+		got, ok := actual[path]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("%s is missing", path))
+		case got != checksum:
+			diffs = append(diffs, fmt.Sprintf("checksum of %s is %s, expected %s", path, got, checksum))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+// verifyWithFallback runs the verification by the verifier of the preferred strategy, and by exec if the
+// preferred one is unavailable for the target or fails
+func verifyWithFallback(ctx context.Context, client TestClient, strategy VerifyStrategy, target VerifyTarget, verify func(DataVerifier) error) error {
+	verifier, err := NewDataVerifier(client, strategy)
+	if err != nil {
+		return err
+	}
+	err = verifier.Available(ctx, target)
+	if err == nil {
+		err = verify(verifier)
+	}
+	if err != nil && verifier.Strategy() != VerifyByExec {
+		fmt.Printf("Fall back to verify %s by %s, %s is unavailable: %v\n", target, VerifyByExec, strategy, err)
+		err = verify(&execVerifier{})
+	}
+	return err
+}
+
+type execVerifier struct{}
+
+func (v *execVerifier) Strategy() VerifyStrategy {
+	return VerifyByExec
+}
+
+func (v *execVerifier) Available(ctx context.Context, target VerifyTarget) error {
+	return nil
+}
+
+func (v *execVerifier) Checksum(ctx context.Context, target VerifyTarget) (string, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", "exec", "-n", target.Namespace, "-c", target.Container, target.Pod,
+		"--", "sha256sum", fmt.Sprintf("/%s/%s", target.Volume, target.File))
+	fmt.Printf("Kubectl exec cmd =%v\n", cmd)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get checksum of %s, stderr=%s", target, stderr)
+	}
+	return parseSha256sum(stdout)
+}
+
+func (v *execVerifier) VolumeChecksums(ctx context.Context, target VerifyTarget) (map[string]string, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", "exec", "-n", target.Namespace, "-c", target.Container, target.Pod,
+		"--", "sh", "-c", fmt.Sprintf("cd /%s && %s", target.Volume, volumeChecksumsScript))
+	fmt.Printf("Kubectl exec cmd =%v\n", cmd)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get checksums of volume %s of pod %s/%s, stderr=%s", target.Volume, target.Namespace, target.Pod, stderr)
+	}
+	return ParseChecksums(stdout), nil
+}
+
+type portForwardHTTPVerifier struct {
+	client TestClient
+}
+
+func (v *portForwardHTTPVerifier) Strategy() VerifyStrategy {
+	return VerifyByPortForwardHTTP
+}
+
+func (v *portForwardHTTPVerifier) Available(ctx context.Context, target VerifyTarget) error {
+	pod, err := GetPod(ctx, v.client, target.Namespace, target.Pod)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pod %s/%s", target.Namespace, target.Pod)
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == ChecksumServerContainer {
+			return nil
+		}
+	}
+	return errors.Errorf("pod %s/%s has no %s sidecar", target.Namespace, target.Pod, ChecksumServerContainer)
+}
+
+func (v *portForwardHTTPVerifier) Checksum(ctx context.Context, target VerifyTarget) (string, error) {
+	checksums, err := v.VolumeChecksums(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	checksum, ok := checksums["./"+target.File]
+	if !ok {
+		return "", errors.Errorf("no checksum of %s served", target)
+	}
+	return checksum, nil
+}
+
+func (v *portForwardHTTPVerifier) VolumeChecksums(ctx context.Context, target VerifyTarget) (map[string]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, "kubectl", "port-forward", "-n", target.Namespace, "pod/"+target.Pod,
+		fmt.Sprintf(":%d", ChecksumServerPort))
+	fmt.Printf("Kubectl port-forward cmd =%v\n", cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to get stdout of kubectl port-forward")
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, errors.Wrapf(err, "failed to port-forward pod %s/%s", target.Namespace, target.Pod)
+	}
+	defer func() {
+		cancel()
+		_ = cmd.Wait()
+	}()
+
+	reader := bufio.NewReader(stdout)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to port-forward pod %s/%s", target.Namespace, target.Pod)
+	}
+	localPort, err := parseForwardedPort(line)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_, _ = io.Copy(io.Discard, reader)
+	}()
+
+	// the checksums are not served until the sidecar computes them for the first time
+	var checksums map[string]string
+	url := fmt.Sprintf("http://127.0.0.1:%s/%s", localPort, target.Volume)
+	err = wait.PollImmediate(time.Second, time.Minute, func() (bool, error) {
+		resp, err := http.Get(url)
+		if err != nil {
+			return false, nil
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return false, nil
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return false, nil
+		}
+		checksums = ParseChecksums(string(body))
+		return true, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get checksums of volume %s from %s", target.Volume, url)
+	}
+	return checksums, nil
+}
+
+type pvReaderVerifier struct {
+	client TestClient
+}
+
+func (v *pvReaderVerifier) Strategy() VerifyStrategy {
+	return VerifyByPVReader
+}
+
+func (v *pvReaderVerifier) Available(ctx context.Context, target VerifyTarget) error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return errors.Wrap(err, "docker is required to read the volumes on kind nodes")
+	}
+	node, _, err := v.hostPathOf(ctx, target)
+	if err != nil {
+		return err
+	}
+	// the nodes of kind are the docker containers of the same names
+	if _, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "docker", "inspect", "--type", "container", node)); err != nil {
+		return errors.Wrapf(err, "node %s is not a kind node, stderr=%s", node, stderr)
+	}
+	return nil
+}
+
+func (v *pvReaderVerifier) Checksum(ctx context.Context, target VerifyTarget) (string, error) {
+	node, path, err := v.hostPathOf(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, "docker", "exec", node, "sha256sum", path+"/"+target.File)
+	fmt.Printf("Docker exec cmd =%v\n", cmd)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get checksum of %s on node %s, stderr=%s", target, node, stderr)
+	}
+	return parseSha256sum(stdout)
+}
+
+func (v *pvReaderVerifier) VolumeChecksums(ctx context.Context, target VerifyTarget) (map[string]string, error) {
+	node, path, err := v.hostPathOf(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "docker", "exec", node, "sh", "-c", fmt.Sprintf("cd %s && %s", path, volumeChecksumsScript))
+	fmt.Printf("Docker exec cmd =%v\n", cmd)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get checksums of volume %s of pod %s/%s on node %s, stderr=%s",
+			target.Volume, target.Namespace, target.Pod, node, stderr)
+	}
+	return ParseChecksums(stdout), nil
+}
+
+// hostPathOf returns the node of the pod and the path of the PV mounted as the volume on the node
+func (v *pvReaderVerifier) hostPathOf(ctx context.Context, target VerifyTarget) (string, string, error) {
+	pod, err := GetPod(ctx, v.client, target.Namespace, target.Pod)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to get pod %s/%s", target.Namespace, target.Pod)
+	}
+	claim := ""
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == target.Volume && volume.PersistentVolumeClaim != nil {
+			claim = volume.PersistentVolumeClaim.ClaimName
+		}
+	}
+	if claim == "" {
+		return "", "", errors.Errorf("volume %s of pod %s/%s is not a PVC", target.Volume, target.Namespace, target.Pod)
+	}
+	pvc, err := GetPVC(ctx, v.client, target.Namespace, claim)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to get PVC %s/%s", target.Namespace, claim)
+	}
+	pv, err := GetPersistentVolume(ctx, v.client, "", pvc.Spec.VolumeName)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to get PV %s", pvc.Spec.VolumeName)
+	}
+	switch {
+	case pv.Spec.HostPath != nil:
+		return pod.Spec.NodeName, pv.Spec.HostPath.Path, nil
+	case pv.Spec.Local != nil:
+		return pod.Spec.NodeName, pv.Spec.Local.Path, nil
+	default:
+		return "", "", errors.Errorf("PV %s is neither hostPath nor local volume", pv.Name)
+	}
+}
+
+// volumeChecksumsScript prints the checksums of all the files under the current directory in the same
+// format as the checksum server sidecar
+const volumeChecksumsScript = "find . -type f -exec sha256sum {} +"
+
+var forwardedPortRegex = regexp.MustCompile(`^Forwarding from 127\.0\.0\.1:(\d+) ->`)
+
+// parseForwardedPort gets the local port from the first line printed by "kubectl port-forward"
+func parseForwardedPort(line string) (string, error) {
+	match := forwardedPortRegex.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return "", errors.Errorf("failed to get the forwarded port from %q", line)
+	}
+	return match[1], nil
+}
+
+// parseSha256sum returns the digest in the output "<digest>  <file>" of sha256sum
+func parseSha256sum(output string) (string, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", errors.Errorf("invalid output of sha256sum %q", output)
+	}
+	return fields[0], nil
+}
+
+// ParseChecksums parses the output of sha256sum into the map of the file paths to the checksums
+func ParseChecksums(output string) map[string]string {
+	checksums := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			continue
+		}
+		checksums[fields[1]] = fields[0]
+	}
+	return checksums
+}
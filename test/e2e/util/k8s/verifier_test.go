@@ -0,0 +1,93 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChecksums(t *testing.T) {
+	output := `e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  ./empty.txt
+5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03  ./.velero/0b4b1ff8
+
+malformed line
+`
+	assert.Equal(t, map[string]string{
+		"./empty.txt":        "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"./.velero/0b4b1ff8": "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+	}, ParseChecksums(output))
+	assert.Empty(t, ParseChecksums(""))
+}
+
+func TestParseSha256sum(t *testing.T) {
+	digest := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	got, err := parseSha256sum(digest + "  /data/file\n")
+	assert.NoError(t, err)
+	assert.Equal(t, digest, got)
+
+	_, err = parseSha256sum("")
+	assert.Error(t, err)
+	_, err = parseSha256sum("sha256sum: /data/file: No such file or directory\n")
+	assert.Error(t, err)
+}
+
+func TestParseForwardedPort(t *testing.T) {
+	port, err := parseForwardedPort("Forwarding from 127.0.0.1:38123 -> 8081\n")
+	require.NoError(t, err)
+	assert.Equal(t, "38123", port)
+
+	_, err = parseForwardedPort("error: unable to forward port because pod is not running\n")
+	assert.Error(t, err)
+}
+
+func TestNewDataVerifier(t *testing.T) {
+	for _, strategy := range []VerifyStrategy{"", VerifyByExec, VerifyByPortForwardHTTP, VerifyByPVReader} {
+		verifier, err := NewDataVerifier(TestClient{}, strategy)
+		require.NoError(t, err)
+		if strategy == "" {
+			assert.Equal(t, VerifyByExec, verifier.Strategy())
+		} else {
+			assert.Equal(t, strategy, verifier.Strategy())
+		}
+	}
+	_, err := NewDataVerifier(TestClient{}, "unknown")
+	assert.Error(t, err)
+}
+
+func TestDiffChecksums(t *testing.T) {
+	expected := map[string]string{
+		"./a":     "checksum-a",
+		"./dir/b": "checksum-b",
+		"./c":     "checksum-c",
+	}
+	assert.Empty(t, diffChecksums(expected, map[string]string{
+		"./a":                "checksum-a",
+		"./dir/b":            "checksum-b",
+		"./c":                "checksum-c",
+		"./.velero/0b4b1ff8": "checksum-restore",
+	}))
+	assert.Equal(t, []string{
+		"./c is missing",
+		"checksum of ./dir/b is checksum-x, expected checksum-b",
+	}, diffChecksums(expected, map[string]string{
+		"./a":     "checksum-a",
+		"./dir/b": "checksum-x",
+	}))
+}
@@ -18,17 +18,23 @@ package kibishii
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/wait"
 
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	veleroexec "github.com/vmware-tanzu/velero/pkg/util/exec"
 	. "github.com/vmware-tanzu/velero/test/e2e"
+	"github.com/vmware-tanzu/velero/test/e2e/util/common"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/providers"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/velero"
@@ -36,6 +42,18 @@ import (
 
 const (
 	jumpPadPod = "jump-pad"
+
+	kibishiiStatefulSet = "kibishii-deployment"
+	// defaultKibishiiReplicas is the number of the kibishii pods deployed by the manifests
+	defaultKibishiiReplicas = 2
+
+	// kibishiiCommandTimeout is the timeout of each run of the generate and verify scripts of kibishii
+	kibishiiCommandTimeout = 20 * time.Minute
+
+	// the large file is written besides the data generated by kibishii if it's enabled, and it's verified by its checksum
+	kibishiiContainer = "kibishii"
+	kibishiiVolume    = "data"
+	kibishiiLargeFile = "large-file"
 )
 
 type KibishiiData struct {
@@ -46,13 +64,37 @@ type KibishiiData struct {
 	BlockSize     int
 	PassNum       int
 	ExpectedNodes int
+	// RewriteAfterRestore writes another pass of data after the restored data is verified and verifies the
+	// whole set again, which checks the restored volumes are still writable without corrupting the data
+	RewriteAfterRestore bool
+	// volumeChecksums are the checksums of the files in the data volume of each kibishii pod keyed by the
+	// namespaces and the pods, they're recorded after the data is generated and verified after restore by the
+	// preferred verify strategy
+	volumeChecksums map[string]map[string]map[string]string
 }
 
-var DefaultKibishiiData = &KibishiiData{2, 10, 10, 1024, 1024, 0, 2}
-var KibishiiPodNameList = []string{"kibishii-deployment-0", "kibishii-deployment-1"}
+var DefaultKibishiiData = &KibishiiData{Levels: 2, DirsPerLevel: 10, FilesPerLevel: 10, FileLength: 1024, BlockSize: 1024, PassNum: 0, ExpectedNodes: 2}
+var KibishiiPodNameList = KibishiiPodNames(defaultKibishiiReplicas)
+
+// KibishiiPodNames returns the names of the pods of the kibishii StatefulSet with the replicas
+func KibishiiPodNames(replicas int) []string {
+	var pods []string
+	for i := 0; i < replicas; i++ {
+		pods = append(pods, fmt.Sprintf("%s-%d", kibishiiStatefulSet, i))
+	}
+	return pods
+}
 
-// RunKibishiiTests runs kibishii tests on the provider.
-func RunKibishiiTests(veleroCfg VeleroConfig, backupName, restoreName, backupLocation, kibishiiNamespace string,
+// KibishiiTestResult records the durations of the backup and restore of a kibishii test
+type KibishiiTestResult struct {
+	BackupDuration  time.Duration
+	RestoreDuration time.Duration
+}
+
+// RunKibishiiTests runs kibishii tests on the provider. The backup is restored into restoreNamespace
+// by namespace mapping and the data is verified there if it's not empty, otherwise it's restored
+// into kibishiiNamespace.
+func RunKibishiiTests(veleroCfg VeleroConfig, backupName, restoreName, backupLocation, kibishiiNamespace, restoreNamespace string,
 	useVolumeSnapshots, defaultVolumesToFsBackup bool) error {
 	client := *veleroCfg.ClientToInstallVelero
 	oneHourTimeout, ctxCancel := context.WithTimeout(context.Background(), time.Minute*60)
@@ -63,10 +105,16 @@ func RunKibishiiTests(veleroCfg VeleroConfig, backupName, restoreName, backupLoc
 	registryCredentialFile := veleroCfg.RegistryCredentialFile
 	veleroFeatures := veleroCfg.Features
 	kibishiiDirectory := veleroCfg.KibishiiDirectory
+	kibishiiStorageClass := veleroCfg.KibishiiStorageClass
+	targetNamespace := kibishiiNamespace
+	if restoreNamespace != "" {
+		targetNamespace = restoreNamespace
+	}
+	log := kibishiiLogger(kibishiiNamespace, backupName)
 	if _, err := GetNamespace(context.Background(), client, kibishiiNamespace); err == nil {
-		fmt.Printf("Workload namespace %s exists, delete it first.\n", kibishiiNamespace)
+		log.Info("Workload namespace exists, delete it first")
 		if err = DeleteNamespace(context.Background(), client, kibishiiNamespace, true); err != nil {
-			fmt.Println(errors.Wrapf(err, "failed to delete the namespace %q", kibishiiNamespace))
+			log.WithError(err).Error("Failed to delete the namespace")
 		}
 	}
 	if err := CreateNamespace(oneHourTimeout, client, kibishiiNamespace); err != nil {
@@ -75,16 +123,31 @@ func RunKibishiiTests(veleroCfg VeleroConfig, backupName, restoreName, backupLoc
 	defer func() {
 		if !veleroCfg.Debug {
 			if err := DeleteNamespace(context.Background(), client, kibishiiNamespace, true); err != nil {
-				fmt.Println(errors.Wrapf(err, "failed to delete the namespace %q", kibishiiNamespace))
+				log.WithError(err).Error("Failed to delete the namespace")
+			}
+			if targetNamespace != kibishiiNamespace {
+				if err := DeleteNamespace(context.Background(), client, targetNamespace, true); err != nil {
+					log.WithError(err).Errorf("Failed to delete the namespace %s", targetNamespace)
+				}
 			}
 		}
 	}()
 
 	if err := KibishiiPrepareBeforeBackup(oneHourTimeout, client, providerName,
 		kibishiiNamespace, registryCredentialFile, veleroFeatures,
-		kibishiiDirectory, useVolumeSnapshots, DefaultKibishiiData); err != nil {
+		kibishiiDirectory, kibishiiStorageClass, useVolumeSnapshots, DefaultKibishiiData); err != nil {
 		return errors.Wrapf(err, "Failed to install and prepare data for kibishii %s", kibishiiNamespace)
 	}
+	var largeFileChecksums map[string]string
+	if veleroCfg.KibishiiLargeFileSizeMB > 0 {
+		var err error
+		largeFileChecksums, err = writeLargeFiles(oneHourTimeout, client, kibishiiNamespace, veleroCfg.KibishiiLargeFileSizeMB)
+		if err != nil {
+			return err
+		}
+	}
+	// a volume is backed up for each kibishii pod
+	replicas := len(kibishiiPodNames(DefaultKibishiiData))
 
 	var BackupCfg BackupConfig
 	BackupCfg.BackupName = backupName
@@ -94,39 +157,67 @@ func RunKibishiiTests(veleroCfg VeleroConfig, backupName, restoreName, backupLoc
 	BackupCfg.DefaultVolumesToFsBackup = defaultVolumesToFsBackup
 	BackupCfg.Selector = ""
 	BackupCfg.ProvideSnapshotsVolumeParam = veleroCfg.ProvideSnapshotsVolumeParam
+	BackupCfg.ProgressClient = &client
+	BackupCfg.ProgressFn = func(backupName string, phase velerov1api.BackupPhase, progress velerov1api.BackupProgress) {
+		log.WithFields(logrus.Fields{
+			"phase":         phase,
+			"itemsBackedUp": progress.ItemsBackedUp,
+			"totalItems":    progress.TotalItems,
+		}).Info("Backup progress changed")
+	}
+	backupMetric := StartPhaseMetric(PerfPhaseBackup, backupName, "")
 	if err := VeleroBackupNamespace(oneHourTimeout, veleroCLI, veleroNamespace, BackupCfg); err != nil {
-		RunDebug(context.Background(), veleroCLI, veleroNamespace, backupName, "")
+		if defaultVolumesToFsBackup {
+			RunDebugWithNodeAgent(context.Background(), veleroCLI, veleroNamespace, backupName, "")
+		} else {
+			RunDebug(context.Background(), veleroCLI, veleroNamespace, backupName, "")
+		}
 		return errors.Wrapf(err, "Failed to backup kibishii namespace %s", kibishiiNamespace)
 	}
+	backupBytes := recordPhaseMetric(oneHourTimeout, veleroCfg, backupMetric, -1)
+	if err := backupObjectsShouldExistInCloud(veleroCfg, backupName, backupLocation, kibishiiNamespace, useVolumeSnapshots); err != nil {
+		return err
+	}
 	var snapshotCheckPoint SnapshotCheckPoint
-	var err error
 	pvbs, err := GetPVB(oneHourTimeout, veleroCfg.VeleroNamespace, kibishiiNamespace)
 	if useVolumeSnapshots {
-		if err != nil || len(pvbs) != 0 {
+		if err != nil {
 			return errors.Wrapf(err, "failed to get PVB for namespace %s", kibishiiNamespace)
 		}
+		if len(pvbs) != 0 {
+			return errors.Errorf("expected 0 PVBs, got %d", len(pvbs))
+		}
 		if providerName == "vsphere" {
 			// Wait for uploads started by the Velero Plug-in for vSphere to complete
 			// TODO - remove after upload progress monitoring is implemented
-			fmt.Println("Waiting for vSphere uploads to complete")
-			if err := WaitForVSphereUploadCompletion(oneHourTimeout, time.Hour, kibishiiNamespace, 2); err != nil {
+			log.Info("Waiting for vSphere uploads to complete")
+			if err := WaitForVSphereUploadCompletion(oneHourTimeout, time.Hour, kibishiiNamespace, replicas); err != nil {
 				return errors.Wrapf(err, "Error waiting for uploads to complete")
 			}
 		}
-		snapshotCheckPoint, err = GetSnapshotCheckPoint(client, veleroCfg, 2, kibishiiNamespace, backupName, KibishiiPodNameList)
+		snapshotCheckPoint, err = GetSnapshotCheckPointOfPVCs(client, veleroCfg, kibishiiNamespace, backupName, nil)
 		if err != nil {
 			return errors.Wrap(err, "Fail to get snapshot checkpoint")
 		}
+		if snapshotCheckPoint.ExpectCount != replicas {
+			return errors.Errorf("expecting snapshots of %d volumes of the kibishii pods, got %d", replicas, snapshotCheckPoint.ExpectCount)
+		}
 		err = SnapshotsShouldBeCreatedInCloud(veleroCfg.CloudProvider,
-			veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket, veleroCfg.BSLConfig,
+			veleroCfg.CloudCredentialsFile, veleroCfg.BSLBucket, veleroCfg.BSLConfig, veleroCfg.VSLConfig,
 			backupName, snapshotCheckPoint)
 		if err != nil {
 			return errors.Wrap(err, "exceed waiting for snapshot created in cloud")
 		}
 	} else {
-		if err != nil || len(pvbs) != 2 {
+		if err != nil {
 			return errors.Wrapf(err, "failed to get PVB for namespace %s", kibishiiNamespace)
 		}
+		if len(pvbs) != replicas {
+			return errors.Errorf("expected %d PVBs, got %d", replicas, len(pvbs))
+		}
+		if err := PodVolumeBackupsShouldBeCompleted(oneHourTimeout, client, veleroNamespace, backupName, replicas); err != nil {
+			return err
+		}
 		if providerName == "vsphere" {
 			// Wait for uploads started by the Velero Plug-in for vSphere to complete
 			// TODO - remove after upload progress monitoring is implemented
@@ -134,7 +225,7 @@ func RunKibishiiTests(veleroCfg VeleroConfig, backupName, restoreName, backupLoc
 			// TODO[High] - uncomment code block below when vSphere plugin PR #500 is included in release version.
 			//   https://github.com/vmware-tanzu/velero-plugin-for-vsphere/pull/500/
 
-			// fmt.Println("Make sure no vSphere snapshot uploads created")
+			// log.Info("Make sure no vSphere snapshot uploads created")
 			// if err := WaitForVSphereUploadCompletion(oneHourTimeout, time.Hour, kibishiiNamespace, 0); err != nil {
 			// 	return errors.Wrapf(err, "Error get vSphere snapshot uploads")
 			// }
@@ -155,48 +246,223 @@ func RunKibishiiTests(veleroCfg VeleroConfig, backupName, restoreName, backupLoc
 		}
 	}
 
-	fmt.Printf("Simulating a disaster by removing namespace %s\n", kibishiiNamespace)
-	if err := DeleteNamespace(oneHourTimeout, client, kibishiiNamespace, true); err != nil {
+	ns, err := GetNamespace(oneHourTimeout, client, kibishiiNamespace)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get namespace %s", kibishiiNamespace)
+	}
+	nsLabels, nsAnnotations := ns.Labels, ns.Annotations
+
+	log.Info("Simulating a disaster by removing the namespace")
+	if err := DeleteNamespace(oneHourTimeout, client, kibishiiNamespace, false); err != nil {
 		return errors.Wrapf(err, "failed to delete namespace %s", kibishiiNamespace)
 	}
+	// the restore conflicts with the finalizers of the namespace if it's still terminating
+	if err := WaitForNamespaceDeleted(oneHourTimeout, client, kibishiiNamespace, 30*time.Minute); err != nil {
+		return err
+	}
 
 	// the snapshots of AWS may be still in pending status when do the restore, wait for a while
 	// to avoid this https://github.com/vmware-tanzu/velero/issues/1799
 	// TODO remove this after https://github.com/vmware-tanzu/velero/issues/3533 is fixed
 	if useVolumeSnapshots {
-		fmt.Println("Waiting 5 minutes to make sure the snapshots are ready...")
+		log.Info("Waiting 5 minutes to make sure the snapshots are ready...")
 		time.Sleep(5 * time.Minute)
 	}
 
-	if err := VeleroRestore(oneHourTimeout, veleroCLI, veleroNamespace, restoreName, backupName, ""); err != nil {
-		RunDebug(context.Background(), veleroCLI, veleroNamespace, "", restoreName)
-		return errors.Wrapf(err, "Restore %s failed from backup %s", restoreName, backupName)
+	restoreMetric := StartPhaseMetric(PerfPhaseRestore, backupName, restoreName)
+	var restoreErr error
+	if targetNamespace != kibishiiNamespace {
+		log.Infof("Restoring the namespace into namespace %s", targetNamespace)
+		restoreErr = VeleroRestoreWithNamespaceMappings(oneHourTimeout, veleroCLI, veleroNamespace, restoreName, backupName,
+			map[string]string{kibishiiNamespace: targetNamespace})
+	} else {
+		restoreErr = VeleroRestore(oneHourTimeout, veleroCLI, veleroNamespace, restoreName, backupName, "")
+	}
+	if restoreErr != nil {
+		if useVolumeSnapshots {
+			RunDebug(context.Background(), veleroCLI, veleroNamespace, "", restoreName)
+		} else {
+			RunDebugWithNodeAgent(context.Background(), veleroCLI, veleroNamespace, "", restoreName)
+		}
+		return errors.Wrapf(restoreErr, "Restore %s failed from backup %s", restoreName, backupName)
 	}
+	recordPhaseMetric(oneHourTimeout, veleroCfg, restoreMetric, backupBytes)
 	if !useVolumeSnapshots {
-		pvrs, err := GetPVR(oneHourTimeout, veleroCfg.VeleroNamespace, kibishiiNamespace)
-		if err != nil || len(pvrs) != 2 {
-			return errors.Wrapf(err, "failed to get PVB for namespace %s", kibishiiNamespace)
+		pvrs, err := GetPVR(oneHourTimeout, veleroCfg.VeleroNamespace, targetNamespace)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get PVR for namespace %s", targetNamespace)
+		}
+		if len(pvrs) != replicas {
+			return errors.Errorf("expected %d PVRs, got %d", replicas, len(pvrs))
 		}
+		if err := PodVolumeRestoresShouldBeCompleted(oneHourTimeout, client, veleroNamespace, restoreName, replicas); err != nil {
+			return err
+		}
+	}
+
+	// check the namespace metadata before the pods, because losing the labels such as PSA labels
+	// makes the pods fail to be admitted, which is hard to diagnose from the pod startup timeout
+	if err := NamespaceMetadataShouldBe(oneHourTimeout, client, targetNamespace, nsLabels, nsAnnotations); err != nil {
+		return errors.Wrapf(err, "Error verifying namespace %s after restore", targetNamespace)
 	}
 
+	if err := KibishiiVerifyAfterRestore(client, targetNamespace, oneHourTimeout, DefaultKibishiiData); err != nil {
+		return errors.Wrapf(err, "Error verifying kibishii after restore")
+	}
+	if err := largeFilesShouldBe(oneHourTimeout, client, targetNamespace, largeFileChecksums); err != nil {
+		return errors.Wrapf(err, "Error verifying large files after restore")
+	}
+	log.Info("kibishii test completed successfully")
+	return nil
+}
+
+// RunKibishiiTestsWithPartiallyFailedBackup runs kibishii tests with fs-backup along with a pod
+// which fails to be backed up, so the backup is PartiallyFailed, and checks the data of kibishii
+// is still restored from the backup. A pod referencing a missing PVC isn't used as it's just
+// skipped with a warning by fs-backup, the pod here fails the backup by its failing pre hook.
+func RunKibishiiTestsWithPartiallyFailedBackup(veleroCfg VeleroConfig, backupName, restoreName, kibishiiNamespace string) error {
+	client := *veleroCfg.ClientToInstallVelero
+	oneHourTimeout, ctxCancel := context.WithTimeout(context.Background(), time.Minute*60)
+	defer ctxCancel()
+	failingPod := "pod-failing-hook"
+	log := kibishiiLogger(kibishiiNamespace, backupName)
+
+	if err := CreateNamespace(oneHourTimeout, client, kibishiiNamespace); err != nil {
+		return errors.Wrapf(err, "Failed to create namespace %s to install Kibishii workload", kibishiiNamespace)
+	}
+	defer func() {
+		if !veleroCfg.Debug {
+			if err := DeleteNamespace(context.Background(), client, kibishiiNamespace, true); err != nil {
+				log.WithError(err).Error("Failed to delete the namespace")
+			}
+		}
+	}()
+
+	if err := KibishiiPrepareBeforeBackup(oneHourTimeout, client, veleroCfg.CloudProvider,
+		kibishiiNamespace, veleroCfg.RegistryCredentialFile, veleroCfg.Features,
+		veleroCfg.KibishiiDirectory, veleroCfg.KibishiiStorageClass, false, DefaultKibishiiData); err != nil {
+		return errors.Wrapf(err, "Failed to install and prepare data for kibishii %s", kibishiiNamespace)
+	}
+
+	log.Infof("Creating pod %s which fails to be backed up", failingPod)
+	ann := map[string]string{
+		"pre.hook.backup.velero.io/container": failingPod,
+		"pre.hook.backup.velero.io/command":   `["/bin/sh", "-c", "exit 1"]`,
+		"pre.hook.backup.velero.io/on-error":  "Fail",
+	}
+	if _, err := CreatePod(client, kibishiiNamespace, failingPod, "", "", nil, nil, ann); err != nil {
+		return errors.Wrapf(err, "Failed to create pod %s", failingPod)
+	}
+	if err := WaitForPods(oneHourTimeout, client, kibishiiNamespace, []string{failingPod}); err != nil {
+		return errors.Wrapf(err, "Failed to wait for pod %s", failingPod)
+	}
+
+	backupCfg := BackupConfig{
+		BackupName:                  backupName,
+		Namespace:                   kibishiiNamespace,
+		DefaultVolumesToFsBackup:    true,
+		ProvideSnapshotsVolumeParam: veleroCfg.ProvideSnapshotsVolumeParam,
+	}
+	if err := VeleroBackupNamespaceExpectPhase(oneHourTimeout, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace,
+		backupCfg, velerov1api.BackupPhasePartiallyFailed); err != nil {
+		RunDebugWithNodeAgent(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, backupName, "")
+		return errors.Wrapf(err, "Failed to backup kibishii namespace %s", kibishiiNamespace)
+	}
+	pvbs, err := GetPVB(oneHourTimeout, veleroCfg.VeleroNamespace, kibishiiNamespace)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get PVB for namespace %s", kibishiiNamespace)
+	}
+	// a volume is backed up for each kibishii pod
+	if expected := len(kibishiiPodNames(DefaultKibishiiData)); len(pvbs) != expected {
+		return errors.Errorf("expected %d PVBs, got %d", expected, len(pvbs))
+	}
+
+	log.Info("Simulating a disaster by removing the namespace")
+	if err := DeleteNamespace(oneHourTimeout, client, kibishiiNamespace, false); err != nil {
+		return errors.Wrapf(err, "failed to delete namespace %s", kibishiiNamespace)
+	}
+	if err := WaitForNamespaceDeleted(oneHourTimeout, client, kibishiiNamespace, 30*time.Minute); err != nil {
+		return err
+	}
+
+	if err := VeleroRestore(oneHourTimeout, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, restoreName, backupName, ""); err != nil {
+		RunDebugWithNodeAgent(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", restoreName)
+		return errors.Wrapf(err, "Restore %s failed from backup %s", restoreName, backupName)
+	}
 	if err := KibishiiVerifyAfterRestore(client, kibishiiNamespace, oneHourTimeout, DefaultKibishiiData); err != nil {
 		return errors.Wrapf(err, "Error verifying kibishii after restore")
 	}
-	fmt.Printf("kibishii test completed successfully\n")
+	if _, err := GetPod(oneHourTimeout, client, kibishiiNamespace, failingPod); !apierrors.IsNotFound(err) {
+		return errors.Errorf("pod %s failed to be backed up should not be restored, err: %v", failingPod, err)
+	}
+	log.Info("kibishii test with partially failed backup completed successfully")
 	return nil
 }
 
+// backupObjectsShouldExistInCloud verifies the files uploaded by the backup in the bucket of the backup location,
+// the repository of the namespace is verified as well if the volumes are backed up by fs-backup
+func backupObjectsShouldExistInCloud(veleroCfg VeleroConfig, backupName, backupLocation, namespace string, useVolumeSnapshots bool) error {
+	provider, credentials := GetObjectStoreProvider(veleroCfg), veleroCfg.CloudCredentialsFile
+	bucket, prefix, config := veleroCfg.BSLBucket, veleroCfg.BSLPrefix, veleroCfg.BSLConfig
+	if backupLocation != "" && backupLocation != "default" {
+		provider, credentials = veleroCfg.AdditionalBSLProvider, veleroCfg.AdditionalBSLCredentials
+		bucket, prefix, config = veleroCfg.AdditionalBSLBucket, veleroCfg.AdditionalBSLPrefix, veleroCfg.AdditionalBSLConfig
+	}
+	repoType := ""
+	if !useVolumeSnapshots {
+		// the uploader type defaults to restic when installing Velero
+		repoType = veleroCfg.UploaderType
+		if repoType == "" {
+			repoType = "restic"
+		}
+	}
+	return BackupObjectsShouldExistInCloud(provider, credentials, bucket, prefix, config, backupName, repoType, namespace)
+}
+
+// recordPhaseMetric finishes the metric and writes it into the perf report, the bytes of the backup
+// are queried if bytes is negative and returned. The failures are only printed as the metrics
+// shouldn't fail the test.
+func recordPhaseMetric(ctx context.Context, veleroCfg VeleroConfig, metric *PhaseMetric, bytes int64) int64 {
+	if veleroCfg.PerfReportDir == "" {
+		return bytes
+	}
+	metric.Finish()
+	if bytes < 0 {
+		var err error
+		if bytes, err = GetBackupBytes(ctx, *veleroCfg.ClientToInstallVelero, veleroCfg.VeleroNamespace, metric.BackupName); err != nil {
+			logger.WithField("backup", metric.BackupName).WithError(err).Error("Failed to get the bytes of the backup")
+			bytes = 0
+		}
+	}
+	metric.Bytes = bytes
+	if err := WritePhaseMetric(veleroCfg.PerfReportDir, metric); err != nil {
+		logger.WithField("backup", metric.BackupName).WithError(err).Error("Failed to write the phase metric")
+	}
+	return bytes
+}
+
 func installKibishii(ctx context.Context, namespace string, cloudPlatform, veleroFeatures,
-	kibishiiDirectory string, useVolumeSnapshots bool) error {
+	kibishiiDirectory, kibishiiStorageClass string, useVolumeSnapshots bool) error {
 	if strings.EqualFold(cloudPlatform, "azure") &&
 		strings.EqualFold(veleroFeatures, "EnableCSI") {
 		cloudPlatform = "azure-csi"
 	}
+	kustomizeDir := kibishiiDirectory + cloudPlatform
+	if kibishiiStorageClass != "" {
+		// The storage class is overridden, so apply the base overlay with the storage class
+		// of the StatefulSet volumeClaimTemplates patched by a generated kustomization
+		dir, err := generateKibishiiKustomization(kibishiiDirectory+"base", kibishiiStorageClass)
+		if err != nil {
+			return errors.Wrapf(err, "failed to generate kustomization for storage class %s", kibishiiStorageClass)
+		}
+		defer os.RemoveAll(dir)
+		kustomizeDir = dir
+	}
 	// We use kustomize to generate YAML for Kibishii from the checked-in yaml directories
 	kibishiiInstallCmd := exec.CommandContext(ctx, "kubectl", "apply", "-n", namespace, "-k",
-		kibishiiDirectory+cloudPlatform, "--timeout=90s")
+		kustomizeDir, "--timeout=90s")
 	_, stderr, err := veleroexec.RunCommand(kibishiiInstallCmd)
-	fmt.Printf("Install Kibishii cmd: %s\n", kibishiiInstallCmd)
+	kibishiiLogger(namespace, "").Infof("Install Kibishii cmd: %s", kibishiiInstallCmd)
 	if err != nil {
 		return errors.Wrapf(err, "failed to install kibishii, stderr=%s", stderr)
 	}
@@ -208,7 +474,7 @@ func installKibishii(ctx context.Context, namespace string, cloudPlatform, veler
 		return errors.Wrapf(err, "failed to rollout, stderr=%s", stderr)
 	}
 
-	fmt.Printf("Waiting for kibishii jump-pad pod to be ready\n")
+	kibishiiLogger(namespace, "").Info("Waiting for kibishii jump-pad pod to be ready")
 	jumpPadWaitCmd := exec.CommandContext(ctx, "kubectl", "wait", "--for=condition=ready", "-n", namespace, "pod/jump-pad")
 	_, stderr, err = veleroexec.RunCommand(jumpPadWaitCmd)
 	if err != nil {
@@ -218,21 +484,57 @@ func installKibishii(ctx context.Context, namespace string, cloudPlatform, veler
 	return err
 }
 
+// generateKibishiiKustomization generates a kustomization in a temp dir which refers to the
+// base overlay and patches the storage class of the kibishii StatefulSet volumeClaimTemplates.
+// The caller is responsible for removing the returned dir.
+func generateKibishiiKustomization(baseDirectory, storageClass string) (string, error) {
+	dir, err := os.MkdirTemp("", "kibishii-kustomization")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temp dir for kibishii kustomization")
+	}
+	// A local base directory must be referred by absolute path since the kustomization is in a temp dir,
+	// remote bases like "github.com/..." are kept as they are
+	if _, err := os.Stat(baseDirectory); err == nil {
+		if baseDirectory, err = filepath.Abs(baseDirectory); err != nil {
+			os.RemoveAll(dir)
+			return "", errors.Wrapf(err, "failed to get absolute path of %s", baseDirectory)
+		}
+	}
+	kustomization := fmt.Sprintf(`apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- %s
+patches:
+- target:
+    group: apps
+    kind: StatefulSet
+    name: kibishii-deployment
+  patch: |-
+    - op: add
+      path: /spec/volumeClaimTemplates/0/spec/storageClassName
+      value: %s
+`, baseDirectory, storageClass)
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte(kustomization), 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", errors.Wrap(err, "failed to write kibishii kustomization")
+	}
+	logger.Infof("Generated kibishii kustomization in %s:\n%s", dir, kustomization)
+	return dir, nil
+}
+
 func generateData(ctx context.Context, namespace string, kibishiiData *KibishiiData) error {
 	timeout := 30 * time.Minute
 	interval := 1 * time.Second
 	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
-		timeout, ctxCancel := context.WithTimeout(context.Background(), time.Minute*20)
-		defer ctxCancel()
-		kibishiiGenerateCmd := exec.CommandContext(timeout, "kubectl", "exec", "-n", namespace, "jump-pad", "--",
+		kibishiiGenerateCmd := exec.Command("kubectl", "exec", "-n", namespace, "jump-pad", "--",
 			"/usr/local/bin/generate.sh", strconv.Itoa(kibishiiData.Levels), strconv.Itoa(kibishiiData.DirsPerLevel),
 			strconv.Itoa(kibishiiData.FilesPerLevel), strconv.Itoa(kibishiiData.FileLength),
 			strconv.Itoa(kibishiiData.BlockSize), strconv.Itoa(kibishiiData.PassNum), strconv.Itoa(kibishiiData.ExpectedNodes))
-		fmt.Printf("kibishiiGenerateCmd cmd =%v\n", kibishiiGenerateCmd)
+		kibishiiLogger(namespace, "").Infof("kibishiiGenerateCmd cmd =%v", kibishiiGenerateCmd)
 
-		stdout, stderr, err := veleroexec.RunCommand(kibishiiGenerateCmd)
+		stdout, stderr, err := common.RunCommandWithTimeout(kibishiiGenerateCmd, kibishiiCommandTimeout)
 		if err != nil || strings.Contains(stderr, "Timeout occurred") || strings.Contains(stderr, "dialing backend") {
-			fmt.Printf("Kibishi generate stdout Timeout occurred: %s stderr: %s err: %s", stdout, stderr, err)
+			kibishiiLogger(namespace, "").Warnf("Kibishi generate stdout Timeout occurred: %s stderr: %s err: %s", stdout, stderr, err)
 			return false, nil
 		}
 		return true, nil
@@ -248,21 +550,19 @@ func verifyData(ctx context.Context, namespace string, kibishiiData *KibishiiDat
 	timeout := 10 * time.Minute
 	interval := 5 * time.Second
 	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
-		timeout, ctxCancel := context.WithTimeout(context.Background(), time.Minute*20)
-		defer ctxCancel()
-		kibishiiVerifyCmd := exec.CommandContext(timeout, "kubectl", "exec", "-n", namespace, "jump-pad", "--",
+		kibishiiVerifyCmd := exec.Command("kubectl", "exec", "-n", namespace, "jump-pad", "--",
 			"/usr/local/bin/verify.sh", strconv.Itoa(kibishiiData.Levels), strconv.Itoa(kibishiiData.DirsPerLevel),
 			strconv.Itoa(kibishiiData.FilesPerLevel), strconv.Itoa(kibishiiData.FileLength),
 			strconv.Itoa(kibishiiData.BlockSize), strconv.Itoa(kibishiiData.PassNum),
 			strconv.Itoa(kibishiiData.ExpectedNodes))
-		fmt.Printf("kibishiiVerifyCmd cmd =%v\n", kibishiiVerifyCmd)
+		kibishiiLogger(namespace, "").Infof("kibishiiVerifyCmd cmd =%v", kibishiiVerifyCmd)
 
-		stdout, stderr, err := veleroexec.RunCommand(kibishiiVerifyCmd)
+		stdout, stderr, err := common.RunCommandWithTimeout(kibishiiVerifyCmd, kibishiiCommandTimeout)
 		if strings.Contains(stderr, "Timeout occurred") {
 			return false, nil
 		}
 		if err != nil {
-			fmt.Printf("Kibishi verify stdout Timeout occurred: %s stderr: %s err: %s", stdout, stderr, err)
+			kibishiiLogger(namespace, "").Warnf("Kibishi verify stdout Timeout occurred: %s stderr: %s err: %s", stdout, stderr, err)
 			return false, nil
 		}
 		return true, nil
@@ -274,13 +574,59 @@ func verifyData(ctx context.Context, namespace string, kibishiiData *KibishiiDat
 	return nil
 }
 
-func waitForKibishiiPods(ctx context.Context, client TestClient, kibishiiNamespace string) error {
-	return WaitForPods(ctx, client, kibishiiNamespace, []string{"jump-pad", "etcd0", "etcd1", "etcd2", "kibishii-deployment-0", "kibishii-deployment-1"})
+func waitForKibishiiPods(ctx context.Context, client TestClient, kibishiiNamespace string, kibishiiData *KibishiiData) error {
+	pods := append([]string{"jump-pad", "etcd0", "etcd1", "etcd2"}, kibishiiPodNames(kibishiiData)...)
+	return WaitForPods(ctx, client, kibishiiNamespace, pods)
+}
+
+// kibishiiPodNames returns the names of the kibishii pods expected by the data, the kibishii
+// StatefulSet is scaled to have one pod per expected node if more than the default pods are expected
+func kibishiiPodNames(kibishiiData *KibishiiData) []string {
+	if kibishiiData.ExpectedNodes <= defaultKibishiiReplicas {
+		return KibishiiPodNameList
+	}
+	return KibishiiPodNames(kibishiiData.ExpectedNodes)
+}
+
+// ScaleKibishii scales the kibishii StatefulSet to the replicas and waits for the rollout, including the PVCs
+// of the new pods to be bound, so a snapshot is expected for the volume of each replica in the later backups
+func ScaleKibishii(ctx context.Context, client TestClient, namespace string, replicas int) error {
+	kibishiiLogger(namespace, "").Infof("Scaling kibishii to %d pods", replicas)
+	if err := ScaleStatefulSet(client.ClientGo, namespace, kibishiiStatefulSet, int32(replicas)); err != nil {
+		return errors.Wrapf(err, "Failed to scale kibishii in %s", namespace)
+	}
+	if err := WaitForPVCsBound(ctx, client, namespace, 10*time.Minute); err != nil {
+		return errors.Wrapf(err, "Failed to wait for PVCs of kibishii in %s to be bound", namespace)
+	}
+	if err := WaitForStatefulSetReplicas(client.ClientGo, namespace, kibishiiStatefulSet); err != nil {
+		return errors.Wrapf(err, "Failed to wait for kibishii in %s to be scaled to %d pods", namespace, replicas)
+	}
+	return WaitForPods(ctx, client, namespace, KibishiiPodNames(replicas))
+}
+
+// GetKibishiiPodNodeDistribution returns the names of kibishii pods grouped by the nodes they
+// are running on
+func GetKibishiiPodNodeDistribution(ctx context.Context, client TestClient, kibishiiNamespace string) (map[string][]string, error) {
+	pods, err := ListPods(ctx, client, kibishiiNamespace)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list pods in namespace %s", kibishiiNamespace)
+	}
+	distribution := map[string][]string{}
+	for _, pod := range pods.Items {
+		if !strings.HasPrefix(pod.Name, kibishiiStatefulSet+"-") {
+			continue
+		}
+		if pod.Spec.NodeName == "" {
+			return nil, errors.Errorf("kibishii pod %s is not scheduled to any node", pod.Name)
+		}
+		distribution[pod.Spec.NodeName] = append(distribution[pod.Spec.NodeName], pod.Name)
+	}
+	return distribution, nil
 }
 
 func KibishiiPrepareBeforeBackup(oneHourTimeout context.Context, client TestClient,
 	providerName, kibishiiNamespace, registryCredentialFile, veleroFeatures,
-	kibishiiDirectory string, useVolumeSnapshots bool, kibishiiData *KibishiiData) error {
+	kibishiiDirectory, kibishiiStorageClass string, useVolumeSnapshots bool, kibishiiData *KibishiiData) error {
 	serviceAccountName := "default"
 
 	// wait until the service account is created before patch the image pull secret
@@ -294,22 +640,54 @@ func KibishiiPrepareBeforeBackup(oneHourTimeout context.Context, client TestClie
 	}
 
 	if err := installKibishii(oneHourTimeout, kibishiiNamespace, providerName, veleroFeatures,
-		kibishiiDirectory, useVolumeSnapshots); err != nil {
+		kibishiiDirectory, kibishiiStorageClass, useVolumeSnapshots); err != nil {
 		return errors.Wrap(err, "Failed to install Kibishii workload")
 	}
 
+	if kibishiiData == nil {
+		kibishiiData = DefaultKibishiiData
+	}
+	if pods := kibishiiPodNames(kibishiiData); len(pods) > defaultKibishiiReplicas {
+		if err := ScaleKibishii(oneHourTimeout, client, kibishiiNamespace, len(pods)); err != nil {
+			return err
+		}
+	}
+
+	// the pods of the unbound PVCs hang in scheduling, so the PVCs are checked first to report the mismatch
+	// of the storage class or the provisioner of the restored PVCs
+	kibishiiLogger(kibishiiNamespace, "").Info("Waiting for PVCs of kibishii to be bound")
+	if err := WaitForPVCsBound(oneHourTimeout, client, kibishiiNamespace, 10*time.Minute); err != nil {
+		return errors.Wrapf(err, "Failed to wait for PVCs of kibishii in %s to be bound", kibishiiNamespace)
+	}
 	// wait for kibishii pod startup
 	// TODO - Fix kibishii so we can check that it is ready to go
-	fmt.Printf("Waiting for kibishii pods to be ready\n")
-	if err := waitForKibishiiPods(oneHourTimeout, client, kibishiiNamespace); err != nil {
+	kibishiiLogger(kibishiiNamespace, "").Info("Waiting for kibishii pods to be ready")
+	if err := waitForKibishiiPods(oneHourTimeout, client, kibishiiNamespace, kibishiiData); err != nil {
 		return errors.Wrapf(err, "Failed to wait for ready status of kibishii pods in %s", kibishiiNamespace)
 	}
-	if kibishiiData == nil {
-		kibishiiData = DefaultKibishiiData
-	}
 	if err := generateData(oneHourTimeout, kibishiiNamespace, kibishiiData); err != nil {
 		return errors.Wrap(err, "Failed to generate data")
 	}
+	return recordVolumeChecksums(oneHourTimeout, client, kibishiiNamespace, kibishiiData)
+}
+
+// recordVolumeChecksums records the checksums of the files in the data volume of each kibishii pod into the
+// data by the preferred verify strategy, so they can be verified after restore by the same strategy
+func recordVolumeChecksums(ctx context.Context, client TestClient, namespace string, kibishiiData *KibishiiData) error {
+	strategy := VerifyStrategy(VeleroCfg.VerifyStrategy)
+	if kibishiiData.volumeChecksums == nil {
+		kibishiiData.volumeChecksums = map[string]map[string]map[string]string{}
+	}
+	recorded := map[string]map[string]string{}
+	for _, pod := range kibishiiPodNames(kibishiiData) {
+		target := VerifyTarget{Namespace: namespace, Pod: pod, Container: kibishiiContainer, Volume: kibishiiVolume}
+		checksums, err := GetVolumeChecksums(ctx, client, strategy, target)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to record checksums of volume %s in pod %s/%s", kibishiiVolume, namespace, pod)
+		}
+		recorded[pod] = checksums
+	}
+	kibishiiData.volumeChecksums[namespace] = recorded
 	return nil
 }
 
@@ -318,17 +696,97 @@ func KibishiiVerifyAfterRestore(client TestClient, kibishiiNamespace string, one
 	if kibishiiData == nil {
 		kibishiiData = DefaultKibishiiData
 	}
+	// the pods of the unbound PVCs hang in scheduling, so the PVCs are checked first to report the mismatch
+	// of the storage class or the provisioner of the restored PVCs
+	kibishiiLogger(kibishiiNamespace, "").Info("Waiting for PVCs of kibishii to be bound")
+	if err := WaitForPVCsBound(oneHourTimeout, client, kibishiiNamespace, 10*time.Minute); err != nil {
+		return errors.Wrapf(err, "Failed to wait for PVCs of kibishii in %s to be bound", kibishiiNamespace)
+	}
 	// wait for kibishii pod startup
 	// TODO - Fix kibishii so we can check that it is ready to go
-	fmt.Printf("Waiting for kibishii pods to be ready\n")
-	if err := waitForKibishiiPods(oneHourTimeout, client, kibishiiNamespace); err != nil {
+	kibishiiLogger(kibishiiNamespace, "").Info("Waiting for kibishii pods to be ready")
+	if err := waitForKibishiiPods(oneHourTimeout, client, kibishiiNamespace, kibishiiData); err != nil {
 		return errors.Wrapf(err, "Failed to wait for ready status of kibishii pods in %s", kibishiiNamespace)
 	}
 	time.Sleep(60 * time.Second)
 	// TODO - check that namespace exists
-	fmt.Printf("running kibishii verify\n")
-	if err := verifyData(oneHourTimeout, kibishiiNamespace, kibishiiData); err != nil {
-		return errors.Wrap(err, "Failed to verify data generated by kibishii")
+	strategy := VerifyStrategy(VeleroCfg.VerifyStrategy)
+	recorded := kibishiiData.volumeChecksums[kibishiiNamespace]
+	for _, pod := range kibishiiPodNames(kibishiiData) {
+		checksums, ok := recorded[pod]
+		if !ok {
+			continue
+		}
+		kibishiiLogger(kibishiiNamespace, pod).Infof("Verifying checksums of %d files in volume %s", len(checksums), kibishiiVolume)
+		target := VerifyTarget{Namespace: kibishiiNamespace, Pod: pod, Container: kibishiiContainer, Volume: kibishiiVolume}
+		if err := VerifyVolumeChecksums(oneHourTimeout, client, strategy, target, checksums); err != nil {
+			return errors.Wrap(err, "Failed to verify data generated by kibishii")
+		}
+	}
+	// verify.sh in the jump-pad pod verifies the data by exec into the kibishii pods, it's the only way to
+	// verify the data if the checksums are not recorded, e.g. the namespace is mapped to another one by the
+	// restore or the data is generated by another process
+	if strategy == "" || strategy == VerifyByExec || recorded == nil {
+		kibishiiLogger(kibishiiNamespace, "").Info("running kibishii verify")
+		if err := verifyData(oneHourTimeout, kibishiiNamespace, kibishiiData); err != nil {
+			return errors.Wrap(err, "Failed to verify data generated by kibishii")
+		}
+	}
+	if kibishiiData.RewriteAfterRestore {
+		if err := rewriteAndVerifyData(oneHourTimeout, kibishiiNamespace, kibishiiData); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// rewriteAndVerifyData generates the next pass of data over the restored data and verifies it, the restored
+// volumes which are read-only or corrupted under the writing fail the verification
+func rewriteAndVerifyData(ctx context.Context, namespace string, kibishiiData *KibishiiData) error {
+	nextPass := *kibishiiData
+	nextPass.PassNum++
+	kibishiiLogger(namespace, "").Infof("running kibishii generate of pass %d over the restored data", nextPass.PassNum)
+	if err := generateData(ctx, namespace, &nextPass); err != nil {
+		return errors.Wrapf(err, "Failed to generate data of pass %d over the restored data", nextPass.PassNum)
+	}
+	kibishiiLogger(namespace, "").Infof("running kibishii verify of pass %d", nextPass.PassNum)
+	if err := verifyData(ctx, namespace, &nextPass); err != nil {
+		return errors.Wrapf(err, "Failed to verify data of pass %d written over the restored data", nextPass.PassNum)
+	}
+	return nil
+}
+
+// writeLargeFiles writes a large file of random data of the size into the data volume of each kibishii pod and
+// returns the checksums of the files keyed by the pods
+func writeLargeFiles(ctx context.Context, client TestClient, namespace string, sizeMB int) (map[string]string, error) {
+	checksums := map[string]string{}
+	for _, pod := range kibishiiPodNames(DefaultKibishiiData) {
+		if err := CreateRandomFileToPod(ctx, namespace, pod, kibishiiContainer, kibishiiVolume, kibishiiLargeFile, sizeMB); err != nil {
+			return nil, err
+		}
+		checksum, err := GetFileChecksum(ctx, client, VerifyStrategy(VeleroCfg.VerifyStrategy), largeFileTarget(namespace, pod))
+		if err != nil {
+			return nil, err
+		}
+		checksums[pod] = checksum
+	}
+	return checksums, nil
+}
+
+// largeFilesShouldBe checks the large files written by writeLargeFiles are restored with the same checksums
+func largeFilesShouldBe(ctx context.Context, client TestClient, namespace string, checksums map[string]string) error {
+	for pod, expected := range checksums {
+		checksum, err := GetFileChecksum(ctx, client, VerifyStrategy(VeleroCfg.VerifyStrategy), largeFileTarget(namespace, pod))
+		if err != nil {
+			return err
+		}
+		if checksum != expected {
+			return errors.Errorf("checksum of file %s in pod %s/%s is %s, expecting %s", kibishiiLargeFile, namespace, pod, checksum, expected)
+		}
+	}
+	return nil
+}
+
+func largeFileTarget(namespace, pod string) VerifyTarget {
+	return VerifyTarget{Namespace: namespace, Pod: pod, Container: kibishiiContainer, Volume: kibishiiVolume, File: kibishiiLargeFile}
+}
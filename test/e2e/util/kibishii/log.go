@@ -0,0 +1,51 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kibishii
+
+import (
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logFormatEnvVar selects the format of the logs of the kibishii helpers, the logs are in JSON if it's
+// "json" so the logs of the parallel runs could be parsed, and they're in text otherwise
+const logFormatEnvVar = "KIBISHII_LOG_FORMAT"
+
+var logger = newLogger(os.Getenv(logFormatEnvVar))
+
+func newLogger(format string) *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(os.Stdout)
+	if strings.EqualFold(format, "json") {
+		l.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		l.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+	return l
+}
+
+// kibishiiLogger returns the logger of the kibishii workload in the namespace, the logs are attributed to
+// the backup as well if its name isn't empty
+func kibishiiLogger(namespace, backupName string) *logrus.Entry {
+	entry := logger.WithField("namespace", namespace)
+	if backupName != "" {
+		entry = entry.WithField("backup", backupName)
+	}
+	return entry
+}
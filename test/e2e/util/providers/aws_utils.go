@@ -17,7 +17,10 @@ limitations under the License.
 package providers
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -29,7 +32,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/vmware-tanzu/velero/pkg/cmd/util/flag"
-	e2e "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e"
 )
 
 type AWSStorage string
@@ -52,42 +55,26 @@ func (s AWSStorage) DeleteItem(client *s3.S3, deleteObjectV2Input *s3.DeleteObje
 	return res, nil
 }
 func (s AWSStorage) IsObjectsInBucket(cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, backupObject string) (bool, error) {
-	config := flag.NewMap()
-	config.Set(bslConfig)
-	region := config.Data()["region"]
 	objectsInput := s3.ListObjectsV2Input{}
 	objectsInput.Bucket = aws.String(bslBucket)
 	objectsInput.Delimiter = aws.String("/")
-	s3url := ""
 	if bslPrefix != "" {
 		objectsInput.Prefix = aws.String(bslPrefix)
 	}
-	var s3Config *aws.Config
-	if region == "minio" {
-		s3url = config.Data()["s3Url"]
-		s3Config = &aws.Config{
-			Credentials:      credentials.NewSharedCredentials(cloudCredentialsFile, ""),
-			Endpoint:         aws.String(s3url),
-			Region:           aws.String(region),
-			DisableSSL:       aws.Bool(true),
-			S3ForcePathStyle: aws.Bool(true),
-		}
-	} else {
-		s3Config = &aws.Config{
-			Region:      aws.String(region),
-			Credentials: credentials.NewSharedCredentials(cloudCredentialsFile, ""),
-		}
+	s3Config, endpoint, err := newS3Config(cloudCredentialsFile, bslConfig)
+	if err != nil {
+		return false, err
 	}
 	sess, err := session.NewSession(s3Config)
 
 	if err != nil {
-		return false, errors.Wrapf(err, "Failed to create AWS session")
+		return false, errors.Wrapf(err, "Failed to create AWS session for %s", endpoint)
 	}
 	svc := s3.New(sess)
 
 	bucketObjects, err := s.ListItems(svc, &objectsInput)
 	if err != nil {
-		return false, errors.Wrapf(err, "Couldn't retrieve bucket items")
+		return false, errors.Wrapf(err, "Couldn't retrieve bucket items from %s", endpoint)
 	}
 
 	for _, item := range bucketObjects.Contents {
@@ -109,27 +96,13 @@ func (s AWSStorage) IsObjectsInBucket(cloudCredentialsFile, bslBucket, bslPrefix
 }
 
 func (s AWSStorage) DeleteObjectsInBucket(cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, backupObject string) error {
-	config := flag.NewMap()
-	config.Set(bslConfig)
-	region := config.Data()["region"]
-	s3url := ""
-	s3Config := &aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewSharedCredentials(cloudCredentialsFile, ""),
-	}
-	if region == "minio" {
-		s3url = config.Data()["s3Url"]
-		s3Config = &aws.Config{
-			Credentials:      credentials.NewSharedCredentials(cloudCredentialsFile, ""),
-			Endpoint:         aws.String(s3url),
-			Region:           aws.String(region),
-			DisableSSL:       aws.Bool(true),
-			S3ForcePathStyle: aws.Bool(true),
-		}
+	s3Config, endpoint, err := newS3Config(cloudCredentialsFile, bslConfig)
+	if err != nil {
+		return err
 	}
 	sess, err := session.NewSession(s3Config)
 	if err != nil {
-		return errors.Wrapf(err, "Error waiting for uploads to complete")
+		return errors.Wrapf(err, "Failed to create AWS session for %s", endpoint)
 	}
 	svc := s3.New(sess)
 	fullPrefix := strings.Trim(bslPrefix, "/") + "/" + strings.Trim(backupObject, "/") + "/"
@@ -139,61 +112,222 @@ func (s AWSStorage) DeleteObjectsInBucket(cloudCredentialsFile, bslBucket, bslPr
 	})
 
 	if err := s3manager.NewBatchDeleteWithClient(svc).Delete(aws.BackgroundContext(), iter); err != nil {
-		return errors.Wrapf(err, "Error waiting for uploads to complete")
+		return errors.Wrapf(err, "Failed to delete objects under prefix %s in bucket %s of %s", fullPrefix, bslBucket, endpoint)
 	}
 	fmt.Printf("Deleted object(s) from bucket: %s %s \n", bslBucket, fullPrefix)
 	return nil
 }
 
-func (s AWSStorage) IsSnapshotExisted(cloudCredentialsFile, bslConfig, backupObject string, snapshotCheck e2e.SnapshotCheckPoint) error {
+func init() {
+	RegisterObjectStore("aws", newAWSObjectStore)
+}
+
+// awsObjectStore is the ObjectStore of AWS, the objects are in the S3 bucket and the snapshots are the
+// EBS snapshots in the region of the snapshot config. There are no snapshots when the bucket is in an
+// S3-compatible object store, e.g. the MinIO of the kind clusters
+type awsObjectStore struct {
+	s3        *s3.S3
+	ec2       *ec2.EC2
+	bslBucket string
+	region    string
+	endpoint  string
+}
+
+func newAWSObjectStore(cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig string) (ObjectStore, error) {
+	s3Config, endpoint, err := newS3Config(cloudCredentialsFile, bslConfig)
+	if err != nil {
+		return nil, err
+	}
+	s3Sess, err := session.NewSession(s3Config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create AWS session for %s", endpoint)
+	}
+	store := &awsObjectStore{
+		s3:        s3.New(s3Sess),
+		bslBucket: bslBucket,
+		region:    aws.StringValue(s3Config.Region),
+		endpoint:  endpoint,
+	}
+	if aws.StringValue(s3Config.Endpoint) != "" {
+		return store, nil
+	}
 
 	config := flag.NewMap()
-	config.Set(bslConfig)
-	region := config.Data()["region"]
-	s3Config := &aws.Config{
-		Region:      aws.String(region),
+	config.Set(snapshotConfig)
+	store.region = config.Data()["region"]
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(store.region),
 		Credentials: credentials.NewSharedCredentials(cloudCredentialsFile, ""),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create AWS session")
 	}
-	if region == "minio" {
-		return errors.New("No snapshot for Minio provider")
+	store.ec2 = ec2.New(sess)
+	return store, nil
+}
+
+func (o *awsObjectStore) ListObjects(prefix string) ([]string, error) {
+	var keys []string
+	if err := o.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(o.bslBucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			keys = append(keys, *item.Key)
+		}
+		return true
+	}); err != nil {
+		return nil, errors.Wrapf(err, "Failed to list objects under prefix %s in bucket %s of %s", prefix, o.bslBucket, o.endpoint)
 	}
-	sess, err := session.NewSession(s3Config)
-	if err != nil {
-		return errors.Wrapf(err, "Error waiting for uploads to complete")
+	return keys, nil
+}
+
+func (o *awsObjectStore) describeSnapshots(filter *ec2.Filter) ([]*ec2.Snapshot, error) {
+	if o.ec2 == nil {
+		return nil, errors.Errorf("No snapshot in S3-compatible object store %s", o.endpoint)
 	}
-	svc := ec2.New(sess)
-	params := &ec2.DescribeSnapshotsInput{
+	result, err := o.ec2.DescribeSnapshots(&ec2.DescribeSnapshotsInput{
 		OwnerIds: []*string{aws.String("self")},
-		Filters: []*ec2.Filter{
-			{
-				Name: aws.String("tag:velero.io/backup"),
-				Values: []*string{
-					aws.String(backupObject),
-				},
-			},
-		},
+		Filters:  []*ec2.Filter{filter},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to describe snapshots in region %s", o.region)
 	}
+	return result.Snapshots, nil
+}
 
-	result, err := svc.DescribeSnapshots(params)
+func (o *awsObjectStore) ListSnapshots(backupName string, snapshotCheck SnapshotCheckPoint) ([]string, error) {
+	snapshots, err := o.describeSnapshots(&ec2.Filter{
+		Name:   aws.String("tag:" + BackupSnapshotTag),
+		Values: []*string{aws.String(backupName)},
+	})
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
+	var ids []string
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotId == nil {
+			continue
+		}
+		fmt.Printf("Snapshot %s of volume %s is found for backup %s\n", *snapshot.SnapshotId, aws.StringValue(snapshot.VolumeId), backupName)
+		ids = append(ids, *snapshot.SnapshotId)
+	}
+	return ids, nil
+}
 
-	for _, n := range result.Snapshots {
-		fmt.Println(n.SnapshotId)
-		if n.SnapshotId != nil {
-			fmt.Println(*n.SnapshotId)
+func (o *awsObjectStore) ListSnapshotsByTag(key, value string) ([]string, error) {
+	snapshots, err := o.describeSnapshots(&ec2.Filter{
+		Name:   aws.String("tag:" + key),
+		Values: []*string{aws.String(value)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotId != nil {
+			ids = append(ids, *snapshot.SnapshotId)
 		}
-		fmt.Println(n.Tags)
-		fmt.Println(n.VolumeId)
-		if n.VolumeId != nil {
-			fmt.Println(*n.VolumeId)
+	}
+	return ids, nil
+}
+
+func (o *awsObjectStore) SnapshotExists(id string) (bool, error) {
+	snapshots, err := o.describeSnapshots(&ec2.Filter{
+		Name:   aws.String("snapshot-id"),
+		Values: []*string{aws.String(id)},
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(snapshots) > 0, nil
+}
+
+func (o *awsObjectStore) DeleteSnapshot(id string) error {
+	if o.ec2 == nil {
+		return errors.Errorf("No snapshot in S3-compatible object store %s", o.endpoint)
+	}
+	if _, err := o.ec2.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(id)}); err != nil {
+		return errors.Wrapf(err, "Failed to delete snapshot %s", id)
+	}
+	fmt.Printf("Deleted snapshot %s in region %s\n", id, o.region)
+	return nil
+}
+
+func (s AWSStorage) newS3Client(cloudCredentialsFile, bslConfig string) (*s3.S3, error) {
+	s3Config, endpoint, err := newS3Config(cloudCredentialsFile, bslConfig)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := session.NewSession(s3Config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create AWS session for %s", endpoint)
+	}
+	return s3.New(sess), nil
+}
+
+// newS3Config returns the config of the S3 client and the endpoint it accesses for the BSL config. The
+// S3-compatible object stores, e.g. MinIO, are accessed by the s3Url of the BSL config with the path-style
+// addressing unless s3ForcePathStyle is set to false
+func newS3Config(cloudCredentialsFile, bslConfig string) (*aws.Config, string, error) {
+	config := flag.NewMap()
+	config.Set(bslConfig)
+	region := config.Data()["region"]
+	s3Url := config.Data()["s3Url"]
+	if s3Url == "" {
+		return &aws.Config{
+			Region:      aws.String(region),
+			Credentials: credentials.NewSharedCredentials(cloudCredentialsFile, ""),
+		}, fmt.Sprintf("AWS S3 in region %s", region), nil
+	}
+
+	if region == "" {
+		region = "minio"
+	}
+	forcePathStyle := true
+	if value := config.Data()["s3ForcePathStyle"]; value != "" {
+		var err error
+		if forcePathStyle, err = strconv.ParseBool(value); err != nil {
+			return nil, "", errors.Wrapf(err, "Invalid s3ForcePathStyle %q of S3-compatible object store %s", value, s3Url)
 		}
 	}
-	if len(result.Snapshots) != snapshotCheck.ExpectCount {
-		return errors.New(fmt.Sprintf("Snapshot count is not as expected %d", snapshotCheck.ExpectCount))
-	} else {
-		fmt.Printf("Snapshot count %d is as expected %d\n", len(result.Snapshots), snapshotCheck.ExpectCount)
-		return nil
+	return &aws.Config{
+		Credentials:      credentials.NewSharedCredentials(cloudCredentialsFile, ""),
+		Endpoint:         aws.String(s3Url),
+		Region:           aws.String(region),
+		DisableSSL:       aws.Bool(strings.HasPrefix(s3Url, "http://")),
+		S3ForcePathStyle: aws.Bool(forcePathStyle),
+	}, s3Url, nil
+}
+
+func (s AWSStorage) GetObject(cloudCredentialsFile, bslBucket, bslConfig, key string) ([]byte, error) {
+	svc, err := s.newS3Client(cloudCredentialsFile, bslConfig)
+	if err != nil {
+		return nil, err
 	}
+	res, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bslBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get object %s from bucket %s of %s", key, bslBucket, svc.Endpoint)
+	}
+	defer res.Body.Close()
+	return io.ReadAll(res.Body)
+}
+
+func (s AWSStorage) PutObject(cloudCredentialsFile, bslBucket, bslConfig, key string, data []byte) error {
+	svc, err := s.newS3Client(cloudCredentialsFile, bslConfig)
+	if err != nil {
+		return err
+	}
+	if _, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(bslBucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	}); err != nil {
+		return errors.Wrapf(err, "Failed to put object %s into bucket %s of %s", key, bslBucket, svc.Endpoint)
+	}
+	fmt.Printf("Put object %s into bucket %s\n", key, bslBucket)
+	return nil
 }
@@ -18,7 +18,9 @@ package providers
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
@@ -29,7 +31,6 @@ import (
 	disk "github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-08-01/compute"
 	storagemgmt "github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
 	"github.com/Azure/azure-storage-blob-go/azblob"
-	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/joho/godotenv"
@@ -282,85 +283,213 @@ func (s AzureStorage) DeleteObjectsInBucket(cloudCredentialsFile, bslBucket, bsl
 	return nil
 }
 
-func (s AzureStorage) IsSnapshotExisted(cloudCredentialsFile, bslConfig, backupName string, snapshotCheck SnapshotCheckPoint) error {
+func newBlockBlobURL(cloudCredentialsFile, bslBucket, bslConfig, key string) (azblob.BlockBlobURL, error) {
+	accountName, accountKey, err := getStorageCredential(cloudCredentialsFile, bslConfig)
+	if err != nil {
+		return azblob.BlockBlobURL{}, errors.Wrapf(err, "Fail to get storage account name and key of bucket %s", bslBucket)
+	}
+	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return azblob.BlockBlobURL{}, errors.Wrapf(err, "Invalid credentials of storage account %s", accountName)
+	}
+	URL, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", accountName, bslBucket, key))
+	if err != nil {
+		return azblob.BlockBlobURL{}, errors.Wrapf(err, "Fail to url.Parse")
+	}
+	return azblob.NewBlockBlobURL(*URL, azblob.NewPipeline(credential, azblob.PipelineOptions{})), nil
+}
 
-	ctx := context.Background()
+func (s AzureStorage) GetObject(cloudCredentialsFile, bslBucket, bslConfig, key string) ([]byte, error) {
+	blobURL, err := newBlockBlobURL(cloudCredentialsFile, bslBucket, bslConfig, key)
+	if err != nil {
+		return nil, err
+	}
+	res, err := blobURL.Download(context.Background(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get object %s from bucket %s", key, bslBucket)
+	}
+	body := res.Body(azblob.RetryReaderOptions{})
+	defer body.Close()
+	return io.ReadAll(body)
+}
 
-	if err := loadCredentialsIntoEnv(cloudCredentialsFile); err != nil {
+func (s AzureStorage) PutObject(cloudCredentialsFile, bslBucket, bslConfig, key string, data []byte) error {
+	blobURL, err := newBlockBlobURL(cloudCredentialsFile, bslBucket, bslConfig, key)
+	if err != nil {
 		return err
 	}
+	if _, err := azblob.UploadBufferToBlockBlob(context.Background(), data, blobURL, azblob.UploadToBlockBlobOptions{}); err != nil {
+		return errors.Wrapf(err, "Failed to put object %s into bucket %s", key, bslBucket)
+	}
+	fmt.Printf("Put object %s into bucket %s\n", key, bslBucket)
+	return nil
+}
+
+func init() {
+	RegisterObjectStore("azure", newAzureObjectStore)
+}
+
+// azureObjectStore is the ObjectStore of Azure, the objects are in the blob container and the snapshots
+// are the disk snapshots in the resource group of the snapshot config or the credentials
+type azureObjectStore struct {
+	container     azblob.ContainerURL
+	snapshots     disk.SnapshotsClient
+	bslBucket     string
+	resourceGroup string
+}
+
+func newAzureObjectStore(cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig string) (ObjectStore, error) {
+	accountName, accountKey, err := getStorageCredential(cloudCredentialsFile, bslConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Fail to get accountName and accountKey")
+	}
+	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid credentials")
+	}
+	URL, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s", accountName, bslBucket))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to url.Parse")
+	}
+	container := azblob.NewContainerURL(*URL, azblob.NewPipeline(credential, azblob.PipelineOptions{}))
+
+	if err := loadCredentialsIntoEnv(cloudCredentialsFile); err != nil {
+		return nil, err
+	}
 	// we need AZURE_SUBSCRIPTION_ID, AZURE_RESOURCE_GROUP
 	envVars, err := getRequiredValues(os.Getenv, subscriptionIDEnvVar, resourceGroupEnvVar)
 	if err != nil {
-		return errors.Wrap(err, "unable to get all required environment variables")
+		return nil, errors.Wrap(err, "unable to get all required environment variables")
 	}
-
 	// Get Azure cloud from AZURE_CLOUD_NAME, if it exists. If the env var does not
 	// exist, parseAzureEnvironment will return azure.PublicCloud.
 	env, err := parseAzureEnvironment(os.Getenv(cloudNameEnvVar))
 	if err != nil {
-		return errors.Wrap(err, "unable to parse azure cloud name environment variable")
+		return nil, errors.Wrap(err, "unable to parse azure cloud name environment variable")
 	}
-
-	// set a different subscriptionId for snapshots if specified
+	// set a different subscriptionId and resourceGroup for snapshots if specified
+	config := flag.NewMap()
+	config.Set(snapshotConfig)
 	snapshotsSubscriptionID := envVars[subscriptionIDEnvVar]
+	if id := config.Data()[subscriptionID]; id != "" {
+		snapshotsSubscriptionID = id
+	}
+	snapshotsResourceGroup := envVars[resourceGroupEnvVar]
+	if group := config.Data()[resourceGroup]; group != "" {
+		snapshotsResourceGroup = group
+	}
 
-	// set up clients
 	snapsClient := disk.NewSnapshotsClientWithBaseURI(env.ResourceManagerEndpoint, snapshotsSubscriptionID)
 	snapsClient.PollingDelay = 5 * time.Second
-
 	authorizer, err := auth.NewAuthorizerFromEnvironment()
 	if err != nil {
-		return errors.Wrap(err, "error getting authorizer from environment")
+		return nil, errors.Wrap(err, "error getting authorizer from environment")
 	}
-	// // if config["snapsIncrementalConfigKey"] is empty, default to nil; otherwise, parse i
 	snapsClient.Authorizer = authorizer
-	snaps := &snapsClient
-	//return ListByResourceGroup(ctx, snaps, envVars[resourceGroupEnvVar], backupName, snapshotCount)
-	req, err := snaps.ListByResourceGroupPreparer(ctx, envVars[resourceGroupEnvVar])
-	if err != nil {
-		return autorest.NewErrorWithError(err, "compute.SnapshotsClient", "ListByResourceGroup", nil, "Failure preparing request")
+
+	return &azureObjectStore{
+		container:     container,
+		snapshots:     snapsClient,
+		bslBucket:     bslBucket,
+		resourceGroup: snapshotsResourceGroup,
+	}, nil
+}
+
+func (o *azureObjectStore) ListObjects(prefix string) ([]string, error) {
+	var keys []string
+	ctx := context.Background()
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		listBlob, err := o.container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: prefix})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list blobs under prefix %s in container %s", prefix, o.bslBucket)
+		}
+		marker = listBlob.NextMarker
+		for _, blobInfo := range listBlob.Segment.BlobItems {
+			keys = append(keys, blobInfo.Name)
+		}
 	}
+	return keys, nil
+}
 
-	resp, err := snaps.ListByResourceGroupSender(req)
+// ListSnapshots looks up the snapshots by the names in the snapshot ID list of the check point when CSI is
+// enabled, as the CSI snapshots are not tagged by the backup name
+func (o *azureObjectStore) ListSnapshots(backupName string, snapshotCheck SnapshotCheckPoint) ([]string, error) {
+	ctx := context.Background()
+	result, err := o.snapshots.ListByResourceGroup(ctx, o.resourceGroup)
 	if err != nil {
-		return autorest.NewErrorWithError(err, "compute.SnapshotsClient", "ListByResourceGroup", resp, "Failure sending request")
+		return nil, errors.Wrap(err, fmt.Sprintf("Fail to list snapshots %s", o.resourceGroup))
 	}
-	result, err := snaps.ListByResourceGroupResponder(resp)
-	snapshotCountFound := 0
-	backupNameInSnapshot := ""
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Fail to list snapshots %s\n", envVars[resourceGroupEnvVar]))
-	}
-	if result.Value == nil {
-		return errors.New(fmt.Sprintf("No snapshots in Azure resource group %s\n", envVars[resourceGroupEnvVar]))
-	}
-	for _, v := range *result.Value {
-		if snapshotCheck.EnableCSI {
-			for _, s := range snapshotCheck.SnapshotIDList {
-				fmt.Println("Azure CSI local snapshot CR: " + s)
-				fmt.Println("Azure provider snapshot name: " + *v.Name)
-				if s == *v.Name {
-					fmt.Printf("Azure snapshot %s is created.\n", s)
-					snapshotCountFound++
+	var ids []string
+	for ; result.NotDone(); err = result.NextWithContext(ctx) {
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Fail to list snapshots %s", o.resourceGroup))
+		}
+		for _, v := range result.Values() {
+			if v.Name == nil {
+				continue
+			}
+			if snapshotCheck.EnableCSI {
+				for _, s := range snapshotCheck.SnapshotIDList {
+					if s == *v.Name {
+						fmt.Printf("Azure snapshot %s is created.\n", s)
+						ids = append(ids, s)
+					}
 				}
+			} else if backup, ok := v.Tags["velero.io-backup"]; ok && backup != nil && *backup == backupName {
+				fmt.Printf("Azure snapshot %s is found for backup %s\n", *v.Name, backupName)
+				ids = append(ids, *v.Name)
 			}
-		} else {
-			fmt.Println(v.Tags)
-			backupNameInSnapshot = *v.Tags["velero.io-backup"]
-			fmt.Println(backupNameInSnapshot)
-			if backupName == backupNameInSnapshot {
-				snapshotCountFound++
+		}
+	}
+	return ids, nil
+}
+
+// ListSnapshotsByTag looks up the snapshots by the tag whose "/" is replaced with "-" by the Azure plugin, e.g.
+// "velero.io-backup", as "/" is not allowed in the tag names of Azure
+func (o *azureObjectStore) ListSnapshotsByTag(key, value string) ([]string, error) {
+	ctx := context.Background()
+	key = strings.Replace(key, "/", "-", -1)
+	result, err := o.snapshots.ListByResourceGroup(ctx, o.resourceGroup)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Fail to list snapshots %s", o.resourceGroup))
+	}
+	var ids []string
+	for ; result.NotDone(); err = result.NextWithContext(ctx) {
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Fail to list snapshots %s", o.resourceGroup))
+		}
+		for _, v := range result.Values() {
+			if v.Name == nil {
+				continue
 			}
+			if tag, ok := v.Tags[key]; ok && tag != nil && *tag == value {
+				ids = append(ids, *v.Name)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (o *azureObjectStore) SnapshotExists(id string) (bool, error) {
+	snapshot, err := o.snapshots.Get(context.Background(), o.resourceGroup, id)
+	if err != nil {
+		if snapshot.StatusCode == http.StatusNotFound {
+			return false, nil
 		}
+		return false, errors.Wrapf(err, "Fail to get snapshot %s", id)
 	}
+	return true, nil
+}
+
+func (o *azureObjectStore) DeleteSnapshot(id string) error {
+	ctx := context.Background()
+	future, err := o.snapshots.Delete(ctx, o.resourceGroup, id)
 	if err != nil {
-		return autorest.NewErrorWithError(err, "compute.SnapshotsClient", "ListByResourceGroup", resp, "Failure responding to request")
+		return errors.Wrapf(err, "Fail to delete snapshot %s", id)
 	}
-	if snapshotCountFound != snapshotCheck.ExpectCount {
-		return errors.New(fmt.Sprintf("Snapshot count %d is not as expected %d\n", snapshotCountFound, snapshotCheck.ExpectCount))
-	} else {
-		fmt.Printf("Snapshot count %d is as expected %d\n", snapshotCountFound, snapshotCheck.ExpectCount)
-		return nil
+	if err := future.WaitForCompletionRef(ctx, o.snapshots.Client); err != nil {
+		return errors.Wrapf(err, "Fail to wait for the deletion of snapshot %s", id)
 	}
+	fmt.Printf("Deleted snapshot %s in resource group %s\n", id, o.resourceGroup)
+	return nil
 }
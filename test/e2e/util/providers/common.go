@@ -17,12 +17,14 @@ limitations under the License.
 package providers
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	velero "github.com/vmware-tanzu/velero/test/e2e/util/velero"
@@ -31,7 +33,13 @@ import (
 type ObjectsInStorage interface {
 	IsObjectsInBucket(cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, backupObject string) (bool, error)
 	DeleteObjectsInBucket(cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, backupObject string) error
-	IsSnapshotExisted(cloudCredentialsFile, bslConfig, backupName string, snapshotCheck SnapshotCheckPoint) error
+}
+
+// ObjectsMutationInStorage is implemented by the providers which support reading and writing the
+// objects in the bucket directly
+type ObjectsMutationInStorage interface {
+	GetObject(cloudCredentialsFile, bslBucket, bslConfig, key string) ([]byte, error)
+	PutObject(cloudCredentialsFile, bslBucket, bslConfig, key string, data []byte) error
 }
 
 func ObjectsShouldBeInBucket(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, backupName, subPrefix string) error {
@@ -112,7 +120,7 @@ func DeleteObjectsInBucket(cloudProvider, cloudCredentialsFile, bslBucket, bslPr
 func SnapshotsShouldNotExistInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, backupName string, snapshotCheckPoint SnapshotCheckPoint) error {
 	fmt.Printf("|| VERIFICATION || - Snapshots should not exist in cloud, backup %s\n", backupName)
 	snapshotCheckPoint.ExpectCount = 0
-	err := IsSnapshotExisted(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, backupName, snapshotCheckPoint)
+	err := IsSnapshotExisted(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, "", backupName, snapshotCheckPoint)
 	if err != nil {
 		return errors.Wrapf(err, fmt.Sprintf("|| UNEXPECTED ||Snapshots %s exist in cloud after backup as expected", backupName))
 	}
@@ -120,9 +128,190 @@ func SnapshotsShouldNotExistInCloud(cloudProvider, cloudCredentialsFile, bslBuck
 	return nil
 }
 
-func SnapshotsShouldBeCreatedInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, backupName string, snapshotCheckPoint SnapshotCheckPoint) error {
+// SnapshotDeletionTimeout is the time to wait for the snapshots of the deleted backup to be removed from
+// cloud, the snapshots are deleted asynchronously by the backup deletion controller
+const SnapshotDeletionTimeout = 10 * time.Minute
+
+// SnapshotsShouldBeDeletedInCloud waits for the snapshots of the deleted backup to be removed from cloud,
+// and returns an error if any of them is left after SnapshotDeletionTimeout
+func SnapshotsShouldBeDeletedInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, backupName string, snapshotCheckPoint SnapshotCheckPoint) error {
+	fmt.Printf("|| VERIFICATION || - Snapshots should be deleted in cloud within %s, backup %s\n", SnapshotDeletionTimeout, backupName)
+	snapshotCheckPoint.ExpectCount = 0
+	var lastErr error
+	err := wait.PollImmediate(30*time.Second, SnapshotDeletionTimeout, func() (bool, error) {
+		if lastErr = IsSnapshotExisted(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, "", backupName, snapshotCheckPoint); lastErr != nil {
+			fmt.Printf("Snapshots of backup %s are not deleted yet: %v\n", backupName, lastErr)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return errors.Wrapf(lastErr, "|| UNEXPECTED || - Snapshots of backup %s still exist in cloud %s after backup deletion", backupName, SnapshotDeletionTimeout)
+	}
+	fmt.Printf("|| EXPECTED || - Snapshots are deleted in cloud, backup %s\n", backupName)
+	return nil
+}
+
+// BackupObjectsDeletionTimeout is the time to wait for the files of the deleted backup to be removed from the
+// object storage, the files are deleted after the snapshots by the backup deletion controller
+const BackupObjectsDeletionTimeout = 5 * time.Minute
+
+// BackupObjectsShouldExistInCloud checks the metadata, the tarball and the logs of the backup are uploaded
+// under the directory of the backup in the bucket. The backup repository of the namespace should also exist
+// under the directory of the repository type, e.g. "kopia", when the repository type isn't empty, i.e. the
+// volumes of the namespace are backed up by fs-backup
+func BackupObjectsShouldExistInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, backupName, repoType, namespace string) error {
+	fmt.Printf("|| VERIFICATION || - Files of backup %s should exist in cloud\n", backupName)
+	store, err := NewObjectStore(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, "")
+	if err != nil {
+		return err
+	}
+	prefix := getFullPrefix(bslPrefix, velero.BackupObjectsPrefix) + backupName + "/"
+	objects, err := listObjectNames(store, prefix)
+	if err != nil {
+		return errors.Wrapf(err, "|| UNEXPECTED || - Failed to list files of backup %s", backupName)
+	}
+	for _, name := range []string{"velero-backup.json", backupName + ".tar.gz", backupName + "-logs.gz"} {
+		if !objects[name] {
+			return errors.Errorf("|| UNEXPECTED || - %s of backup %s does not exist in storage %s", name, backupName, prefix)
+		}
+	}
+
+	if repoType != "" {
+		repoPrefix := getFullPrefix(bslPrefix, repoType) + namespace + "/"
+		repoObjects, err := listObjectNames(store, repoPrefix)
+		if err != nil {
+			return errors.Wrapf(err, "|| UNEXPECTED || - Failed to list files of %s repository of namespace %s", repoType, namespace)
+		}
+		if len(repoObjects) == 0 {
+			return errors.Errorf("|| UNEXPECTED || - %s repository of namespace %s does not exist in storage %s", repoType, namespace, repoPrefix)
+		}
+	}
+	fmt.Printf("|| EXPECTED || - Files of backup %s exist in bucket %s\n", backupName, bslBucket)
+	return nil
+}
+
+// BackupObjectsShouldNotExistInCloud waits for the directory of the deleted backup to be removed from the bucket,
+// and returns an error if any file of the backup is left after BackupObjectsDeletionTimeout. The backup repository
+// is shared by the backups of the namespace, so it's not checked
+func BackupObjectsShouldNotExistInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, backupName string) error {
+	fmt.Printf("|| VERIFICATION || - Files of backup %s should be deleted in cloud within %s\n", backupName, BackupObjectsDeletionTimeout)
+	store, err := NewObjectStore(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, "")
+	if err != nil {
+		return err
+	}
+	prefix := getFullPrefix(bslPrefix, velero.BackupObjectsPrefix) + backupName + "/"
+	deadline := time.Now().Add(BackupObjectsDeletionTimeout)
+	for {
+		objects, err := listObjectNames(store, prefix)
+		if err != nil {
+			return errors.Wrapf(err, "|| UNEXPECTED || - Failed to list files of backup %s", backupName)
+		}
+		if len(objects) == 0 {
+			fmt.Printf("|| EXPECTED || - Files of backup %s are deleted in cloud\n", backupName)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("|| UNEXPECTED || - %d files of backup %s still exist in storage %s after backup deletion",
+				len(objects), backupName, prefix)
+		}
+		fmt.Printf("%d files of backup %s are not deleted yet\n", len(objects), backupName)
+		time.Sleep(30 * time.Second)
+	}
+}
+
+// listResticSnapshots returns the IDs of the snapshots of the restic repository of the namespace in the bucket,
+// restic stores each snapshot as a file named by its full ID under the "snapshots" directory of the repository
+func listResticSnapshots(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, namespace string) ([]string, error) {
+	store, err := NewObjectStore(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, "")
+	if err != nil {
+		return nil, err
+	}
+	prefix := getFullPrefix(bslPrefix, "restic") + namespace + "/snapshots/"
+	objects, err := listObjectNames(store, prefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list snapshots of restic repository of namespace %s", namespace)
+	}
+	var ids []string
+	for name := range objects {
+		ids = append(ids, name)
+	}
+	return ids, nil
+}
+
+// findResticSnapshots returns the snapshots found in the repository of the IDs recorded by the pod volume
+// backups, which are the short IDs, i.e. the prefixes of the full IDs
+func findResticSnapshots(repoSnapshots, snapshotIDs []string) []string {
+	var found []string
+	for _, id := range snapshotIDs {
+		for _, repoSnapshot := range repoSnapshots {
+			if strings.HasPrefix(repoSnapshot, id) {
+				found = append(found, id)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// ResticSnapshotsShouldExistInCloud checks the snapshots of the pod volume backups exist in the restic
+// repository of the namespace
+func ResticSnapshotsShouldExistInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, namespace string, snapshotIDs []string) error {
+	fmt.Printf("|| VERIFICATION || - Snapshots %v should exist in restic repository of namespace %s\n", snapshotIDs, namespace)
+	repoSnapshots, err := listResticSnapshots(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, namespace)
+	if err != nil {
+		return err
+	}
+	if found := findResticSnapshots(repoSnapshots, snapshotIDs); len(found) != len(snapshotIDs) {
+		return errors.Errorf("|| UNEXPECTED || - Only snapshots %v of %v exist in restic repository of namespace %s", found, snapshotIDs, namespace)
+	}
+	fmt.Printf("|| EXPECTED || - Snapshots %v exist in restic repository of namespace %s\n", snapshotIDs, namespace)
+	return nil
+}
+
+// ResticSnapshotsShouldNotExistInCloud waits for the snapshots of the pod volume backups of the deleted backup to be
+// removed from the restic repository of the namespace within BackupObjectsDeletionTimeout
+func ResticSnapshotsShouldNotExistInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, namespace string, snapshotIDs []string) error {
+	fmt.Printf("|| VERIFICATION || - Snapshots %v should be deleted from restic repository of namespace %s\n", snapshotIDs, namespace)
+	deadline := time.Now().Add(BackupObjectsDeletionTimeout)
+	for {
+		repoSnapshots, err := listResticSnapshots(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, namespace)
+		if err != nil {
+			return err
+		}
+		found := findResticSnapshots(repoSnapshots, snapshotIDs)
+		if len(found) == 0 {
+			fmt.Printf("|| EXPECTED || - Snapshots %v are deleted from restic repository of namespace %s\n", snapshotIDs, namespace)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("|| UNEXPECTED || - Snapshots %v still exist in restic repository of namespace %s after backup deletion", found, namespace)
+		}
+		fmt.Printf("Snapshots %v are not deleted from restic repository yet\n", found)
+		time.Sleep(30 * time.Second)
+	}
+}
+
+// listObjectNames lists the objects under the prefix, the objects are keyed by their names relative to the prefix
+func listObjectNames(store ObjectStore, prefix string) (map[string]bool, error) {
+	keys, err := store.ListObjects(prefix)
+	if err != nil {
+		return nil, err
+	}
+	objects := map[string]bool{}
+	for _, key := range keys {
+		objects[strings.TrimPrefix(key, prefix)] = true
+	}
+	return objects, nil
+}
+
+// SnapshotsShouldBeCreatedInCloud checks the snapshots of the backup exist in cloud, the snapshots are looked up
+// by the snapshot config, which is in the same format as the BSL config, e.g. "region=us-west-1", so that the
+// snapshots created in a different region than the object store can be verified. The BSL config is used when
+// the snapshot config is empty
+func SnapshotsShouldBeCreatedInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig, backupName string, snapshotCheckPoint SnapshotCheckPoint) error {
 	fmt.Printf("|| VERIFICATION || - Snapshots should exist in cloud, backup %s\n", backupName)
-	err := IsSnapshotExisted(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, backupName, snapshotCheckPoint)
+	err := IsSnapshotExisted(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig, backupName, snapshotCheckPoint)
 	if err != nil {
 		return errors.Wrapf(err, fmt.Sprintf("|| UNEXPECTED ||Snapshots %s do not exist in cloud after backup as expected", backupName))
 	}
@@ -130,45 +319,180 @@ func SnapshotsShouldBeCreatedInCloud(cloudProvider, cloudCredentialsFile, bslBuc
 	return nil
 }
 
-func IsSnapshotExisted(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, backupName string, snapshotCheck SnapshotCheckPoint) error {
+// DeleteSnapshotsInCloud deletes the snapshots with the IDs from cloud, it's for cleaning up the snapshots leaked
+// by the failed tests, so the snapshots not found are skipped and the failures are collected rather than stopping
+// the deletion of the others
+func DeleteSnapshotsInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig string, snapshotIDs []string) error {
+	store, err := NewObjectStore(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, id := range snapshotIDs {
+		exist, err := store.SnapshotExists(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !exist {
+			fmt.Printf("Snapshot %s is not found in cloud, skip deleting it\n", id)
+			continue
+		}
+		if err := store.DeleteSnapshot(id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return kerrors.NewAggregate(errs)
+}
 
-	s, err := getProvider(cloudProvider)
+// CleanupSnapshotsByTags deletes the snapshots tagged with all the keys and values from cloud, e.g. the snapshots
+// of a backup are tagged with "velero.io/backup" and the labels of the backup like RunLabel
+func CleanupSnapshotsByTags(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig string, tags map[string]string) error {
+	store, err := NewObjectStore(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig)
 	if err != nil {
-		return errors.Wrapf(err, fmt.Sprintf("Cloud provider %s is not valid", cloudProvider))
+		return err
 	}
-	if cloudProvider == "vsphere" {
-		var retSnapshotIDs []string
-		ctx, ctxCancel := context.WithTimeout(context.Background(), time.Minute*2)
-		defer ctxCancel()
-		retSnapshotIDs, err = velero.GetVsphereSnapshotIDs(ctx, time.Hour, snapshotCheck.NamespaceBackedUp, snapshotCheck.PodName)
+	var snapshotIDs []string
+	first := true
+	for key, value := range tags {
+		ids, err := store.ListSnapshotsByTag(key, value)
 		if err != nil {
-			return errors.Wrapf(err, fmt.Sprintf("Fail to get snapshot CRs of backup%s", backupName))
+			return errors.Wrapf(err, "Failed to list snapshots tagged with %s=%s", key, value)
+		}
+		if first {
+			snapshotIDs, first = ids, false
+			continue
 		}
+		snapshotIDs = intersectSnapshotIDs(snapshotIDs, ids)
+	}
+	if len(snapshotIDs) == 0 {
+		return nil
+	}
+	fmt.Printf("Cleanup %d snapshots tagged with %v: %v\n", len(snapshotIDs), tags, snapshotIDs)
+	return DeleteSnapshotsInCloud(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig, snapshotIDs)
+}
 
-		bslPrefix := "plugins"
-		subPrefix := "vsphere-astrolabe-repo/ivd/data"
-		if snapshotCheck.ExpectCount == 0 {
-			for _, snapshotID := range retSnapshotIDs {
-				err := ObjectsShouldNotBeInBucket(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, snapshotID, subPrefix, 5)
-				if err != nil {
-					return errors.Wrapf(err, "|| UNEXPECTED || - Snapshot %s of backup %s exist in object store", snapshotID, backupName)
-				}
-			}
-		} else {
-			if snapshotCheck.ExpectCount != len(retSnapshotIDs) {
-				return errors.New(fmt.Sprintf("Snapshot CRs count %d is not equal to expected %d", len(retSnapshotIDs), snapshotCheck.ExpectCount))
-			}
-			for _, snapshotID := range retSnapshotIDs {
-				err := ObjectsShouldBeInBucket(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, snapshotID, subPrefix)
-				if err != nil {
-					return errors.Wrapf(err, "|| UNEXPECTED || - Snapshot %s of backup %s does not exist in object store", snapshotID, backupName)
-				}
-			}
+// intersectSnapshotIDs returns the IDs in both a and b
+func intersectSnapshotIDs(a, b []string) []string {
+	inB := map[string]bool{}
+	for _, id := range b {
+		inB[id] = true
+	}
+	var ids []string
+	for _, id := range a {
+		if inB[id] {
+			ids = append(ids, id)
 		}
-	} else {
-		err = s.IsSnapshotExisted(cloudCredentialsFile, bslConfig, backupName, snapshotCheck)
+	}
+	return ids
+}
+
+// IsSnapshotExisted checks the count of the snapshots of the backup in cloud is the expected count of the
+// snapshot check point, the snapshots are looked up by the ObjectStore of the cloud provider
+func IsSnapshotExisted(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig, backupName string, snapshotCheck SnapshotCheckPoint) error {
+	store, err := NewObjectStore(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig)
+	if err != nil {
+		return err
+	}
+	snapshotIDs, err := store.ListSnapshots(backupName, snapshotCheck)
+	if err != nil {
+		return errors.Wrapf(err, fmt.Sprintf("Fail to get snapshot of backup%s", backupName))
+	}
+	if len(snapshotIDs) != snapshotCheck.ExpectCount {
+		return errors.Errorf("Snapshot count %d is not as expected %d, snapshots: %v", len(snapshotIDs), snapshotCheck.ExpectCount, snapshotIDs)
+	}
+	fmt.Printf("Snapshot count %d is as expected %d\n", len(snapshotIDs), snapshotCheck.ExpectCount)
+	return nil
+}
+
+func getMutationProvider(cloudProvider string) (ObjectsMutationInStorage, error) {
+	switch cloudProvider {
+	case "aws", "vsphere":
+		aws := AWSStorage("")
+		return &aws, nil
+	case "gcp":
+		gcs := GCSStorage("")
+		return &gcs, nil
+	case "azure":
+		az := AzureStorage("")
+		return &az, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Mutating objects in bucket is not supported by cloud provider %s", cloudProvider))
+	}
+}
+
+// IsObjectsMutationSupported returns whether the objects in the bucket of the cloud provider could
+// be mutated by CopyBackupMetadataInBucket and PutObjectsToBucket
+func IsObjectsMutationSupported(cloudProvider string) bool {
+	_, err := getMutationProvider(cloudProvider)
+	return err == nil
+}
+
+// CopyBackupMetadataInBucket copies the metadata file velero-backup.json of the source backup as
+// the metadata of a new backup in the bucket, so the new backup could be synced by Velero. The
+// metadata is decoded as a map to keep the fields unknown to the Backup type, and could be mutated
+// by the mutate function before writing
+func CopyBackupMetadataInBucket(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, srcBackup, dstBackup string,
+	mutate func(metadata map[string]interface{})) error {
+	s, err := getMutationProvider(cloudProvider)
+	if err != nil {
+		return err
+	}
+	prefix := getFullPrefix(bslPrefix, velero.BackupObjectsPrefix)
+	data, err := s.GetObject(cloudCredentialsFile, bslBucket, bslConfig, prefix+srcBackup+"/velero-backup.json")
+	if err != nil {
+		return err
+	}
+	metadata := map[string]interface{}{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return errors.Wrapf(err, "Failed to decode metadata of backup %s", srcBackup)
+	}
+	objectMeta, ok := metadata["metadata"].(map[string]interface{})
+	if !ok {
+		return errors.Errorf("No object metadata in metadata of backup %s", srcBackup)
+	}
+	objectMeta["name"] = dstBackup
+	if mutate != nil {
+		mutate(metadata)
+	}
+	if data, err = json.Marshal(metadata); err != nil {
+		return errors.Wrapf(err, "Failed to encode metadata of backup %s", dstBackup)
+	}
+	fmt.Printf("Copy metadata of backup %s to backup %s in bucket %s\n", srcBackup, dstBackup, bslBucket)
+	return s.PutObject(cloudCredentialsFile, bslBucket, bslConfig, prefix+dstBackup+"/velero-backup.json", data)
+}
+
+// GetObjectsFromBucket reads the files of the backup from the bucket by their names under the directory
+// of the backup, e.g. "velero-backup.json", so they could be uploaded into another prefix by PutObjectsToBucket
+func GetObjectsFromBucket(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, backupName string, fileNames []string) (map[string][]byte, error) {
+	s, err := getMutationProvider(cloudProvider)
+	if err != nil {
+		return nil, err
+	}
+	prefix := getFullPrefix(bslPrefix, velero.BackupObjectsPrefix) + backupName + "/"
+	files := map[string][]byte{}
+	for _, name := range fileNames {
+		data, err := s.GetObject(cloudCredentialsFile, bslBucket, bslConfig, prefix+name)
 		if err != nil {
-			return errors.Wrapf(err, fmt.Sprintf("Fail to get snapshot of backup%s", backupName))
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// PutObjectsToBucket writes the files into the directory of the backup under the backups prefix of the
+// bucket, the files are keyed by their names under the directory
+func PutObjectsToBucket(cloudProvider, cloudCredentialsFile, bslBucket, bslPrefix, bslConfig, backupName string, files map[string][]byte) error {
+	s, err := getMutationProvider(cloudProvider)
+	if err != nil {
+		return err
+	}
+	prefix := getFullPrefix(bslPrefix, velero.BackupObjectsPrefix) + backupName + "/"
+	fmt.Printf("Put %d files of backup %s into storage %s\n", len(files), backupName, prefix)
+	for name, data := range files {
+		if err := s.PutObject(cloudCredentialsFile, bslBucket, bslConfig, prefix+name, data); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -19,6 +19,8 @@ package providers
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
 
@@ -27,9 +29,11 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 
+	"github.com/vmware-tanzu/velero/pkg/cmd/util/flag"
 	"github.com/vmware-tanzu/velero/test/e2e"
 )
 
@@ -101,43 +105,147 @@ func (s GCSStorage) DeleteObjectsInBucket(cloudCredentialsFile, bslBucket, bslPr
 	}
 }
 
-func (s GCSStorage) IsSnapshotExisted(cloudCredentialsFile, bslConfig, backupObject string, snapshotCheck e2e.SnapshotCheckPoint) error {
+func (s GCSStorage) GetObject(cloudCredentialsFile, bslBucket, bslConfig, key string) ([]byte, error) {
 	ctx := context.Background()
-	data, err := os.ReadFile(cloudCredentialsFile)
+	client, err := storage.NewClient(ctx, option.WithCredentialsFile(cloudCredentialsFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to create gcloud client")
+	}
+	defer client.Close()
+	reader, err := client.Bucket(bslBucket).Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get object %s from bucket %s", key, bslBucket)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func (s GCSStorage) PutObject(cloudCredentialsFile, bslBucket, bslConfig, key string, data []byte) error {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, option.WithCredentialsFile(cloudCredentialsFile))
 	if err != nil {
-		return errors.Wrapf(err, fmt.Sprintf("Failed reading gcloud credential file %s", cloudCredentialsFile))
+		return errors.Wrapf(err, "Fail to create gcloud client")
+	}
+	defer client.Close()
+	writer := client.Bucket(bslBucket).Object(key).NewWriter(ctx)
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return errors.Wrapf(err, "Failed to put object %s into bucket %s", key, bslBucket)
 	}
+	// the object is only created when the writer is closed successfully
+	if err := writer.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to put object %s into bucket %s", key, bslBucket)
+	}
+	fmt.Printf("Put object %s into bucket %s\n", key, bslBucket)
+	return nil
+}
+
+func init() {
+	RegisterObjectStore("gcp", newGCPObjectStore)
+}
+
+// gcpObjectStore is the ObjectStore of GCP, the objects are in the GCS bucket and the snapshots are the
+// disk snapshots in the project of the credentials
+type gcpObjectStore struct {
+	storage   *storage.Client
+	compute   *compute.Service
+	bslBucket string
+	project   string
+}
 
+func newGCPObjectStore(cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig string) (ObjectStore, error) {
+	ctx := context.Background()
+	data, err := os.ReadFile(cloudCredentialsFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, fmt.Sprintf("Failed reading gcloud credential file %s", cloudCredentialsFile))
+	}
 	creds, err := google.CredentialsFromJSON(ctx, data)
 	if err != nil {
-		return errors.Wrapf(err, fmt.Sprintf("Failed getting credentials from JSON data %s", string(data)))
+		return nil, errors.Wrapf(err, "Failed getting credentials from JSON data")
+	}
+	storageClient, err := storage.NewClient(ctx, option.WithCredentialsFile(cloudCredentialsFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to create gcloud client")
 	}
+	computeService, err := compute.NewService(ctx, option.WithCredentialsFile(cloudCredentialsFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to create gcloud compute service")
+	}
+	// the snapshots are created in the project of the VSL config if it's specified
+	config := flag.NewMap()
+	config.Set(snapshotConfig)
+	project := config.Data()["project"]
+	if project == "" {
+		project = creds.ProjectID
+	}
+	return &gcpObjectStore{
+		storage:   storageClient,
+		compute:   computeService,
+		bslBucket: bslBucket,
+		project:   project,
+	}, nil
+}
+
+func (o *gcpObjectStore) ListObjects(prefix string) ([]string, error) {
+	var keys []string
+	iter := o.storage.Bucket(o.bslBucket).Objects(context.Background(), &storage.Query{Prefix: prefix})
+	for {
+		obj, err := iter.Next()
+		if err == iterator.Done {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list objects under prefix %s in bucket %s", prefix, o.bslBucket)
+		}
+		keys = append(keys, obj.Name)
+	}
+}
 
-	computeService, err := compute.NewService(context.Background(), option.WithCredentialsFile(cloudCredentialsFile))
+func (o *gcpObjectStore) ListSnapshots(backupName string, snapshotCheck e2e.SnapshotCheckPoint) ([]string, error) {
+	ids, err := o.ListSnapshotsByTag(BackupSnapshotTag, backupName)
 	if err != nil {
-		return errors.Wrapf(err, "Fail to create gcloud compute service")
+		return nil, err
+	}
+	for _, id := range ids {
+		fmt.Printf("Snapshot %s is found for backup %s\n", id, backupName)
 	}
-	// Project ID for this request.
-	project := creds.ProjectID
-	req := computeService.Snapshots.List(project)
-	snapshotCountFound := 0
-	if err := req.Pages(ctx, func(page *compute.SnapshotList) error {
+	return ids, nil
+}
+
+// ListSnapshotsByTag looks up the tags in the descriptions of the snapshots, the tags are written into the
+// description in JSON by the GCP plugin as the label keys of GCP can't contain "/"
+func (o *gcpObjectStore) ListSnapshotsByTag(key, value string) ([]string, error) {
+	var ids []string
+	ctx := context.Background()
+	if err := o.compute.Snapshots.List(o.project).Pages(ctx, func(page *compute.SnapshotList) error {
 		for _, snapshot := range page.Items {
 			snapshotDesc := map[string]string{}
 			json.Unmarshal([]byte(snapshot.Description), &snapshotDesc)
-			if backupObject == snapshotDesc["velero.io/backup"] {
-				snapshotCountFound++
+			if value == snapshotDesc[key] {
+				ids = append(ids, snapshot.Name)
 			}
 		}
 		return nil
 	}); err != nil {
-		return errors.Wrapf(err, "Failed listing snapshot pages")
+		return nil, errors.Wrapf(err, "Failed listing snapshot pages")
+	}
+	return ids, nil
+}
+
+func (o *gcpObjectStore) SnapshotExists(id string) (bool, error) {
+	if _, err := o.compute.Snapshots.Get(o.project, id).Do(); err != nil {
+		if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusNotFound {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "Failed to get snapshot %s", id)
 	}
+	return true, nil
+}
 
-	if snapshotCountFound != snapshotCheck.ExpectCount {
-		return errors.New(fmt.Sprintf("Snapshot count %d is not as expected %d\n", snapshotCountFound, len(snapshotCheck.SnapshotIDList)))
-	} else {
-		fmt.Printf("Snapshot count %d is as expected %d\n", snapshotCountFound, len(snapshotCheck.SnapshotIDList))
-		return nil
+func (o *gcpObjectStore) DeleteSnapshot(id string) error {
+	if _, err := o.compute.Snapshots.Delete(o.project, id).Do(); err != nil {
+		return errors.Wrapf(err, "Failed to delete snapshot %s", id)
 	}
+	fmt.Printf("Deleted snapshot %s in project %s\n", id, o.project)
+	return nil
 }
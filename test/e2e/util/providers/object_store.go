@@ -0,0 +1,71 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providers
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+)
+
+// ObjectStore is the client of the bucket and the volume snapshots of a cloud provider, it's bound to the
+// credentials, the bucket and the configs when created, so the verifications don't need to branch on the
+// cloud provider
+type ObjectStore interface {
+	// ListObjects returns the keys of all the objects under the prefix in the bucket
+	ListObjects(prefix string) ([]string, error)
+	// ListSnapshots returns the IDs of the snapshots of the backup which exist in cloud, the snapshot check
+	// point is for the providers whose snapshots can't be looked up by the backup name
+	ListSnapshots(backupName string, snapshotCheck SnapshotCheckPoint) ([]string, error)
+	// ListSnapshotsByTag returns the IDs of the snapshots tagged with the key and value by Velero, e.g.
+	// "velero.io/backup", which are the labels of the backup and the labels added by Velero
+	ListSnapshotsByTag(key, value string) ([]string, error)
+	// SnapshotExists returns whether the snapshot with the ID exists in cloud
+	SnapshotExists(id string) (bool, error)
+	// DeleteSnapshot deletes the snapshot with the ID from cloud
+	DeleteSnapshot(id string) error
+}
+
+// NewObjectStoreFunc creates the ObjectStore of a cloud provider, the snapshot config is in the same
+// format as the BSL config, e.g. "region=us-west-1"
+type NewObjectStoreFunc func(cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig string) (ObjectStore, error)
+
+// BackupSnapshotTag is the tag of the name of the backup added to the snapshots by Velero
+const BackupSnapshotTag = "velero.io/backup"
+
+var objectStores = map[string]NewObjectStoreFunc{}
+
+// RegisterObjectStore registers the ObjectStore of the cloud provider, it's called by the providers in
+// their init functions
+func RegisterObjectStore(cloudProvider string, newFunc NewObjectStoreFunc) {
+	objectStores[cloudProvider] = newFunc
+}
+
+// NewObjectStore creates the ObjectStore registered for the cloud provider, the BSL config is used to
+// look up the snapshots when the snapshot config is empty
+func NewObjectStore(cloudProvider, cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig string) (ObjectStore, error) {
+	newFunc, ok := objectStores[cloudProvider]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Cloud provider %s is not valid", cloudProvider))
+	}
+	if snapshotConfig == "" {
+		snapshotConfig = bslConfig
+	}
+	return newFunc(cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	velero "github.com/vmware-tanzu/velero/test/e2e/util/velero"
+)
+
+// vsphereSnapshotPrefix is the prefix in the bucket where the vSphere plugin uploads the snapshots
+const vsphereSnapshotPrefix = "plugins/vsphere-astrolabe-repo/ivd/data/"
+
+func init() {
+	RegisterObjectStore("vsphere", newVsphereObjectStore)
+}
+
+// vsphereObjectStore is the ObjectStore of vSphere, the snapshots are uploaded into the S3 compatible bucket
+// by the vSphere plugin, so they are looked up as the objects under vsphereSnapshotPrefix
+type vsphereObjectStore struct {
+	*awsObjectStore
+}
+
+func newVsphereObjectStore(cloudCredentialsFile, bslBucket, bslConfig, snapshotConfig string) (ObjectStore, error) {
+	// the snapshots are in the bucket, so they are looked up by the BSL config
+	store, err := newAWSObjectStore(cloudCredentialsFile, bslBucket, bslConfig, bslConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &vsphereObjectStore{store.(*awsObjectStore)}, nil
+}
+
+// ListSnapshots gets the snapshots of the PVCs in the check point from the snapshot CRs of the vSphere plugin, as the
+// snapshots in the bucket are not named by the backup. The PVCs are matched by the volumes of the check point, or by
+// the names of the pods if it has no volume. Each snapshot should be uploaded with a snapshot ID, and the IDs of the
+// snapshots whose objects exist in the bucket are returned
+func (o *vsphereObjectStore) ListSnapshots(backupName string, snapshotCheck SnapshotCheckPoint) ([]string, error) {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), time.Minute*2)
+	defer ctxCancel()
+	namespaces := []string{snapshotCheck.NamespaceBackedUp}
+	if len(snapshotCheck.Volumes) > 0 {
+		namespaces = volumeNamespaces(snapshotCheck.Volumes)
+	}
+	var ids []string
+	for _, namespace := range namespaces {
+		statuses, err := velero.GetVSphereSnapshotStatuses(ctx, namespace)
+		if err != nil {
+			return nil, errors.Wrapf(err, fmt.Sprintf("Fail to get snapshot CRs of backup%s", backupName))
+		}
+		for _, status := range statuses {
+			if len(snapshotCheck.Volumes) > 0 {
+				if _, ok := snapshotCheck.Volumes[velero.PVCKey(namespace, status.PVC)]; !ok {
+					continue
+				}
+			} else if !isPVCOfPods(status.PVC, snapshotCheck.PodName) {
+				continue
+			}
+			if status.Phase != "Uploaded" || status.SnapshotID == "" {
+				return nil, errors.Errorf("vSphere %s of backup %s is not uploaded with a snapshot ID", status, backupName)
+			}
+			exist, err := o.SnapshotExists(status.SnapshotID)
+			if err != nil {
+				return nil, err
+			}
+			if !exist {
+				fmt.Printf("Snapshot %s of PVC %s is not found under %s in bucket %s\n", status.SnapshotID, status.PVC, vsphereSnapshotPrefix, o.bslBucket)
+				continue
+			}
+			fmt.Printf("Snapshot %s of PVC %s is found for backup %s\n", status.SnapshotID, status.PVC, backupName)
+			ids = append(ids, status.SnapshotID)
+		}
+	}
+	return ids, nil
+}
+
+// volumeNamespaces returns the namespaces of the PVCs keyed by "<namespace>/<pvc>" in the volumes of the check point
+func volumeNamespaces(volumes map[string]string) []string {
+	var namespaces []string
+	seen := map[string]bool{}
+	for key := range volumes {
+		namespace := strings.SplitN(key, "/", 2)[0]
+		if !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// isPVCOfPods returns whether the PVC is of one of the pods, the PVCs of the statefulsets are named after the pods
+func isPVCOfPods(pvc string, podNames []string) bool {
+	for _, podName := range podNames {
+		if podName != "" && strings.Contains(pvc, podName) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListSnapshotsByTag isn't supported as the snapshots uploaded by the vSphere plugin are not tagged, they're
+// deleted along with the backups by the plugin
+func (o *vsphereObjectStore) ListSnapshotsByTag(key, value string) ([]string, error) {
+	return nil, errors.New("Snapshots of vSphere are not tagged")
+}
+
+func (o *vsphereObjectStore) snapshotObjects(id string) ([]string, error) {
+	keys, err := o.ListObjects(vsphereSnapshotPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var objects []string
+	for _, key := range keys {
+		if strings.Contains(strings.TrimPrefix(key, vsphereSnapshotPrefix), id) {
+			objects = append(objects, key)
+		}
+	}
+	return objects, nil
+}
+
+func (o *vsphereObjectStore) SnapshotExists(id string) (bool, error) {
+	objects, err := o.snapshotObjects(id)
+	if err != nil {
+		return false, err
+	}
+	return len(objects) > 0, nil
+}
+
+func (o *vsphereObjectStore) DeleteSnapshot(id string) error {
+	objects, err := o.snapshotObjects(id)
+	if err != nil {
+		return err
+	}
+	for _, key := range objects {
+		if _, err := o.s3.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(o.bslBucket),
+			Key:    aws.String(key),
+		}); err != nil {
+			return errors.Wrapf(err, "Failed to delete object %s of snapshot %s", key, id)
+		}
+	}
+	fmt.Printf("Deleted %d object(s) of snapshot %s from bucket %s\n", len(objects), id, o.bslBucket)
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package velero
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kbclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+)
+
+const (
+	DataPathKindPVB = "PodVolumeBackup"
+	DataPathKindPVR = "PodVolumeRestore"
+)
+
+// DataPathCR is a PodVolumeBackup or PodVolumeRestore handled by node-agent. The CRs are created in
+// the Velero namespace and only reference the workload namespace by the pod in spec, so they are
+// attributed to the workload namespace when they are queried.
+type DataPathCR struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Phase     string
+	Terminal  bool
+	Object    kbclient.Object
+}
+
+func (d DataPathCR) String() string {
+	return fmt.Sprintf("%s %s of namespace %s in phase %q", d.Kind, d.Name, d.Namespace, d.Phase)
+}
+
+// GetDataPathCRsOfNamespace returns the PodVolumeBackups and PodVolumeRestores of the pods in namespace
+func GetDataPathCRsOfNamespace(ctx context.Context, client TestClient, veleroNamespace, namespace string) ([]DataPathCR, error) {
+	var crs []DataPathCR
+	pvbList := new(velerov1api.PodVolumeBackupList)
+	if err := client.Kubebuilder.List(ctx, pvbList, &kbclient.ListOptions{Namespace: veleroNamespace}); err != nil {
+		return nil, errors.Wrap(err, "failed to list PodVolumeBackups")
+	}
+	for i := range pvbList.Items {
+		pvb := &pvbList.Items[i]
+		if pvb.Spec.Pod.Namespace != namespace {
+			continue
+		}
+		crs = append(crs, DataPathCR{
+			Kind:      DataPathKindPVB,
+			Name:      pvb.Name,
+			Namespace: namespace,
+			Phase:     string(pvb.Status.Phase),
+			Terminal: pvb.Status.Phase == velerov1api.PodVolumeBackupPhaseCompleted ||
+				pvb.Status.Phase == velerov1api.PodVolumeBackupPhaseFailed,
+			Object: pvb,
+		})
+	}
+	pvrList := new(velerov1api.PodVolumeRestoreList)
+	if err := client.Kubebuilder.List(ctx, pvrList, &kbclient.ListOptions{Namespace: veleroNamespace}); err != nil {
+		return nil, errors.Wrap(err, "failed to list PodVolumeRestores")
+	}
+	for i := range pvrList.Items {
+		pvr := &pvrList.Items[i]
+		if pvr.Spec.Pod.Namespace != namespace {
+			continue
+		}
+		crs = append(crs, DataPathCR{
+			Kind:      DataPathKindPVR,
+			Name:      pvr.Name,
+			Namespace: namespace,
+			Phase:     string(pvr.Status.Phase),
+			Terminal: pvr.Status.Phase == velerov1api.PodVolumeRestorePhaseCompleted ||
+				pvr.Status.Phase == velerov1api.PodVolumeRestorePhaseFailed,
+			Object: pvr,
+		})
+	}
+	return crs, nil
+}
+
+// SafeDeleteWorkloadNamespace deletes the workload namespace and waits for it to be deleted, the
+// PodVolumeBackups and PodVolumeRestores of the namespace still in progress, such as the ones left by
+// an aborted backup or restore, are waited for up to dataPathTimeout and deleted after that. Deleting
+// the namespace under a running data path could wedge node-agent.
+func SafeDeleteWorkloadNamespace(ctx context.Context, client TestClient, veleroNamespace, namespace string, dataPathTimeout time.Duration) error {
+	var inProgress []DataPathCR
+	err := wait.PollImmediate(5*time.Second, dataPathTimeout, func() (bool, error) {
+		crs, err := GetDataPathCRsOfNamespace(ctx, client, veleroNamespace, namespace)
+		if err != nil {
+			return false, err
+		}
+		inProgress = nil
+		for _, cr := range crs {
+			if !cr.Terminal {
+				fmt.Printf("Waiting for %s before deleting the namespace\n", cr)
+				inProgress = append(inProgress, cr)
+			}
+		}
+		return len(inProgress) == 0, nil
+	})
+	if err != nil && err != wait.ErrWaitTimeout {
+		return errors.Wrapf(err, "failed to wait for data path of namespace %s", namespace)
+	}
+	for _, cr := range inProgress {
+		fmt.Printf("Delete %s not completed in %s\n", cr, dataPathTimeout)
+		if err := client.Kubebuilder.Delete(ctx, cr.Object); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete %s", cr)
+		}
+	}
+	return DeleteNamespace(ctx, client, namespace, true)
+}
+
+// GetNodeAgentRestartCounts returns the restart count of the containers of each node-agent pod
+func GetNodeAgentRestartCounts(ctx context.Context, client TestClient, veleroNamespace string) (map[string]int32, error) {
+	return getRestartCounts(ctx, client, veleroNamespace, "node-agent", map[string]string{"name": "node-agent"})
+}
+
+// GetVeleroRestartCounts returns the restart count of the containers of each velero server pod, the
+// pods are keyed by name so a recreated pod is told from a restarted one
+func GetVeleroRestartCounts(ctx context.Context, client TestClient, veleroNamespace string) (map[string]int32, error) {
+	return getRestartCounts(ctx, client, veleroNamespace, "velero", map[string]string{"deploy": "velero"})
+}
+
+func getRestartCounts(ctx context.Context, client TestClient, veleroNamespace, component string, selector map[string]string) (map[string]int32, error) {
+	pods, err := client.ClientGo.CoreV1().Pods(veleroNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list %s pods", component)
+	}
+	counts := make(map[string]int32)
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			counts[pod.Name] += status.RestartCount
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,173 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package velero
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/vmware-tanzu/velero/test/e2e"
+)
+
+var (
+	// the pod of the Velero deployment is named as velero-<replicaset hash>-<suffix>
+	veleroPodLogPattern = regexp.MustCompile(`^velero-[a-z0-9]+-[a-z0-9]{5}$`)
+	// the pod of the node-agent daemonset is named as node-agent-<suffix>
+	nodeAgentPodLogPattern = regexp.MustCompile(`^node-agent-[a-z0-9]{5}$`)
+)
+
+// CollectDebugBundle generates the debug bundle of the backup and restore by "velero debug" under the
+// artifacts dir, and returns the path of the bundle tarball
+func CollectDebugBundle(ctx context.Context, veleroCLI, veleroNamespace, backup, restore string) (string, error) {
+	if len(VeleroCfg.ArtifactsDir) > 0 {
+		if err := os.MkdirAll(VeleroCfg.ArtifactsDir, 0755); err != nil {
+			return "", errors.Wrapf(err, "failed to create artifacts dir %s", VeleroCfg.ArtifactsDir)
+		}
+	}
+	output := filepath.Join(VeleroCfg.ArtifactsDir, fmt.Sprintf("debug-bundle-%d.tar.gz", time.Now().UnixNano()))
+	args := []string{"debug", "--namespace", veleroNamespace, "--output", output, "--verbose"}
+	if len(backup) > 0 {
+		args = append(args, "--backup", backup)
+	}
+	if len(restore) > 0 {
+		args = append(args, "--restore", restore)
+	}
+	fmt.Printf("Generating the debug tarball at %s\n", output)
+	if err := VeleroCmdExec(ctx, veleroCLI, args); err != nil {
+		return "", errors.Wrap(err, "failed to run the debug command")
+	}
+	if _, err := os.Stat(output); err != nil {
+		return "", errors.Wrapf(err, "debug bundle %s is not generated", output)
+	}
+	return output, nil
+}
+
+// ExtractDebugBundle extracts the debug bundle tarball into the dir next to it, which is named after the
+// tarball without the ".tar.gz" suffix, and returns the dir and the paths of the files relative to the dir
+func ExtractDebugBundle(bundle string) (string, []string, error) {
+	dir := strings.TrimSuffix(bundle, ".tar.gz")
+	file, err := os.Open(bundle)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to open debug bundle %s", bundle)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to read debug bundle %s", bundle)
+	}
+	defer gzipReader.Close()
+
+	var files []string
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "failed to read debug bundle %s", bundle)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return "", nil, errors.Errorf("invalid file %s in debug bundle %s", header.Name, bundle)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", nil, errors.Wrapf(err, "failed to create dir for %s", target)
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "failed to create file %s", target)
+		}
+		_, err = io.Copy(out, tarReader)
+		out.Close()
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "failed to extract file %s", target)
+		}
+		files = append(files, name)
+	}
+	return dir, files, nil
+}
+
+// DebugBundleShouldContain checks the files extracted from the debug bundle contain the version, the logs
+// of the Velero server, the describe output and logs of the backup and restore if they're specified, and
+// the logs of node-agent if it's installed
+func DebugBundleShouldContain(files []string, backup, restore string, nodeAgent bool) error {
+	expected := []string{"version.txt"}
+	if len(backup) > 0 {
+		expected = append(expected, fmt.Sprintf("backup_describe_%s.txt", backup), fmt.Sprintf("backup_%s.log", backup))
+	}
+	if len(restore) > 0 {
+		expected = append(expected, fmt.Sprintf("restore_describe_%s.txt", restore), fmt.Sprintf("restore_%s.log", restore))
+	}
+
+	var missing []string
+	for _, name := range expected {
+		if FindDebugBundleFile(files, name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if !hasPodLogs(files, veleroPodLogPattern) {
+		missing = append(missing, "logs of Velero server")
+	}
+	if nodeAgent && !hasPodLogs(files, nodeAgentPodLogPattern) {
+		missing = append(missing, "logs of node-agent")
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("debug bundle doesn't contain %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// FindDebugBundleFile returns the path of the file with the name in the debug bundle, or empty if it's not found
+func FindDebugBundleFile(files []string, name string) string {
+	for _, file := range files {
+		if path.Base(file) == name {
+			return file
+		}
+	}
+	return ""
+}
+
+// hasPodLogs returns whether there are log files in the dir of the pod matching the pattern
+func hasPodLogs(files []string, podPattern *regexp.Regexp) bool {
+	for _, file := range files {
+		if path.Ext(file) != ".log" {
+			continue
+		}
+		for _, dir := range strings.Split(path.Dir(file), "/") {
+			if podPattern.MatchString(dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package velero
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	veleroexec "github.com/vmware-tanzu/velero/pkg/util/exec"
+)
+
+// BackupDescription is the result of the backup according to "velero backup describe --details"
+type BackupDescription struct {
+	Phase         string
+	TotalItems    int
+	ItemsBackedUp int
+	// Resources are the keys of the resources included in the backup in the format of GetBackupContents
+	Resources []string
+	Warnings  int
+	Errors    int
+	Volumes   *BackupVolumeDetails
+}
+
+// RestoreDescription is the result of the restore according to "velero restore describe"
+type RestoreDescription struct {
+	Phase         string
+	TotalItems    int
+	ItemsRestored int
+	Warnings      int
+	Errors        int
+}
+
+// DescribeBackup returns the result of the backup described by "velero backup describe --details -o json",
+// the plaintext output is parsed instead if the CLI doesn't support the structured output
+func DescribeBackup(ctx context.Context, veleroCLI, veleroNamespace, backupName string) (*BackupDescription, error) {
+	args := []string{"--namespace", veleroNamespace, "backup", "describe", backupName, "--details", "-o", "json"}
+	stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, veleroCLI, args...))
+	if err == nil {
+		description, err := parseBackupDescriptionJSON(stdout)
+		if err == nil {
+			return description, nil
+		}
+		fmt.Printf("Failed to decode the structured description of backup %s, fall back to plaintext: %v\n", backupName, err)
+	} else {
+		fmt.Printf("Failed to get the structured description of backup %s, fall back to plaintext: %v, stderr=%s\n", backupName, err, stderr)
+	}
+
+	output, err := VeleroBackupDescribe(ctx, veleroCLI, veleroNamespace, backupName, true)
+	if err != nil {
+		return nil, err
+	}
+	description, err := parseBackupDescription(output)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the description of backup %s", backupName)
+	}
+	return description, nil
+}
+
+// DescribeRestore returns the result of the restore described by "velero restore describe --details", the
+// restore can only be described in plaintext
+func DescribeRestore(ctx context.Context, veleroCLI, veleroNamespace, restoreName string) (*RestoreDescription, error) {
+	output, err := VeleroRestoreDescribe(ctx, veleroCLI, veleroNamespace, restoreName, true)
+	if err != nil {
+		return nil, err
+	}
+	description, err := parseRestoreDescription(output)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the description of restore %s", restoreName)
+	}
+	return description, nil
+}
+
+func parseBackupDescription(output string) (*BackupDescription, error) {
+	sections := ParseDescribeOutput(output)
+	description := &BackupDescription{Phase: describedPhase(sections)}
+	var err error
+	if description.TotalItems, err = describedCount(sections, "Total items to be backed up"); err != nil {
+		return nil, err
+	}
+	if description.ItemsBackedUp, err = describedCount(sections, "Items backed up"); err != nil {
+		return nil, err
+	}
+	if description.Resources, err = parseBackupResourceList(output); err != nil {
+		return nil, err
+	}
+	if description.Warnings, description.Errors, err = parseDescribeResult(output); err != nil {
+		return nil, err
+	}
+	if description.Volumes, err = ParseBackupVolumeDetails(output); err != nil {
+		return nil, err
+	}
+	return description, nil
+}
+
+func parseRestoreDescription(output string) (*RestoreDescription, error) {
+	sections := ParseDescribeOutput(output)
+	description := &RestoreDescription{Phase: describedPhase(sections)}
+	var err error
+	if description.TotalItems, err = describedCount(sections, "Total items to be restored"); err != nil {
+		return nil, err
+	}
+	if description.ItemsRestored, err = describedCount(sections, "Items restored"); err != nil {
+		return nil, err
+	}
+	if description.Warnings, description.Errors, err = parseDescribeResult(output); err != nil {
+		return nil, err
+	}
+	return description, nil
+}
+
+// describedPhase returns the phase without the note following it, e.g.
+// "PartiallyFailed (run 'velero restore logs restore-1' for more information)"
+func describedPhase(sections map[string]string) string {
+	fields := strings.Fields(sections["Phase"])
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// describedCount returns the count of the section, which is 0 if the section isn't described, e.g. the
+// items are not described before the backup or restore starts
+func describedCount(sections map[string]string, name string) (int, error) {
+	value, ok := sections[name]
+	if !ok {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid count of %q", name)
+	}
+	return count, nil
+}
+
+// parseDescribeResult counts the warnings and errors of the backup or restore, only the counts are described
+// if the results were not uploaded by the Velero of the older versions, e.g.
+//
+//	Errors:    1
+//	Warnings:  2
+func parseDescribeResult(output string) (int, int, error) {
+	sections := ParseDescribeOutput(output)
+	warnings, warningsErr := strconv.Atoi(sections["Warnings"])
+	errs, errsErr := strconv.Atoi(sections["Errors"])
+	if warningsErr == nil && errsErr == nil {
+		return warnings, errs, nil
+	}
+	return parseRestoreResult(output)
+}
+
+// describedResultJSON is the warnings or errors in the structured description, only the count is described if
+// the results were not uploaded by the Velero of the older versions
+type describedResultJSON struct {
+	Count   *int     `json:"count"`
+	Velero  []string `json:"velero"`
+	Cluster []string `json:"cluster"`
+	// Namespace is an empty list rather than a map when there is no result in the namespaces
+	Namespace            json.RawMessage `json:"namespace"`
+	ErrorGettingWarnings json.RawMessage `json:"errorGettingWarnings"`
+	ErrorGettingErrors   json.RawMessage `json:"errorGettingErrors"`
+}
+
+func (r describedResultJSON) count() (int, error) {
+	if r.ErrorGettingWarnings != nil || r.ErrorGettingErrors != nil {
+		return 0, errors.New("failed to get the results")
+	}
+	if r.Count != nil {
+		return *r.Count, nil
+	}
+	count := len(r.Velero) + len(r.Cluster)
+	if len(r.Namespace) > 0 && r.Namespace[0] == '{' {
+		namespaces := map[string][]string{}
+		if err := json.Unmarshal(r.Namespace, &namespaces); err != nil {
+			return 0, errors.Wrap(err, "failed to decode the results of namespaces")
+		}
+		for _, messages := range namespaces {
+			count += len(messages)
+		}
+	}
+	return count, nil
+}
+
+// backupDescriptionJSON is the structured description of "velero backup describe --details -o json"
+type backupDescriptionJSON struct {
+	Phase  string `json:"phase"`
+	Status struct {
+		TotalItems               int                 `json:"totalItemsToBeBackedUp"`
+		ItemsBackedUp            int                 `json:"itemsBackedUp"`
+		ResourceList             map[string][]string `json:"resourceList"`
+		ErrorGettingResourceList string              `json:"errorGettingResourceList"`
+		ErrorGettingSnapshots    string              `json:"errorGettingSnapshots"`
+		NativeSnapshots          map[string]struct {
+			SnapshotID       string `json:"snapshotID"`
+			Type             string `json:"type"`
+			AvailabilityZone string `json:"availabilityZone"`
+			IOPS             string `json:"IOPS"`
+		} `json:"veleroNativeSnapshotsDetail"`
+	} `json:"status"`
+	PodVolumeBackups struct {
+		Type string `json:"type"`
+		// Details are the volumes keyed by "<namespace>/<pod>" in each phase
+		Details map[string][]map[string]string `json:"podVolumeBackupsDetails"`
+	} `json:"podVolumeBackups"`
+	CSIVolumeSnapshots struct {
+		Details map[string]struct {
+			SnapshotHandle string `json:"storageSnapshotID"`
+			Size           int64  `json:"snapshotSize(bytes)"`
+			ReadyToUse     bool   `json:"readyToUse"`
+		} `json:"CSIVolumeSnapshotsDetails"`
+	} `json:"CSIVolumeSnapshots"`
+	Warnings describedResultJSON `json:"warnings"`
+	Errors   describedResultJSON `json:"errors"`
+}
+
+func parseBackupDescriptionJSON(output string) (*BackupDescription, error) {
+	decoder := json.NewDecoder(bytes.NewBufferString(output))
+	structured := backupDescriptionJSON{}
+	if err := decoder.Decode(&structured); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the structured description")
+	}
+	if structured.Status.ErrorGettingResourceList != "" {
+		return nil, errors.Errorf("failed to get the resource list of backup: %s", structured.Status.ErrorGettingResourceList)
+	}
+	if structured.Status.ErrorGettingSnapshots != "" {
+		return nil, errors.Errorf("failed to get the volume information of backup: %s", structured.Status.ErrorGettingSnapshots)
+	}
+
+	description := &BackupDescription{
+		Phase:         structured.Phase,
+		TotalItems:    structured.Status.TotalItems,
+		ItemsBackedUp: structured.Status.ItemsBackedUp,
+		Volumes: &BackupVolumeDetails{
+			NativeSnapshots:   map[string]NativeSnapshotDetails{},
+			CSISnapshots:      map[string]CSISnapshotDetails{},
+			PodVolumeUploader: structured.PodVolumeBackups.Type,
+			PodVolumeBackups:  map[string]string{},
+		},
+	}
+	for gvk, items := range structured.Status.ResourceList {
+		for _, item := range items {
+			description.Resources = append(description.Resources, gvk+":"+item)
+		}
+	}
+	var err error
+	if description.Warnings, err = structured.Warnings.count(); err != nil {
+		return nil, errors.Wrap(err, "failed to count the warnings of backup")
+	}
+	if description.Errors, err = structured.Errors.count(); err != nil {
+		return nil, errors.Wrap(err, "failed to count the errors of backup")
+	}
+	for pv, snapshot := range structured.Status.NativeSnapshots {
+		description.Volumes.NativeSnapshots[pv] = NativeSnapshotDetails(snapshot)
+	}
+	for name, snapshot := range structured.CSIVolumeSnapshots.Details {
+		description.Volumes.CSISnapshots[name] = CSISnapshotDetails(snapshot)
+	}
+	for phase, pods := range structured.PodVolumeBackups.Details {
+		for _, pod := range pods {
+			for key, volumes := range pod {
+				for _, volume := range strings.Split(volumes, ",") {
+					// the progress is appended to the volume in progress, e.g. "volume-1 (12.34%)"
+					fields := strings.Fields(volume)
+					if len(fields) == 0 {
+						continue
+					}
+					description.Volumes.PodVolumeBackups[key+"/"+fields[0]] = phase
+				}
+			}
+		}
+	}
+	return description, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package velero
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBackupDescription(t *testing.T) {
+	captured, err := os.ReadFile("testdata/backup-describe-details.txt")
+	require.NoError(t, err)
+
+	description, err := parseBackupDescription(string(captured))
+	require.NoError(t, err)
+	assert.Equal(t, "Completed", description.Phase)
+	assert.Equal(t, 12, description.TotalItems)
+	assert.Equal(t, 12, description.ItemsBackedUp)
+	assert.Equal(t, []string{"v1/PersistentVolumeClaim:ns-1/pvc-volume-1"}, description.Resources)
+	assert.Equal(t, 0, description.Warnings)
+	assert.Equal(t, 0, description.Errors)
+	assert.Len(t, description.Volumes.NativeSnapshots, 2)
+	assert.Equal(t, "Failed", description.Volumes.PodVolumeBackups["ns-1/pod-2/volume-3"])
+
+	// only the counts are described when the results were not uploaded
+	description, err = parseBackupDescription("Phase:  PartiallyFailed (run `velero backup logs backup-1` for more information)\n\n" +
+		"Resource List:\n  v1/ConfigMap:\n    - ns-1/cm-1\n\n" +
+		"Errors:    1\nWarnings:  2\n")
+	require.NoError(t, err)
+	assert.Equal(t, "PartiallyFailed", description.Phase)
+	assert.Equal(t, 0, description.TotalItems)
+	assert.Equal(t, 2, description.Warnings)
+	assert.Equal(t, 1, description.Errors)
+
+	_, err = parseBackupDescription("Phase:  Completed\n\nResource List:  <backup resource list not found>\n")
+	assert.Error(t, err)
+}
+
+func TestParseBackupDescriptionJSON(t *testing.T) {
+	captured, err := os.ReadFile("testdata/backup-describe-details.json")
+	require.NoError(t, err)
+
+	description, err := parseBackupDescriptionJSON(string(captured))
+	require.NoError(t, err)
+	sort.Strings(description.Resources)
+	assert.Equal(t, &BackupDescription{
+		Phase:         "PartiallyFailed",
+		TotalItems:    12,
+		ItemsBackedUp: 12,
+		Resources:     []string{"v1/Namespace:ns-1", "v1/PersistentVolumeClaim:ns-1/pvc-volume-1"},
+		Warnings:      3,
+		Errors:        1,
+		Volumes: &BackupVolumeDetails{
+			NativeSnapshots: map[string]NativeSnapshotDetails{
+				"pvc-6f0e9a4e-1": {SnapshotID: "snap-pvc-6f0e9a4e-1", Type: "gp2", AvailabilityZone: "us-east-1a", IOPS: "<N/A>"},
+			},
+			CSISnapshots: map[string]CSISnapshotDetails{
+				"snapcontent-1": {SnapshotHandle: "snap-0a1b2c3d", Size: 1073741824, ReadyToUse: true},
+			},
+			PodVolumeUploader: "kopia",
+			PodVolumeBackups: map[string]string{
+				"ns-1/pod-1/volume-1": "Completed",
+				"ns-1/pod-1/volume-2": "Completed",
+				"ns-1/pod-2/volume-3": "Failed",
+			},
+		},
+	}, description)
+
+	description, err = parseBackupDescriptionJSON(`{"phase": "Completed", "errors": {"count": 0}, "warnings": {"count": 4}}`)
+	require.NoError(t, err)
+	assert.Equal(t, 4, description.Warnings)
+	assert.Equal(t, 0, description.Errors)
+
+	_, err = parseBackupDescriptionJSON(`{"phase": "Completed", "errors": {"errorGettingErrors": {}}, "warnings": {"errorGettingWarnings": {}}}`)
+	assert.Error(t, err)
+	_, err = parseBackupDescriptionJSON("Phase:  Completed\n")
+	assert.Error(t, err)
+}
+
+func TestParseRestoreDescription(t *testing.T) {
+	captured, err := os.ReadFile("testdata/restore-describe.txt")
+	require.NoError(t, err)
+
+	description, err := parseRestoreDescription(string(captured))
+	require.NoError(t, err)
+	assert.Equal(t, &RestoreDescription{
+		Phase:         "PartiallyFailed",
+		TotalItems:    12,
+		ItemsRestored: 12,
+		Warnings:      4,
+		Errors:        2,
+	}, description)
+
+	_, err = parseRestoreDescription("Phase:  Completed\nItems restored:  many\n")
+	assert.Error(t, err)
+}
@@ -36,6 +36,7 @@ import (
 	clientset "k8s.io/client-go/kubernetes"
 
 	"github.com/vmware-tanzu/velero/pkg/cmd/cli/install"
+	veleroinstall "github.com/vmware-tanzu/velero/pkg/install"
 	velerexec "github.com/vmware-tanzu/velero/pkg/util/exec"
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
@@ -52,6 +53,8 @@ type installOptions struct {
 	RegistryCredentialFile string
 	RestoreHelperImage     string
 	VeleroServerDebugMode  bool
+	VeleroServerArgs       []string
+	NodeAgentArgs          []string
 }
 
 func VeleroInstall(ctx context.Context, veleroCfg *VeleroConfig) error {
@@ -79,7 +82,7 @@ func VeleroInstall(ctx context.Context, veleroCfg *VeleroConfig) error {
 		// backup, but needed to pick up the provider plugins earlier.  vSphere plugin no longer needs a Volume
 		// Snapshot location specified
 		veleroCfg.ObjectStoreProvider = "aws"
-		if err := configvSpherePlugin(*veleroCfg.ClientToInstallVelero); err != nil {
+		if err := configvSpherePlugin(*veleroCfg.ClientToInstallVelero, veleroCfg.VeleroNamespace); err != nil {
 			return errors.WithMessagef(err, "Failed to config vsphere plugin")
 		}
 	}
@@ -98,12 +101,28 @@ func VeleroInstall(ctx context.Context, veleroCfg *VeleroConfig) error {
 	veleroInstallOptions.UploaderType = veleroCfg.UploaderType
 	GCFrequency, _ := time.ParseDuration(veleroCfg.GCFrequency)
 	veleroInstallOptions.GarbageCollectionFrequency = GCFrequency
+	repoMaintenanceFrequency, _ := time.ParseDuration(veleroCfg.RepoMaintenanceFrequency)
+	veleroInstallOptions.DefaultRepoMaintenanceFrequency = repoMaintenanceFrequency
+	if len(veleroCfg.NodeAgentPodCPURequest) > 0 {
+		veleroInstallOptions.NodeAgentPodCPURequest = veleroCfg.NodeAgentPodCPURequest
+	}
+	if len(veleroCfg.NodeAgentPodMemRequest) > 0 {
+		veleroInstallOptions.NodeAgentPodMemRequest = veleroCfg.NodeAgentPodMemRequest
+	}
+	if len(veleroCfg.NodeAgentPodCPULimit) > 0 {
+		veleroInstallOptions.NodeAgentPodCPULimit = veleroCfg.NodeAgentPodCPULimit
+	}
+	if len(veleroCfg.NodeAgentPodMemLimit) > 0 {
+		veleroInstallOptions.NodeAgentPodMemLimit = veleroCfg.NodeAgentPodMemLimit
+	}
 
 	err = installVeleroServer(ctx, veleroCfg.VeleroCLI, &installOptions{
 		Options:                veleroInstallOptions,
 		RegistryCredentialFile: veleroCfg.RegistryCredentialFile,
 		RestoreHelperImage:     veleroCfg.RestoreHelperImage,
 		VeleroServerDebugMode:  veleroCfg.VeleroServerDebugMode,
+		VeleroServerArgs:       veleroCfg.VeleroServerArgs,
+		NodeAgentArgs:          veleroCfg.NodeAgentArgs,
 	})
 	if err != nil {
 		RunDebug(context.Background(), veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace, "", "")
@@ -114,34 +133,34 @@ func VeleroInstall(ctx context.Context, veleroCfg *VeleroConfig) error {
 }
 
 // configvSpherePlugin refers to https://github.com/vmware-tanzu/velero-plugin-for-vsphere/blob/v1.3.0/docs/vanilla.md
-func configvSpherePlugin(cli TestClient) error {
+func configvSpherePlugin(cli TestClient, veleroNamespace string) error {
 	var err error
 	vsphereSecret := "velero-vsphere-config-secret"
 	configmaptName := "velero-vsphere-plugin-config"
-	if err := clearupvSpherePluginConfig(cli.ClientGo, VeleroCfg.VeleroNamespace, vsphereSecret, configmaptName); err != nil {
-		return errors.WithMessagef(err, "Failed to clear up vsphere plugin config %s namespace", VeleroCfg.VeleroNamespace)
+	if err := clearupvSpherePluginConfig(cli.ClientGo, veleroNamespace, vsphereSecret, configmaptName); err != nil {
+		return errors.WithMessagef(err, "Failed to clear up vsphere plugin config %s namespace", veleroNamespace)
 	}
-	if err := CreateNamespace(context.Background(), cli, VeleroCfg.VeleroNamespace); err != nil {
-		return errors.WithMessagef(err, "Failed to create Velero %s namespace", VeleroCfg.VeleroNamespace)
+	if err := CreateNamespace(context.Background(), cli, veleroNamespace); err != nil {
+		return errors.WithMessagef(err, "Failed to create Velero %s namespace", veleroNamespace)
 	}
-	if err := createVCCredentialSecret(cli.ClientGo, VeleroCfg.VeleroNamespace); err != nil {
-		return errors.WithMessagef(err, "Failed to create virtual center credential secret in %s namespace", VeleroCfg.VeleroNamespace)
+	if err := createVCCredentialSecret(cli.ClientGo, veleroNamespace); err != nil {
+		return errors.WithMessagef(err, "Failed to create virtual center credential secret in %s namespace", veleroNamespace)
 	}
-	if err := WaitForSecretsComplete(cli.ClientGo, VeleroCfg.VeleroNamespace, vsphereSecret); err != nil {
+	if err := WaitForSecretsComplete(cli.ClientGo, veleroNamespace, vsphereSecret); err != nil {
 		return errors.Wrap(err, "Failed to ensure velero-vsphere-config-secret secret completion in namespace kube-system")
 	}
-	_, err = CreateConfigMap(cli.ClientGo, VeleroCfg.VeleroNamespace, configmaptName, map[string]string{
+	_, err = CreateConfigMap(cli.ClientGo, veleroNamespace, configmaptName, map[string]string{
 		"cluster_flavor":           "VANILLA",
 		"vsphere_secret_name":      vsphereSecret,
-		"vsphere_secret_namespace": VeleroCfg.VeleroNamespace,
+		"vsphere_secret_namespace": veleroNamespace,
 	}, nil)
 	if err != nil {
-		return errors.WithMessagef(err, "Failed to create velero-vsphere-plugin-config configmap in %s namespace", VeleroCfg.VeleroNamespace)
+		return errors.WithMessagef(err, "Failed to create velero-vsphere-plugin-config configmap in %s namespace", veleroNamespace)
 	}
 	fmt.Println("configvSpherePlugin: WaitForConfigMapComplete")
-	err = WaitForConfigMapComplete(cli.ClientGo, VeleroCfg.VeleroNamespace, configmaptName)
+	err = WaitForConfigMapComplete(cli.ClientGo, veleroNamespace, configmaptName)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Failed to ensure configmap %s completion in namespace: %s", configmaptName, VeleroCfg.VeleroNamespace))
+		return errors.Wrap(err, fmt.Sprintf("Failed to ensure configmap %s completion in namespace: %s", configmaptName, veleroNamespace))
 	}
 	return nil
 }
@@ -227,15 +246,51 @@ func installVeleroServer(ctx context.Context, cli string, options *installOption
 		args = append(args, fmt.Sprintf("--garbage-collection-frequency=%v", options.GarbageCollectionFrequency))
 	}
 
+	if options.DefaultRepoMaintenanceFrequency > 0 {
+		args = append(args, fmt.Sprintf("--default-repo-maintain-frequency=%v", options.DefaultRepoMaintenanceFrequency))
+	}
+
 	if len(options.UploaderType) > 0 {
 		args = append(args, fmt.Sprintf("--uploader-type=%v", options.UploaderType))
 	}
 
+	if options.UseNodeAgent || options.UseRestic {
+		if len(options.NodeAgentPodCPURequest) > 0 {
+			args = append(args, "--node-agent-pod-cpu-request", options.NodeAgentPodCPURequest)
+		}
+		if len(options.NodeAgentPodMemRequest) > 0 {
+			args = append(args, "--node-agent-pod-mem-request", options.NodeAgentPodMemRequest)
+		}
+		if len(options.NodeAgentPodCPULimit) > 0 {
+			args = append(args, "--node-agent-pod-cpu-limit", options.NodeAgentPodCPULimit)
+		}
+		if len(options.NodeAgentPodMemLimit) > 0 {
+			args = append(args, "--node-agent-pod-mem-limit", options.NodeAgentPodMemLimit)
+		}
+	}
+
 	if err := createVelereResources(ctx, cli, namespace, args, options); err != nil {
 		return err
 	}
 
-	return waitVeleroReady(ctx, namespace, options.UseNodeAgent)
+	if err := waitVeleroReady(ctx, namespace, options.UseNodeAgent); err != nil {
+		return err
+	}
+
+	// make sure the pods are rolled out with the customized args
+	if err := ContainerArgsShouldContain(ctx, namespace, "deployment", "velero", "velero", veleroServerArgs(options)); err != nil {
+		return err
+	}
+	return ContainerArgsShouldContain(ctx, namespace, "daemonset", "node-agent", "node-agent", options.NodeAgentArgs)
+}
+
+// veleroServerArgs returns the extra args of the velero server container
+func veleroServerArgs(options *installOptions) []string {
+	var args []string
+	if options.VeleroServerDebugMode {
+		args = append(args, "--log-level", "debug")
+	}
+	return append(args, options.VeleroServerArgs...)
 }
 
 func createVelereResources(ctx context.Context, cli, namespace string, args []string, options *installOptions) error {
@@ -306,9 +361,6 @@ func createVelereResources(ctx context.Context, cli, namespace string, args []st
 
 // patch the velero resources
 func patchResources(ctx context.Context, resources *unstructured.UnstructuredList, namespace string, options *installOptions) error {
-	i := 0
-	size := 2
-	var deploy apps.Deployment
 	var imagePullSecret corev1.Secret
 
 	for resourceIndex, resource := range resources.Items {
@@ -346,43 +398,17 @@ func patchResources(ctx context.Context, resources *unstructured.UnstructuredLis
 				return errors.Wrapf(err, "failed to convert pull secret to unstructure")
 			}
 			resources.Items = append(resources.Items, un)
-			i++
-		} else if options.VeleroServerDebugMode && resource.GetKind() == "Deployment" &&
-			resource.GetName() == "velero" {
-			deployJsonStr, err := json.Marshal(resource.Object)
-			if err != nil {
-				return errors.Wrapf(err, "failed to marshal velero deployment")
-			}
-			if err := json.Unmarshal(deployJsonStr, &deploy); err != nil {
-				return errors.Wrapf(err, "failed to unmarshal velero deployment")
-			}
-			veleroDeployIndex := -1
-			for containerIndex, container := range deploy.Spec.Template.Spec.Containers {
-				if container.Name == "velero" {
-					veleroDeployIndex = containerIndex
-					container.Args = append(container.Args, "--log-level", "debug")
-					break
-				}
-			}
-			if veleroDeployIndex >= 0 {
-				deploy.Spec.Template.Spec.Containers[veleroDeployIndex].Args = append(deploy.Spec.Template.Spec.Containers[veleroDeployIndex].Args, "--log-level")
-				deploy.Spec.Template.Spec.Containers[veleroDeployIndex].Args = append(deploy.Spec.Template.Spec.Containers[veleroDeployIndex].Args, "debug")
-				un, err := toUnstructured(deploy)
-				if err != nil {
-					return errors.Wrapf(err, "failed to unstructured velero deployment")
-				}
-				resources.Items = append(resources.Items, un)
-				resources.Items = append(resources.Items[:resourceIndex], resources.Items[resourceIndex+1:]...)
-			} else {
-				return errors.New("failed to get velero container in velero pod")
-			}
-			i++
-		}
-		if i == size {
 			break
 		}
 	}
 
+	if err := patchContainerArgs(resources, "Deployment", "velero", "velero", veleroServerArgs(options)); err != nil {
+		return err
+	}
+	if err := patchContainerArgs(resources, "DaemonSet", "node-agent", "node-agent", options.NodeAgentArgs); err != nil {
+		return err
+	}
+
 	// customize the restic restore helper image
 	if len(options.RestoreHelperImage) > 0 {
 		restoreActionConfig := corev1.ConfigMap{
@@ -414,6 +440,81 @@ func patchResources(ctx context.Context, resources *unstructured.UnstructuredLis
 	return nil
 }
 
+// patchContainerArgs appends the args to the container of the workload in the resources
+func patchContainerArgs(resources *unstructured.UnstructuredList, kind, name, containerName string, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	for i := range resources.Items {
+		resource := &resources.Items[i]
+		if resource.GetKind() != kind || resource.GetName() != name {
+			continue
+		}
+		containers, found, err := unstructured.NestedSlice(resource.Object, "spec", "template", "spec", "containers")
+		if err != nil || !found {
+			return errors.Errorf("failed to get containers of %s %s: %v", kind, name, err)
+		}
+		for j, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok || container["name"] != containerName {
+				continue
+			}
+			existing, _, err := unstructured.NestedStringSlice(container, "args")
+			if err != nil {
+				return errors.Wrapf(err, "failed to get args of container %s in %s %s", containerName, kind, name)
+			}
+			var patched []interface{}
+			for _, arg := range append(existing, args...) {
+				patched = append(patched, arg)
+			}
+			container["args"] = patched
+			containers[j] = container
+			fmt.Printf("args %v appended to container %s of %s %s \n", args, containerName, kind, name)
+			return unstructured.SetNestedSlice(resource.Object, containers, "spec", "template", "spec", "containers")
+		}
+		return errors.Errorf("failed to get container %s in %s %s", containerName, kind, name)
+	}
+	return errors.Errorf("failed to get %s %s in the resources to install", kind, name)
+}
+
+// ContainerArgsShouldContain checks the args are present in the container of the workload, which is
+// "deployment" or "daemonset", after it's rolled out
+func ContainerArgsShouldContain(ctx context.Context, namespace, kind, name, containerName string, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	stdout, stderr, err := velerexec.RunCommand(exec.CommandContext(ctx, "kubectl", "get", kind+"/"+name,
+		"-o", "jsonpath={.spec.template.spec.containers[?(@.name==\""+containerName+"\")].args}", "-n", namespace))
+	if err != nil {
+		return errors.Wrapf(err, "failed to get args of container %s in %s %s, stdout=%s, stderr=%s", containerName, kind, name, stdout, stderr)
+	}
+	var actual []string
+	if err := json.Unmarshal([]byte(stdout), &actual); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal args of container %s in %s %s: %s", containerName, kind, name, stdout)
+	}
+	if !containsArgs(actual, args) {
+		return errors.Errorf("args %v are not present in container %s of %s %s: %v", args, containerName, kind, name, actual)
+	}
+	return nil
+}
+
+// containsArgs returns whether the expected args are present in order in the actual args
+func containsArgs(actual, expected []string) bool {
+	for i := 0; i+len(expected) <= len(actual); i++ {
+		matched := true
+		for j := range expected {
+			if actual[i+j] != expected[j] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
 func toUnstructured(res interface{}) (unstructured.Unstructured, error) {
 	un := unstructured.Unstructured{}
 	data, err := json.Marshal(res)
@@ -460,6 +561,38 @@ func waitVeleroReady(ctx context.Context, namespace string, useNodeAgent bool) e
 	return nil
 }
 
+// RestartNodeAgent restarts the node-agent pods and waits until they are ready, the cache of the
+// backup repositories kept by node-agent is dropped after the restart
+func RestartNodeAgent(ctx context.Context, namespace string) error {
+	stdout, stderr, err := velerexec.RunCommand(exec.CommandContext(ctx, "kubectl", "rollout", "restart",
+		"daemonset/node-agent", "-n", namespace))
+	if err != nil {
+		return errors.Wrapf(err, "failed to restart the node-agent daemonset, stdout=%s, stderr=%s", stdout, stderr)
+	}
+	stdout, stderr, err = velerexec.RunCommand(exec.CommandContext(ctx, "kubectl", "rollout", "status",
+		"daemonset/node-agent", "-n", namespace))
+	if err != nil {
+		return errors.Wrapf(err, "fail to wait for the node-agent daemonset ready, stdout=%s, stderr=%s", stdout, stderr)
+	}
+	return nil
+}
+
+// RestartVeleroServer restarts the Velero server and waits until it's ready, the backups and restores
+// in progress are marked as failed by the restarted server
+func RestartVeleroServer(ctx context.Context, namespace string) error {
+	stdout, stderr, err := velerexec.RunCommand(exec.CommandContext(ctx, "kubectl", "rollout", "restart",
+		"deployment/velero", "-n", namespace))
+	if err != nil {
+		return errors.Wrapf(err, "failed to restart the velero deployment, stdout=%s, stderr=%s", stdout, stderr)
+	}
+	stdout, stderr, err = velerexec.RunCommand(exec.CommandContext(ctx, "kubectl", "rollout", "status",
+		"deployment/velero", "-n", namespace))
+	if err != nil {
+		return errors.Wrapf(err, "fail to wait for the velero deployment ready, stdout=%s, stderr=%s", stdout, stderr)
+	}
+	return nil
+}
+
 func VeleroUninstall(ctx context.Context, cli, namespace string) error {
 	stdout, stderr, err := velerexec.RunCommand(exec.CommandContext(ctx, cli, "uninstall", "--force", "-n", namespace))
 	if err != nil {
@@ -469,6 +602,23 @@ func VeleroUninstall(ctx context.Context, cli, namespace string) error {
 	return nil
 }
 
+// VeleroUninstallInstance uninstalls the Velero instance in the namespace by deleting the namespace and its cluster
+// role binding, the CRDs shared by the other Velero instances in the cluster are kept
+func VeleroUninstallInstance(ctx context.Context, client TestClient, namespace string) error {
+	crb := veleroinstall.ClusterRoleBinding(namespace)
+	if err := client.ClientGo.RbacV1().ClusterRoleBindings().Delete(ctx, crb.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete cluster role binding %s of velero in namespace %s", crb.Name, namespace)
+	}
+	if err := client.ClientGo.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete velero namespace %s", namespace)
+	}
+	if err := WaitForNamespaceDeleted(ctx, client, namespace, 10*time.Minute); err != nil {
+		return errors.Wrapf(err, "failed to wait for velero namespace %s to be deleted", namespace)
+	}
+	fmt.Printf("Velero in namespace %s uninstalled ⛵\n", namespace)
+	return nil
+}
+
 // createVCCredentialSecret refer to https://github.com/vmware-tanzu/velero-plugin-for-vsphere/blob/v1.3.0/docs/vanilla.md
 func createVCCredentialSecret(c clientset.Interface, veleroNamespace string) error {
 	secret, err := getVCCredentialSecret(c)
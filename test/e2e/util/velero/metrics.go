@@ -0,0 +1,169 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package velero
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	kbclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/label"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+)
+
+const (
+	PerfPhaseBackup  = "backup"
+	PerfPhaseRestore = "restore"
+	PerfPhaseDR      = "dr"
+)
+
+// PerfReportFile is the file in the perf report directory the phase metrics are appended to
+const PerfReportFile = "velero-perf.jsonl"
+
+// PhaseMetric is the timing of a backup or restore, which is written into the perf report as a
+// JSON line so that the durations can be compared across the runs to catch the slowdowns
+type PhaseMetric struct {
+	Phase           string    `json:"phase"`
+	BackupName      string    `json:"backupName"`
+	RestoreName     string    `json:"restoreName,omitempty"`
+	Bytes           int64     `json:"bytes"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+// StartPhaseMetric records the start time of the phase, the restore name is empty for backup
+func StartPhaseMetric(phase, backupName, restoreName string) *PhaseMetric {
+	return &PhaseMetric{
+		Phase:       phase,
+		BackupName:  backupName,
+		RestoreName: restoreName,
+		Start:       time.Now(),
+	}
+}
+
+// Finish records the end time of the phase
+func (m *PhaseMetric) Finish() {
+	m.End = time.Now()
+	m.DurationSeconds = m.End.Sub(m.Start).Seconds()
+}
+
+// WritePhaseMetric appends the metric as a JSON line to PerfReportFile in the report directory,
+// nothing is written if the report directory is empty
+func WritePhaseMetric(reportDir string, m *PhaseMetric) error {
+	if err := appendPerfReport(reportDir, m); err != nil {
+		return errors.Wrapf(err, "failed to write %s metric of backup %s", m.Phase, m.BackupName)
+	}
+	fmt.Printf("%s of backup %s took %.1fs for %d bytes\n", m.Phase, m.BackupName, m.DurationSeconds, m.Bytes)
+	return nil
+}
+
+// DRMetric is the recovery time objective and recovery point objective measured by failing over a
+// workload to another cluster.
+// RTO is the time from starting the restore to the workload serving again, and RPO is the time
+// from the last write surviving the restore to the decision of failover.
+type DRMetric struct {
+	Phase              string    `json:"phase"`
+	BackupName         string    `json:"backupName"`
+	RestoreName        string    `json:"restoreName"`
+	BackupStart        time.Time `json:"backupStart"`
+	BackupCompletion   time.Time `json:"backupCompletion"`
+	FailoverDecision   time.Time `json:"failoverDecision"`
+	RestoreStart       time.Time `json:"restoreStart"`
+	WorkloadServing    time.Time `json:"workloadServing"`
+	LastSurvivingWrite time.Time `json:"lastSurvivingWrite"`
+	RTOSeconds         float64   `json:"rtoSeconds"`
+	RPOSeconds         float64   `json:"rpoSeconds"`
+}
+
+// Compute calculates the RTO and RPO from the recorded times
+func (m *DRMetric) Compute() {
+	m.Phase = PerfPhaseDR
+	m.RTOSeconds = m.WorkloadServing.Sub(m.RestoreStart).Seconds()
+	m.RPOSeconds = m.FailoverDecision.Sub(m.LastSurvivingWrite).Seconds()
+}
+
+// Check returns an error if the RTO exceeds maxRTO or the writes before the backup started are lost
+func (m *DRMetric) Check(maxRTO time.Duration) error {
+	if m.LastSurvivingWrite.Before(m.BackupStart.Truncate(time.Second)) {
+		return errors.Errorf("the last surviving write at %s is before backup %s started at %s, the data written before the backup is lost",
+			m.LastSurvivingWrite, m.BackupName, m.BackupStart)
+	}
+	if rto := time.Duration(m.RTOSeconds * float64(time.Second)); rto > maxRTO {
+		return errors.Errorf("RTO %s of restore %s exceeds %s", rto, m.RestoreName, maxRTO)
+	}
+	return nil
+}
+
+// WriteDRMetric appends the metric as a JSON line to PerfReportFile in the report directory,
+// nothing is written if the report directory is empty
+func WriteDRMetric(reportDir string, m *DRMetric) error {
+	fmt.Printf("Restore %s from backup %s: RTO %.1fs, RPO %.1fs\n", m.RestoreName, m.BackupName, m.RTOSeconds, m.RPOSeconds)
+	if err := appendPerfReport(reportDir, m); err != nil {
+		return errors.Wrapf(err, "failed to write DR metric of restore %s", m.RestoreName)
+	}
+	return nil
+}
+
+func appendPerfReport(reportDir string, v interface{}) error {
+	if reportDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(reportDir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create perf report directory %s", reportDir)
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal metric")
+	}
+	path := filepath.Join(reportDir, PerfReportFile)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open perf report %s", path)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return errors.Wrapf(err, "failed to write perf report %s", path)
+	}
+	return nil
+}
+
+// GetBackupBytes returns the total bytes of the pod volume backups of the backup.
+// "velero backup describe" only prints the progress of the pod volume backups in progress, so the
+// bytes are read from the PodVolumeBackups directly, the backups with snapshots only have 0 bytes.
+func GetBackupBytes(ctx context.Context, client TestClient, veleroNamespace, backupName string) (int64, error) {
+	pvbList := new(velerov1api.PodVolumeBackupList)
+	if err := client.Kubebuilder.List(ctx, pvbList, &kbclient.ListOptions{
+		Namespace:     veleroNamespace,
+		LabelSelector: labels.SelectorFromSet(map[string]string{velerov1api.BackupNameLabel: label.GetValidName(backupName)}),
+	}); err != nil {
+		return 0, errors.Wrapf(err, "failed to list PodVolumeBackups of backup %s", backupName)
+	}
+	var bytes int64
+	for _, pvb := range pvbList.Items {
+		bytes += pvb.Status.Progress.TotalBytes
+	}
+	return bytes, nil
+}
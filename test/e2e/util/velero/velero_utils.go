@@ -30,19 +30,28 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	kbclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 
 	ver "k8s.io/apimachinery/pkg/util/version"
 
 	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/builder"
 	cliinstall "github.com/vmware-tanzu/velero/pkg/cmd/cli/install"
 	"github.com/vmware-tanzu/velero/pkg/cmd/util/flag"
+	"github.com/vmware-tanzu/velero/pkg/label"
+	"github.com/vmware-tanzu/velero/pkg/uploader"
 	veleroexec "github.com/vmware-tanzu/velero/pkg/util/exec"
 	. "github.com/vmware-tanzu/velero/test/e2e"
 	common "github.com/vmware-tanzu/velero/test/e2e/util/common"
@@ -54,6 +63,13 @@ const BackupObjectsPrefix = "backups"
 const RestoreObjectsPrefix = "restores"
 const PluginsObjectsPrefix = "plugins"
 
+// the mechanisms a volume could be protected by in a backup
+const (
+	VolumeProtectedByCSISnapshot    = "CSISnapshot"
+	VolumeProtectedByFsBackup       = "FsBackup"
+	VolumeProtectedByNativeSnapshot = "NativeSnapshot"
+)
+
 var pluginsMatrix = map[string]map[string][]string{
 	"v1.4": {
 		"aws":       {"velero/velero-plugin-for-aws:v1.1.0"},
@@ -180,47 +196,342 @@ func getProviderVeleroInstallOptions(veleroCfg *VeleroConfig,
 // checkBackupPhase uses VeleroCLI to inspect the phase of a Velero backup.
 func checkBackupPhase(ctx context.Context, veleroCLI string, veleroNamespace string, backupName string,
 	expectedPhase velerov1api.BackupPhase) error {
+	backup, err := GetBackupObject(ctx, veleroCLI, veleroNamespace, backupName)
+	if err != nil {
+		return err
+	}
+	if backup.Status.Phase != expectedPhase {
+		return errors.Errorf("Unexpected backup phase got %s, expecting %s", backup.Status.Phase, expectedPhase)
+	}
+	return nil
+}
+
+// BackupPhaseShouldBe checks the backup is in the expected phase
+func BackupPhaseShouldBe(ctx context.Context, veleroCLI, veleroNamespace, backupName string, expectedPhase velerov1api.BackupPhase) error {
+	return checkBackupPhase(ctx, veleroCLI, veleroNamespace, backupName, expectedPhase)
+}
+
+// GetBackupObject uses VeleroCLI to get the Velero backup object.
+func GetBackupObject(ctx context.Context, veleroCLI string, veleroNamespace string, backupName string) (*velerov1api.Backup, error) {
 	checkCMD := exec.CommandContext(ctx, veleroCLI, "--namespace", veleroNamespace, "backup", "get", "-o", "json",
 		backupName)
 
 	fmt.Printf("get backup cmd =%v\n", checkCMD)
 	jsonBuf, err := common.CMDExecWithOutput(checkCMD)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	backup := velerov1api.Backup{}
-	err = json.Unmarshal(*jsonBuf, &backup)
+	backup := &velerov1api.Backup{}
+	if err = json.Unmarshal(*jsonBuf, backup); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// GetBackupsBySchedule uses VeleroCLI to get the backups created by the schedule, sorted by
+// the creation time
+func GetBackupsBySchedule(ctx context.Context, veleroCLI, veleroNamespace, scheduleName string) ([]velerov1api.Backup, error) {
+	checkCMD := exec.CommandContext(ctx, veleroCLI, "--namespace", veleroNamespace, "backup", "get", "-o", "json",
+		"--selector", fmt.Sprintf("%s=%s", velerov1api.ScheduleNameLabel, scheduleName))
+	jsonBuf, err := common.CMDExecWithOutput(checkCMD)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if backup.Status.Phase != expectedPhase {
-		return errors.Errorf("Unexpected backup phase got %s, expecting %s", backup.Status.Phase, expectedPhase)
+	// the CLI prints the backup itself rather than a list when there is only one backup
+	typeMeta := metav1.TypeMeta{}
+	if err = json.Unmarshal(*jsonBuf, &typeMeta); err != nil {
+		return nil, err
+	}
+	var backups []velerov1api.Backup
+	if typeMeta.Kind == "Backup" {
+		backup := velerov1api.Backup{}
+		if err = json.Unmarshal(*jsonBuf, &backup); err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	} else {
+		backupList := velerov1api.BackupList{}
+		if err = json.Unmarshal(*jsonBuf, &backupList); err != nil {
+			return nil, err
+		}
+		backups = backupList.Items
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreationTimestamp.Before(&backups[j].CreationTimestamp)
+	})
+	return backups, nil
+}
+
+// WaitForBackupsBySchedule waits until at least the given count of backups created by the
+// schedule are completed, and returns all the backups created by the schedule
+func WaitForBackupsBySchedule(ctx context.Context, veleroCLI, veleroNamespace, scheduleName string, count int, timeout time.Duration) ([]velerov1api.Backup, error) {
+	var backups []velerov1api.Backup
+	err := wait.PollImmediate(30*time.Second, timeout, func() (bool, error) {
+		var err error
+		backups, err = GetBackupsBySchedule(ctx, veleroCLI, veleroNamespace, scheduleName)
+		if err != nil {
+			return false, err
+		}
+		completed := 0
+		for _, backup := range backups {
+			if backup.Status.Phase == velerov1api.BackupPhaseCompleted {
+				completed++
+			}
+		}
+		fmt.Printf("%d of %d backups created by schedule %s are completed, expecting %d\n", completed, len(backups), scheduleName, count)
+		return completed >= count, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to wait for %d backups created by schedule %s", count, scheduleName)
+	}
+	return backups, nil
+}
+
+// WaitForBackupsByScheduleFinished waits until all the backups created by the schedule are in the final
+// phases, and returns them
+func WaitForBackupsByScheduleFinished(ctx context.Context, veleroCLI, veleroNamespace, scheduleName string, timeout time.Duration) ([]velerov1api.Backup, error) {
+	var backups []velerov1api.Backup
+	err := wait.PollImmediate(30*time.Second, timeout, func() (bool, error) {
+		var err error
+		backups, err = GetBackupsBySchedule(ctx, veleroCLI, veleroNamespace, scheduleName)
+		if err != nil {
+			return false, err
+		}
+		for _, backup := range backups {
+			if !isBackupPhaseFinal(backup.Status.Phase) {
+				fmt.Printf("Backup %s created by schedule %s is %s\n", backup.Name, scheduleName, backup.Status.Phase)
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to wait for the backups created by schedule %s to be finished", scheduleName)
+	}
+	return backups, nil
+}
+
+// LatestCompletedBackup returns the latest completed one of the backups sorted by the creation time, nil is
+// returned if none of them is completed
+func LatestCompletedBackup(backups []velerov1api.Backup) *velerov1api.Backup {
+	for i := len(backups) - 1; i >= 0; i-- {
+		if backups[i].Status.Phase == velerov1api.BackupPhaseCompleted {
+			return &backups[i]
+		}
 	}
 	return nil
 }
 
-// checkRestorePhase uses VeleroCLI to inspect the phase of a Velero restore.
-func checkRestorePhase(ctx context.Context, veleroCLI string, veleroNamespace string, restoreName string,
-	expectedPhase velerov1api.RestorePhase) error {
+// GetRestoreObject uses VeleroCLI to get the Velero restore object.
+func GetRestoreObject(ctx context.Context, veleroCLI string, veleroNamespace string, restoreName string) (*velerov1api.Restore, error) {
 	checkCMD := exec.CommandContext(ctx, veleroCLI, "--namespace", veleroNamespace, "restore", "get", "-o", "json",
 		restoreName)
 
 	fmt.Printf("get restore cmd =%v\n", checkCMD)
 	jsonBuf, err := common.CMDExecWithOutput(checkCMD)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	restore := &velerov1api.Restore{}
+	if err = json.Unmarshal(*jsonBuf, restore); err != nil {
+		return nil, err
 	}
-	restore := velerov1api.Restore{}
-	err = json.Unmarshal(*jsonBuf, &restore)
+	return restore, nil
+}
+
+// WaitForRestoreCompletion waits until the restore is in one of the final phases, and returns the restore
+func WaitForRestoreCompletion(ctx context.Context, veleroCLI, veleroNamespace, restoreName string, timeout time.Duration) (*velerov1api.Restore, error) {
+	var restore *velerov1api.Restore
+	err := wait.PollImmediate(10*time.Second, timeout, func() (bool, error) {
+		var err error
+		restore, err = GetRestoreObject(ctx, veleroCLI, veleroNamespace, restoreName)
+		if err != nil {
+			return false, err
+		}
+		if isRestorePhaseFinal(restore.Status.Phase) {
+			return true, nil
+		}
+		fmt.Printf("Restore %s is in phase %s, still waiting...\n", restoreName, restore.Status.Phase)
+		return false, nil
+	})
 	if err != nil {
-		return err
+		return nil, errors.Wrapf(err, "failed to wait for restore %s to be completed", restoreName)
+	}
+	return restore, nil
+}
+
+// WaitForBackupCompletion waits for the backup to be finished and returns it
+func WaitForBackupCompletion(ctx context.Context, veleroCLI, veleroNamespace, backupName string, timeout time.Duration) (*velerov1api.Backup, error) {
+	var backup *velerov1api.Backup
+	err := wait.PollImmediate(10*time.Second, timeout, func() (bool, error) {
+		var err error
+		backup, err = GetBackupObject(ctx, veleroCLI, veleroNamespace, backupName)
+		if err != nil {
+			return false, err
+		}
+		if isBackupPhaseFinal(backup.Status.Phase) {
+			return true, nil
+		}
+		fmt.Printf("Backup %s is in phase %s, still waiting...\n", backupName, backup.Status.Phase)
+		return false, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to wait for backup %s to be completed", backupName)
+	}
+	return backup, nil
+}
+
+// defaultPhaseTimeout is the time to wait for the phase of the backup or restore created by the CLI helpers when
+// there is no deadline in the context
+const defaultPhaseTimeout = time.Hour
+
+// phaseTimeout returns the time left before the deadline of the context or defaultPhaseTimeout
+func phaseTimeout(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return defaultPhaseTimeout
+}
+
+func isBackupPhaseFinal(phase velerov1api.BackupPhase) bool {
+	switch phase {
+	case velerov1api.BackupPhaseCompleted, velerov1api.BackupPhasePartiallyFailed,
+		velerov1api.BackupPhaseFailed, velerov1api.BackupPhaseFailedValidation:
+		return true
+	}
+	return false
+}
+
+func isRestorePhaseFinal(phase velerov1api.RestorePhase) bool {
+	switch phase {
+	case velerov1api.RestorePhaseCompleted, velerov1api.RestorePhasePartiallyFailed,
+		velerov1api.RestorePhaseFailed, velerov1api.RestorePhaseFailedValidation:
+		return true
+	}
+	return false
+}
+
+// WaitForBackupPhase waits for the backup to be in the expected phase and returns it, the phase could be an
+// intermediate one like InProgress or WaitingForPluginOperations. It fails without waiting for the timeout
+// once the backup is finished in another phase
+func WaitForBackupPhase(ctx context.Context, veleroCLI, veleroNamespace, backupName string, expectedPhase velerov1api.BackupPhase,
+	timeout time.Duration) (*velerov1api.Backup, error) {
+	var backup *velerov1api.Backup
+	err := wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		var err error
+		backup, err = GetBackupObject(ctx, veleroCLI, veleroNamespace, backupName)
+		if err != nil {
+			return false, err
+		}
+		if backup.Status.Phase == expectedPhase {
+			return true, nil
+		}
+		if isBackupPhaseFinal(backup.Status.Phase) {
+			return false, errors.Errorf("Unexpected backup phase got %s, expecting %s", backup.Status.Phase, expectedPhase)
+		}
+		fmt.Printf("Backup %s is in phase %q, waiting for it to be %s...\n", backupName, backup.Status.Phase, expectedPhase)
+		return false, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to wait for backup %s to be %s", backupName, expectedPhase)
+	}
+	return backup, nil
+}
+
+// WaitForBackupWithProgress polls the backup by the client until it's finished and returns its final phase,
+// logFn is called whenever the phase or the progress of the backup changes. It returns once the backup is
+// finished in any phase, so a failed backup is reported without waiting for the timeout
+func WaitForBackupWithProgress(ctx context.Context, client TestClient, namespace, backupName string, timeout time.Duration,
+	logFn BackupProgressFunc) (velerov1api.BackupPhase, error) {
+	var phase velerov1api.BackupPhase
+	var progress velerov1api.BackupProgress
+	reported := false
+	err := wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		backup := new(velerov1api.Backup)
+		if err := client.Kubebuilder.Get(ctx, kbclient.ObjectKey{Namespace: namespace, Name: backupName}, backup); err != nil {
+			return false, errors.Wrapf(err, "failed to get backup %s", backupName)
+		}
+		current := velerov1api.BackupProgress{}
+		if backup.Status.Progress != nil {
+			current = *backup.Status.Progress
+		}
+		if !reported || backup.Status.Phase != phase || current != progress {
+			phase, progress, reported = backup.Status.Phase, current, true
+			if logFn != nil {
+				logFn(backupName, phase, progress)
+			}
+		}
+		return isBackupPhaseFinal(phase), nil
+	})
+	if err != nil {
+		return phase, errors.Wrapf(err, "failed to wait for backup %s to be finished, last in phase %q with %d/%d items backed up",
+			backupName, phase, progress.ItemsBackedUp, progress.TotalItems)
+	}
+	return phase, nil
+}
+
+// PrintBackupProgress is a BackupProgressFunc printing the progress of the backup
+func PrintBackupProgress(backupName string, phase velerov1api.BackupPhase, progress velerov1api.BackupProgress) {
+	fmt.Printf("Backup %s is in phase %q with %d/%d items backed up\n", backupName, phase, progress.ItemsBackedUp, progress.TotalItems)
+}
+
+// WaitForRestorePhase waits for the restore to be in the expected phase and returns it, the same as
+// WaitForBackupPhase
+func WaitForRestorePhase(ctx context.Context, veleroCLI, veleroNamespace, restoreName string, expectedPhase velerov1api.RestorePhase,
+	timeout time.Duration) (*velerov1api.Restore, error) {
+	var restore *velerov1api.Restore
+	err := wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		var err error
+		restore, err = GetRestoreObject(ctx, veleroCLI, veleroNamespace, restoreName)
+		if err != nil {
+			return false, err
+		}
+		if restore.Status.Phase == expectedPhase {
+			return true, nil
+		}
+		if isRestorePhaseFinal(restore.Status.Phase) {
+			return false, errors.Errorf("Unexpected restore phase got %s, expecting %s", restore.Status.Phase, expectedPhase)
+		}
+		fmt.Printf("Restore %s is in phase %q, waiting for it to be %s...\n", restoreName, restore.Status.Phase, expectedPhase)
+		return false, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to wait for restore %s to be %s", restoreName, expectedPhase)
 	}
-	if restore.Status.Phase != expectedPhase {
-		return errors.Errorf("Unexpected restore phase got %s, expecting %s", restore.Status.Phase, expectedPhase)
+	return restore, nil
+}
+
+// CreateBackupWithOrSelectors creates the backup of the namespaces with the resources matching
+// any of the label selectors. There is no flag of the OR label selectors in the velero CLI, so
+// the backup is created through the API directly
+func CreateBackupWithOrSelectors(ctx context.Context, client TestClient, veleroNamespace, backupName string,
+	namespaces []string, orSelectors []map[string]string) error {
+	var selectors []*metav1.LabelSelector
+	for _, s := range orSelectors {
+		selectors = append(selectors, &metav1.LabelSelector{MatchLabels: s})
+	}
+	backup := builder.ForBackup(veleroNamespace, backupName).IncludedNamespaces(namespaces...).
+		OrLabelSelector(selectors).Result()
+	fmt.Printf("Create backup %s of namespaces %v with OR label selectors %v\n", backupName, namespaces, orSelectors)
+	if err := client.Kubebuilder.Create(ctx, backup); err != nil {
+		return errors.Wrapf(err, "failed to create backup %s", backupName)
 	}
 	return nil
 }
 
+// GetBackupTotalItems returns the total number of items to be backed up in the status of the
+// backup, which is the "Total items to be backed up" of "velero backup describe"
+func GetBackupTotalItems(ctx context.Context, veleroCLI, veleroNamespace, backupName string) (int, error) {
+	backup, err := GetBackupObject(ctx, veleroCLI, veleroNamespace, backupName)
+	if err != nil {
+		return 0, err
+	}
+	if backup.Status.Progress == nil {
+		return 0, nil
+	}
+	return backup.Status.Progress.TotalItems, nil
+}
+
 func checkSchedulePhase(ctx context.Context, veleroCLI, veleroNamespace, scheduleName string) error {
 	return wait.PollImmediate(time.Second*5, time.Minute*2, func() (bool, error) {
 		checkCMD := exec.CommandContext(ctx, veleroCLI, "--namespace", veleroNamespace, "schedule", "get", scheduleName, "-ojson")
@@ -282,6 +593,21 @@ func CheckScheduleWithResourceOrder(ctx context.Context, veleroCLI, veleroNamesp
 	}
 }
 
+// GetOrderedResourcesArg converts the map of resource kind to resource names into the
+// value of "--ordered-resources" flag, the kinds are sorted to make the value stable
+func GetOrderedResourcesArg(order map[string]string) string {
+	var kinds []string
+	for kind := range order {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	var orderList []string
+	for _, kind := range kinds {
+		orderList = append(orderList, fmt.Sprintf("%s=%s", kind, order[kind]))
+	}
+	return strings.Join(orderList, ";")
+}
+
 func CheckBackupWithResourceOrder(ctx context.Context, veleroCLI, veleroNamespace, backupName string, order map[string]string) error {
 	checkCMD := exec.CommandContext(ctx, veleroCLI, "--namespace", veleroNamespace, "get", "backup", backupName, "-ojson")
 	jsonBuf, err := common.CMDExecWithOutput(checkCMD)
@@ -303,16 +629,102 @@ func CheckBackupWithResourceOrder(ctx context.Context, veleroCLI, veleroNamespac
 	}
 }
 
-// VeleroBackupNamespace uses the veleroCLI to backup a namespace.
+// BackupExecHookAnnotations returns the pod annotations defining the pre and post backup exec hooks which run
+// the commands in the container, the hook of an empty command isn't defined
+func BackupExecHookAnnotations(container string, preCommand, postCommand []string) (map[string]string, error) {
+	ann := map[string]string{}
+	for phase, command := range map[string][]string{"pre": preCommand, "post": postCommand} {
+		if len(command) == 0 {
+			continue
+		}
+		// the shell redirections are kept readable in the annotations rather than escaped as HTML
+		buf := new(bytes.Buffer)
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(command); err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal command of %s backup hook", phase)
+		}
+		ann[phase+".hook.backup.velero.io/container"] = container
+		ann[phase+".hook.backup.velero.io/command"] = strings.TrimSpace(buf.String())
+	}
+	return ann, nil
+}
+
+// VeleroBackupNamespace uses the veleroCLI to backup a namespace. The backup is waited for by its progress
+// when backupCfg has a progress callback, or by its phase otherwise
 func VeleroBackupNamespace(ctx context.Context, veleroCLI, veleroNamespace string, backupCfg BackupConfig) error {
+	args := getBackupNamespaceArgs(veleroNamespace, backupCfg)
+	if backupCfg.ProgressFn == nil || backupCfg.ProgressClient == nil {
+		return VeleroBackupExec(ctx, veleroCLI, veleroNamespace, backupCfg.BackupName, args)
+	}
+	if err := VeleroCmdExec(ctx, veleroCLI, withRunLabel(args)); err != nil {
+		return err
+	}
+	phase, err := WaitForBackupWithProgress(ctx, *backupCfg.ProgressClient, veleroNamespace, backupCfg.BackupName,
+		phaseTimeout(ctx), backupCfg.ProgressFn)
+	if err != nil {
+		return err
+	}
+	if phase != velerov1api.BackupPhaseCompleted {
+		return errors.Errorf("Unexpected backup phase got %s, expecting %s", phase, velerov1api.BackupPhaseCompleted)
+	}
+	return nil
+}
+
+// VeleroBackupNamespaceExpectPhase is the same as VeleroBackupNamespace but expects the backup
+// to be finished in the specified phase, e.g. PartiallyFailed
+func VeleroBackupNamespaceExpectPhase(ctx context.Context, veleroCLI, veleroNamespace string, backupCfg BackupConfig,
+	expectedPhase velerov1api.BackupPhase) error {
+	args := getBackupNamespaceArgs(veleroNamespace, backupCfg)
+	if err := VeleroCmdExec(ctx, veleroCLI, withRunLabel(args)); err != nil {
+		return err
+	}
+	_, err := WaitForBackupPhase(ctx, veleroCLI, veleroNamespace, backupCfg.BackupName, expectedPhase, phaseTimeout(ctx))
+	return err
+}
+
+// BackupResult is the result of the backup created by the CLI, which is returned rather than an error when the
+// backup isn't completed
+type BackupResult struct {
+	Phase            velerov1api.BackupPhase
+	ValidationErrors []string
+	// Stderr is the standard error of the CLI creating the backup
+	Stderr string
+}
+
+// VeleroBackupNamespaceWithResult is the same as VeleroBackupNamespace but returns the result of the backup
+// finished in any phase, so the failed backups could be checked by the callers. An error is only returned
+// when the backup can't be created or waited for, the stderr of the CLI is kept in the result for both cases
+func VeleroBackupNamespaceWithResult(ctx context.Context, veleroCLI, veleroNamespace string, backupCfg BackupConfig) (*BackupResult, error) {
+	args := getBackupNamespaceArgs(veleroNamespace, backupCfg)
+	cmd := exec.CommandContext(ctx, veleroCLI, withRunLabel(args)...)
+	fmt.Printf("velero cmd =%v\n", cmd)
+	_, stderr, err := veleroexec.RunCommand(cmd)
+	result := &BackupResult{Stderr: stderr}
+	if err != nil {
+		return result, errors.Wrapf(err, "failed to create backup %s, stderr=%s", backupCfg.BackupName, stderr)
+	}
+	backup, err := WaitForBackupCompletion(ctx, veleroCLI, veleroNamespace, backupCfg.BackupName, phaseTimeout(ctx))
+	if err != nil {
+		return result, err
+	}
+	result.Phase = backup.Status.Phase
+	result.ValidationErrors = backup.Status.ValidationErrors
+	return result, nil
+}
+
+// getBackupNamespaceArgs returns the arguments of velero CLI to create the backup defined by backupCfg
+func getBackupNamespaceArgs(veleroNamespace string, backupCfg BackupConfig) []string {
 	args := []string{
 		"--namespace", veleroNamespace,
 		"create", "backup", backupCfg.BackupName,
-		"--wait",
 	}
 	if backupCfg.Namespace != "" {
 		args = append(args, "--include-namespaces", backupCfg.Namespace)
 	}
+	if len(backupCfg.ExcludedNamespaces) > 0 {
+		args = append(args, "--exclude-namespaces", strings.Join(backupCfg.ExcludedNamespaces, ","))
+	}
 	if backupCfg.Selector != "" {
 		args = append(args, "--selector", backupCfg.Selector)
 	}
@@ -343,6 +755,9 @@ func VeleroBackupNamespace(ctx context.Context, veleroCLI, veleroNamespace strin
 	if backupCfg.TTL != 0 {
 		args = append(args, "--ttl", backupCfg.TTL.String())
 	}
+	if backupCfg.ItemOperationTimeout != 0 {
+		args = append(args, "--item-operation-timeout", backupCfg.ItemOperationTimeout.String())
+	}
 
 	if backupCfg.IncludeResources != "" {
 		args = append(args, "--include-resources", backupCfg.IncludeResources)
@@ -356,22 +771,25 @@ func VeleroBackupNamespace(ctx context.Context, veleroCLI, veleroNamespace strin
 		args = append(args, "--include-cluster-resources")
 	}
 
-	if backupCfg.OrderedResources != "" {
-		args = append(args, "--ordered-resources", backupCfg.OrderedResources)
+	if len(backupCfg.OrderedResources) > 0 {
+		args = append(args, "--ordered-resources", GetOrderedResourcesArg(backupCfg.OrderedResources))
+	}
+
+	if backupCfg.ResourcePoliciesConfigmap != "" {
+		args = append(args, "--resource-policies-configmap", backupCfg.ResourcePoliciesConfigmap)
 	}
 
-	return VeleroBackupExec(ctx, veleroCLI, veleroNamespace, backupCfg.BackupName, args)
+	return args
 }
 
 // VeleroBackupExcludeNamespaces uses the veleroCLI to backup a namespace.
 func VeleroBackupExcludeNamespaces(ctx context.Context, veleroCLI string, veleroNamespace string, backupName string, excludeNamespaces []string) error {
-	namespaces := strings.Join(excludeNamespaces, ",")
-	args := []string{
-		"--namespace", veleroNamespace, "create", "backup", backupName,
-		"--exclude-namespaces", namespaces,
-		"--default-volumes-to-fs-backup", "--wait",
+	backupCfg := BackupConfig{
+		BackupName:               backupName,
+		ExcludedNamespaces:       excludeNamespaces,
+		DefaultVolumesToFsBackup: true,
 	}
-	return VeleroBackupExec(ctx, veleroCLI, veleroNamespace, backupName, args)
+	return VeleroBackupNamespace(ctx, veleroCLI, veleroNamespace, backupCfg)
 }
 
 // VeleroBackupIncludeNamespaces uses the veleroCLI to backup a namespace.
@@ -380,36 +798,118 @@ func VeleroBackupIncludeNamespaces(ctx context.Context, veleroCLI string, velero
 	args := []string{
 		"--namespace", veleroNamespace, "create", "backup", backupName,
 		"--include-namespaces", namespaces,
-		"--default-volumes-to-fs-backup", "--wait",
+		"--default-volumes-to-fs-backup",
 	}
 	return VeleroBackupExec(ctx, veleroCLI, veleroNamespace, backupName, args)
 }
 
 // VeleroRestore uses the VeleroCLI to restore from a Velero backup.
 func VeleroRestore(ctx context.Context, veleroCLI, veleroNamespace, restoreName, backupName, includeResources string) error {
+	return VeleroRestoreWithConfig(ctx, veleroCLI, veleroNamespace, RestoreConfig{
+		RestoreName:       restoreName,
+		BackupName:        backupName,
+		IncludedResources: includeResources,
+	})
+}
+
+// VeleroRestoreWithNamespaceMappings uses the VeleroCLI to restore from a Velero backup into the
+// namespaces mapped from the source namespaces
+func VeleroRestoreWithNamespaceMappings(ctx context.Context, veleroCLI, veleroNamespace, restoreName, backupName string,
+	namespaceMappings map[string]string) error {
+	return VeleroRestoreWithConfig(ctx, veleroCLI, veleroNamespace, RestoreConfig{
+		RestoreName:       restoreName,
+		BackupName:        backupName,
+		NamespaceMappings: namespaceMappings,
+	})
+}
+
+// VeleroRestoreWithExistingResourcePolicy uses the VeleroCLI to restore from a Velero backup with
+// the policy applied to the resources which already exist in cluster
+func VeleroRestoreWithExistingResourcePolicy(ctx context.Context, veleroCLI, veleroNamespace, restoreName, backupName string,
+	policy velerov1api.PolicyType) error {
+	return VeleroRestoreWithConfig(ctx, veleroCLI, veleroNamespace, RestoreConfig{
+		RestoreName:            restoreName,
+		BackupName:             backupName,
+		ExistingResourcePolicy: string(policy),
+	})
+}
+
+// VeleroRestoreWithConfig uses the VeleroCLI to restore the restore defined by restoreCfg and expects it
+// to be completed
+func VeleroRestoreWithConfig(ctx context.Context, veleroCLI, veleroNamespace string, restoreCfg RestoreConfig) error {
+	args := getRestoreArgs(veleroNamespace, restoreCfg)
+	return VeleroRestoreExec(ctx, veleroCLI, veleroNamespace, restoreCfg.RestoreName, args, velerov1api.RestorePhaseCompleted)
+}
+
+// getRestoreArgs returns the arguments of velero CLI to create the restore defined by restoreCfg
+func getRestoreArgs(veleroNamespace string, restoreCfg RestoreConfig) []string {
 	args := []string{
-		"--namespace", veleroNamespace, "create", "restore", restoreName,
-		"--from-backup", backupName, "--wait",
+		"--namespace", veleroNamespace, "create", "restore", restoreCfg.RestoreName,
+		"--from-backup", restoreCfg.BackupName,
 	}
-	if includeResources != "" {
-		args = append(args, "--include-resources", includeResources)
+	if restoreCfg.IncludedResources != "" {
+		args = append(args, "--include-resources", restoreCfg.IncludedResources)
 	}
-	return VeleroRestoreExec(ctx, veleroCLI, veleroNamespace, restoreName, args, velerov1api.RestorePhaseCompleted)
+	if restoreCfg.ExcludedResources != "" {
+		args = append(args, "--exclude-resources", restoreCfg.ExcludedResources)
+	}
+	if len(restoreCfg.NamespaceMappings) > 0 {
+		var mappings []string
+		for src, dst := range restoreCfg.NamespaceMappings {
+			mappings = append(mappings, src+":"+dst)
+		}
+		sort.Strings(mappings)
+		args = append(args, "--namespace-mappings", strings.Join(mappings, ","))
+	}
+	if restoreCfg.ExistingResourcePolicy != "" {
+		args = append(args, "--existing-resource-policy", restoreCfg.ExistingResourcePolicy)
+	}
+	return args
 }
 
+// RestoreLabelsShouldBe checks the object is labeled with the names of the backup and restore,
+// which are added to the objects created by the restore or updated by the update policy
+func RestoreLabelsShouldBe(obj metav1.Object, backupName, restoreName string) error {
+	expected := map[string]string{
+		velerov1api.BackupNameLabel:  label.GetValidName(backupName),
+		velerov1api.RestoreNameLabel: label.GetValidName(restoreName),
+	}
+	for k, v := range expected {
+		if obj.GetLabels()[k] != v {
+			return errors.Errorf("label %s of %s in namespace %s is %q, expecting %q", k, obj.GetName(), obj.GetNamespace(), obj.GetLabels()[k], v)
+		}
+	}
+	return nil
+}
+
+// VeleroRestoreExec creates the restore by the args and waits for it to be in the expected phase, the args
+// don't need "--wait" as the phase of the restore is polled
 func VeleroRestoreExec(ctx context.Context, veleroCLI, veleroNamespace, restoreName string, args []string, phaseExpect velerov1api.RestorePhase) error {
 	if err := VeleroCmdExec(ctx, veleroCLI, args); err != nil {
 		return err
 	}
-
-	return checkRestorePhase(ctx, veleroCLI, veleroNamespace, restoreName, phaseExpect)
+	_, err := WaitForRestorePhase(ctx, veleroCLI, veleroNamespace, restoreName, phaseExpect, phaseTimeout(ctx))
+	return err
 }
 
+// VeleroBackupExec creates the backup by the args and waits for it to be completed, the args don't need
+// "--wait" as the phase of the backup is polled
 func VeleroBackupExec(ctx context.Context, veleroCLI string, veleroNamespace string, backupName string, args []string) error {
-	if err := VeleroCmdExec(ctx, veleroCLI, args); err != nil {
+	if err := VeleroCmdExec(ctx, veleroCLI, withRunLabel(args)); err != nil {
 		return err
 	}
-	return checkBackupPhase(ctx, veleroCLI, veleroNamespace, backupName, velerov1api.BackupPhaseCompleted)
+	_, err := WaitForBackupPhase(ctx, veleroCLI, veleroNamespace, backupName, velerov1api.BackupPhaseCompleted, phaseTimeout(ctx))
+	return err
+}
+
+// RunLabel is the label of the backups created by the test run with the UUID of the run, Velero tags the
+// snapshots of the backups with the labels of the backups, so the snapshots leaked by the run are looked up
+// by it without touching the snapshots of the backups of the same name created by the other runs
+const RunLabel = "e2e-run"
+
+// withRunLabel returns the arguments of velero CLI creating the backup with RunLabel added
+func withRunLabel(args []string) []string {
+	return append(append([]string{}, args...), "--labels", RunLabel+"="+UUIDgen.String())
 }
 
 func VeleroBackupDelete(ctx context.Context, veleroCLI string, veleroNamespace string, backupName string) error {
@@ -471,34 +971,651 @@ func VeleroCmdExec(ctx context.Context, veleroCLI string, args []string) error {
 	return err
 }
 
-func VeleroBackupLogs(ctx context.Context, veleroCLI string, veleroNamespace string, backupName string) error {
-	args := []string{
-		"--namespace", veleroNamespace, "backup", "describe", backupName,
+// VeleroBackupLogs returns the output of "velero backup logs"
+func VeleroBackupLogs(ctx context.Context, veleroCLI, veleroNamespace, backupName string) (string, error) {
+	args := []string{"--namespace", veleroNamespace, "backup", "logs", backupName}
+	stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, veleroCLI, args...))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get logs of backup %s, stderr=%s", backupName, stderr)
 	}
-	if err := VeleroCmdExec(ctx, veleroCLI, args); err != nil {
+	return stdout, nil
+}
+
+// VeleroRestoreLogs returns the output of "velero restore logs"
+func VeleroRestoreLogs(ctx context.Context, veleroCLI, veleroNamespace, restoreName string) (string, error) {
+	args := []string{"--namespace", veleroNamespace, "restore", "logs", restoreName}
+	stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, veleroCLI, args...))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get logs of restore %s, stderr=%s", restoreName, stderr)
+	}
+	return stdout, nil
+}
+
+// APIGroupVersionFallbacks returns the lines of restore logs reporting the API group version of the
+// resource falls back to a lower priority with the EnableAPIGroupVersions feature, the resource is
+// formatted as resource.group
+func APIGroupVersionFallbacks(restoreLogs, resource string) []string {
+	var fallbacks []string
+	for _, line := range strings.Split(restoreLogs, "\n") {
+		if strings.Contains(line, "Cannot find") && strings.Contains(line, "for "+resource) {
+			fallbacks = append(fallbacks, line)
+		}
+	}
+	return fallbacks
+}
+
+// GetVeleroServerLogs returns the logs of the Velero server
+func GetVeleroServerLogs(ctx context.Context, veleroNamespace string) (string, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", "logs", "-n", veleroNamespace, "deployment/velero")
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get logs of Velero server, stderr=%s", stderr)
+	}
+	return stdout, nil
+}
+
+// GetNodeAgentLogs returns the logs of all the node-agent pods, each line is prefixed with the pod name
+func GetNodeAgentLogs(ctx context.Context, veleroNamespace string) (string, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", "logs", "-n", veleroNamespace, "-l", "name=node-agent",
+		"--tail=-1", "--prefix")
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get logs of node-agent, stderr=%s", stderr)
+	}
+	return stdout, nil
+}
+
+// VeleroBackupDescribe returns the output of "velero backup describe"
+func VeleroBackupDescribe(ctx context.Context, veleroCLI, veleroNamespace, backupName string, details bool) (string, error) {
+	args := []string{"--namespace", veleroNamespace, "backup", "describe", backupName}
+	if details {
+		args = append(args, "--details")
+	}
+	stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, veleroCLI, args...))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to describe backup %s, stderr=%s", backupName, stderr)
+	}
+	return stdout, nil
+}
+
+// VeleroRestoreDescribe returns the output of "velero restore describe"
+func VeleroRestoreDescribe(ctx context.Context, veleroCLI, veleroNamespace, restoreName string, details bool) (string, error) {
+	args := []string{"--namespace", veleroNamespace, "restore", "describe", restoreName}
+	if details {
+		args = append(args, "--details")
+	}
+	stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, veleroCLI, args...))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to describe restore %s, stderr=%s", restoreName, stderr)
+	}
+	return stdout, nil
+}
+
+// GetRestoreResult returns the counts of the warnings and errors of the restore according to the output
+// of "velero restore describe"
+func GetRestoreResult(ctx context.Context, veleroCLI, veleroNamespace, restoreName string) (int, int, error) {
+	output, err := VeleroRestoreDescribe(ctx, veleroCLI, veleroNamespace, restoreName, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	warnings, errs, err := parseRestoreResult(output)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to parse the result of restore %s", restoreName)
+	}
+	return warnings, errs, nil
+}
+
+// parseRestoreResult counts the messages in the "Warnings" and "Errors" sections of the output of
+// "velero restore describe", which are omitted when there is no warning or error, e.g.
+//
+//	Warnings:
+//	  Velero:     <none>
+//	  Cluster:  could not restore, CustomResourceDefinition "foos.example.io" already exists...
+//	  Namespaces:
+//	    ns-1:  could not restore, ConfigMap "cm-1" already exists...
+//	           could not restore, Secret "secret-1" already exists...
+func parseRestoreResult(output string) (int, int, error) {
+	counts := map[string]int{}
+	section := ""
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			section = ""
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			section = ""
+			for _, name := range []string{"Warnings", "Errors"} {
+				if !strings.HasPrefix(trimmed, name+":") {
+					continue
+				}
+				if value := strings.TrimSpace(strings.TrimPrefix(trimmed, name+":")); value != "" {
+					// the results can't be downloaded or decoded
+					return 0, 0, errors.Errorf("failed to get the %s of restore: %s", strings.ToLower(name), value)
+				}
+				section = name
+			}
+			continue
+		}
+		if section == "" {
+			continue
+		}
+		// the message follows the label of Velero, Cluster or namespace in the first line of a slice,
+		// and the following lines of the slice are the messages only
+		message := trimmed
+		if label, value, found := strings.Cut(trimmed, ":"); found && !strings.Contains(label, " ") {
+			message = strings.TrimSpace(value)
+		}
+		if message == "" || message == "<none>" {
+			continue
+		}
+		counts[section]++
+	}
+	return counts["Warnings"], counts["Errors"], nil
+}
+
+// GetBackupContents returns the keys of the resources included in the backup according to the
+// resource list of "velero backup describe --details", each key is in the format of
+// "<group/version/kind>:<namespace/name>" for the namespaced resources or
+// "<group/version/kind>:<name>" for the cluster scoped resources, e.g. "v1/ConfigMap:ns-1/cm-1"
+func GetBackupContents(ctx context.Context, veleroCLI, veleroNamespace, backupName string) ([]string, error) {
+	output, err := VeleroBackupDescribe(ctx, veleroCLI, veleroNamespace, backupName, true)
+	if err != nil {
+		return nil, err
+	}
+	return parseBackupResourceList(output)
+}
+
+func parseBackupResourceList(output string) ([]string, error) {
+	var contents []string
+	inResourceList := false
+	gvk := ""
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !inResourceList {
+			if strings.HasPrefix(trimmed, "Resource List:") {
+				if trimmed != "Resource List:" {
+					return nil, errors.Errorf("failed to get the resource list of backup: %s", strings.TrimSpace(strings.TrimPrefix(trimmed, "Resource List:")))
+				}
+				inResourceList = true
+			}
+			continue
+		}
+		// the resource list ends with an empty line or the next section without indent
+		if trimmed == "" || trimmed == line {
+			break
+		}
+		if strings.HasPrefix(trimmed, "- ") {
+			if gvk == "" {
+				return nil, errors.Errorf("no group version kind for the resource %q in resource list", trimmed)
+			}
+			contents = append(contents, gvk+":"+strings.TrimPrefix(trimmed, "- "))
+			continue
+		}
+		gvk = strings.TrimSuffix(trimmed, ":")
+	}
+	if !inResourceList {
+		return nil, errors.New("no resource list in the output of backup describe")
+	}
+	return contents, nil
+}
+
+// BackupContentsShouldMatchSelector checks the configmaps, secrets, services, pods and
+// deployments in the namespaces are included in the backup if and only if they match the label
+// selector, the other kinds of resources in the backup are ignored
+func BackupContentsShouldMatchSelector(ctx context.Context, client TestClient, veleroCLI, veleroNamespace, backupName string,
+	namespaces []string, selector string) error {
+	contents, err := GetBackupContents(ctx, veleroCLI, veleroNamespace, backupName)
+	if err != nil {
 		return err
 	}
-	args = []string{
-		"--namespace", veleroNamespace, "backup", "logs", backupName,
+	included := map[string]bool{}
+	for _, c := range contents {
+		included[c] = true
 	}
-	return VeleroCmdExec(ctx, veleroCLI, args)
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse label selector %q", selector)
+	}
+
+	for _, ns := range namespaces {
+		objects := map[string]map[string]string{}
+		configMaps, err := client.ClientGo.CoreV1().ConfigMaps(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list configmaps in namespace %s", ns)
+		}
+		for _, o := range configMaps.Items {
+			objects["v1/ConfigMap:"+ns+"/"+o.Name] = o.Labels
+		}
+		secrets, err := client.ClientGo.CoreV1().Secrets(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list secrets in namespace %s", ns)
+		}
+		for _, o := range secrets.Items {
+			objects["v1/Secret:"+ns+"/"+o.Name] = o.Labels
+		}
+		services, err := client.ClientGo.CoreV1().Services(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list services in namespace %s", ns)
+		}
+		for _, o := range services.Items {
+			objects["v1/Service:"+ns+"/"+o.Name] = o.Labels
+		}
+		pods, err := client.ClientGo.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list pods in namespace %s", ns)
+		}
+		for _, o := range pods.Items {
+			objects["v1/Pod:"+ns+"/"+o.Name] = o.Labels
+		}
+		deployments, err := client.ClientGo.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list deployments in namespace %s", ns)
+		}
+		for _, o := range deployments.Items {
+			objects["apps/v1/Deployment:"+ns+"/"+o.Name] = o.Labels
+		}
+
+		for key, objLabels := range objects {
+			matched := sel.Matches(labels.Set(objLabels))
+			if matched && !included[key] {
+				return errors.Errorf("%s matches the label selector %q but isn't included in backup %s", key, selector, backupName)
+			}
+			if !matched && included[key] {
+				return errors.Errorf("%s doesn't match the label selector %q but is included in backup %s", key, selector, backupName)
+			}
+		}
+	}
+	fmt.Printf("Resources in backup %s match the label selector %q\n", backupName, selector)
+	return nil
+}
+
+// ParseDescribeOutput parses the output of "velero backup/restore describe" into the map of the top level
+// sections, the value of a section contains its inline value and the indented lines under it
+func ParseDescribeOutput(output string) map[string]string {
+	sections := map[string]string{}
+	var key string
+	var value []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			if index := strings.Index(line, ":"); index > 0 {
+				if key != "" {
+					sections[key] = strings.Join(value, "\n")
+				}
+				key = strings.TrimSpace(line[:index])
+				value = []string{}
+				if v := strings.TrimSpace(line[index+1:]); v != "" {
+					value = append(value, v)
+				}
+				continue
+			}
+		}
+		if key != "" {
+			value = append(value, strings.TrimSpace(line))
+		}
+	}
+	if key != "" {
+		sections[key] = strings.Join(value, "\n")
+	}
+	return sections
+}
+
+// NativeSnapshotDetails is a Velero-native snapshot in the output of "velero backup describe --details"
+type NativeSnapshotDetails struct {
+	SnapshotID       string
+	Type             string
+	AvailabilityZone string
+	IOPS             string
+}
+
+// CSISnapshotDetails is a CSI snapshot in the output of "velero backup describe --details"
+type CSISnapshotDetails struct {
+	SnapshotHandle string
+	Size           int64
+	ReadyToUse     bool
+}
+
+// BackupVolumeDetails is the volume information in the output of "velero backup describe --details"
+type BackupVolumeDetails struct {
+	// NativeSnapshots is keyed by the name of the snapshotted PV
+	NativeSnapshots map[string]NativeSnapshotDetails
+	// CSISnapshots is keyed by the name of the VolumeSnapshotContent
+	CSISnapshots map[string]CSISnapshotDetails
+	// PodVolumeUploader is the uploader type of the pod volume backups such as restic or kopia
+	PodVolumeUploader string
+	// PodVolumeBackups is the phase of the pod volume backups keyed by "<namespace>/<pod>/<volume>"
+	PodVolumeBackups map[string]string
+}
+
+var podVolumeBackupsHeader = regexp.MustCompile(`^(\S+) Backups:$`)
+
+// ParseBackupVolumeDetails parses the sections of Velero-native snapshots, CSI snapshots and pod volume
+// backups in the output of "velero backup describe --details", the sections missing in the output
+// such as "<none included>" are left empty
+func ParseBackupVolumeDetails(output string) (*BackupVolumeDetails, error) {
+	details := &BackupVolumeDetails{
+		NativeSnapshots:  map[string]NativeSnapshotDetails{},
+		CSISnapshots:     map[string]CSISnapshotDetails{},
+		PodVolumeBackups: map[string]string{},
+	}
+	const (
+		sectionNone = iota
+		sectionNative
+		sectionCSI
+		sectionPodVolume
+	)
+	section := sectionNone
+	// current is the PV of native snapshot, the VolumeSnapshotContent or the phase of pod volume backups
+	current := ""
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		key, value := trimmed, ""
+		if index := strings.Index(trimmed, ":"); index >= 0 {
+			key, value = strings.TrimSpace(trimmed[:index]), strings.TrimSpace(trimmed[index+1:])
+		}
+		indented := trimmed != line
+		// the VolumeSnapshotContents are listed without indent in the CSI section
+		if section == sectionCSI && !indented && key == "Snapshot Content Name" {
+			current = value
+			details.CSISnapshots[current] = CSISnapshotDetails{}
+			continue
+		}
+		if !indented {
+			section, current = sectionNone, ""
+			switch {
+			case trimmed == "Velero-Native Snapshots:":
+				section = sectionNative
+			case trimmed == "CSI Volume Snapshots:":
+				section = sectionCSI
+			case podVolumeBackupsHeader.MatchString(trimmed):
+				section = sectionPodVolume
+				details.PodVolumeUploader = podVolumeBackupsHeader.FindStringSubmatch(trimmed)[1]
+			case strings.HasPrefix(trimmed, "Velero-Native Snapshots:"), strings.HasPrefix(trimmed, "CSI Volume Snapshots:"):
+				if strings.HasPrefix(value, "<error") {
+					return nil, errors.Errorf("failed to get the volume information of backup: %s", trimmed)
+				}
+			}
+			continue
+		}
+
+		switch section {
+		case sectionNative:
+			if value == "" && strings.HasSuffix(trimmed, ":") {
+				current = key
+				details.NativeSnapshots[current] = NativeSnapshotDetails{}
+				continue
+			}
+			if current == "" {
+				return nil, errors.Errorf("no PV for the native snapshot field %q", trimmed)
+			}
+			snapshot := details.NativeSnapshots[current]
+			switch key {
+			case "Snapshot ID":
+				snapshot.SnapshotID = value
+			case "Type":
+				snapshot.Type = value
+			case "Availability Zone":
+				snapshot.AvailabilityZone = value
+			case "IOPS":
+				snapshot.IOPS = value
+			}
+			details.NativeSnapshots[current] = snapshot
+		case sectionCSI:
+			if current == "" {
+				return nil, errors.Errorf("no VolumeSnapshotContent for the CSI snapshot field %q", trimmed)
+			}
+			snapshot := details.CSISnapshots[current]
+			switch key {
+			case "Storage Snapshot ID":
+				snapshot.SnapshotHandle = value
+			case "Snapshot Size (bytes)":
+				size, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid size of VolumeSnapshotContent %s", current)
+				}
+				snapshot.Size = size
+			case "Ready to use":
+				snapshot.ReadyToUse = value == "true"
+			}
+			details.CSISnapshots[current] = snapshot
+		case sectionPodVolume:
+			if value == "" && strings.HasSuffix(trimmed, ":") {
+				current = key
+				continue
+			}
+			if current == "" {
+				return nil, errors.Errorf("no phase for the pod volume backups %q", trimmed)
+			}
+			for _, volume := range strings.Split(value, ",") {
+				// the progress is appended to the volume in progress, e.g. "volume-1 (12.34%)"
+				fields := strings.Fields(volume)
+				if len(fields) == 0 {
+					continue
+				}
+				details.PodVolumeBackups[key+"/"+fields[0]] = current
+			}
+		}
+	}
+	return details, nil
+}
+
+// BackupVolumeDetailsShouldMatch checks the volume information in the output of "velero backup describe --details"
+// lists every PVC in the namespace protected by the data path, and cross-checks the information
+// against the PodVolumeBackups, VolumeSnapshotContents or the status of backup.
+// The describe output doesn't tell the PVCs, so they are matched by the PVs of native snapshots, the
+// volume handles of the VolumeSnapshotContents and the PVC UIDs of the PodVolumeBackups.
+func BackupVolumeDetailsShouldMatch(ctx context.Context, client TestClient, veleroCLI, veleroNamespace, namespace, backupName, dataPath string) error {
+	output, err := VeleroBackupDescribe(ctx, veleroCLI, veleroNamespace, backupName, true)
+	if err != nil {
+		return err
+	}
+	details, err := ParseBackupVolumeDetails(output)
+	if err != nil {
+		return err
+	}
+	pvcList, err := client.ClientGo.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list PVCs in namespace %s", namespace)
+	}
+	if len(pvcList.Items) == 0 {
+		return errors.Errorf("no PVC in namespace %s", namespace)
+	}
+
+	switch dataPath {
+	case VolumeProtectedByNativeSnapshot:
+		backup, err := GetBackupObject(ctx, veleroCLI, veleroNamespace, backupName)
+		if err != nil {
+			return err
+		}
+		if len(details.NativeSnapshots) != backup.Status.VolumeSnapshotsCompleted {
+			return errors.Errorf("%d native snapshots are described while %d are completed in backup %s",
+				len(details.NativeSnapshots), backup.Status.VolumeSnapshotsCompleted, backupName)
+		}
+		for _, pvc := range pvcList.Items {
+			snapshot, ok := details.NativeSnapshots[pvc.Spec.VolumeName]
+			if !ok {
+				return errors.Errorf("no native snapshot of PV %s of PVC %s is described", pvc.Spec.VolumeName, pvc.Name)
+			}
+			if snapshot.SnapshotID == "" {
+				return errors.Errorf("no snapshot ID of PV %s of PVC %s is described", pvc.Spec.VolumeName, pvc.Name)
+			}
+		}
+	case VolumeProtectedByCSISnapshot:
+		vscList, err := util.GetVolumeSnapshotContentsOfBackup(backupName)
+		if err != nil {
+			return err
+		}
+		if len(details.CSISnapshots) != len(vscList) {
+			return errors.Errorf("%d CSI snapshots are described while backup %s has %d VolumeSnapshotContents",
+				len(details.CSISnapshots), backupName, len(vscList))
+		}
+		vscByVolumeHandle := map[string]string{}
+		for _, vsc := range vscList {
+			snapshot, ok := details.CSISnapshots[vsc.Name]
+			if !ok {
+				return errors.Errorf("VolumeSnapshotContent %s is not described", vsc.Name)
+			}
+			if vsc.Status == nil || vsc.Status.SnapshotHandle == nil || *vsc.Status.SnapshotHandle != snapshot.SnapshotHandle {
+				return errors.Errorf("snapshot handle %q of VolumeSnapshotContent %s doesn't match the status", snapshot.SnapshotHandle, vsc.Name)
+			}
+			if vsc.Status.RestoreSize != nil && *vsc.Status.RestoreSize != snapshot.Size {
+				return errors.Errorf("size %d of VolumeSnapshotContent %s doesn't match %d in status", snapshot.Size, vsc.Name, *vsc.Status.RestoreSize)
+			}
+			if !snapshot.ReadyToUse {
+				return errors.Errorf("VolumeSnapshotContent %s is not ready to use", vsc.Name)
+			}
+			if vsc.Spec.Source.VolumeHandle != nil {
+				vscByVolumeHandle[*vsc.Spec.Source.VolumeHandle] = vsc.Name
+			}
+		}
+		for _, pvc := range pvcList.Items {
+			pv, err := GetPersistentVolume(ctx, client, "", pvc.Spec.VolumeName)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get PV of PVC %s", pvc.Name)
+			}
+			if pv.Spec.CSI == nil {
+				return errors.Errorf("PV %s of PVC %s is not provisioned by CSI driver", pv.Name, pvc.Name)
+			}
+			if _, ok := vscByVolumeHandle[pv.Spec.CSI.VolumeHandle]; !ok {
+				return errors.Errorf("no CSI snapshot of PVC %s is described", pvc.Name)
+			}
+		}
+	case VolumeProtectedByFsBackup:
+		pvbList := new(velerov1api.PodVolumeBackupList)
+		if err := client.Kubebuilder.List(ctx, pvbList, &kbclient.ListOptions{
+			Namespace:     veleroNamespace,
+			LabelSelector: labels.SelectorFromSet(map[string]string{velerov1api.BackupNameLabel: label.GetValidName(backupName)}),
+		}); err != nil {
+			return errors.Wrapf(err, "failed to list PodVolumeBackups of backup %s", backupName)
+		}
+		if len(details.PodVolumeBackups) != len(pvbList.Items) {
+			return errors.Errorf("%d pod volume backups are described while backup %s has %d PodVolumeBackups",
+				len(details.PodVolumeBackups), backupName, len(pvbList.Items))
+		}
+		pvbByPVCUID := map[string]string{}
+		for _, pvb := range pvbList.Items {
+			key := fmt.Sprintf("%s/%s/%s", pvb.Spec.Pod.Namespace, pvb.Spec.Pod.Name, pvb.Spec.Volume)
+			phase, ok := details.PodVolumeBackups[key]
+			if !ok {
+				return errors.Errorf("PodVolumeBackup %s of %s is not described", pvb.Name, key)
+			}
+			if phase != string(pvb.Status.Phase) {
+				return errors.Errorf("phase %s of %s is described while PodVolumeBackup %s is %s", phase, key, pvb.Name, pvb.Status.Phase)
+			}
+			if details.PodVolumeUploader != pvb.Spec.UploaderType {
+				return errors.Errorf("uploader %s is described while PodVolumeBackup %s is uploaded by %s",
+					details.PodVolumeUploader, pvb.Name, pvb.Spec.UploaderType)
+			}
+			pvbByPVCUID[pvb.Labels[velerov1api.PVCUIDLabel]] = pvb.Name
+		}
+		for _, pvc := range pvcList.Items {
+			if _, ok := pvbByPVCUID[string(pvc.UID)]; !ok {
+				return errors.Errorf("no pod volume backup of PVC %s is described", pvc.Name)
+			}
+		}
+	default:
+		return errors.Errorf("unknown data path %s", dataPath)
+	}
+	fmt.Printf("Volume information of backup %s matches the %s of PVCs in namespace %s\n", backupName, dataPath, namespace)
+	return nil
 }
 
 func RunDebug(ctx context.Context, veleroCLI, veleroNamespace, backup, restore string) {
-	output := fmt.Sprintf("debug-bundle-%d.tar.gz", time.Now().UnixNano())
-	args := []string{"debug", "--namespace", veleroNamespace, "--output", output, "--verbose"}
-	if len(backup) > 0 {
-		args = append(args, "--backup", backup)
+	if _, err := CollectDebugBundle(ctx, veleroCLI, veleroNamespace, backup, restore); err != nil {
+		fmt.Println(err)
 	}
-	if len(restore) > 0 {
-		//args = append(args, "--restore", restore)
+}
+
+// RunDebugWithNodeAgent runs RunDebug and also saves the logs of the node-agent pods into files, the
+// debug bundle doesn't include the node-agent logs which are needed to triage the fs-backup failures.
+// Only the node-agent pods on the nodes the pod volume backups and restores ran on are dumped, or all
+// of them if the nodes are unknown.
+func RunDebugWithNodeAgent(ctx context.Context, veleroCLI, veleroNamespace, backup, restore string) {
+	RunDebug(ctx, veleroCLI, veleroNamespace, backup, restore)
+
+	nodes, err := getDataPathNodes(ctx, veleroNamespace, backup, restore)
+	if err != nil {
+		fmt.Println(errors.Wrap(err, "failed to get the nodes of the data path, dump all node-agent pods"))
 	}
-	fmt.Printf("Generating the debug tarball at %s\n", output)
-	if err := VeleroCmdExec(ctx, veleroCLI, args); err != nil {
-		fmt.Println(errors.Wrapf(err, "failed to run the debug command"))
+	args := []string{"get", "pods", "-n", veleroNamespace, "-l", "name=node-agent", "-o", "jsonpath={.items[*].metadata.name}"}
+	var pods []string
+	if len(nodes) == 0 {
+		stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", args...))
+		if err != nil {
+			fmt.Println(errors.Wrapf(err, "failed to get node-agent pods, stderr=%s", stderr))
+			return
+		}
+		pods = strings.Fields(stdout)
+	}
+	for _, node := range nodes {
+		stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl",
+			append(args, "--field-selector", "spec.nodeName="+node)...))
+		if err != nil {
+			fmt.Println(errors.Wrapf(err, "failed to get node-agent pod on node %s, stderr=%s", node, stderr))
+			continue
+		}
+		pods = append(pods, strings.Fields(stdout)...)
+	}
+
+	for _, pod := range pods {
+		output := fmt.Sprintf("node-agent-logs-%s-%d.log", pod, time.Now().UnixNano())
+		stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "logs", "-n", veleroNamespace, pod, "--tail=-1"))
+		if err != nil {
+			fmt.Println(errors.Wrapf(err, "failed to get logs of node-agent pod %s, stderr=%s", pod, stderr))
+			continue
+		}
+		if err := os.WriteFile(output, []byte(stdout), 0644); err != nil {
+			fmt.Println(errors.Wrapf(err, "failed to write logs of node-agent pod %s", pod))
+			continue
+		}
+		fmt.Printf("Saved the logs of node-agent pod %s at %s\n", pod, output)
 	}
 }
 
+// getDataPathNodes returns the nodes the pod volume backups of the backup and the pod volume restores
+// of the restore ran on, the node of pod volume restore is the node of the restored pod
+func getDataPathNodes(ctx context.Context, veleroNamespace, backup, restore string) ([]string, error) {
+	nodes := sets.NewString()
+	if backup != "" {
+		stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "get", "podvolumebackups",
+			"-n", veleroNamespace, "-l", velerov1api.BackupNameLabel+"="+label.GetValidName(backup),
+			"-o", "jsonpath={.items[*].spec.node}"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get PodVolumeBackups of backup %s, stderr=%s", backup, stderr)
+		}
+		nodes.Insert(strings.Fields(stdout)...)
+	}
+	if restore != "" {
+		stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "get", "podvolumerestores",
+			"-n", veleroNamespace, "-l", velerov1api.RestoreNameLabel+"="+label.GetValidName(restore),
+			"-o", "jsonpath={range .items[*]}{.spec.pod.namespace}{\" \"}{.spec.pod.name}{\"\\n\"}{end}"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get PodVolumeRestores of restore %s, stderr=%s", restore, stderr)
+		}
+		for _, line := range strings.Split(stdout, "\n") {
+			pod := strings.Fields(line)
+			if len(pod) != 2 {
+				continue
+			}
+			nodeName, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "get", "pod", "-n", pod[0], pod[1],
+				"-o", "jsonpath={.spec.nodeName}"))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get node of pod %s/%s, stderr=%s", pod[0], pod[1], stderr)
+			}
+			if nodeName = strings.TrimSpace(nodeName); nodeName != "" {
+				nodes.Insert(nodeName)
+			}
+		}
+	}
+	return nodes.List(), nil
+}
+
 func VeleroCreateBackupLocation(ctx context.Context,
 	veleroCLI,
 	veleroNamespace,
@@ -517,18 +1634,191 @@ func VeleroCreateBackupLocation(ctx context.Context,
 		"--bucket", bucket,
 	}
 
-	if prefix != "" {
-		args = append(args, "--prefix", prefix)
+	if prefix != "" {
+		args = append(args, "--prefix", prefix)
+	}
+
+	if config != "" {
+		args = append(args, "--config", config)
+	}
+
+	if secretName != "" && secretKey != "" {
+		args = append(args, "--credential", fmt.Sprintf("%s=%s", secretName, secretKey))
+	}
+	return VeleroCmdExec(ctx, veleroCLI, args)
+}
+
+// PatchBackupStorageLocation applies the JSON merge patch to the backup storage location by kubectl
+func PatchBackupStorageLocation(ctx context.Context, veleroNamespace, bslName, patch string) error {
+	cmd := exec.CommandContext(ctx, "kubectl", "patch", "-n", veleroNamespace, "backupstoragelocations.velero.io", bslName,
+		"--type", "merge", "-p", patch)
+	fmt.Printf("Patch backup storage location cmd =%v\n", cmd)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		return errors.Wrapf(err, "failed to patch backup storage location %s, stdout=%s, stderr=%s", bslName, stdout, stderr)
+	}
+	return nil
+}
+
+// SetBackupStorageLocationAccessMode sets the access mode of the backup storage location
+func SetBackupStorageLocationAccessMode(ctx context.Context, veleroNamespace, bslName string, mode velerov1api.BackupStorageLocationAccessMode) error {
+	return PatchBackupStorageLocation(ctx, veleroNamespace, bslName, fmt.Sprintf(`{"spec":{"accessMode":"%s"}}`, mode))
+}
+
+// ParseBackupStorageLocations parses the output of "velero backup-location get -o json", which is the
+// backup storage location itself rather than a list when there is only one location
+func ParseBackupStorageLocations(jsonBuf []byte) ([]velerov1api.BackupStorageLocation, error) {
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(jsonBuf, &typeMeta); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the output of backup-location get")
+	}
+	if typeMeta.Kind == "BackupStorageLocation" {
+		bsl := velerov1api.BackupStorageLocation{}
+		if err := json.Unmarshal(jsonBuf, &bsl); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the output of backup-location get")
+		}
+		return []velerov1api.BackupStorageLocation{bsl}, nil
+	}
+	bslList := velerov1api.BackupStorageLocationList{}
+	if err := json.Unmarshal(jsonBuf, &bslList); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the output of backup-location get")
+	}
+	return bslList.Items, nil
+}
+
+// ParseBackupRepositories decodes the JSON output of "velero repo get", which is the repository itself
+// rather than a list when there is only one repository
+func ParseBackupRepositories(jsonBuf []byte) ([]velerov1api.BackupRepository, error) {
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(jsonBuf, &typeMeta); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the output of repo get")
+	}
+	if typeMeta.Kind == "BackupRepository" {
+		repo := velerov1api.BackupRepository{}
+		if err := json.Unmarshal(jsonBuf, &repo); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the output of repo get")
+		}
+		return []velerov1api.BackupRepository{repo}, nil
+	}
+	repoList := velerov1api.BackupRepositoryList{}
+	if err := json.Unmarshal(jsonBuf, &repoList); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the output of repo get")
+	}
+	return repoList.Items, nil
+}
+
+// GetBackupRepositoriesByCLI uses VeleroCLI to get the backup repositories for the volumes in the namespace
+func GetBackupRepositoriesByCLI(ctx context.Context, veleroCLI, veleroNamespace, volumeNamespace string) ([]velerov1api.BackupRepository, error) {
+	checkCMD := exec.CommandContext(ctx, veleroCLI, "--namespace", veleroNamespace, "repo", "get", "-o", "json",
+		"--selector", fmt.Sprintf("%s=%s", velerov1api.VolumeNamespaceLabel, label.GetValidName(volumeNamespace)))
+	jsonBuf, err := common.CMDExecWithOutput(checkCMD)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBackupRepositories(*jsonBuf)
+}
+
+// GetBackupStorageLocation uses VeleroCLI to get the backup storage location
+func GetBackupStorageLocation(ctx context.Context, veleroCLI, veleroNamespace, bslName string) (*velerov1api.BackupStorageLocation, error) {
+	checkCMD := exec.CommandContext(ctx, veleroCLI, "--namespace", veleroNamespace, "backup-location", "get", "-o", "json", bslName)
+	jsonBuf, err := common.CMDExecWithOutput(checkCMD)
+	if err != nil {
+		return nil, err
+	}
+	bsls, err := ParseBackupStorageLocations(*jsonBuf)
+	if err != nil {
+		return nil, err
+	}
+	if len(bsls) != 1 {
+		return nil, errors.Errorf("expected 1 backup storage location %s, got %d", bslName, len(bsls))
+	}
+	return &bsls[0], nil
+}
+
+// WaitForBSLPhase waits until the backup storage location is validated to be in the phase
+func WaitForBSLPhase(ctx context.Context, veleroCLI, veleroNamespace, bslName string,
+	phase velerov1api.BackupStorageLocationPhase, timeout time.Duration) error {
+	err := wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		bsl, err := GetBackupStorageLocation(ctx, veleroCLI, veleroNamespace, bslName)
+		if err != nil {
+			return false, err
+		}
+		if bsl.Status.Phase != phase {
+			fmt.Printf("Backup storage location %s is in phase %q, waiting for it to be %s...\n", bslName, bsl.Status.Phase, phase)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for backup storage location %s to be %s", bslName, phase)
+	}
+	fmt.Printf("Backup storage location %s is %s\n", bslName, phase)
+	return nil
+}
+
+// WaitForBSLAvailable waits for the backup storage location to be Available
+func WaitForBSLAvailable(ctx context.Context, veleroCLI, veleroNamespace, bslName string, timeout time.Duration) error {
+	return WaitForBSLPhase(ctx, veleroCLI, veleroNamespace, bslName, velerov1api.BackupStorageLocationPhaseAvailable, timeout)
+}
+
+// GetObjectStoreProvider returns the provider of the object store of the default BSL, which is different from
+// the cloud provider when the BSL is served by an S3-compatible object store on kind, e.g. MinIO
+func GetObjectStoreProvider(veleroCfg VeleroConfig) string {
+	if veleroCfg.ObjectStoreProvider != "" {
+		return veleroCfg.ObjectStoreProvider
 	}
+	return veleroCfg.CloudProvider
+}
 
-	if config != "" {
-		args = append(args, "--config", config)
+// AdditionalBSLSecret returns the name of the secret created by SetupAdditionalBSL and the key of the
+// additional BSL credentials in it
+func AdditionalBSLSecret(veleroCfg VeleroConfig, uuid string) (string, string) {
+	return fmt.Sprintf("bsl-credentials-%s", uuid), fmt.Sprintf("creds-%s", veleroCfg.AdditionalBSLProvider)
+}
+
+// SetupAdditionalBSL installs the plugins of the additional BSL provider, creates the secret with
+// the additional BSL credentials and the backup location using it. The returned cleanup function
+// deletes the backup location and the secret.
+func SetupAdditionalBSL(ctx context.Context, veleroCfg VeleroConfig, uuid string) (string, func(), error) {
+	if err := VeleroAddPluginsForProvider(ctx, veleroCfg.VeleroCLI, veleroCfg.VeleroNamespace,
+		veleroCfg.AdditionalBSLProvider, veleroCfg.AddBSLPlugins, veleroCfg.Features); err != nil {
+		return "", nil, errors.Wrapf(err, "failed to add plugins for provider %s", veleroCfg.AdditionalBSLProvider)
 	}
 
-	if secretName != "" && secretKey != "" {
-		args = append(args, "--credential", fmt.Sprintf("%s=%s", secretName, secretKey))
+	bslName := fmt.Sprintf("bsl-%s", uuid)
+	secretName, secretKey := AdditionalBSLSecret(veleroCfg, uuid)
+	files := map[string]string{
+		secretKey: veleroCfg.AdditionalBSLCredentials,
 	}
-	return VeleroCmdExec(ctx, veleroCLI, args)
+	if err := CreateSecretFromFiles(ctx, *veleroCfg.ClientToInstallVelero, veleroCfg.VeleroNamespace, secretName, files); err != nil {
+		return "", nil, errors.Wrapf(err, "failed to create secret %s for additional BSL", secretName)
+	}
+	cleanup := func() {
+		args := []string{"--namespace", veleroCfg.VeleroNamespace, "delete", "backup-location", bslName, "--confirm"}
+		if err := VeleroCmdExec(context.Background(), veleroCfg.VeleroCLI, args); err != nil {
+			fmt.Println(errors.Wrapf(err, "failed to delete backup location %s", bslName))
+		}
+		if err := veleroCfg.ClientToInstallVelero.ClientGo.CoreV1().Secrets(veleroCfg.VeleroNamespace).Delete(
+			context.Background(), secretName, metav1.DeleteOptions{}); err != nil {
+			fmt.Println(errors.Wrapf(err, "failed to delete secret %s", secretName))
+		}
+	}
+
+	if err := VeleroCreateBackupLocation(ctx,
+		veleroCfg.VeleroCLI,
+		veleroCfg.VeleroNamespace,
+		bslName,
+		veleroCfg.AdditionalBSLProvider,
+		veleroCfg.AdditionalBSLBucket,
+		veleroCfg.AdditionalBSLPrefix,
+		veleroCfg.AdditionalBSLConfig,
+		secretName,
+		secretKey,
+	); err != nil {
+		cleanup()
+		return "", nil, errors.Wrapf(err, "failed to create additional BSL %s", bslName)
+	}
+	return bslName, cleanup, nil
 }
 
 func VeleroVersion(ctx context.Context, veleroCLI, veleroNamespace string) error {
@@ -595,26 +1885,101 @@ func VeleroAddPluginsForProvider(ctx context.Context, veleroCLI string, veleroNa
 	return nil
 }
 
-// WaitForVSphereUploadCompletion waits for uploads started by the Velero Plug-in for vSphere to complete
+// VSphereSnapshotStatus is the status of a snapshot taken by the Velero Plug-in for vSphere, which is
+// uploaded to the durable storage after the local snapshot completes
+type VSphereSnapshotStatus struct {
+	Name       string
+	PVC        string
+	Phase      string
+	BytesDone  int64
+	TotalBytes int64
+	// SnapshotID is the ID of the uploaded snapshot decoded from the status, it's empty before the
+	// local snapshot completes
+	SnapshotID string
+}
+
+// Percent returns the percent of the bytes uploaded, or -1 if the total bytes are unknown yet
+func (s VSphereSnapshotStatus) Percent() float64 {
+	if s.TotalBytes <= 0 {
+		return -1
+	}
+	return float64(s.BytesDone) * 100 / float64(s.TotalBytes)
+}
+
+func (s VSphereSnapshotStatus) String() string {
+	progress := "unknown"
+	if percent := s.Percent(); percent >= 0 {
+		progress = fmt.Sprintf("%.1f%% (%d/%d bytes)", percent, s.BytesDone, s.TotalBytes)
+	}
+	return fmt.Sprintf("snapshot %s of PVC %s: phase %s, progress %s", s.Name, s.PVC, s.Phase, progress)
+}
+
+// vsphereSnapshotStatusQuery is the jsonpath query of the snapshots of the Velero Plug-in for vSphere, each line is
+// "<snapshot>=<pvc>=<phase>=<bytes done>=<total bytes>=<snapshot id>"
+const vsphereSnapshotStatusQuery = `-o=jsonpath='{range .items[*]}{.metadata.name}{"="}{.spec.resourceHandle.name}{"="}{.status.phase}{"="}{.status.progress.bytesDone}{"="}{.status.progress.totalBytes}{"="}{.status.snapshotID}{"\n"}{end}'`
+
+// ParseVSphereSnapshotStatuses parses the output of vsphereSnapshotStatusQuery, the snapshot ID is the last
+// field as its base64 encoded part may end with "=" paddings
+func ParseVSphereSnapshotStatuses(output string) []VSphereSnapshotStatus {
+	var statuses []VSphereSnapshotStatus
+	for _, line := range strings.Split(strings.Trim(output, "'"), "\n") {
+		comps := strings.SplitN(strings.TrimSpace(line), "=", 6)
+		if len(comps) < 5 {
+			continue
+		}
+		status := VSphereSnapshotStatus{Name: comps[0], PVC: comps[1], Phase: comps[2]}
+		// the progress is empty before the upload starts
+		status.BytesDone, _ = strconv.ParseInt(comps[3], 10, 64)
+		status.TotalBytes, _ = strconv.ParseInt(comps[4], 10, 64)
+		if len(comps) == 6 {
+			status.SnapshotID = decodeVSphereSnapshotID(comps[5])
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// decodeVSphereSnapshotID decodes the ID of the snapshot in the bucket from the snapshot ID in the status,
+// which ends with the base64 encoded ID after the last ":"
+func decodeVSphereSnapshotID(snapshotID string) string {
+	if snapshotID == "" {
+		return ""
+	}
+	decoded, _ := b64.StdEncoding.DecodeString(snapshotID[strings.LastIndex(snapshotID, ":")+1:])
+	return string(decoded)
+}
+
+// GetVSphereSnapshotStatuses returns the statuses of the snapshots taken by the Velero Plug-in for vSphere
+// in the namespace
+func GetVSphereSnapshotStatuses(ctx context.Context, namespace string) ([]VSphereSnapshotStatus, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", "get", "-n", namespace, "snapshots.backupdriver.cnsdp.vmware.com",
+		vsphereSnapshotStatusQuery)
+	stdout, stderr, err := veleroexec.RunCommand(cmd)
+	if err != nil {
+		fmt.Print(stdout)
+		fmt.Print(stderr)
+		return nil, errors.Wrapf(err, "failed to get vSphere snapshots in namespace %s", namespace)
+	}
+	return ParseVSphereSnapshotStatuses(stdout), nil
+}
+
+// WaitForVSphereUploadCompletion waits for uploads started by the Velero Plug-in for vSphere to complete,
+// the phase and progress of each snapshot are printed every poll, and the snapshots not uploaded yet
+// are listed in the error on timeout
 // TODO - remove after upload progress monitoring is implemented
 func WaitForVSphereUploadCompletion(ctx context.Context, timeout time.Duration, namespace string, expectCount int) error {
+	var statuses []VSphereSnapshotStatus
 	err := wait.PollImmediate(time.Second*5, timeout, func() (bool, error) {
-		checkSnapshotCmd := exec.CommandContext(ctx, "kubectl",
-			"get", "-n", namespace, "snapshots.backupdriver.cnsdp.vmware.com", "-o=jsonpath='{range .items[*]}{.spec.resourceHandle.name}{\"=\"}{.status.phase}{\"\\n\"}{end}'")
-		fmt.Printf("checkSnapshotCmd cmd =%v\n", checkSnapshotCmd)
-		stdout, stderr, err := veleroexec.RunCommand(checkSnapshotCmd)
+		var err error
+		statuses, err = GetVSphereSnapshotStatuses(ctx, namespace)
 		if err != nil {
-			fmt.Print(stdout)
-			fmt.Print(stderr)
 			return false, errors.Wrap(err, "failed to wait for vSphere upload completion")
 		}
-		lines := strings.Split(stdout, "\n")
 		complete := true
-		actualCount := 0
 
-		for _, curLine := range lines {
-			fmt.Println(curLine)
-			comps := strings.Split(curLine, "=")
+		fmt.Printf("vSphere snapshots in namespace %s at %s:\n", namespace, time.Now().Format(time.RFC3339))
+		for _, status := range statuses {
+			fmt.Printf("  %s\n", status)
 			// SnapshotPhase represents the lifecycle phase of a Snapshot.
 			// New - No work yet, next phase is InProgress
 			// InProgress - snapshot being taken
@@ -627,22 +1992,17 @@ func WaitForVSphereUploadCompletion(ctx context.Context, timeout time.Duration,
 			//             status will move to Canceling.  The snapshot ID will be removed from the status status if has been filled in
 			//             and the snapshot ID will not longer be valid for a Clone operation
 			// Canceled - the operation was canceled, the snapshot ID is not valid
-			// Canceled - the operation was canceled, the snapshot ID is not valid
-			if len(comps) == 2 {
-				phase := comps[1]
-				actualCount++
-				switch phase {
-				case "Uploaded":
-				case "New", "InProgress", "Snapshotted", "Uploading":
-					complete = false
-				default:
-					return false, fmt.Errorf("unexpected snapshot phase: %s", phase)
-				}
+			switch status.Phase {
+			case "Uploaded":
+			case "New", "InProgress", "Snapshotted", "Uploading":
+				complete = false
+			default:
+				return false, fmt.Errorf("unexpected phase of %s", status)
 			}
 		}
 
-		if expectCount != actualCount {
-			fmt.Printf("Snapshot expect count and actual count: %d-%d", expectCount, actualCount)
+		if actualCount := len(statuses); expectCount != actualCount {
+			fmt.Printf("Snapshot expect count and actual count: %d-%d\n", expectCount, actualCount)
 			complete = false
 			if expectCount == 0 {
 				return true, nil
@@ -651,47 +2011,17 @@ func WaitForVSphereUploadCompletion(ctx context.Context, timeout time.Duration,
 		return complete, nil
 	})
 
-	return err
-}
-
-func GetVsphereSnapshotIDs(ctx context.Context, timeout time.Duration, namespace string, podNameList []string) ([]string, error) {
-	checkSnapshotCmd := exec.CommandContext(ctx, "kubectl",
-		"get", "-n", namespace, "snapshots.backupdriver.cnsdp.vmware.com", "-o=jsonpath='{range .items[*]}{.spec.resourceHandle.name}{\"=\"}{.status.snapshotID}{\"\\n\"}{end}'")
-	fmt.Printf("checkSnapshotCmd cmd =%v\n", checkSnapshotCmd)
-	stdout, stderr, err := veleroexec.RunCommand(checkSnapshotCmd)
-	if err != nil {
-		fmt.Print(stdout)
-		fmt.Print(stderr)
-		return nil, errors.Wrap(err, "Failed to get vSphere snapshot ID list from snapshots.backupdriver.cnsdp.vmware.com")
-	}
-	stdout = strings.Replace(stdout, "'", "", -1)
-	lines := strings.Split(stdout, "\n")
-	var result []string
-	for _, curLine := range lines {
-		fmt.Println("curLine:" + curLine)
-		curLine = strings.Replace(curLine, "\n", "", -1)
-		if len(curLine) == 0 {
-			continue
-		}
-		var Exist bool
-		for _, podName := range podNameList {
-			if podName != "" && strings.Contains(curLine, podName) {
-				Exist = true
-				break
+	if err == wait.ErrWaitTimeout {
+		var stuck []string
+		for _, status := range statuses {
+			if status.Phase != "Uploaded" {
+				stuck = append(stuck, status.String())
 			}
 		}
-		if !Exist {
-			continue
-		}
-		snapshotID := curLine[strings.LastIndex(curLine, ":")+1:]
-		fmt.Println("snapshotID:" + snapshotID)
-		snapshotIDDec, _ := b64.StdEncoding.DecodeString(snapshotID)
-		fmt.Println("snapshotIDDec:" + string(snapshotIDDec))
-		result = append(result, string(snapshotIDDec))
-		fmt.Println(result)
+		return errors.Errorf("timed out after %s waiting for %d vSphere snapshots in namespace %s to be uploaded, found %d, not uploaded: [%s]",
+			timeout, expectCount, namespace, len(statuses), strings.Join(stuck, "; "))
 	}
-	fmt.Println(result)
-	return result, nil
+	return err
 }
 
 func getVeleroVersion(ctx context.Context, veleroCLI string, clientOnly bool) (string, error) {
@@ -846,6 +2176,30 @@ func IsBackupExist(ctx context.Context, veleroCLI string, backupName string) (bo
 	return true, nil
 }
 
+// WaitForBackupExpired waits until the backup is expired and picked up by the garbage collection,
+// which means the backup is in Deleting phase after its expiration or already deleted
+func WaitForBackupExpired(ctx context.Context, veleroCLI, veleroNamespace, backupName string, timeout time.Duration) error {
+	return wait.PollImmediate(10*time.Second, timeout, func() (bool, error) {
+		exist, err := IsBackupExist(ctx, veleroCLI, backupName)
+		if err != nil {
+			return false, err
+		}
+		if !exist {
+			return true, nil
+		}
+		backup, err := GetBackupObject(ctx, veleroCLI, veleroNamespace, backupName)
+		if err != nil {
+			return false, err
+		}
+		if backup.Status.Expiration == nil || time.Now().Before(backup.Status.Expiration.Time) {
+			fmt.Printf("Backup %s expires at %v, still waiting...\n", backupName, backup.Status.Expiration)
+			return false, nil
+		}
+		fmt.Printf("Backup %s is expired and in phase %s\n", backupName, backup.Status.Phase)
+		return backup.Status.Phase == velerov1api.BackupPhaseDeleting, nil
+	})
+}
+
 func WaitBackupDeleted(ctx context.Context, veleroCLI string, backupName string, timeout time.Duration) error {
 	return wait.PollImmediate(10*time.Second, timeout, func() (bool, error) {
 		if exist, err := IsBackupExist(ctx, veleroCLI, backupName); err != nil {
@@ -861,6 +2215,31 @@ func WaitBackupDeleted(ctx context.Context, veleroCLI string, backupName string,
 	})
 }
 
+// WaitForDeleteBackupRequestProcessed waits for the delete backup request of the backup to be processed and
+// returns the errors of the request. The request is removed once the backup is deleted successfully, so it
+// is only left in Processed phase when the deletion is rejected or failed
+func WaitForDeleteBackupRequestProcessed(ctx context.Context, client TestClient, veleroNamespace, backupName string, timeout time.Duration) ([]string, error) {
+	var errs []string
+	err := wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		requestList := new(velerov1api.DeleteBackupRequestList)
+		if err := client.Kubebuilder.List(ctx, requestList, &kbclient.ListOptions{
+			Namespace:     veleroNamespace,
+			LabelSelector: labels.SelectorFromSet(map[string]string{velerov1api.BackupNameLabel: label.GetValidName(backupName)}),
+		}); err != nil {
+			return false, errors.Wrapf(err, "failed to list delete backup requests of backup %s", backupName)
+		}
+		for _, request := range requestList.Items {
+			if request.Status.Phase == velerov1api.DeleteBackupRequestPhaseProcessed {
+				fmt.Printf("Delete backup request %s of backup %s is processed with errors %v\n", request.Name, backupName, request.Status.Errors)
+				errs = request.Status.Errors
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return errs, err
+}
+
 func WaitForExpectedStateOfBackup(ctx context.Context, veleroCLI string, backupName string,
 	timeout time.Duration, existing bool) error {
 	return wait.PollImmediate(10*time.Second, timeout, func() (bool, error) {
@@ -886,6 +2265,31 @@ func WaitForBackupToBeCreated(ctx context.Context, veleroCLI string, backupName
 	return WaitForExpectedStateOfBackup(ctx, veleroCLI, backupName, timeout, true)
 }
 
+// WaitForBackupSynced waits for the backup in object storage to be synced into the cluster by the backup
+// sync controller, the synced backup keeps the phase it had when it was uploaded
+func WaitForBackupSynced(ctx context.Context, veleroCLI, veleroNamespace, backupName string, timeout time.Duration) error {
+	err := wait.PollImmediate(10*time.Second, timeout, func() (bool, error) {
+		exist, err := IsBackupExist(ctx, veleroCLI, backupName)
+		if err != nil || !exist {
+			return false, err
+		}
+		backup, err := GetBackupObject(ctx, veleroCLI, veleroNamespace, backupName)
+		if err != nil {
+			return false, err
+		}
+		if backup.Status.Phase != velerov1api.BackupPhaseCompleted {
+			fmt.Printf("Backup %s is synced in phase %q, waiting for it to be %s...\n", backupName, backup.Status.Phase, velerov1api.BackupPhaseCompleted)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for backup %s to be synced", backupName)
+	}
+	fmt.Printf("Backup %s is synced\n", backupName)
+	return nil
+}
+
 func WaitForBackupToBeDeleted(ctx context.Context, veleroCLI string, backupName string, timeout time.Duration) error {
 	return WaitForExpectedStateOfBackup(ctx, veleroCLI, backupName, timeout, false)
 }
@@ -1072,6 +2476,46 @@ func GetSnapshotCheckPoint(client TestClient, VeleroCfg VeleroConfig, expectCoun
 	return snapshotCheckPoint, nil
 }
 
+// GetSnapshotCheckPointOfPVCs returns the snapshot check point expecting a snapshot for each of the PVCs in the
+// namespace, all the bound PVCs in the namespace are expected if no PVC name is specified, which fits the backups
+// including the whole namespace. The namespace should not be deleted yet.
+func GetSnapshotCheckPointOfPVCs(client TestClient, VeleroCfg VeleroConfig, namespaceBackedUp, backupName string, pvcNames []string) (SnapshotCheckPoint, error) {
+	return GetSnapshotCheckPointOfVolumes(client, VeleroCfg, backupName, map[string][]string{namespaceBackedUp: pvcNames})
+}
+
+// GetSnapshotCheckPointOfVolumes returns the snapshot check point expecting a snapshot for each of the PVCs keyed
+// by the namespaces, the PVCs are resolved to the volumes bound to them, so the check point is independent of the
+// naming of the pods mounting them
+func GetSnapshotCheckPointOfVolumes(client TestClient, VeleroCfg VeleroConfig, backupName string, pvcs map[string][]string) (SnapshotCheckPoint, error) {
+	volumes := map[string]string{}
+	var namespaceBackedUp string
+	for namespace, pvcNames := range pvcs {
+		namespaceBackedUp = namespace
+		bound, err := GetBoundVolumes(context.Background(), client, namespace, pvcNames)
+		if err != nil {
+			return SnapshotCheckPoint{}, errors.Wrapf(err, "failed to get volumes of PVCs in namespace %s", namespace)
+		}
+		for pvc, volume := range bound {
+			volumes[PVCKey(namespace, pvc)] = volume
+		}
+	}
+	// the namespace is only meaningful when all the PVCs are in the same one
+	if len(pvcs) > 1 {
+		namespaceBackedUp = ""
+	}
+	snapshotCheckPoint, err := GetSnapshotCheckPoint(client, VeleroCfg, len(volumes), namespaceBackedUp, backupName, nil)
+	if err != nil {
+		return snapshotCheckPoint, err
+	}
+	snapshotCheckPoint.Volumes = volumes
+	return snapshotCheckPoint, nil
+}
+
+// PVCKey returns the key of the PVC in the volumes of the snapshot check point
+func PVCKey(namespace, pvc string) string {
+	return namespace + "/" + pvc
+}
+
 func GetBackupTTL(ctx context.Context, veleroNamespace, backupName string) (string, error) {
 	checkSnapshotCmd := exec.CommandContext(ctx, "kubectl",
 		"get", "backup", "-n", veleroNamespace, backupName, "-o=jsonpath='{.spec.ttl}'")
@@ -1116,6 +2560,29 @@ func DeleteBackups(ctx context.Context, client TestClient) error {
 	return nil
 }
 
+// UseCluster switches the kubeconfig context to the cluster, so that the velero CLI works on it, and sets the
+// client of the cluster as the one to install Velero
+func UseCluster(ctx context.Context, veleroCfg *VeleroConfig, kubecontext string, client *TestClient) error {
+	if kubecontext == "" || client == nil {
+		return errors.Errorf("kubeconfig context %q or its client is not provided", kubecontext)
+	}
+	if err := KubectlConfigUseContext(ctx, kubecontext); err != nil {
+		return errors.Wrapf(err, "failed to switch to kubeconfig context %s", kubecontext)
+	}
+	veleroCfg.ClientToInstallVelero = client
+	return nil
+}
+
+// UseDefaultCluster switches to the default cluster of the migration
+func UseDefaultCluster(ctx context.Context, veleroCfg *VeleroConfig) error {
+	return UseCluster(ctx, veleroCfg, veleroCfg.DefaultCluster, veleroCfg.DefaultClient)
+}
+
+// UseStandbyCluster switches to the standby cluster of the migration
+func UseStandbyCluster(ctx context.Context, veleroCfg *VeleroConfig) error {
+	return UseCluster(ctx, veleroCfg, veleroCfg.StandbyCluster, veleroCfg.StandbyClient)
+}
+
 func GetSchedule(ctx context.Context, veleroNamespace, scheduleName string) (string, error) {
 	checkSnapshotCmd := exec.CommandContext(ctx, "kubectl",
 		"get", "schedule", "-n", veleroNamespace, scheduleName, "-o=jsonpath='{.metadata.creationTimestamp}'")
@@ -1130,6 +2597,10 @@ func GetSchedule(ctx context.Context, veleroNamespace, scheduleName string) (str
 }
 
 func VeleroUpgrade(ctx context.Context, veleroCfg VeleroConfig) error {
+	oldImage, err := GetVeleroServerImage(ctx, veleroCfg.VeleroNamespace)
+	if err != nil {
+		return err
+	}
 	crd, err := ApplyCRDs(ctx, veleroCfg.VeleroCLI)
 	if err != nil {
 		return errors.Wrap(err, "Fail to Apply CRDs")
@@ -1140,6 +2611,15 @@ func VeleroUpgrade(ctx context.Context, veleroCfg VeleroConfig) error {
 		return errors.Wrap(err, "Fail to update Velero deployment")
 	}
 	fmt.Println(deploy)
+	// the image is replaced by matching the old image tag, make sure it's really upgraded
+	newImage, err := GetVeleroServerImage(ctx, veleroCfg.VeleroNamespace)
+	if err != nil {
+		return err
+	}
+	if newImage == oldImage {
+		return errors.Errorf("image %s of Velero deployment is not changed by the upgrade", oldImage)
+	}
+	fmt.Printf("Image of Velero deployment is upgraded from %s to %s\n", oldImage, newImage)
 	if veleroCfg.UseNodeAgent {
 		dsjson, err := KubectlGetDsJson(veleroCfg.VeleroNamespace)
 		if err != nil {
@@ -1158,6 +2638,17 @@ func VeleroUpgrade(ctx context.Context, veleroCfg VeleroConfig) error {
 	}
 	return waitVeleroReady(ctx, veleroCfg.VeleroNamespace, veleroCfg.UseNodeAgent)
 }
+
+// GetVeleroServerImage returns the image of the velero container in the Velero deployment
+func GetVeleroServerImage(ctx context.Context, veleroNamespace string) (string, error) {
+	stdout, stderr, err := veleroexec.RunCommand(exec.CommandContext(ctx, "kubectl", "get", "deploy/velero", "-n", veleroNamespace,
+		"-o", `jsonpath={.spec.template.spec.containers[?(@.name=="velero")].image}`))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get image of Velero deployment, stdout=%s, stderr=%s", stdout, stderr)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
 func ApplyCRDs(ctx context.Context, veleroCLI string) ([]string, error) {
 	cmds := []*common.OsCommandLine{}
 
@@ -1300,6 +2791,260 @@ func GetPVR(ctx context.Context, veleroNamespace, namespace string) ([]string, e
 	return GetVeleroResource(ctx, veleroNamespace, namespace, "podvolumerestore")
 }
 
+// ListPodVolumeBackups returns the pod volume backups created for the backup
+func ListPodVolumeBackups(ctx context.Context, client TestClient, veleroNamespace, backupName string) ([]velerov1api.PodVolumeBackup, error) {
+	pvbList := new(velerov1api.PodVolumeBackupList)
+	if err := client.Kubebuilder.List(ctx, pvbList, &kbclient.ListOptions{
+		Namespace:     veleroNamespace,
+		LabelSelector: labels.SelectorFromSet(map[string]string{velerov1api.BackupNameLabel: label.GetValidName(backupName)}),
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list pod volume backups of backup %s", backupName)
+	}
+	return pvbList.Items, nil
+}
+
+// ListPodVolumeRestores returns the pod volume restores created for the restore
+func ListPodVolumeRestores(ctx context.Context, client TestClient, veleroNamespace, restoreName string) ([]velerov1api.PodVolumeRestore, error) {
+	pvrList := new(velerov1api.PodVolumeRestoreList)
+	if err := client.Kubebuilder.List(ctx, pvrList, &kbclient.ListOptions{
+		Namespace:     veleroNamespace,
+		LabelSelector: labels.SelectorFromSet(map[string]string{velerov1api.RestoreNameLabel: label.GetValidName(restoreName)}),
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list pod volume restores of restore %s", restoreName)
+	}
+	return pvrList.Items, nil
+}
+
+// ListBackupRepositories returns the backup repositories for the volumes in the namespace
+func ListBackupRepositories(ctx context.Context, client TestClient, veleroNamespace, volumeNamespace string) ([]velerov1api.BackupRepository, error) {
+	repoList := new(velerov1api.BackupRepositoryList)
+	if err := client.Kubebuilder.List(ctx, repoList, &kbclient.ListOptions{
+		Namespace:     veleroNamespace,
+		LabelSelector: labels.SelectorFromSet(map[string]string{velerov1api.VolumeNamespaceLabel: label.GetValidName(volumeNamespace)}),
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list backup repositories of namespace %s", volumeNamespace)
+	}
+	return repoList.Items, nil
+}
+
+// WaitForBackupRepositoryPhase waits for the only backup repository for the volumes in the namespace to be in
+// the expected phase and returns it
+func WaitForBackupRepositoryPhase(ctx context.Context, client TestClient, veleroNamespace, volumeNamespace string,
+	phase velerov1api.BackupRepositoryPhase, timeout time.Duration) (*velerov1api.BackupRepository, error) {
+	var repo *velerov1api.BackupRepository
+	err := wait.PollImmediate(10*time.Second, timeout, func() (bool, error) {
+		repos, err := ListBackupRepositories(ctx, client, veleroNamespace, volumeNamespace)
+		if err != nil {
+			return false, err
+		}
+		if len(repos) != 1 {
+			fmt.Printf("Got %d backup repositories of namespace %s, waiting for the only one...\n", len(repos), volumeNamespace)
+			return false, nil
+		}
+		repo = &repos[0]
+		if repo.Status.Phase != phase {
+			fmt.Printf("Backup repository %s is in phase %q, waiting for it to be %s...\n", repo.Name, repo.Status.Phase, phase)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to wait for backup repository of namespace %s to be %s", volumeNamespace, phase)
+	}
+	return repo, nil
+}
+
+// WaitForBackupRepositoryMaintained waits for the maintenance of the backup repository to be run after the time
+func WaitForBackupRepositoryMaintained(ctx context.Context, client TestClient, veleroNamespace, repoName string,
+	after time.Time, timeout time.Duration) error {
+	err := wait.PollImmediate(30*time.Second, timeout, func() (bool, error) {
+		repo := new(velerov1api.BackupRepository)
+		if err := client.Kubebuilder.Get(ctx, kbclient.ObjectKey{Namespace: veleroNamespace, Name: repoName}, repo); err != nil {
+			return false, errors.Wrapf(err, "failed to get backup repository %s", repoName)
+		}
+		if repo.Status.LastMaintenanceTime == nil || !repo.Status.LastMaintenanceTime.After(after) {
+			fmt.Printf("Backup repository %s is last maintained at %v, waiting for maintenance after %v...\n", repoName, repo.Status.LastMaintenanceTime, after)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for backup repository %s to be maintained", repoName)
+	}
+	return nil
+}
+
+// PodVolumeBackupsShouldBeCompleted checks the backup has the expected count of pod volume backups, and all of
+// them are completed with the data transferred. The pod volume backups are printed if the check fails
+func PodVolumeBackupsShouldBeCompleted(ctx context.Context, client TestClient, veleroNamespace, backupName string, expectedCount int) error {
+	pvbs, err := ListPodVolumeBackups(ctx, client, veleroNamespace, backupName)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		if len(pvbs) != expectedCount {
+			return errors.Errorf("got %d pod volume backups of backup %s, expecting %d", len(pvbs), backupName, expectedCount)
+		}
+		for _, pvb := range pvbs {
+			if pvb.Status.Phase != velerov1api.PodVolumeBackupPhaseCompleted {
+				return errors.Errorf("pod volume backup %s is %s, expecting %s: %s", pvb.Name, pvb.Status.Phase, velerov1api.PodVolumeBackupPhaseCompleted, pvb.Status.Message)
+			}
+			if pvb.Status.Progress.BytesDone <= 0 {
+				return errors.Errorf("no bytes are backed up by pod volume backup %s", pvb.Name)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		for i := range pvbs {
+			printYAML(&pvbs[i])
+		}
+	}
+	return err
+}
+
+// PodVolumeRestoresShouldBeCompleted checks the restore has the expected count of pod volume restores, the same
+// as PodVolumeBackupsShouldBeCompleted
+func PodVolumeRestoresShouldBeCompleted(ctx context.Context, client TestClient, veleroNamespace, restoreName string, expectedCount int) error {
+	pvrs, err := ListPodVolumeRestores(ctx, client, veleroNamespace, restoreName)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		if len(pvrs) != expectedCount {
+			return errors.Errorf("got %d pod volume restores of restore %s, expecting %d", len(pvrs), restoreName, expectedCount)
+		}
+		for _, pvr := range pvrs {
+			if pvr.Status.Phase != velerov1api.PodVolumeRestorePhaseCompleted {
+				return errors.Errorf("pod volume restore %s is %s, expecting %s: %s", pvr.Name, pvr.Status.Phase, velerov1api.PodVolumeRestorePhaseCompleted, pvr.Status.Message)
+			}
+			if pvr.Status.Progress.BytesDone <= 0 {
+				return errors.Errorf("no bytes are restored by pod volume restore %s", pvr.Name)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		for i := range pvrs {
+			printYAML(&pvrs[i])
+		}
+	}
+	return err
+}
+
+// GetPodVolumeBackupUploaderType returns the uploader type of the pod volume backups of the backup, the pod
+// volume backups created before the uploader type is introduced are taken by restic
+func GetPodVolumeBackupUploaderType(ctx context.Context, client TestClient, veleroNamespace, backupName string) (string, error) {
+	pvbs, err := ListPodVolumeBackups(ctx, client, veleroNamespace, backupName)
+	if err != nil {
+		return "", err
+	}
+	if len(pvbs) == 0 {
+		return "", errors.Errorf("no pod volume backup of backup %s", backupName)
+	}
+	if pvbs[0].Spec.UploaderType == "" {
+		return uploader.ResticType, nil
+	}
+	return pvbs[0].Spec.UploaderType, nil
+}
+
+// PodVolumeRestoresUploaderTypeShouldBe checks the pod volume restores of the restore are done by the uploader
+func PodVolumeRestoresUploaderTypeShouldBe(ctx context.Context, client TestClient, veleroNamespace, restoreName, uploaderType string) error {
+	pvrs, err := ListPodVolumeRestores(ctx, client, veleroNamespace, restoreName)
+	if err != nil {
+		return err
+	}
+	for _, pvr := range pvrs {
+		if pvr.Spec.UploaderType != uploaderType {
+			return errors.Errorf("pod volume restore %s is done by uploader %q, expecting %q", pvr.Name, pvr.Spec.UploaderType, uploaderType)
+		}
+	}
+	return nil
+}
+
+// BackupRepositoriesShouldBeReady checks the backup repositories still exist with the same repository type
+// and are ready
+func BackupRepositoriesShouldBeReady(ctx context.Context, client TestClient, repos []velerov1api.BackupRepository) error {
+	for _, repo := range repos {
+		current := new(velerov1api.BackupRepository)
+		if err := client.Kubebuilder.Get(ctx, kbclient.ObjectKey{Namespace: repo.Namespace, Name: repo.Name}, current); err != nil {
+			return errors.Wrapf(err, "failed to get backup repository %s", repo.Name)
+		}
+		if current.Spec.RepositoryType != repo.Spec.RepositoryType {
+			return errors.Errorf("repository type of backup repository %s is changed from %s to %s", repo.Name, repo.Spec.RepositoryType, current.Spec.RepositoryType)
+		}
+		if current.Status.Phase != velerov1api.BackupRepositoryPhaseReady {
+			return errors.Errorf("backup repository %s is %q, expecting %s: %s", repo.Name, current.Status.Phase, velerov1api.BackupRepositoryPhaseReady, current.Status.Message)
+		}
+	}
+	return nil
+}
+
+// printYAML prints the object as YAML for debugging
+func printYAML(obj interface{}) {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		fmt.Printf("Failed to marshal %v: %v\n", obj, err)
+		return
+	}
+	fmt.Printf("---\n%s", data)
+}
+
+// GetVolumeProtectionMechanisms attributes the CSI snapshots and pod volume backups of backup to the PVCs
+// in namespace, it returns the map of PVC name to the mechanisms protected it, PVCs that are not
+// protected by any mechanism are included with an empty list.
+func GetVolumeProtectionMechanisms(ctx context.Context, client TestClient, veleroNamespace, namespace, backupName string) (map[string][]string, error) {
+	pvcList, err := client.ClientGo.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list PVCs in namespace %s", namespace)
+	}
+	mechanisms := make(map[string][]string)
+	pvcByUID := make(map[string]string)
+	pvcByVolumeHandle := make(map[string]string)
+	for _, pvc := range pvcList.Items {
+		mechanisms[pvc.Name] = []string{}
+		pvcByUID[string(pvc.UID)] = pvc.Name
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := GetPersistentVolume(ctx, client, "", pvc.Spec.VolumeName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get PV %s of PVC %s/%s", pvc.Spec.VolumeName, namespace, pvc.Name)
+		}
+		if pv.Spec.CSI != nil {
+			pvcByVolumeHandle[pv.Spec.CSI.VolumeHandle] = pvc.Name
+		}
+	}
+
+	volumeHandles, err := util.GetCsiSnapshotSourceVolumeHandles(backupName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get CSI snapshots of backup %s", backupName)
+	}
+	for _, volumeHandle := range volumeHandles {
+		if pvcName, ok := pvcByVolumeHandle[volumeHandle]; ok {
+			mechanisms[pvcName] = append(mechanisms[pvcName], VolumeProtectedByCSISnapshot)
+		}
+	}
+
+	pvbList := new(velerov1api.PodVolumeBackupList)
+	if err := client.Kubebuilder.List(ctx, pvbList, &kbclient.ListOptions{
+		Namespace:     veleroNamespace,
+		LabelSelector: labels.SelectorFromSet(map[string]string{velerov1api.BackupNameLabel: label.GetValidName(backupName)}),
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list PodVolumeBackups of backup %s", backupName)
+	}
+	for _, pvb := range pvbList.Items {
+		if pvb.Spec.Pod.Namespace != namespace {
+			continue
+		}
+		if pvcName, ok := pvcByUID[pvb.Labels[velerov1api.PVCUIDLabel]]; ok {
+			mechanisms[pvcName] = append(mechanisms[pvcName], VolumeProtectedByFsBackup)
+		}
+	}
+	fmt.Printf("Volume protection mechanisms of backup %s in namespace %s: %v\n", backupName, namespace, mechanisms)
+	return mechanisms, nil
+}
+
 func IsSupportUploaderType(version string) (bool, error) {
 	if strings.Contains(version, "self") {
 		return true, nil
@@ -1318,3 +3063,36 @@ func IsSupportUploaderType(version string) (bool, error) {
 		return false, nil
 	}
 }
+
+// ListDownloadRequests returns the download requests created for the backup or restore, they are created by
+// the CLI to get the logs and the details of the backup or restore from the object storage
+func ListDownloadRequests(ctx context.Context, client TestClient, veleroNamespace, targetName string) ([]velerov1api.DownloadRequest, error) {
+	requestList := new(velerov1api.DownloadRequestList)
+	if err := client.Kubebuilder.List(ctx, requestList, &kbclient.ListOptions{Namespace: veleroNamespace}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list download requests in namespace %s", veleroNamespace)
+	}
+	var requests []velerov1api.DownloadRequest
+	for _, request := range requestList.Items {
+		if request.Spec.Target.Name == targetName {
+			requests = append(requests, request)
+		}
+	}
+	return requests, nil
+}
+
+// WaitForDownloadRequestsDeleted waits for the download requests of the backup or restore to be deleted, the
+// download requests are deleted by Velero after the download URLs expire
+func WaitForDownloadRequestsDeleted(ctx context.Context, client TestClient, veleroNamespace, targetName string, timeout time.Duration) error {
+	err := wait.PollImmediate(30*time.Second, timeout, func() (bool, error) {
+		requests, err := ListDownloadRequests(ctx, client, veleroNamespace, targetName)
+		if err != nil {
+			return false, err
+		}
+		if len(requests) > 0 {
+			fmt.Printf("%d download requests of %s are not deleted yet, waiting...\n", len(requests), targetName)
+			return false, nil
+		}
+		return true, nil
+	})
+	return errors.Wrapf(err, "failed to wait for download requests of %s to be deleted", targetName)
+}
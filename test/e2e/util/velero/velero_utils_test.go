@@ -0,0 +1,973 @@
+/*
+Copyright the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package velero
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/cmd/util/output"
+	"github.com/vmware-tanzu/velero/pkg/features"
+	. "github.com/vmware-tanzu/velero/test/e2e"
+	. "github.com/vmware-tanzu/velero/test/e2e/util/k8s"
+)
+
+func TestGetBackupNamespaceArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		backupCfg BackupConfig
+		expected  []string
+	}{
+		{
+			name: "no ordered resources",
+			backupCfg: BackupConfig{
+				BackupName: "backup-1",
+				Namespace:  "ns-1",
+			},
+			expected: []string{
+				"--namespace", "velero", "create", "backup", "backup-1",
+				"--include-namespaces", "ns-1",
+			},
+		},
+		{
+			name: "ordered resources of multiple kinds",
+			backupCfg: BackupConfig{
+				BackupName: "backup-1",
+				Namespace:  "ns-1",
+				OrderedResources: map[string]string{
+					"pods":              "ns-1/pod-2,ns-1/pod-1",
+					"persistentvolumes": "pv-1,pv-2",
+				},
+			},
+			expected: []string{
+				"--namespace", "velero", "create", "backup", "backup-1",
+				"--include-namespaces", "ns-1",
+				"--ordered-resources", "persistentvolumes=pv-1,pv-2;pods=ns-1/pod-2,ns-1/pod-1",
+			},
+		},
+		{
+			name: "excluded namespaces and resources",
+			backupCfg: BackupConfig{
+				BackupName:         "backup-1",
+				ExcludedNamespaces: []string{"ns-1", "ns-2"},
+				IncludeResources:   "deployments,configmaps",
+				ExcludeResources:   "secrets",
+			},
+			expected: []string{
+				"--namespace", "velero", "create", "backup", "backup-1",
+				"--exclude-namespaces", "ns-1,ns-2",
+				"--include-resources", "deployments,configmaps",
+				"--exclude-resources", "secrets",
+			},
+		},
+		{
+			name: "ttl and item operation timeout",
+			backupCfg: BackupConfig{
+				BackupName:           "backup-1",
+				Namespace:            "ns-1",
+				TTL:                  time.Hour,
+				ItemOperationTimeout: 30 * time.Minute,
+			},
+			expected: []string{
+				"--namespace", "velero", "create", "backup", "backup-1",
+				"--include-namespaces", "ns-1",
+				"--ttl", "1h0m0s",
+				"--item-operation-timeout", "30m0s",
+			},
+		},
+		{
+			name: "resource policies configmap",
+			backupCfg: BackupConfig{
+				BackupName:                "backup-1",
+				Namespace:                 "ns-1",
+				ResourcePoliciesConfigmap: "cm-1",
+			},
+			expected: []string{
+				"--namespace", "velero", "create", "backup", "backup-1",
+				"--include-namespaces", "ns-1",
+				"--resource-policies-configmap", "cm-1",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, getBackupNamespaceArgs("velero", tc.backupCfg))
+		})
+	}
+}
+
+func TestGetRestoreArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		restoreCfg RestoreConfig
+		expected   []string
+	}{
+		{
+			name: "no filter",
+			restoreCfg: RestoreConfig{
+				RestoreName: "restore-1",
+				BackupName:  "backup-1",
+			},
+			expected: []string{
+				"--namespace", "velero", "create", "restore", "restore-1", "--from-backup", "backup-1",
+			},
+		},
+		{
+			name: "all the options",
+			restoreCfg: RestoreConfig{
+				RestoreName:            "restore-1",
+				BackupName:             "backup-1",
+				IncludedResources:      "deployments,configmaps",
+				ExcludedResources:      "secrets",
+				NamespaceMappings:      map[string]string{"ns-2": "ns-4", "ns-1": "ns-3"},
+				ExistingResourcePolicy: "update",
+			},
+			expected: []string{
+				"--namespace", "velero", "create", "restore", "restore-1", "--from-backup", "backup-1",
+				"--include-resources", "deployments,configmaps",
+				"--exclude-resources", "secrets",
+				"--namespace-mappings", "ns-1:ns-3,ns-2:ns-4",
+				"--existing-resource-policy", "update",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, getRestoreArgs("velero", tc.restoreCfg))
+		})
+	}
+}
+
+func TestGetBackupNamespaceArgsExclusiveFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		backupCfg BackupConfig
+		flags     []string
+	}{
+		{
+			name: "fs backup by restic or kopia",
+			backupCfg: BackupConfig{
+				BackupName:               "backup-1",
+				DefaultVolumesToFsBackup: true,
+				UseResticIfFSBackup:      true,
+			},
+			flags: []string{"--default-volumes-to-restic", "--default-volumes-to-fs-backup"},
+		},
+		{
+			name: "snapshot volumes or not",
+			backupCfg: BackupConfig{
+				BackupName:                  "backup-1",
+				UseVolumeSnapshots:          true,
+				ProvideSnapshotsVolumeParam: true,
+				DefaultVolumesToFsBackup:    true,
+			},
+			flags: []string{"--snapshot-volumes", "--snapshot-volumes=false"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args := getBackupNamespaceArgs("velero", tc.backupCfg)
+			found := 0
+			for _, flag := range tc.flags {
+				for _, arg := range args {
+					if arg == flag {
+						found++
+					}
+				}
+			}
+			assert.Equal(t, 1, found, "only one of the flags %v is expected in %v", tc.flags, args)
+		})
+	}
+}
+
+func TestLatestCompletedBackup(t *testing.T) {
+	backup := func(name string, phase velerov1api.BackupPhase) velerov1api.Backup {
+		return velerov1api.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     velerov1api.BackupStatus{Phase: phase},
+		}
+	}
+
+	latest := LatestCompletedBackup([]velerov1api.Backup{
+		backup("backup-1", velerov1api.BackupPhaseCompleted),
+		backup("backup-2", velerov1api.BackupPhaseCompleted),
+		backup("backup-3", velerov1api.BackupPhasePartiallyFailed),
+		backup("backup-4", velerov1api.BackupPhaseInProgress),
+	})
+	require.NotNil(t, latest)
+	assert.Equal(t, "backup-2", latest.Name)
+
+	assert.Nil(t, LatestCompletedBackup([]velerov1api.Backup{backup("backup-1", velerov1api.BackupPhaseFailed)}))
+	assert.Nil(t, LatestCompletedBackup(nil))
+}
+
+func TestParseBackupResourceList(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name: "namespaced and cluster scoped resources",
+			output: `Phase:  Completed
+
+Resource List:
+  apps/v1/Deployment:
+    - ns-1/deploy-1
+  v1/ConfigMap:
+    - ns-1/cm-1
+    - ns-1/cm-2
+  v1/Namespace:
+    - ns-1
+
+Velero-Native Snapshots: <none included>
+`,
+			expected: []string{
+				"apps/v1/Deployment:ns-1/deploy-1",
+				"v1/ConfigMap:ns-1/cm-1",
+				"v1/ConfigMap:ns-1/cm-2",
+				"v1/Namespace:ns-1",
+			},
+		},
+		{
+			name: "resource list not found",
+			output: `Phase:  Completed
+
+Resource List:  <backup resource list not found>
+`,
+			expectErr: true,
+		},
+		{
+			name:      "no resource list",
+			output:    "Phase:  Completed\n",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			contents, err := parseBackupResourceList(tc.output)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, contents)
+		})
+	}
+}
+
+func TestParseBackupStorageLocations(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		expected  map[string]velerov1api.BackupStorageLocationPhase
+		expectErr bool
+	}{
+		{
+			name: "single location",
+			output: `{
+    "kind": "BackupStorageLocation",
+    "apiVersion": "velero.io/v1",
+    "metadata": {"name": "default", "namespace": "velero"},
+    "spec": {"provider": "aws", "objectStorage": {"bucket": "bucket"}, "accessMode": "ReadOnly"},
+    "status": {"phase": "Available"}
+}`,
+			expected: map[string]velerov1api.BackupStorageLocationPhase{"default": velerov1api.BackupStorageLocationPhaseAvailable},
+		},
+		{
+			name: "list of locations",
+			output: `{
+    "kind": "BackupStorageLocationList",
+    "apiVersion": "velero.io/v1",
+    "metadata": {},
+    "items": [
+        {"metadata": {"name": "default"}, "status": {"phase": "Available"}},
+        {"metadata": {"name": "bsl-1"}, "status": {"phase": "Unavailable"}}
+    ]
+}`,
+			expected: map[string]velerov1api.BackupStorageLocationPhase{
+				"default": velerov1api.BackupStorageLocationPhaseAvailable,
+				"bsl-1":   velerov1api.BackupStorageLocationPhaseUnavailable,
+			},
+		},
+		{
+			name:      "invalid output",
+			output:    "An error occurred: backupstoragelocations.velero.io \"bsl-1\" not found",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bsls, err := ParseBackupStorageLocations([]byte(tc.output))
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			phases := map[string]velerov1api.BackupStorageLocationPhase{}
+			for _, bsl := range bsls {
+				phases[bsl.Name] = bsl.Status.Phase
+			}
+			assert.Equal(t, tc.expected, phases)
+		})
+	}
+}
+
+func TestParseBackupRepositories(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		expected  map[string]velerov1api.BackupRepositoryPhase
+		expectErr bool
+	}{
+		{
+			name: "single repository",
+			output: `{
+    "kind": "BackupRepository",
+    "apiVersion": "velero.io/v1",
+    "metadata": {"name": "ns-1-default-kopia-abcde", "namespace": "velero"},
+    "spec": {"volumeNamespace": "ns-1", "backupStorageLocation": "default", "repositoryType": "kopia", "maintenanceFrequency": "1m0s"},
+    "status": {"phase": "Ready", "lastMaintenanceTime": "2023-01-01T00:00:00Z"}
+}`,
+			expected: map[string]velerov1api.BackupRepositoryPhase{"ns-1-default-kopia-abcde": velerov1api.BackupRepositoryPhaseReady},
+		},
+		{
+			name: "list of repositories",
+			output: `{
+    "kind": "BackupRepositoryList",
+    "apiVersion": "velero.io/v1",
+    "metadata": {},
+    "items": [
+        {"metadata": {"name": "ns-1-default-kopia-abcde"}, "status": {"phase": "Ready"}},
+        {"metadata": {"name": "ns-2-default-kopia-fghij"}, "status": {"phase": "NotReady", "message": "error to connect"}}
+    ]
+}`,
+			expected: map[string]velerov1api.BackupRepositoryPhase{
+				"ns-1-default-kopia-abcde": velerov1api.BackupRepositoryPhaseReady,
+				"ns-2-default-kopia-fghij": velerov1api.BackupRepositoryPhaseNotReady,
+			},
+		},
+		{
+			name:      "invalid output",
+			output:    "An error occurred: backuprepositories.velero.io \"repo-1\" not found",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repos, err := ParseBackupRepositories([]byte(tc.output))
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			phases := map[string]velerov1api.BackupRepositoryPhase{}
+			for _, repo := range repos {
+				phases[repo.Name] = repo.Status.Phase
+			}
+			assert.Equal(t, tc.expected, phases)
+		})
+	}
+}
+
+func TestWritePhaseMetric(t *testing.T) {
+	assert.NoError(t, WritePhaseMetric("", StartPhaseMetric(PerfPhaseBackup, "backup-1", "")))
+
+	reportDir := filepath.Join(t.TempDir(), "perf")
+	backup := StartPhaseMetric(PerfPhaseBackup, "backup-1", "")
+	backup.Finish()
+	backup.Bytes = 1024
+	restore := StartPhaseMetric(PerfPhaseRestore, "backup-1", "restore-1")
+	restore.Finish()
+	restore.Bytes = 1024
+	assert.NoError(t, WritePhaseMetric(reportDir, backup))
+	assert.NoError(t, WritePhaseMetric(reportDir, restore))
+
+	content, err := os.ReadFile(filepath.Join(reportDir, PerfReportFile))
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 2)
+	var metric PhaseMetric
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &metric))
+	assert.Equal(t, PerfPhaseRestore, metric.Phase)
+	assert.Equal(t, "backup-1", metric.BackupName)
+	assert.Equal(t, "restore-1", metric.RestoreName)
+	assert.Equal(t, int64(1024), metric.Bytes)
+	assert.False(t, metric.End.Before(metric.Start))
+}
+
+func TestDRMetric(t *testing.T) {
+	start := time.Unix(1000, 500)
+	m := &DRMetric{
+		BackupName:         "backup-1",
+		RestoreName:        "restore-1",
+		BackupStart:        start,
+		BackupCompletion:   start.Add(time.Minute),
+		FailoverDecision:   start.Add(5 * time.Minute),
+		RestoreStart:       start.Add(6 * time.Minute),
+		WorkloadServing:    start.Add(9 * time.Minute),
+		LastSurvivingWrite: time.Unix(1000, 0),
+	}
+	m.Compute()
+	assert.Equal(t, PerfPhaseDR, m.Phase)
+	assert.Equal(t, float64(180), m.RTOSeconds)
+	assert.InDelta(t, float64(300), m.RPOSeconds, 1)
+	assert.NoError(t, m.Check(5*time.Minute))
+	assert.Error(t, m.Check(time.Minute))
+
+	m.LastSurvivingWrite = time.Unix(999, 0)
+	assert.Error(t, m.Check(5*time.Minute))
+}
+
+func TestParseBackupVolumeDetails(t *testing.T) {
+	captured, err := os.ReadFile("testdata/backup-describe-details.txt")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		output    string
+		expected  *BackupVolumeDetails
+		expectErr bool
+	}{
+		{
+			name:   "captured output with all the data paths",
+			output: string(captured),
+			expected: &BackupVolumeDetails{
+				NativeSnapshots: map[string]NativeSnapshotDetails{
+					"pvc-6f0e9a4e-1": {SnapshotID: "snap-pvc-6f0e9a4e-1", Type: "gp2", AvailabilityZone: "us-east-1a", IOPS: "<N/A>"},
+					"pvc-6f0e9a4e-2": {SnapshotID: "snap-pvc-6f0e9a4e-2", Type: "gp2", AvailabilityZone: "us-east-1a", IOPS: "<N/A>"},
+				},
+				CSISnapshots: map[string]CSISnapshotDetails{
+					"snapcontent-1": {SnapshotHandle: "snap-0a1b2c3d", Size: 1073741824, ReadyToUse: true},
+				},
+				PodVolumeUploader: "kopia",
+				PodVolumeBackups: map[string]string{
+					"ns-1/pod-1/volume-1": "Completed",
+					"ns-1/pod-1/volume-2": "Completed",
+					"ns-1/pod-2/volume-3": "Failed",
+				},
+			},
+		},
+		{
+			name: "no volume included",
+			output: "Phase:  Completed\n\n" +
+				"Velero-Native Snapshots: <none included>\n\n" +
+				"CSI Volume Snapshots: <none included>\n",
+			expected: &BackupVolumeDetails{
+				NativeSnapshots:  map[string]NativeSnapshotDetails{},
+				CSISnapshots:     map[string]CSISnapshotDetails{},
+				PodVolumeBackups: map[string]string{},
+			},
+		},
+		{
+			name: "pod volume backups in progress",
+			output: "restic Backups:\n" +
+				"  Completed:\n" +
+				"    ns-1/pod-1: volume-1\n" +
+				"  In Progress:\n" +
+				"    ns-1/pod-1: volume-2 (12.34%), volume-3\n",
+			expected: &BackupVolumeDetails{
+				NativeSnapshots:   map[string]NativeSnapshotDetails{},
+				CSISnapshots:      map[string]CSISnapshotDetails{},
+				PodVolumeUploader: "restic",
+				PodVolumeBackups: map[string]string{
+					"ns-1/pod-1/volume-1": "Completed",
+					"ns-1/pod-1/volume-2": "In Progress",
+					"ns-1/pod-1/volume-3": "In Progress",
+				},
+			},
+		},
+		{
+			name:      "error getting native snapshots",
+			output:    "Velero-Native Snapshots:  <error getting snapshot info: timeout>\n",
+			expectErr: true,
+		},
+		{
+			name:      "invalid size of CSI snapshot",
+			output:    "CSI Volume Snapshots:\nSnapshot Content Name: snapcontent-1\n  Snapshot Size (bytes): 1Gi\n",
+			expectErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			details, err := ParseBackupVolumeDetails(tc.output)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, details)
+		})
+	}
+}
+
+// TestParseBackupVolumeDetailsOfDescriber parses the sections rendered by the describer of the
+// current release, so that the format changes of describe are caught
+func TestParseBackupVolumeDetailsOfDescriber(t *testing.T) {
+	features.Enable(velerov1api.CSIFeatureFlag)
+	defer features.Disable(velerov1api.CSIFeatureFlag)
+	handle := "snap-0a1b2c3d"
+	size := int64(1073741824)
+	ready := true
+	pvb := func(pod, volume string, phase velerov1api.PodVolumeBackupPhase) velerov1api.PodVolumeBackup {
+		return velerov1api.PodVolumeBackup{
+			Spec: velerov1api.PodVolumeBackupSpec{
+				UploaderType: "kopia",
+				Volume:       volume,
+				Pod:          corev1api.ObjectReference{Namespace: "ns-1", Name: pod},
+			},
+			Status: velerov1api.PodVolumeBackupStatus{Phase: phase},
+		}
+	}
+
+	rendered := output.Describe(func(d *output.Describer) {
+		output.DescribeCSIVolumeSnapshots(d, true, []snapshotv1api.VolumeSnapshotContent{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "snapcontent-1"},
+				Status:     &snapshotv1api.VolumeSnapshotContentStatus{SnapshotHandle: &handle, RestoreSize: &size, ReadyToUse: &ready},
+			},
+		})
+		d.Println()
+		output.DescribePodVolumeBackups(d, []velerov1api.PodVolumeBackup{
+			pvb("pod-1", "volume-1", velerov1api.PodVolumeBackupPhaseCompleted),
+			pvb("pod-2", "volume-2", velerov1api.PodVolumeBackupPhaseFailed),
+		}, true)
+	})
+
+	details, err := ParseBackupVolumeDetails(rendered)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]CSISnapshotDetails{
+		"snapcontent-1": {SnapshotHandle: handle, Size: size, ReadyToUse: true},
+	}, details.CSISnapshots)
+	assert.Equal(t, "kopia", details.PodVolumeUploader)
+	assert.Equal(t, map[string]string{
+		"ns-1/pod-1/volume-1": "Completed",
+		"ns-1/pod-2/volume-2": "Failed",
+	}, details.PodVolumeBackups)
+}
+
+func TestParseVSphereSnapshotStatuses(t *testing.T) {
+	output := "'snap-1=kibishii-data-kibishii-deployment-0=Uploaded=1024=1024\n" +
+		"snap-2=kibishii-data-kibishii-deployment-1=Uploading=256=1024\n" +
+		"snap-3=kibishii-data-kibishii-deployment-2=New==\n'"
+	statuses := ParseVSphereSnapshotStatuses(output)
+	require.Len(t, statuses, 3)
+
+	assert.Equal(t, VSphereSnapshotStatus{Name: "snap-1", PVC: "kibishii-data-kibishii-deployment-0", Phase: "Uploaded", BytesDone: 1024, TotalBytes: 1024}, statuses[0])
+	assert.Equal(t, float64(100), statuses[0].Percent())
+	assert.Equal(t, float64(25), statuses[1].Percent())
+	assert.Equal(t, "snapshot snap-2 of PVC kibishii-data-kibishii-deployment-1: phase Uploading, progress 25.0% (256/1024 bytes)", statuses[1].String())
+	assert.Equal(t, float64(-1), statuses[2].Percent())
+	assert.Equal(t, "snapshot snap-3 of PVC kibishii-data-kibishii-deployment-2: phase New, progress unknown", statuses[2].String())
+
+	assert.Empty(t, ParseVSphereSnapshotStatuses("''"))
+
+	// the snapshot ID is decoded from the base64 encoded part with the "=" paddings
+	statuses = ParseVSphereSnapshotStatuses("'snap-1=kibishii-data-kibishii-deployment-0=Uploaded=1024=1024=pvc:ns-1/pvc-1:aXZkOjEyMzQ=\n'")
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "ivd:1234", statuses[0].SnapshotID)
+	assert.Equal(t, "", decodeVSphereSnapshotID(""))
+}
+
+func TestAPIGroupVersionFallbacks(t *testing.T) {
+	logs := `time="2023-06-01T00:00:00Z" level=info msg="Cannot find cluster preferred API group version in backup. Ignoring version v2 for rockbands.music.example.io" logSource="pkg/restore/prioritize_group_version.go:105" restore=velero/restore-1
+time="2023-06-01T00:00:00Z" level=info msg="Cannot find cluster preferred API group version in backup. Ignoring version v2 for rockbands.other.example.io" logSource="pkg/restore/prioritize_group_version.go:105" restore=velero/restore-1
+time="2023-06-01T00:00:01Z" level=info msg="Restoring resource 'rockbands.music.example.io' into namespace 'ns-1'" logSource="pkg/restore/restore.go:537" restore=velero/restore-1`
+
+	fallbacks := APIGroupVersionFallbacks(logs, "rockbands.music.example.io")
+	require.Len(t, fallbacks, 1)
+	assert.Contains(t, fallbacks[0], "Ignoring version v2 for rockbands.music.example.io")
+
+	assert.Empty(t, APIGroupVersionFallbacks(logs, "rockbands.version-change.music.example.io"))
+}
+
+func newWorkloadResource(kind, name, containerName string, args ...interface{}) unstructured.Unstructured {
+	container := map[string]interface{}{"name": containerName}
+	if len(args) > 0 {
+		container["args"] = args
+	}
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     kind,
+		"metadata": map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{container},
+				},
+			},
+		},
+	}}
+}
+
+func TestPatchContainerArgs(t *testing.T) {
+	tests := []struct {
+		name          string
+		resources     []unstructured.Unstructured
+		kind          string
+		workload      string
+		containerName string
+		args          []string
+		expected      []string
+		expectErr     bool
+	}{
+		{
+			name:          "args are appended to the existing args of the container",
+			resources:     []unstructured.Unstructured{newWorkloadResource("Deployment", "velero", "velero", "server", "--features=")},
+			kind:          "Deployment",
+			workload:      "velero",
+			containerName: "velero",
+			args:          []string{"--log-level", "debug"},
+			expected:      []string{"server", "--features=", "--log-level", "debug"},
+		},
+		{
+			name: "only the args of the matched workload are patched",
+			resources: []unstructured.Unstructured{
+				newWorkloadResource("Deployment", "velero", "velero", "server"),
+				newWorkloadResource("DaemonSet", "node-agent", "node-agent", "node-agent", "server"),
+			},
+			kind:          "DaemonSet",
+			workload:      "node-agent",
+			containerName: "node-agent",
+			args:          []string{"--log-level=debug"},
+			expected:      []string{"node-agent", "server", "--log-level=debug"},
+		},
+		{
+			name:          "container without args",
+			resources:     []unstructured.Unstructured{newWorkloadResource("Deployment", "velero", "velero")},
+			kind:          "Deployment",
+			workload:      "velero",
+			containerName: "velero",
+			args:          []string{"--log-level=debug"},
+			expected:      []string{"--log-level=debug"},
+		},
+		{
+			name:          "no args to patch",
+			resources:     []unstructured.Unstructured{newWorkloadResource("Deployment", "velero", "velero", "server")},
+			kind:          "DaemonSet",
+			workload:      "node-agent",
+			containerName: "node-agent",
+		},
+		{
+			name:          "workload not found",
+			resources:     []unstructured.Unstructured{newWorkloadResource("Deployment", "velero", "velero", "server")},
+			kind:          "DaemonSet",
+			workload:      "node-agent",
+			containerName: "node-agent",
+			args:          []string{"--log-level=debug"},
+			expectErr:     true,
+		},
+		{
+			name:          "container not found",
+			resources:     []unstructured.Unstructured{newWorkloadResource("Deployment", "velero", "velero", "server")},
+			kind:          "Deployment",
+			workload:      "velero",
+			containerName: "plugin",
+			args:          []string{"--log-level=debug"},
+			expectErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resources := &unstructured.UnstructuredList{Items: test.resources}
+			err := patchContainerArgs(resources, test.kind, test.workload, test.containerName, test.args)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if test.expected == nil {
+				return
+			}
+			for _, resource := range resources.Items {
+				if resource.GetKind() != test.kind || resource.GetName() != test.workload {
+					continue
+				}
+				containers, _, err := unstructured.NestedSlice(resource.Object, "spec", "template", "spec", "containers")
+				require.NoError(t, err)
+				args, _, err := unstructured.NestedStringSlice(containers[0].(map[string]interface{}), "args")
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, args)
+			}
+		})
+	}
+}
+
+func TestVeleroServerArgs(t *testing.T) {
+	assert.Nil(t, veleroServerArgs(&installOptions{}))
+	assert.Equal(t, []string{"--log-level", "debug", "--fs-backup-timeout=10m"}, veleroServerArgs(&installOptions{
+		VeleroServerDebugMode: true,
+		VeleroServerArgs:      []string{"--fs-backup-timeout=10m"},
+	}))
+}
+
+func TestContainsArgs(t *testing.T) {
+	actual := []string{"server", "--log-level", "debug", "--features="}
+	assert.True(t, containsArgs(actual, []string{"--log-level", "debug"}))
+	assert.True(t, containsArgs(actual, nil))
+	assert.False(t, containsArgs(actual, []string{"--log-level", "info"}))
+	assert.False(t, containsArgs(actual, []string{"debug", "--log-level"}))
+	assert.False(t, containsArgs(nil, []string{"--log-level"}))
+}
+
+func TestParseRestoreResult(t *testing.T) {
+	captured, err := os.ReadFile("testdata/restore-describe.txt")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		output           string
+		expectedWarnings int
+		expectedErrors   int
+		expectErr        bool
+	}{
+		{
+			name:             "captured output with warnings and errors",
+			output:           string(captured),
+			expectedWarnings: 4,
+			expectedErrors:   2,
+		},
+		{
+			name:   "no warning or error",
+			output: "Phase:  Completed\n\nStarted:    2023-05-10 08:12:01 +0000 UTC\nCompleted:  2023-05-10 08:12:09 +0000 UTC\n\nBackup:  backup-1\n",
+		},
+		{
+			name:             "warnings with a message containing colon and no namespace",
+			output:           "Phase:  Completed\n\nWarnings:\n  Velero:   error: plugin timed out\n            another one\n  Cluster:    <none>\n  Namespaces: <none>\n\nBackup:  backup-1\n",
+			expectedWarnings: 2,
+		},
+		{
+			name:      "results can't be downloaded",
+			output:    "Phase:  PartiallyFailed\n\nWarnings:  <error getting warnings: timed out>\n\nErrors:  <error getting errors: timed out>\n",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings, errs, err := parseRestoreResult(test.output)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedWarnings, warnings)
+			assert.Equal(t, test.expectedErrors, errs)
+		})
+	}
+}
+
+func writeDebugBundle(t *testing.T, bundle string, files map[string]string) {
+	file, err := os.Create(bundle)
+	require.NoError(t, err)
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+	for name, content := range files {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+}
+
+func TestExtractDebugBundle(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "debug-bundle-1.tar.gz")
+	writeDebugBundle(t, bundle, map[string]string{
+		"velero-bundle/version.txt":                         "Client: v1.11.0",
+		"velero-bundle/backup_describe_backup-1.txt":        "Phase:  PartiallyFailed",
+		"velero-bundle/velero/velero-7d9c-abcde/velero.log": "level=info",
+	})
+
+	dir, files, err := ExtractDebugBundle(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSuffix(bundle, ".tar.gz"), dir)
+	assert.ElementsMatch(t, []string{
+		"velero-bundle/version.txt",
+		"velero-bundle/backup_describe_backup-1.txt",
+		"velero-bundle/velero/velero-7d9c-abcde/velero.log",
+	}, files)
+	content, err := os.ReadFile(filepath.Join(dir, "velero-bundle", "backup_describe_backup-1.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Phase:  PartiallyFailed", string(content))
+
+	invalid := filepath.Join(t.TempDir(), "debug-bundle-2.tar.gz")
+	writeDebugBundle(t, invalid, map[string]string{"../escaped.txt": "content"})
+	_, _, err = ExtractDebugBundle(invalid)
+	assert.Error(t, err)
+}
+
+func TestDebugBundleShouldContain(t *testing.T) {
+	files := []string{
+		"velero-bundle/version.txt",
+		"velero-bundle/backup_describe_backup-1.txt",
+		"velero-bundle/backup_backup-1.log",
+		"velero-bundle/restore_describe_restore-1.txt",
+		"velero-bundle/restore_restore-1.log",
+		"velero-bundle/kubecapture/core_v1/velero/velero-7d9c5b8f4-x2x7k/velero.log",
+		"velero-bundle/kubecapture/core_v1/velero/node-agent-q8z2m/node-agent.log",
+	}
+	tests := []struct {
+		name      string
+		files     []string
+		backup    string
+		restore   string
+		nodeAgent bool
+		expectErr bool
+	}{
+		{
+			name:      "all the files are included",
+			files:     files,
+			backup:    "backup-1",
+			restore:   "restore-1",
+			nodeAgent: true,
+		},
+		{
+			name:  "only the server logs are required without backup and restore",
+			files: []string{files[0], files[5]},
+		},
+		{
+			name:      "missing backup describe output",
+			files:     []string{files[0], files[2], files[5]},
+			backup:    "backup-1",
+			expectErr: true,
+		},
+		{
+			name:      "missing node-agent logs",
+			files:     files[:6],
+			backup:    "backup-1",
+			nodeAgent: true,
+			expectErr: true,
+		},
+		{
+			name:      "the work dir of the bundle isn't taken as the server pod",
+			files:     []string{files[0], "velero-bundle/velero-bundle.log"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := DebugBundleShouldContain(test.files, test.backup, test.restore, test.nodeAgent)
+			if test.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWaitForBackupWithProgress(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, velerov1api.AddToScheme(scheme))
+
+	tests := []struct {
+		name     string
+		status   velerov1api.BackupStatus
+		expected velerov1api.BackupPhase
+	}{
+		{
+			name: "completed backup",
+			status: velerov1api.BackupStatus{
+				Phase:    velerov1api.BackupPhaseCompleted,
+				Progress: &velerov1api.BackupProgress{TotalItems: 10, ItemsBackedUp: 10},
+			},
+			expected: velerov1api.BackupPhaseCompleted,
+		},
+		{
+			name:     "failed backup without progress",
+			status:   velerov1api.BackupStatus{Phase: velerov1api.BackupPhaseFailed},
+			expected: velerov1api.BackupPhaseFailed,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backup := &velerov1api.Backup{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"},
+				Status:     test.status,
+			}
+			client := TestClient{Kubebuilder: fake.NewClientBuilder().WithScheme(scheme).WithObjects(backup).Build()}
+
+			var logged []velerov1api.BackupProgress
+			phase, err := WaitForBackupWithProgress(context.Background(), client, "velero", "backup-1", time.Second,
+				func(backupName string, phase velerov1api.BackupPhase, progress velerov1api.BackupProgress) {
+					assert.Equal(t, "backup-1", backupName)
+					assert.Equal(t, test.expected, phase)
+					logged = append(logged, progress)
+				})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, phase)
+			require.Len(t, logged, 1)
+			if test.status.Progress != nil {
+				assert.Equal(t, *test.status.Progress, logged[0])
+			}
+		})
+	}
+}
+
+func TestWaitForBackupWithProgressNotFound(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, velerov1api.AddToScheme(scheme))
+	client := TestClient{Kubebuilder: fake.NewClientBuilder().WithScheme(scheme).Build()}
+
+	_, err := WaitForBackupWithProgress(context.Background(), client, "velero", "backup-1", time.Second, nil)
+	assert.Error(t, err)
+}
+
+func TestBackupExecHookAnnotations(t *testing.T) {
+	ann, err := BackupExecHookAnnotations("container-1", []string{"/bin/sh", "-c", "echo pre > /vol/file"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"pre.hook.backup.velero.io/container": "container-1",
+		"pre.hook.backup.velero.io/command":   `["/bin/sh","-c","echo pre > /vol/file"]`,
+	}, ann)
+
+	ann, err = BackupExecHookAnnotations("container-1", []string{"sync"}, []string{"rm", "/vol/file"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"pre.hook.backup.velero.io/container":  "container-1",
+		"pre.hook.backup.velero.io/command":    `["sync"]`,
+		"post.hook.backup.velero.io/container": "container-1",
+		"post.hook.backup.velero.io/command":   `["rm","/vol/file"]`,
+	}, ann)
+}